@@ -1,27 +1,47 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"os"
 
 	"github.com/joho/godotenv"
 
 	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	auditRepository "github.com/rafaeldepontes/fauthless-go/internal/audit/repository"
+	auditServer "github.com/rafaeldepontes/fauthless-go/internal/audit/server"
+	auditService "github.com/rafaeldepontes/fauthless-go/internal/audit/service"
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
 	authRepository "github.com/rafaeldepontes/fauthless-go/internal/auth/repository"
 	authServer "github.com/rafaeldepontes/fauthless-go/internal/auth/server"
 	authService "github.com/rafaeldepontes/fauthless-go/internal/auth/service"
 	"github.com/rafaeldepontes/fauthless-go/internal/cache"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/health"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	memberRepository "github.com/rafaeldepontes/fauthless-go/internal/member/repository"
+	memberServer "github.com/rafaeldepontes/fauthless-go/internal/member/server"
+	memberService "github.com/rafaeldepontes/fauthless-go/internal/member/service"
 	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/saml"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+	scimServer "github.com/rafaeldepontes/fauthless-go/internal/scim/server"
+	scimService "github.com/rafaeldepontes/fauthless-go/internal/scim/service"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	tenantRepository "github.com/rafaeldepontes/fauthless-go/internal/tenant/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
 	"github.com/rafaeldepontes/fauthless-go/internal/tool"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
 	userRepository "github.com/rafaeldepontes/fauthless-go/internal/user/repository"
 	userServer "github.com/rafaeldepontes/fauthless-go/internal/user/server"
 	userService "github.com/rafaeldepontes/fauthless-go/internal/user/service"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/migrations"
 	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
 
 	log "github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -30,6 +50,7 @@ const (
 	JwtBased
 	JwtRefreshBased
 	OAuth2
+	MutualTLS
 )
 
 func initLogger() *log.Logger {
@@ -47,52 +68,200 @@ func initLogger() *log.Logger {
 	}
 }
 
+// LoadEnv loads the .env file, or .env.example when there's none.
+func LoadEnv() error {
+	envFile := ".env"
+	tool.ChecksEnvFile(&envFile)
+
+	return godotenv.Load(envFile)
+}
+
+// LoadConfig loads the .env file into the environment and reads the
+// configuration from every source, it's not validated yet since the CLI
+// commands only need part of it.
+func LoadConfig() (*configs.Configuration, error) {
+	if err := LoadEnv(); err != nil && os.Getenv(configs.ConfigFileEnv) == "" {
+		return nil, err
+	}
+
+	return configs.Load()
+}
+
 // Init initialize all the resources needed for the server run properly.
 func Init() (*configs.Configuration, *Application, *sql.DB, error) {
 	var logger *log.Logger = initLogger()
-	envFile := ".env"
-	tool.ChecksEnvFile(&envFile)
 
-	err := godotenv.Load(envFile)
+	config, err := LoadConfig()
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	config := &configs.Configuration{
-		JwtSecretKey:        os.Getenv("JWT_SECRET_KEY"),
-		JwtBasedPort:        os.Getenv("JWT_PORT"),
-		CookieBasedPort:     os.Getenv("COOKIE_PORT"),
-		OAuth2Port:          os.Getenv("OAUTH2_PORT"),
-		JwtRefreshBasedPort: os.Getenv("JWT_REFRESH_PORT"),
-		GoogleClientId:      os.Getenv("GOOGLE_CLIENT_ID"),
-		GoogleSecretKey:     os.Getenv("GOOGLE_KEY"),
-		GoogleClientSecret:  os.Getenv("GOOGLE_CLIENT_SECRET"),
-		UrlCallback:         os.Getenv("URL_CALLBACK"),
+	if err := config.Validate(); err != nil {
+		return nil, nil, nil, err
 	}
+	config.AuthModes = normalizeAuthModes(config.AuthModes)
 
 	auth.InitOAuth(config)
 
-	db, err := postgres.Open()
+	keySet, err := loadKeySet(config, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, err := postgres.Open(config.DatabaseUrl)
+	if err == nil && config.MigrateOnStartup {
+		if err := migrate(db, logger); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	var caches *cache.Caches = cache.NewCacheStorage()
+	var groupRepository user.GroupRepository = userRepository.NewGroupRepository(db, config.QueryTimeout)
+	var userRepository user.Repository = userRepository.NewUserRepository(db, config.QueryTimeout)
+	var sessionRepository auth.Repository = authRepository.NewSessionRepository(db, config.QueryTimeout)
+	var oauthRepository auth.OAuthRepository = authRepository.NewOAuthRepository(db, config.QueryTimeout)
+	var patRepository auth.PersonalAccessTokenRepository = authRepository.NewPersonalAccessTokenRepository(db, config.QueryTimeout)
+	var organizationRepository tenant.Repository = tenantRepository.NewOrganizationRepository(db, config.QueryTimeout)
+	var memberRepository member.Repository = memberRepository.NewMemberRepository(db, config.QueryTimeout)
+	var auditRepository audit.Repository = auditRepository.NewAuditRepository(db, config.QueryTimeout)
 
-	var userRepository user.Repository = userRepository.NewUserRepository(db)
-	var sessionRepository auth.Repository = authRepository.NewSessionRepository(db)
+	// the events that can't be saved are still logged
+	var auditRecorder audit.Recorder = audit.NewRepositoryRecorder(auditRepository, audit.NewLogRecorder(logger))
 
-	var userService user.Service = userService.NewUserService(userRepository, logger, caches)
-	var authService auth.Service = authService.NewAuthService(userRepository, sessionRepository, logger, config.JwtSecretKey, caches)
+	var userService user.Service = userService.NewUserService(userRepository, logger, config, caches, auditRecorder)
+	var scimService scim.Service = scimService.NewScimService(userRepository, groupRepository, sessionRepository, patRepository, auditRecorder, logger, config)
+	var memberService member.Service = memberService.NewMemberService(memberRepository, userRepository, sessionRepository, patRepository, newMailer(config, logger), auditRecorder, logger, config)
+	var auditService audit.Service = auditService.NewAuditService(auditRepository, logger)
+	samlProvider, samlErr := loadSamlProvider(config, userRepository, logger)
+	if samlErr != nil {
+		return nil, nil, nil, samlErr
+	}
+
+	var oauthServer auth.OAuthServer = authService.NewOAuthServer(userRepository, sessionRepository, oauthRepository, patRepository, logger, config, keySet, auditRecorder, caches, samlProvider)
+	var authService auth.Service = authService.NewAuthService(userRepository, sessionRepository, oauthRepository, patRepository, logger, config, keySet, auditRecorder, caches)
+
+	var middleware *middleware.Middleware = middleware.NewMiddleware(config, userRepository, auditRecorder, caches)
+	if config.AccessTokenAlg == token.SigningAlg {
+		middleware.JwtBuilder = middleware.JwtBuilder.WithKeySet(keySet)
+	}
+	middleware.Tenants = tenant.NewResolver(organizationRepository, config.TenantHeader)
+	middleware.Members = memberRepository
 
 	var userController user.Controller = userServer.NewUserController(&userService)
-	var authController auth.Controller = authServer.NewAuthController(&authService)
+	var authController auth.Controller = authServer.NewAuthController(&authService, &oauthServer, middleware)
+	var scimController scim.Controller = scimServer.NewScimController(&scimService)
+	var memberController member.Controller = memberServer.NewMemberController(&memberService)
+	var auditController audit.Controller = auditServer.NewAuditController(&auditService)
+
+	authenticators, authErr := newAuthenticators(config, middleware, patRepository)
+	if authErr != nil {
+		return nil, nil, nil, authErr
+	}
 
-	var middleware *middleware.Middleware = middleware.NewMiddleware(config.JwtSecretKey, caches)
+	var healthController *health.Controller = health.NewController(logger, readinessChecks(db, keySet)...)
+	var grpcServer *grpc.Server = NewGrpcServer(middleware, &authService, &userService, authenticators)
 
 	application := &Application{
-		UserController: &userController,
-		AuthController: &authController,
-		Middleware:     middleware,
-		Logger:         logger,
+		UserController:   &userController,
+		AuthController:   &authController,
+		ScimController:   &scimController,
+		MemberController: &memberController,
+		AuditController:  &auditController,
+		Middleware:       middleware,
+		Authenticators:   authenticators,
+		Health:           healthController,
+		Grpc:             grpcServer,
+		Logger:           logger,
 	}
 
 	return config, application, db, err
 }
+
+// migrate applies the pending migrations, the advisory lock makes the
+// instances starting together wait for the first one.
+func migrate(db *sql.DB, logger *log.Logger) error {
+	applied, err := migrations.Up(db)
+	for _, migration := range applied {
+		logger.Infof("Applied the migration %04d_%v", migration.Version, migration.Name)
+	}
+	return err
+}
+
+// readinessChecks are the dependencies behind /readyz, the database and the
+// key that signs the ID tokens.
+func readinessChecks(db *sql.DB, keySet *token.KeySet) []health.Check {
+	return []health.Check{
+		{
+			Name: "database",
+			Run: func(ctx context.Context) error {
+				if db == nil {
+					return errorhandler.ErrDatabaseUnavailable
+				}
+				return db.PingContext(ctx)
+			},
+		},
+		{
+			Name: "signing_key",
+			Run: func(ctx context.Context) error {
+				if keySet.Active() == nil {
+					return errorhandler.ErrInvalidSigningKey
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// newMailer returns the mailer of the invitations, they're written in the
+// log when there's no SMTP server.
+func newMailer(config *configs.Configuration, logger *log.Logger) member.Mailer {
+	if config.SmtpAddr == "" {
+		logger.Warnln("SMTP_ADDR is not set, the invitations are written in the log.")
+		return member.NewLogMailer(logger)
+	}
+	return member.NewSmtpMailer(config.SmtpAddr, config.SmtpUsername, config.SmtpPassword, config.MailFrom)
+}
+
+// loadSamlProvider loads the SAML service provider, it's nil when there's
+// no identity provider metadata configured.
+func loadSamlProvider(config *configs.Configuration, userRepository user.Repository, logger *log.Logger) (*saml.ServiceProvider, error) {
+	if config.SamlIdpMetadataUrl == "" && config.SamlIdpMetadataFile == "" {
+		return nil, nil
+	}
+
+	if config.SamlKeyFile == "" {
+		logger.Warnln("SAML_KEY_FILE is not set, using an ephemeral SAML key.")
+	}
+
+	sp, err := saml.Load(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return saml.NewServiceProvider(config, userRepository, sp), nil
+}
+
+// loadKeySet loads the key used to sign the ID tokens and the previous one
+// when the key was rotated, without a key file a new one is generated, which
+// means the tokens it signed can't be verified after a restart.
+func loadKeySet(config *configs.Configuration, logger *log.Logger) (*token.KeySet, error) {
+	if config.SigningKeyFile == "" {
+		logger.Warnln("SIGNING_KEY_FILE is not set, using an ephemeral signing key.")
+		signingKey, err := token.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		return token.NewKeySet(signingKey), nil
+	}
+
+	signingKey, err := token.LoadSigningKey(config.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// left by `fauthless keys rotate`, only used to verify
+	previousKey, err := token.LoadSigningKey(config.SigningKeyFile + token.PreviousSigningKeySuffix)
+	if err != nil {
+		return token.NewKeySet(signingKey), nil
+	}
+	return token.NewKeySet(signingKey, previousKey), nil
+}
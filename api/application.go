@@ -1,15 +1,26 @@
 package api
 
 import (
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/health"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
 	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 type Application struct {
-	UserController *user.Controller
-	AuthController *auth.Controller
-	Logger         *log.Logger
-	Middleware     *middleware.Middleware
+	UserController   *user.Controller
+	AuthController   *auth.Controller
+	ScimController   *scim.Controller
+	MemberController *member.Controller
+	AuditController  *audit.Controller
+	Logger           *log.Logger
+	Middleware       *middleware.Middleware
+	Authenticators   []middleware.Authenticator
+	Health           *health.Controller
+	Grpc             *grpc.Server
 }
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+)
+
+// DefaultAuthModes are the modes of cmd/server when AUTH_MODES is empty.
+var DefaultAuthModes = []string{
+	middleware.AuthMethodCookie,
+	middleware.AuthMethodJwt,
+	middleware.AuthMethodPersonalAccessToken,
+	middleware.AuthMethodOAuthSession,
+}
+
+func normalizeAuthModes(modes []string) []string {
+	if len(modes) == 0 {
+		return DefaultAuthModes
+	}
+
+	normalized := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		normalized = append(normalized, strings.ToLower(mode))
+	}
+	return normalized
+}
+
+// newAuthenticators builds the authenticator chain of the single binary,
+// the credentials are tried in the order of the modes.
+func newAuthenticators(config *configs.Configuration, m *middleware.Middleware, patRepo auth.PersonalAccessTokenRepository) ([]middleware.Authenticator, error) {
+	authenticators := make([]middleware.Authenticator, 0, len(config.AuthModes))
+	for _, mode := range config.AuthModes {
+		switch mode {
+		case middleware.AuthMethodCookie:
+			authenticators = append(authenticators, m.CookieAuthenticator())
+		case middleware.AuthMethodJwt:
+			authenticators = append(authenticators, m.BearerAuthenticator())
+		case middleware.AuthMethodPersonalAccessToken:
+			authenticators = append(authenticators, m.PersonalAccessTokenAuthenticator(patRepo))
+		case middleware.AuthMethodOAuthSession:
+			authenticators = append(authenticators, m.OAuthSessionAuthenticator(auth.NewBrowserStore(config.JwtSecretKey)))
+		default:
+			return nil, fmt.Errorf("%w: %v", errorhandler.ErrUnknownAuthMode, mode)
+		}
+	}
+	return authenticators, nil
+}
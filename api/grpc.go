@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	authServer "github.com/rafaeldepontes/fauthless-go/internal/auth/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	userServer "github.com/rafaeldepontes/fauthless-go/internal/user/server"
+	fauthlessv1 "github.com/rafaeldepontes/fauthless-go/pkg/pb/fauthless/v1"
+	"google.golang.org/grpc"
+)
+
+// PublicGrpcMethods are the gRPC calls that don't need a token.
+var PublicGrpcMethods = []string{
+	fauthlessv1.AuthService_Register_FullMethodName,
+	fauthlessv1.AuthService_Login_FullMethodName,
+	fauthlessv1.AuthService_Renew_FullMethodName,
+	// the confidential clients send their own credentials, see Introspect
+	fauthlessv1.AuthService_Introspect_FullMethodName,
+	// Envoy sends the credentials of the checked request in the message
+	authv3.Authorization_Check_FullMethodName,
+}
+
+// NewGrpcServer creates the gRPC server of the AuthService, UserService and
+// the Envoy ext_authz, the calls are authenticated by the interceptors of
+// the middleware.
+func NewGrpcServer(m *middleware.Middleware, authService *auth.Service, userService *user.Service, authenticators []middleware.Authenticator) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(m.UnaryInterceptor(PublicGrpcMethods...)),
+		grpc.ChainStreamInterceptor(m.StreamInterceptor(PublicGrpcMethods...)),
+	)
+
+	fauthlessv1.RegisterAuthServiceServer(server, authServer.NewAuthGrpcServer(authService))
+	fauthlessv1.RegisterUserServiceServer(server, userServer.NewUserGrpcServer(userService))
+	authv3.RegisterAuthorizationServer(server, m.ExtAuthzServer(authenticators...))
+
+	return server
+}
+
+// listenGrpc serves the gRPC server on port until it's stopped.
+func listenGrpc(server *grpc.Server, port string) error {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// stopGrpc waits for the calls in progress like the http server does, they
+// are cancelled when ctx is done first.
+func stopGrpc(ctx context.Context, server *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
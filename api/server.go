@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"google.golang.org/grpc"
+)
+
+// NewServer creates the http server listening on port with the timeouts of
+// the configuration, a slow client can't hold a connection forever.
+func NewServer(config *configs.Configuration, port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// Serve runs listen (ListenAndServe or ListenAndServeTLS of the server),
+// and the gRPC server when GRPC_PORT is set, until a SIGINT or SIGTERM. Then
+// the server stops being ready, stops accepting connections and waits up to
+// SHUTDOWN_TIMEOUT for the requests in progress, like the logins, before the
+// database is closed.
+func Serve(config *configs.Configuration, app *Application, db *sql.DB, server *http.Server, listen func() error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	servers := 1
+	listenErr := make(chan error, 2)
+	go func() {
+		listenErr <- listen()
+	}()
+
+	if config.GrpcPort != "" {
+		servers++
+		app.Logger.Infof("gRPC running at %v\n", config.GrpcPort)
+		go func() {
+			listenErr <- listenGrpc(app.Grpc, config.GrpcPort)
+		}()
+	}
+
+	select {
+	case err := <-listenErr:
+		server.Close()
+		app.Grpc.Stop()
+		db.Close()
+		return err
+	case <-ctx.Done():
+		stop()
+	}
+
+	app.Logger.Infoln("Shutting down, waiting for the requests in progress...")
+	app.Health.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	grpcStopped := make(chan error, 1)
+	go func() {
+		grpcStopped <- stopGrpc(shutdownCtx, app.Grpc)
+	}()
+
+	err := server.Shutdown(shutdownCtx)
+	if grpcErr := <-grpcStopped; err == nil {
+		err = grpcErr
+	}
+	if err != nil {
+		app.Logger.Errorf("The requests in progress didn't finish in time: %v", err)
+	}
+
+	for range servers {
+		if err := <-listenErr; err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, grpc.ErrServerStopped) {
+			app.Logger.Errorf("An error occurred: %v", err)
+		}
+	}
+
+	if closeErr := db.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	app.Logger.Infoln("The server stopped.")
+	return err
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// NewMutualTLSConfig builds the TLS configuration of the mutual TLS mode,
+// only clients with a certificate signed by the client CA can connect.
+func NewMutualTLSConfig(config *configs.Configuration) (*tls.Config, error) {
+	caPem, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPem) {
+		return nil, errorhandler.ErrInvalidClientCA
+	}
+
+	return &tls.Config{
+		ClientCAs:  clientCAs,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rafaeldepontes/fauthless-go/api"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+func keysCommand(args []string) error {
+	return subcommand(args, map[string]command{
+		"rotate": keysRotate,
+	})
+}
+
+// keysRotate generates a new signing key in SIGNING_KEY_FILE, the current
+// one is kept with the .previous suffix so the ID tokens it signed can still
+// be verified. The servers pick the new key up when they restart.
+func keysRotate(args []string) error {
+	config, err := api.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	path := config.SigningKeyFile
+	if path == "" {
+		return fmt.Errorf("%w: SIGNING_KEY_FILE is not set", errorhandler.ErrInvalidSigningKey)
+	}
+
+	signingKey, err := token.GenerateSigningKey()
+	if err != nil {
+		return err
+	}
+
+	previousPath := path + token.PreviousSigningKeySuffix
+	err = os.Rename(path, previousPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := token.SaveSigningKey(path, signingKey); err != nil {
+		return err
+	}
+
+	fmt.Printf("the new signing key is %v, the previous one was moved to %v\n", signingKey.Id, previousPath)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	osuser "os/user"
+
+	"github.com/rafaeldepontes/fauthless-go/api"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	auditRepository "github.com/rafaeldepontes/fauthless-go/internal/audit/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+	log "github.com/sirupsen/logrus"
+)
+
+const usage = `fauthless operates the fauthless-go server.
+
+Usage:
+  fauthless serve [--modes=cookie,jwt,pat,oauth] [--port=8000]
+  fauthless migrate up|down|status [--steps=1]
+  fauthless user create --username=NAME --password=PASSWORD --age=AGE [--email=EMAIL] [--org=SLUG]
+  fauthless user lock --username=NAME [--unlock] [--org=SLUG]
+  fauthless user reset-password --username=NAME [--password=PASSWORD] [--org=SLUG]
+  fauthless sessions revoke --user=NAME [--org=SLUG]
+  fauthless org create --slug=SLUG [--name=NAME] [--host=HOST] [--modes=jwt,pat] [--password-min-length=N]
+                       [--token-duration=15m] [--refresh-token-duration=24h]
+  fauthless org list
+  fauthless org add-member --username=NAME [--role=owner] [--org=SLUG]
+  fauthless keys rotate
+  fauthless seed --users=N [--password=PASSWORD] [--prefix=user]
+`
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"serve":    serve,
+	"migrate":  migrate,
+	"user":     userCommand,
+	"sessions": sessionsCommand,
+	"org":      orgCommand,
+	"keys":     keysCommand,
+	"seed":     seed,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%v", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "fauthless %v: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// subcommand picks the subcommand of the commands that have them (user,
+// sessions, keys...).
+func subcommand(args []string, subcommands map[string]command) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand\n\n%v", usage)
+	}
+
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %q\n\n%v", args[0], usage)
+	}
+	return run(args[1:])
+}
+
+// openDatabase connects to DATABASE_URL, it can come from the .env file,
+// the config file or the environment itself. The configuration is returned
+// for the repositories (QUERY_TIMEOUT).
+func openDatabase() (*sql.DB, *configs.Configuration, error) {
+	config, err := api.LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.DatabaseUrl == "" {
+		return nil, nil, fmt.Errorf("%w: DATABASE_URL is required", errorhandler.ErrInvalidConfig)
+	}
+
+	db, err := postgres.Open(config.DatabaseUrl)
+	return db, config, err
+}
+
+// record keeps the audit trail of the command like the server does, as a
+// failure when err isn't nil. The actor is the user of the operating system
+// running it, the events that can't be saved are logged.
+func record(ctx context.Context, db *sql.DB, config *configs.Configuration, action, target string, err error) {
+	actor := audit.ActorCli
+	if current, userErr := osuser.Current(); userErr == nil {
+		actor += ":" + current.Username
+	}
+
+	event := &audit.Event{Action: action, Actor: actor, Target: target}
+	if err != nil {
+		event = audit.Failure(event, err)
+	}
+	recorder := audit.NewRepositoryRecorder(auditRepository.NewAuditRepository(db, config.QueryTimeout), audit.NewLogRecorder(log.StandardLogger()))
+	recorder.Record(ctx, event)
+}
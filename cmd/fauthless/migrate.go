@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/migrations"
+)
+
+func migrate(args []string) error {
+	return subcommand(args, map[string]command{
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+	})
+}
+
+func migrateUp(args []string) error {
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := migrations.Up(db)
+	for _, migration := range applied {
+		fmt.Printf("applied %04d_%v\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("the database is up to date")
+	}
+	return nil
+}
+
+func migrateDown(args []string) error {
+	flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+	steps := flags.Int("steps", 1, "how many migrations to revert")
+	flags.Parse(args)
+
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	reverted, err := migrations.Down(db, *steps)
+	for _, migration := range reverted {
+		fmt.Printf("reverted %04d_%v\n", migration.Version, migration.Name)
+	}
+	return err
+}
+
+func migrateStatus(args []string) error {
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statuses, err := migrations.Statuses(db)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if status.Modified {
+			appliedAt += " (changed after it was applied)"
+		}
+		fmt.Printf("%04d_%-30v %v\n", status.Version, status.Name, appliedAt)
+	}
+	return nil
+}
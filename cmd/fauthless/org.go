@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	memberRepository "github.com/rafaeldepontes/fauthless-go/internal/member/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	tenantRepository "github.com/rafaeldepontes/fauthless-go/internal/tenant/repository"
+	userRepository "github.com/rafaeldepontes/fauthless-go/internal/user/repository"
+)
+
+func orgCommand(args []string) error {
+	return subcommand(args, map[string]command{
+		"create":     orgCreate,
+		"list":       orgList,
+		"add-member": orgAddMember,
+	})
+}
+
+// orgCreate creates an organization, its users log in through the host or
+// by sending the slug in TENANT_HEADER. The settings left out are the ones
+// of the server.
+func orgCreate(args []string) error {
+	flags := flag.NewFlagSet("org create", flag.ExitOnError)
+	slug := flags.String("slug", "", "slug of the organization, sent in TENANT_HEADER")
+	name := flags.String("name", "", "name of the organization")
+	host := flags.String("host", "", "host the organization is served at")
+	modes := flags.String("modes", "", "login modes allowed, comma separated (default every mode of the server)")
+	passwordMinLength := flags.Int("password-min-length", 0, "minimum length of the passwords")
+	tokenDuration := flags.Duration("token-duration", 0, "duration of the access tokens")
+	refreshTokenDuration := flags.Duration("refresh-token-duration", 0, "duration of the refresh tokens")
+	flags.Parse(args)
+
+	if *slug == "" {
+		return errorhandler.ErrSlugIsRequired
+	}
+	if *name == "" {
+		*name = *slug
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	org := &domain.Organization{
+		Slug: *slug,
+		Name: *name,
+		Settings: domain.OrganizationSettings{
+			PasswordMinLength:    *passwordMinLength,
+			AccessTokenDuration:  *tokenDuration,
+			RefreshTokenDuration: *refreshTokenDuration,
+		},
+	}
+	if *host != "" {
+		lowered := strings.ToLower(*host)
+		org.Host = &lowered
+	}
+	for _, mode := range strings.Split(*modes, ",") {
+		if mode = strings.TrimSpace(strings.ToLower(mode)); mode != "" {
+			org.Settings.AuthModes = append(org.Settings.AuthModes, mode)
+		}
+	}
+
+	if err := tenantRepository.NewOrganizationRepository(db, config.QueryTimeout).CreateOrganization(context.Background(), org); err != nil {
+		return err
+	}
+
+	fmt.Printf("created the organization %v (id %d)\n", org.Slug, org.Id)
+	return nil
+}
+
+func orgList(args []string) error {
+	flags := flag.NewFlagSet("org list", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	orgs, err := tenantRepository.NewOrganizationRepository(db, config.QueryTimeout).FindOrganizations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		host := "-"
+		if org.Host != nil {
+			host = *org.Host
+		}
+		fmt.Printf("%d\t%v\t%v\t%v\n", org.Id, org.Slug, host, org.Name)
+	}
+	return nil
+}
+
+// orgAddMember makes the user a member of the organization, or changes its
+// role when it's one already. It's how the first owner is added, the next
+// members are invited by them.
+func orgAddMember(args []string) error {
+	flags := flag.NewFlagSet("org add-member", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	role := flags.String("role", member.RoleOwner, "role of the member (owner, admin or member)")
+	org := flags.String("org", "", "slug of the organization (default the default one)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errorhandler.ErrUsernameIsRequired
+	}
+	if !member.ValidRole(*role) {
+		return errorhandler.ErrInvalidRole
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, err := orgContext(db, config, *org)
+	if err != nil {
+		return err
+	}
+
+	user, err := userRepository.NewUserRepository(db, config.QueryTimeout).FindUserByUsername(ctx, *username)
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, *username)
+	}
+
+	members := memberRepository.NewMemberRepository(db, config.QueryTimeout)
+	if _, err := members.FindMember(ctx, *user.Id); err == nil {
+		if err := members.UpdateMemberRole(ctx, *user.Id, *role); err != nil {
+			return err
+		}
+	} else if err := members.AddMember(ctx, &domain.Member{UserId: *user.Id, Role: *role}); err != nil {
+		return err
+	}
+
+	fmt.Printf("%v is a member with the role %v\n", *username, *role)
+	return nil
+}
+
+// orgContext is the context of the commands run in the organization of the
+// --org flag, the default one when it's empty.
+func orgContext(db *sql.DB, config *configs.Configuration, slug string) (context.Context, error) {
+	ctx := context.Background()
+	if slug == "" {
+		return ctx, nil
+	}
+
+	org, err := tenantRepository.NewOrganizationRepository(db, config.QueryTimeout).FindOrganizationBySlug(ctx, slug)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", err, slug)
+	}
+	return tenant.WithOrganization(ctx, org), nil
+}
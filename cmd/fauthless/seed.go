@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const seedBatchSize = 10000
+
+// seed inserts test users that can log in, all of them share the same
+// password so it's hashed only once (bcrypt is slow on purpose).
+func seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	users := flags.Int("users", 1000, "how many users to insert")
+	password := flags.String("password", "password", "password of every user")
+	prefix := flags.String("prefix", "user", "usernames are the prefix followed by a number")
+	flags.Parse(args)
+
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), service.Cost)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO users (username, password, age)
+	SELECT $1 || i::text, $2, (floor(random()*60) + 18)::int
+	FROM generate_series($3::int, $4::int) AS s(i)
+	ON CONFLICT (username) DO NOTHING
+	`
+
+	var inserted int64
+	for from := 1; from <= *users; from += seedBatchSize {
+		to := min(from+seedBatchSize-1, *users)
+
+		result, err := db.Exec(query, *prefix, string(hashedPassword), from, to)
+		if err != nil {
+			return err
+		}
+
+		rows, _ := result.RowsAffected()
+		inserted += rows
+		fmt.Printf("\rinserted %d/%d users", inserted, *users)
+	}
+
+	fmt.Printf("\nlog in as %v1 ... %v%d with the password %q\n", *prefix, *prefix, *users, *password)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/api"
+	"github.com/rafaeldepontes/fauthless-go/internal/handler"
+)
+
+// serve runs the server with every mode in --modes (AUTH_MODES by default)
+// at once, the same as cmd/server.
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	modes := flags.String("modes", "", "authentication modes, comma separated (default AUTH_MODES)")
+	port := flags.String("port", "", "port to listen on (default SERVER_PORT)")
+	flags.Parse(args)
+
+	// the flags win over the .env file, godotenv doesn't override variables
+	if *modes != "" {
+		os.Setenv("AUTH_MODES", *modes)
+	}
+	if *port != "" {
+		os.Setenv("SERVER_PORT", *port)
+	}
+
+	config, app, db, err := api.Init()
+	if err != nil {
+		return err
+	}
+
+	var r *chi.Mux = chi.NewRouter()
+	handler.HandlerModes(r, app, config.AuthModes)
+
+	app.Logger.Infof("API running at %v with the modes %v\n", config.ServerPort, config.AuthModes)
+
+	server := api.NewServer(config, config.ServerPort, r)
+	return api.Serve(config, app, db, server, server.ListenAndServe)
+}
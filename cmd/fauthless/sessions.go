@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	authRepository "github.com/rafaeldepontes/fauthless-go/internal/auth/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+func sessionsCommand(args []string) error {
+	return subcommand(args, map[string]command{
+		"revoke": sessionsRevoke,
+	})
+}
+
+// sessionsRevoke revokes every session of the user, the refresh tokens stop
+// working right away.
+func sessionsRevoke(args []string) error {
+	flags := flag.NewFlagSet("sessions revoke", flag.ExitOnError)
+	username := flags.String("user", "", "user whose sessions are revoked")
+	org := flags.String("org", "", "slug of the organization of the user (default the default one)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errorhandler.ErrUsernameIsRequired
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, err := orgContext(db, config, *org)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := authRepository.NewSessionRepository(db, config.QueryTimeout).RevokeUserSessions(ctx, *username)
+	record(ctx, db, config, audit.ActionUserSessionsRevoked, *username, err)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d sessions of %v\n", revoked, *username)
+	return nil
+}
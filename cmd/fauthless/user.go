@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	authRepository "github.com/rafaeldepontes/fauthless-go/internal/auth/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/service"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	userRepository "github.com/rafaeldepontes/fauthless-go/internal/user/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const generatedPasswordLength = 12
+
+func userCommand(args []string) error {
+	return subcommand(args, map[string]command{
+		"create":         userCreate,
+		"lock":           userLock,
+		"reset-password": userResetPassword,
+	})
+}
+
+func userCreate(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := flags.String("username", "", "username of the new user")
+	password := flags.String("password", "", "password of the new user")
+	age := flags.Int("age", 0, "age of the new user")
+	email := flags.String("email", "", "email of the new user")
+	org := flags.String("org", "", "slug of the organization of the user (default the default one)")
+	flags.Parse(args)
+
+	switch {
+	case *username == "":
+		return errorhandler.ErrUsernameIsRequired
+	case *password == "":
+		return errorhandler.ErrPasswordIsRequired
+	case *age <= 0:
+		return errorhandler.ErrAgeIsRequired
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, err := orgContext(db, config, *org)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), service.Cost)
+	if err != nil {
+		return err
+	}
+
+	hashed := string(hashedPassword)
+	user := &domain.User{
+		Username:       username,
+		HashedPassword: &hashed,
+		Age:            age,
+	}
+	if *email != "" {
+		user.Email = email
+	}
+
+	if err := userRepository.NewUserRepository(db, config.QueryTimeout).RegisterUser(ctx, user); err != nil {
+		return err
+	}
+
+	fmt.Printf("created the user %v (id %d)\n", *user.Username, *user.Id)
+	return nil
+}
+
+// userLock locks (or unlocks) the user, a locked user can't log in and its
+// sessions are revoked, the access tokens already issued last until they
+// expire.
+func userLock(args []string) error {
+	flags := flag.NewFlagSet("user lock", flag.ExitOnError)
+	username := flags.String("username", "", "user to lock")
+	unlock := flags.Bool("unlock", false, "unlock the user instead")
+	org := flags.String("org", "", "slug of the organization of the user (default the default one)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errorhandler.ErrUsernameIsRequired
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, err := orgContext(db, config, *org)
+	if err != nil {
+		return err
+	}
+
+	action := audit.ActionUserLocked
+	if *unlock {
+		action = audit.ActionUserUnlocked
+	}
+
+	if err := userRepository.NewUserRepository(db, config.QueryTimeout).LockUser(ctx, *username, !*unlock); err != nil {
+		record(ctx, db, config, action, *username, err)
+		return err
+	}
+
+	if *unlock {
+		record(ctx, db, config, action, *username, nil)
+		fmt.Printf("unlocked the user %v\n", *username)
+		return nil
+	}
+
+	revoked, err := authRepository.NewSessionRepository(db, config.QueryTimeout).RevokeUserSessions(ctx, *username)
+	record(ctx, db, config, action, *username, err)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("locked the user %v, %d sessions revoked\n", *username, revoked)
+	return nil
+}
+
+// userResetPassword sets a new password, a random one is generated and
+// printed when --password is empty, the sessions of the user are revoked.
+func userResetPassword(args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	username := flags.String("username", "", "user to reset the password")
+	password := flags.String("password", "", "new password (default a random one)")
+	org := flags.String("org", "", "slug of the organization of the user (default the default one)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errorhandler.ErrUsernameIsRequired
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = token.CookieBased{}.GenerateToken(generatedPasswordLength)
+	}
+
+	db, config, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, err := orgContext(db, config, *org)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), service.Cost)
+	if err != nil {
+		return err
+	}
+
+	err = userRepository.NewUserRepository(db, config.QueryTimeout).UpdatePassword(ctx, *username, string(hashedPassword))
+	if err != nil {
+		record(ctx, db, config, audit.ActionPasswordReset, *username, err)
+		if errors.Is(err, errorhandler.ErrUserNotFound) {
+			return fmt.Errorf("%w: %v", err, *username)
+		}
+		return err
+	}
+
+	revoked, err := authRepository.NewSessionRepository(db, config.QueryTimeout).RevokeUserSessions(ctx, *username)
+	record(ctx, db, config, audit.ActionPasswordReset, *username, err)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("reset the password of %v, %d sessions revoked\n", *username, revoked)
+	if generated {
+		fmt.Printf("new password: %v\n", *password)
+	}
+	return nil
+}
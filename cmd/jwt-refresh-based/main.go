@@ -1,12 +1,11 @@
 package main
 
 import (
-	"net/http"
-
 	"github.com/go-chi/chi/v5"
 	"github.com/rafaeldepontes/fauthless-go/api"
 	"github.com/rafaeldepontes/fauthless-go/configs"
 	"github.com/rafaeldepontes/fauthless-go/internal/handler"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -15,14 +14,16 @@ func main() {
 
 	config, app, db, err := api.Init()
 	if err != nil {
-		app.Logger.Fatalf("An error occurred: %v", err)
+		log.Fatalf("An error occurred: %v", err)
 	}
-	defer db.Close()
 
 	var r *chi.Mux = chi.NewRouter()
 	handler.Handler(r, app, api.JwtRefreshBased)
 
 	app.Logger.Infof("API running at %v\n", config.JwtRefreshBasedPort)
 
-	http.ListenAndServe(":"+config.JwtRefreshBasedPort, r)
+	server := api.NewServer(config, config.JwtRefreshBasedPort, r)
+	if err := api.Serve(config, app, db, server, server.ListenAndServe); err != nil {
+		app.Logger.Fatalf("An error occurred: %v", err)
+	}
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/api"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/handler"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	var app *api.Application
+	var config *configs.Configuration
+
+	config, app, db, err := api.Init()
+	if err != nil {
+		log.Fatalf("An error occurred: %v", err)
+	}
+
+	tlsConfig, err := api.NewMutualTLSConfig(config)
+	if err != nil {
+		app.Logger.Fatalf("An error occurred: %v", err)
+	}
+
+	var r *chi.Mux = chi.NewRouter()
+	handler.Handler(r, app, api.MutualTLS)
+
+	app.Logger.Infof("API running at %v\n", config.MutualTLSPort)
+
+	server := api.NewServer(config, config.MutualTLSPort, r)
+	server.TLSConfig = tlsConfig
+	listen := func() error {
+		return server.ListenAndServeTLS(config.TlsCertFile, config.TlsKeyFile)
+	}
+	if err := api.Serve(config, app, db, server, listen); err != nil {
+		app.Logger.Fatalf("An error occurred: %v", err)
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"net/http"
-
 	"github.com/go-chi/chi/v5"
-
 	"github.com/rafaeldepontes/fauthless-go/api"
 	"github.com/rafaeldepontes/fauthless-go/configs"
 	"github.com/rafaeldepontes/fauthless-go/internal/handler"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -16,14 +14,16 @@ func main() {
 
 	config, app, db, err := api.Init()
 	if err != nil {
-		app.Logger.Fatalf("An error occurred: %v", err)
+		log.Fatalf("An error occurred: %v", err)
 	}
-	defer db.Close()
 
 	var r *chi.Mux = chi.NewRouter()
 	handler.Handler(r, app, api.OAuth2)
 
 	app.Logger.Infof("API running at %v\n", config.OAuth2Port)
 
-	http.ListenAndServe(":"+config.OAuth2Port, r)
+	server := api.NewServer(config, config.OAuth2Port, r)
+	if err := api.Serve(config, app, db, server, server.ListenAndServe); err != nil {
+		app.Logger.Fatalf("An error occurred: %v", err)
+	}
 }
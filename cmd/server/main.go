@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/api"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/handler"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	var app *api.Application
+	var config *configs.Configuration
+
+	config, app, db, err := api.Init()
+	if err != nil {
+		log.Fatalf("An error occurred: %v", err)
+	}
+
+	var r *chi.Mux = chi.NewRouter()
+	handler.HandlerModes(r, app, config.AuthModes)
+
+	app.Logger.Infof("API running at %v with the modes %v\n", config.ServerPort, config.AuthModes)
+
+	server := api.NewServer(config, config.ServerPort, r)
+	if err := api.Serve(config, app, db, server, server.ListenAndServe); err != nil {
+		app.Logger.Fatalf("An error occurred: %v", err)
+	}
+}
@@ -1,13 +1,114 @@
 package configs
 
+import "time"
+
+// Configuration is every setting of the server. The env tag is the name of
+// the variable (and, lowercased, the key in the config file), default is
+// used when no source sets it and secret fields can also be read from the
+// file named by <NAME>_FILE.
 type Configuration struct {
-	JwtSecretKey        string
-	JwtBasedPort        string
-	CookieBasedPort     string
-	JwtRefreshBasedPort string
-	OAuth2Port          string
-	GoogleClientId      string
-	GoogleSecretKey     string
-	GoogleClientSecret  string
-	UrlCallback         string
+	JwtSecretKey        string   `env:"JWT_SECRET_KEY" secret:"true"`
+	JwtBasedPort        string   `env:"JWT_PORT"`
+	CookieBasedPort     string   `env:"COOKIE_PORT"`
+	JwtRefreshBasedPort string   `env:"JWT_REFRESH_PORT"`
+	OAuth2Port          string   `env:"OAUTH2_PORT"`
+	GoogleClientId      string   `env:"GOOGLE_CLIENT_ID"`
+	GoogleSecretKey     string   `env:"GOOGLE_KEY" secret:"true"`
+	GoogleClientSecret  string   `env:"GOOGLE_CLIENT_SECRET" secret:"true"`
+	UrlCallback         string   `env:"URL_CALLBACK"`
+	SigningKeyFile      string   `env:"SIGNING_KEY_FILE"`
+	MutualTLSPort       string   `env:"MTLS_PORT"`
+	TlsCertFile         string   `env:"TLS_CERT_FILE"`
+	TlsKeyFile          string   `env:"TLS_KEY_FILE"`
+	ClientCAFile        string   `env:"TLS_CLIENT_CA_FILE"`
+	ServerPort          string   `env:"SERVER_PORT"`
+	GrpcPort            string   `env:"GRPC_PORT"`
+	ForwardAuthLoginUrl string   `env:"FORWARD_AUTH_LOGIN_URL"`
+	AuthModes           []string `env:"AUTH_MODES"`
+	MigrateOnStartup    bool     `env:"MIGRATE_ON_STARTUP"`
+
+	DatabaseUrl string `env:"DATABASE_URL" secret:"true"`
+	// QueryTimeout bounds every query of the repositories.
+	QueryTimeout time.Duration `env:"QUERY_TIMEOUT" default:"5s"`
+
+	// Issuer is the iss claim of the jwt tokens, IssuerUrl the public url of
+	// the OpenID Connect provider (taken from the request when empty).
+	Issuer        string        `env:"ISSUER"`
+	IssuerUrl     string        `env:"ISSUER_URL"`
+	TokenDuration time.Duration `env:"TOKEN_DURATION" default:"15m"`
+	// AccessTokenAlg signs the access tokens with JWT_SECRET_KEY (HS256) or
+	// with the key of the jwks_uri (RS256).
+	AccessTokenAlg string `env:"ACCESS_TOKEN_ALG" default:"HS256"`
+
+	// The timeouts of the http servers, ShutdownTimeout is how long the
+	// requests in progress have to finish after a SIGTERM.
+	ReadTimeout     time.Duration `env:"READ_TIMEOUT" default:"10s"`
+	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT" default:"2m"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// The LDAP or Active Directory the logins are checked against before the
+	// users table, it's disabled when LdapUrl is empty. The user is searched
+	// by LdapUsernameAttribute with the service account and then bound with
+	// the password, LdapGroupRoles maps the CN of their groups to roles
+	// ("Domain Admins=admin").
+	LdapUrl               string   `env:"LDAP_URL"`
+	LdapStartTls          bool     `env:"LDAP_START_TLS"`
+	LdapBindDn            string   `env:"LDAP_BIND_DN"`
+	LdapBindPassword      string   `env:"LDAP_BIND_PASSWORD" secret:"true"`
+	LdapBaseDn            string   `env:"LDAP_BASE_DN"`
+	LdapUserFilter        string   `env:"LDAP_USER_FILTER" default:"(objectClass=person)"`
+	LdapUsernameAttribute string   `env:"LDAP_USERNAME_ATTRIBUTE" default:"uid"`
+	LdapEmailAttribute    string   `env:"LDAP_EMAIL_ATTRIBUTE" default:"mail"`
+	LdapGroupAttribute    string   `env:"LDAP_GROUP_ATTRIBUTE" default:"memberOf"`
+	LdapGroupRoles        []string `env:"LDAP_GROUP_ROLES"`
+
+	// The SAML identity provider of /saml/login, it's disabled without the
+	// metadata of the IdP. The urls of the service provider are under
+	// IssuerUrl, a key is generated when SamlKeyFile is empty. The username
+	// is the NameID unless SamlUsernameAttribute is set and SamlGroupRoles
+	// maps the groups to roles like LdapGroupRoles.
+	SamlIdpMetadataUrl    string   `env:"SAML_IDP_METADATA_URL"`
+	SamlIdpMetadataFile   string   `env:"SAML_IDP_METADATA_FILE"`
+	SamlEntityId          string   `env:"SAML_ENTITY_ID"`
+	SamlCertFile          string   `env:"SAML_CERT_FILE"`
+	SamlKeyFile           string   `env:"SAML_KEY_FILE"`
+	SamlAllowIdpInitiated bool     `env:"SAML_ALLOW_IDP_INITIATED"`
+	SamlUsernameAttribute string   `env:"SAML_USERNAME_ATTRIBUTE"`
+	SamlEmailAttribute    string   `env:"SAML_EMAIL_ATTRIBUTE" default:"email"`
+	SamlGroupAttribute    string   `env:"SAML_GROUP_ATTRIBUTE" default:"groups"`
+	SamlGroupRoles        []string `env:"SAML_GROUP_ROLES"`
+
+	// The SCIM 2.0 endpoints under /scim/v2, the identity provider of the
+	// default organization sends ScimToken as a bearer token and the ones of
+	// the others their token of ScimOrgTokens (slug=token), an organization
+	// without a token can't use them. ScimGroupRoles maps the SCIM groups to
+	// the roles of their members.
+	ScimToken      string   `env:"SCIM_TOKEN" secret:"true"`
+	ScimOrgTokens  []string `env:"SCIM_ORG_TOKENS" secret:"true"`
+	ScimGroupRoles []string `env:"SCIM_GROUP_ROLES"`
+
+	// TokenReviewToken is the bearer token the Kubernetes API server sends
+	// to /k8s/tokenreview, the webhook is disabled without it.
+	TokenReviewToken string `env:"TOKEN_REVIEW_TOKEN" secret:"true"`
+
+	// The organizations are resolved from TenantHeader (the slug) or else
+	// from the host of the request, the requests that name none are of the
+	// default organization. PasswordMinLength is the minimum length of the
+	// passwords of the organizations without their own.
+	TenantHeader      string `env:"TENANT_HEADER" default:"X-Tenant"`
+	PasswordMinLength int    `env:"PASSWORD_MIN_LENGTH"`
+
+	// The invitations to the organizations link to InvitationUrl with the
+	// token in the query, it's the page that accepts or declines them. They
+	// are sent through the SMTP server at SmtpAddr (host:port) or written in
+	// the log when it's empty.
+	InvitationUrl string `env:"INVITATION_URL" default:"http://localhost:8000/invitations"`
+	SmtpAddr      string `env:"SMTP_ADDR"`
+	SmtpUsername  string `env:"SMTP_USERNAME"`
+	SmtpPassword  string `env:"SMTP_PASSWORD" secret:"true"`
+	MailFrom      string `env:"MAIL_FROM" default:"fauthless@localhost"`
+
+	CursorSecretKey       string `env:"SECRET_CURSOR_KEY" secret:"true"`
+	CursorSignatureLength int    `env:"SIGNATURE_LENGTH" default:"32"`
 }
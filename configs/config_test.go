@@ -0,0 +1,181 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("couldn't write %v: %v", name, err)
+	}
+	return path
+}
+
+// TestLoad verifies the order of the sources, the secret files and the
+// typed values.
+func TestLoad(t *testing.T) {
+	// given
+	t.Setenv(ConfigFileEnv, writeFile(t, "config.yaml", `
+jwt_secret_key: from-file
+server_port: 9000
+token_duration: 1h
+auth_modes: [jwt, pat]
+migrate_on_startup: true
+`))
+	t.Setenv("SERVER_PORT", "8000")
+	t.Setenv("JWT_SECRET_KEY", "from-env")
+	t.Setenv("JWT_SECRET_KEY_FILE", writeFile(t, "jwt_secret", "from-secret\n"))
+	t.Setenv("SIGNATURE_LENGTH", "")
+
+	// when
+	config, err := Load()
+
+	// then
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+	if config.JwtSecretKey != "from-secret" {
+		t.Errorf("expected the secret file to win, got %q", config.JwtSecretKey)
+	}
+	if config.ServerPort != "8000" {
+		t.Errorf("expected the environment to override the file, got %q", config.ServerPort)
+	}
+	if config.TokenDuration != time.Hour {
+		t.Errorf("expected TOKEN_DURATION of 1h, got %v", config.TokenDuration)
+	}
+	if !slices.Equal(config.AuthModes, []string{"jwt", "pat"}) {
+		t.Errorf("expected the modes of the file, got %v", config.AuthModes)
+	}
+	if !config.MigrateOnStartup {
+		t.Error("expected MIGRATE_ON_STARTUP to be true")
+	}
+	if config.CursorSignatureLength != 32 {
+		t.Errorf("expected the default SIGNATURE_LENGTH when it's empty, got %v", config.CursorSignatureLength)
+	}
+}
+
+// TestLoad_Toml verifies the TOML files and the durations in minutes.
+func TestLoad_Toml(t *testing.T) {
+	// given
+	t.Setenv("TOKEN_DURATION", "")
+	t.Setenv(ConfigFileEnv, writeFile(t, "config.toml", `
+token_duration = 30
+issuer = "golang"
+`))
+
+	// when
+	config, err := Load()
+
+	// then
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+	if config.TokenDuration != 30*time.Minute {
+		t.Errorf("expected a plain number to be minutes, got %v", config.TokenDuration)
+	}
+	if config.Issuer != "golang" {
+		t.Errorf("expected the issuer of the file, got %q", config.Issuer)
+	}
+}
+
+// TestLoad_Invalid verifies the values that can't be parsed and the
+// unknown settings are reported.
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		wants string
+	}{
+		{
+			name:  "invalid duration",
+			env:   map[string]string{"TOKEN_DURATION": "forever"},
+			wants: "TOKEN_DURATION",
+		},
+		{
+			name:  "invalid bool",
+			env:   map[string]string{"MIGRATE_ON_STARTUP": "maybe"},
+			wants: "MIGRATE_ON_STARTUP",
+		},
+		{
+			name:  "missing secret file",
+			env:   map[string]string{"JWT_SECRET_KEY_FILE": "/does/not/exist"},
+			wants: "JWT_SECRET_KEY_FILE",
+		},
+		{
+			name:  "unknown setting",
+			file:  "jwt_secret: typo\n",
+			wants: `unknown setting "jwt_secret"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// given
+			if test.file != "" {
+				t.Setenv(ConfigFileEnv, writeFile(t, "config.yml", test.file))
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			// when
+			_, err := Load()
+
+			// then
+			if !errors.Is(err, errorhandler.ErrInvalidConfig) {
+				t.Fatalf("expected ErrInvalidConfig, got %v", err)
+			}
+			if !strings.Contains(err.Error(), test.wants) {
+				t.Errorf("expected the error to mention %q, got %v", test.wants, err)
+			}
+		})
+	}
+}
+
+// TestValidate verifies every problem is reported at once.
+func TestValidate(t *testing.T) {
+	// given
+	config := &Configuration{
+		TokenDuration:         15 * time.Minute,
+		CursorSignatureLength: 32,
+		ReadTimeout:           10 * time.Second,
+		WriteTimeout:          30 * time.Second,
+		IdleTimeout:           2 * time.Minute,
+		ShutdownTimeout:       30 * time.Second,
+		QueryTimeout:          5 * time.Second,
+		DatabaseUrl:           "postgres://localhost/postgres",
+		CursorSecretKey:       "cursor",
+		ServerPort:            "http",
+		IssuerUrl:             "localhost",
+	}
+
+	// when
+	err := config.Validate()
+
+	// then
+	if !errors.Is(err, errorhandler.ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+	for _, wants := range []string{"JWT_SECRET_KEY is required", "SERVER_PORT must be a port number", "ISSUER_URL must be an absolute url"} {
+		if !strings.Contains(err.Error(), wants) {
+			t.Errorf("expected the error to mention %q, got %v", wants, err)
+		}
+	}
+
+	config.JwtSecretKey = "secret"
+	config.ServerPort = "8000"
+	config.IssuerUrl = "https://auth.example.com"
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected a valid configuration, got %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the optional YAML or TOML file with the settings.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// SecretFileSuffix is appended to the name of a secret to read it from a
+// file instead, like the docker and kubernetes secrets mounted as files.
+const SecretFileSuffix = "_FILE"
+
+// Load reads the configuration, each source overrides the previous one:
+// the defaults, the file in CONFIG_FILE, the environment and the secret
+// files. It doesn't validate the result, see Validate.
+func Load() (*Configuration, error) {
+	values, err := readFile(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Configuration{}
+	var errs []error
+	forEachField(config, func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+
+		raw, ok := field.Tag.Lookup("default")
+		if fileValue, found := values[strings.ToLower(name)]; found {
+			raw, ok = fileValue, true
+		}
+		// an empty variable, like the ones left blank in the .env, is unset
+		if envValue := os.Getenv(name); envValue != "" {
+			raw, ok = envValue, true
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			secretValue, found, err := readSecretFile(name)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if found {
+				raw, ok = secretValue, true
+			}
+		}
+
+		if !ok {
+			return
+		}
+		if err := setField(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", name, err))
+		}
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%w:\n%w", errorhandler.ErrInvalidConfig, err)
+	}
+	return config, nil
+}
+
+// Validate reports every invalid setting at once, so they can all be fixed
+// before the next start.
+func (config *Configuration) Validate() error {
+	var errs []error
+
+	if config.JwtSecretKey == "" {
+		errs = append(errs, errors.New("JWT_SECRET_KEY is required"))
+	}
+	if config.DatabaseUrl == "" {
+		errs = append(errs, errors.New("DATABASE_URL is required"))
+	}
+	if config.CursorSecretKey == "" {
+		errs = append(errs, errors.New("SECRET_CURSOR_KEY is required"))
+	}
+	if config.TokenDuration <= 0 {
+		errs = append(errs, errors.New("TOKEN_DURATION must be positive"))
+	}
+	timeouts := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"READ_TIMEOUT", config.ReadTimeout},
+		{"WRITE_TIMEOUT", config.WriteTimeout},
+		{"IDLE_TIMEOUT", config.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", config.ShutdownTimeout},
+		{"QUERY_TIMEOUT", config.QueryTimeout},
+	}
+	for _, t := range timeouts {
+		if t.timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%v must be positive", t.name))
+		}
+	}
+	if config.CursorSignatureLength <= 0 {
+		errs = append(errs, errors.New("SIGNATURE_LENGTH must be positive"))
+	}
+	if alg := config.AccessTokenAlg; alg != "" && alg != "HS256" && alg != "RS256" {
+		errs = append(errs, fmt.Errorf("ACCESS_TOKEN_ALG must be HS256 or RS256, got %q", config.AccessTokenAlg))
+	}
+
+	if config.IssuerUrl != "" {
+		issuerUrl, err := url.Parse(config.IssuerUrl)
+		if err != nil || issuerUrl.Scheme == "" || issuerUrl.Host == "" {
+			errs = append(errs, errors.New("ISSUER_URL must be an absolute url"))
+		}
+	}
+
+	if config.ForwardAuthLoginUrl != "" {
+		if _, err := url.Parse(config.ForwardAuthLoginUrl); err != nil {
+			errs = append(errs, errors.New("FORWARD_AUTH_LOGIN_URL must be a url"))
+		}
+	}
+
+	if config.LdapUrl != "" {
+		ldapUrl, err := url.Parse(config.LdapUrl)
+		if err != nil || (ldapUrl.Scheme != "ldap" && ldapUrl.Scheme != "ldaps") {
+			errs = append(errs, errors.New("LDAP_URL must be a ldap:// or ldaps:// url"))
+		}
+		if config.LdapBaseDn == "" {
+			errs = append(errs, errors.New("LDAP_BASE_DN is required with LDAP_URL"))
+		}
+		for _, mapping := range config.LdapGroupRoles {
+			if group, role, found := strings.Cut(mapping, "="); !found || group == "" || role == "" {
+				errs = append(errs, fmt.Errorf("LDAP_GROUP_ROLES must be group=role pairs, got %q", mapping))
+			}
+		}
+	}
+
+	if config.SamlIdpMetadataUrl != "" || config.SamlIdpMetadataFile != "" {
+		if config.SamlIdpMetadataUrl != "" && config.SamlIdpMetadataFile != "" {
+			errs = append(errs, errors.New("SAML_IDP_METADATA_URL and SAML_IDP_METADATA_FILE can't be both set"))
+		}
+		if config.IssuerUrl == "" {
+			errs = append(errs, errors.New("ISSUER_URL is required with SAML, the service provider urls are under it"))
+		}
+		if (config.SamlCertFile == "") != (config.SamlKeyFile == "") {
+			errs = append(errs, errors.New("SAML_CERT_FILE and SAML_KEY_FILE must be set together"))
+		}
+		for _, mapping := range config.SamlGroupRoles {
+			if group, role, found := strings.Cut(mapping, "="); !found || group == "" || role == "" {
+				errs = append(errs, fmt.Errorf("SAML_GROUP_ROLES must be group=role pairs, got %q", mapping))
+			}
+		}
+	}
+
+	for _, mapping := range config.ScimGroupRoles {
+		if group, role, found := strings.Cut(mapping, "="); !found || group == "" || role == "" {
+			errs = append(errs, fmt.Errorf("SCIM_GROUP_ROLES must be group=role pairs, got %q", mapping))
+		}
+	}
+
+	ports := []struct{ name, port string }{
+		{"JWT_PORT", config.JwtBasedPort},
+		{"COOKIE_PORT", config.CookieBasedPort},
+		{"JWT_REFRESH_PORT", config.JwtRefreshBasedPort},
+		{"OAUTH2_PORT", config.OAuth2Port},
+		{"MTLS_PORT", config.MutualTLSPort},
+		{"SERVER_PORT", config.ServerPort},
+		{"GRPC_PORT", config.GrpcPort},
+	}
+	for _, p := range ports {
+		if p.port == "" {
+			continue
+		}
+		if number, err := strconv.Atoi(p.port); err != nil || number < 1 || number > 65535 {
+			errs = append(errs, fmt.Errorf("%v must be a port number, got %q", p.name, p.port))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w:\n%w", errorhandler.ErrInvalidConfig, err)
+	}
+	return nil
+}
+
+func forEachField(config *Configuration, fn func(field reflect.StructField, value reflect.Value)) {
+	value := reflect.ValueOf(config).Elem()
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		if field.Tag.Get("env") == "" {
+			continue
+		}
+		fn(field, value.Field(i))
+	}
+}
+
+// setField parses the raw value by the type of the field, so the file and
+// the environment go through the same rules.
+func setField(value reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(raw)
+	case int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", raw)
+		}
+		value.SetInt(int64(number))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		value.SetBool(b)
+	case time.Duration:
+		duration, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+	case []string:
+		var list []string
+		for item := range strings.SplitSeq(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %v", value.Type())
+	}
+	return nil
+}
+
+// parseDuration accepts the Go syntax (90s, 15m, 1h30m), a plain number is
+// taken as minutes since that's how TOKEN_DURATION was always set.
+func parseDuration(raw string) (time.Duration, error) {
+	if minutes, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration like 15m or 1h, got %q", raw)
+	}
+	return duration, nil
+}
+
+// readSecretFile reads <NAME>_FILE, the trailing new line most editors add
+// isn't part of the secret.
+func readSecretFile(name string) (string, bool, error) {
+	path := os.Getenv(name + SecretFileSuffix)
+	if path == "" {
+		return "", false, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%v%v: %w", name, SecretFileSuffix, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// readFile reads a flat YAML or TOML file, by its extension, into the raw
+// values keyed by the lowercase variable name. Lists are joined by commas
+// like in the environment.
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrInvalidConfig, err)
+	}
+
+	document := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		err = toml.Unmarshal(content, &document)
+	default:
+		return nil, fmt.Errorf("%w: %v must be a .yaml, .yml or .toml file", errorhandler.ErrInvalidConfig, ConfigFileEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %w", errorhandler.ErrInvalidConfig, path, err)
+	}
+
+	known := map[string]bool{}
+	forEachField(&Configuration{}, func(field reflect.StructField, _ reflect.Value) {
+		known[strings.ToLower(field.Tag.Get("env"))] = true
+	})
+
+	keys := slices.Sorted(maps.Keys(document))
+
+	values := make(map[string]string, len(document))
+	var errs []error
+	for _, key := range keys {
+		value := document[key]
+		key = strings.ToLower(key)
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+
+		switch value := value.(type) {
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]any:
+			errs = append(errs, fmt.Errorf("%v: nested settings aren't supported", key))
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%w: %v:\n%w", errorhandler.ErrInvalidConfig, path, err)
+	}
+	return values, nil
+}
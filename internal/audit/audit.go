@@ -0,0 +1,164 @@
+// Package audit is the audit trail of the security relevant events, who
+// did what to whom, from where and whether it succeeded.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ActionImpersonationStarted = "impersonation.started"
+	ActionImpersonatedRequest  = "impersonation.request"
+
+	ActionLogin                      = "user.login"
+	ActionRegister                   = "user.register"
+	ActionUserUpdated                = "user.update"
+	ActionUserDeleted                = "user.delete"
+	ActionUserLocked                 = "user.lock"
+	ActionUserUnlocked               = "user.unlock"
+	ActionPasswordReset              = "user.password_reset"
+	ActionSessionRevoked             = "session.revoke"
+	ActionUserSessionsRevoked        = "session.revoke_all"
+	ActionTokenRevoked               = "token.revoke"
+	ActionPersonalAccessTokenCreated = "pat.create"
+	ActionPersonalAccessTokenDeleted = "pat.delete"
+	ActionMemberRoleChanged          = "member.role"
+	ActionMemberRemoved              = "member.remove"
+	ActionInvitationCreated          = "invitation.create"
+	ActionInvitationRevoked          = "invitation.revoke"
+	ActionInvitationAccepted         = "invitation.accept"
+
+	// The changes made by the identity provider through SCIM, their actor
+	// is ActorScim.
+	ActionScimUserCreated  = "scim.user.create"
+	ActionScimUserReplaced = "scim.user.replace"
+	ActionScimUserPatched  = "scim.user.patch"
+	ActionScimUserDeleted  = "scim.user.delete"
+)
+
+// The actors of the events that aren't made by a user, the identity
+// provider and the commands of the CLI (followed by the user of the
+// operating system).
+const (
+	ActorScim = "scim"
+	ActorCli  = "cli"
+)
+
+// The outcomes of the events, the failed logins are user.login failures.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is an entry of the audit trail, Actor is who did it and Subject on
+// behalf of whom, they're the same user when nobody is impersonating.
+// Target is what it was done to, like the user deleted or the session
+// revoked, and Reason why it failed.
+type Event struct {
+	Id        int64     `json:"id,omitempty"`
+	OrgId     int64     `json:"org_id"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Outcome   string    `json:"outcome"`
+	Actor     string    `json:"actor,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Ip        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ClientId  string    `json:"client_id,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Status    int       `json:"status,omitempty"`
+}
+
+// Recorder records the events, the organization, time and client of the
+// event are taken from the context when they're not set.
+type Recorder interface {
+	Record(ctx context.Context, event *Event)
+}
+
+// Failure is the outcome and reason of an event that failed because of err.
+func Failure(event *Event, err error) *Event {
+	event.Outcome = OutcomeFailure
+	event.Reason = err.Error()
+	return event
+}
+
+// complete fills what the event didn't set from the context.
+func complete(ctx context.Context, event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+	if event.OrgId == 0 {
+		event.OrgId = tenant.IdFrom(ctx)
+	}
+	if client, ok := ClientFromContext(ctx); ok {
+		if event.Ip == "" {
+			event.Ip = client.Ip
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = client.UserAgent
+		}
+	}
+}
+
+type logRecorder struct {
+	logger *log.Logger
+}
+
+// NewLogRecorder initialize a Recorder that writes the events as structured
+// log entries, tagged with audit so they can be filtered.
+func NewLogRecorder(logger *log.Logger) Recorder {
+	return &logRecorder{logger: logger}
+}
+
+func (r *logRecorder) Record(ctx context.Context, event *Event) {
+	complete(ctx, event)
+
+	r.logger.WithFields(log.Fields{
+		"audit":      true,
+		"time":       event.Time.Format(time.RFC3339),
+		"org_id":     event.OrgId,
+		"action":     event.Action,
+		"outcome":    event.Outcome,
+		"actor":      event.Actor,
+		"subject":    event.Subject,
+		"target":     event.Target,
+		"reason":     event.Reason,
+		"ip":         event.Ip,
+		"user_agent": event.UserAgent,
+		"client_id":  event.ClientId,
+		"method":     event.Method,
+		"path":       event.Path,
+		"status":     event.Status,
+	}).Infoln("Audit event recorded.")
+}
+
+type repositoryRecorder struct {
+	repository Repository
+	fallback   Recorder
+}
+
+// NewRepositoryRecorder initialize a Recorder that appends the events to
+// the repository, the ones it can't save are written by the fallback so
+// they're not lost.
+func NewRepositoryRecorder(repository Repository, fallback Recorder) Recorder {
+	return &repositoryRecorder{repository: repository, fallback: fallback}
+}
+
+func (r *repositoryRecorder) Record(ctx context.Context, event *Event) {
+	complete(ctx, event)
+
+	// the event is recorded even when the request was canceled
+	if err := r.repository.CreateEvent(context.WithoutCancel(ctx), event); err != nil {
+		r.fallback.Record(ctx, event)
+	}
+}
@@ -0,0 +1,23 @@
+package audit
+
+import "context"
+
+// Client is where the request came from, the ip is the one of the
+// connection.
+type Client struct {
+	Ip        string
+	UserAgent string
+}
+
+type clientContextKey struct{}
+
+// WithClient returns the context of the requests of the client, the events
+// recorded with it carry its ip and user agent.
+func WithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(clientContextKey{}).(*Client)
+	return client, ok && client != nil
+}
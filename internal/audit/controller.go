@@ -0,0 +1,8 @@
+package audit
+
+import "net/http"
+
+type Controller interface {
+	ListEvents(w http.ResponseWriter, r *http.Request)
+	ExportEvents(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Filter narrows the events, the empty fields match every event. From is
+// inclusive and To exclusive.
+type Filter struct {
+	Action  string
+	Outcome string
+	Actor   string
+	Target  string
+	From    time.Time
+	To      time.Time
+}
+
+// Repository appends the events and finds the ones of the organization of
+// the context, the events are never changed or deleted.
+type Repository interface {
+	CreateEvent(ctx context.Context, event *Event) error
+	FindEvents(ctx context.Context, filter *Filter, cursor int64, size int) ([]Event, int64, error)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+type auditRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewAuditRepository initialize a new audit.Repository containing a
+// database connection, the events are scoped by the organization of the
+// context.
+func NewAuditRepository(conn *sql.DB, queryTimeout time.Duration) audit.Repository {
+	return &auditRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// CreateEvent appends the event and sets its id, the table rejects the
+// updates and deletes.
+func (repo *auditRepository) CreateEvent(ctx context.Context, event *audit.Event) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO audit_events (org_id, time, action, outcome, actor, subject, target, reason, ip, user_agent, client_id, method, path, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id;
+	`
+	return repo.db.QueryRowContext(ctx, query,
+		event.OrgId,
+		event.Time,
+		event.Action,
+		event.Outcome,
+		event.Actor,
+		event.Subject,
+		event.Target,
+		event.Reason,
+		event.Ip,
+		event.UserAgent,
+		event.ClientId,
+		event.Method,
+		event.Path,
+		event.Status,
+	).Scan(&event.Id)
+}
+
+// FindEvents lists the events that match the filter from the id cursor, the
+// newest first, 0 starts from the newest one. Size is the page plus one so
+// the next cursor is known, it's 0 on the last page.
+func (repo *auditRepository) FindEvents(ctx context.Context, filter *audit.Filter, cursor int64, size int) ([]audit.Event, int64, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, org_id, time, action, outcome, actor, subject, target, reason, ip, user_agent, client_id, method, path, status
+		FROM audit_events
+		WHERE org_id = $1
+			AND ($2::bigint = 0 OR id <= $2)
+			AND ($4::text = '' OR action = $4)
+			AND ($5::text = '' OR outcome = $5)
+			AND ($6::text = '' OR actor = $6 OR subject = $6)
+			AND ($7::text = '' OR target = $7)
+			AND ($8::timestamptz IS NULL OR time >= $8)
+			AND ($9::timestamptz IS NULL OR time < $9)
+		ORDER BY id DESC
+		LIMIT $3;
+	`
+	rows, err := repo.db.QueryContext(ctx, query,
+		tenant.IdFrom(ctx),
+		cursor,
+		size,
+		filter.Action,
+		filter.Outcome,
+		filter.Actor,
+		filter.Target,
+		nullTime(filter.From),
+		nullTime(filter.To),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := make([]audit.Event, 0, size)
+	for rows.Next() {
+		var e audit.Event
+		err := rows.Scan(&e.Id, &e.OrgId, &e.Time, &e.Action, &e.Outcome, &e.Actor, &e.Subject, &e.Target, &e.Reason, &e.Ip, &e.UserAgent, &e.ClientId, &e.Method, &e.Path, &e.Status)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor int64
+	if len(events) == size {
+		nextCursor = events[len(events)-1].Id
+		events = events[:len(events)-1]
+	}
+
+	return events, nextCursor, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// auditController is the http transport of the audit.Service, the events
+// are filtered by the action, outcome, actor, target, from and to query
+// parameters, the times in RFC 3339.
+type auditController struct {
+	service *audit.Service
+}
+
+func NewAuditController(s *audit.Service) audit.Controller {
+	return &auditController{
+		service: s,
+	}
+}
+
+// ListEvents lists the events paged by the cursor and size query
+// parameters, the next_cursor of the response is 0 on the last page.
+func (c *auditController) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterOf(r)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	cursor, err := strconv.ParseInt(queryOr(r, "cursor", "0"), 10, 64)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	size, err := strconv.Atoi(queryOr(r, "size", strconv.Itoa(audit.DefaultSize)))
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	pageModel, err := (*c.service).ListEvents(r.Context(), filter, cursor, size)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, pageModel)
+}
+
+// exportPageTimeout is how long each page of the export has to be written,
+// the deadline is extended after every page so the WRITE_TIMEOUT of the
+// server doesn't cut the long exports.
+const exportPageTimeout = 30 * time.Second
+
+// ExportEvents streams every event that matches the filter as NDJSON, each
+// page is flushed as soon as it's written. Once the first line is sent the
+// status can't change anymore, an export that fails then is cut short.
+func (c *auditController) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterOf(r)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Header().Set("Content-Type", "application/x-ndjson")
+	ww.Header().Set("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+
+	controller := http.NewResponseController(ww)
+	// the writers without a deadline (ErrNotSupported) are written as is
+	controller.SetWriteDeadline(time.Now().Add(exportPageTimeout))
+	pageWritten := func() error {
+		if err := controller.Flush(); err != nil {
+			return err
+		}
+		err := controller.SetWriteDeadline(time.Now().Add(exportPageTimeout))
+		if errors.Is(err, http.ErrNotSupported) {
+			return nil
+		}
+		return err
+	}
+
+	if err := (*c.service).ExportEvents(r.Context(), filter, ww, pageWritten); err != nil && ww.BytesWritten() == 0 {
+		errorhandler.ServiceErrorHandler(ww, err, r.URL.Path)
+	}
+}
+
+func filterOf(r *http.Request) (*audit.Filter, error) {
+	query := r.URL.Query()
+	filter := &audit.Filter{
+		Action:  query.Get("action"),
+		Outcome: query.Get("outcome"),
+		Actor:   query.Get("actor"),
+		Target:  query.Get("target"),
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+func queryOr(r *http.Request, key, defaultVal string) string {
+	if value := r.URL.Query().Get(key); value != "" {
+		return value
+	}
+	return defaultVal
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
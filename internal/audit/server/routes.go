@@ -0,0 +1,15 @@
+package server
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+)
+
+// MapAuditRoutes maps the audit trail of the organization, behind the
+// authentication and only for its admins.
+func MapAuditRoutes(route *chi.Router, controller *audit.Controller, m *middleware.Middleware) {
+	(*route).With(m.OrgRole(member.RoleAdmin)).Get("/audit/events", (*controller).ListEvents)
+	(*route).With(m.OrgRole(member.RoleAdmin)).Get("/audit/events/export", (*controller).ExportEvents)
+}
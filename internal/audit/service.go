@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"context"
+	"io"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// DefaultSize is the page size when the client doesn't send one and
+// MaxSize the largest one it can ask for.
+const (
+	DefaultSize = 50
+	MaxSize     = 500
+)
+
+// Service queries the audit trail of the organization of the context, the
+// newest events first. The cursor is the id of the first event of the page,
+// 0 is the newest one. The export calls pageWritten after each page, when
+// it isn't nil.
+type Service interface {
+	ListEvents(ctx context.Context, filter *Filter, cursor int64, size int) (*domain.CursorPagination[Event], error)
+	ExportEvents(ctx context.Context, filter *Filter, w io.Writer, pageWritten func() error) error
+}
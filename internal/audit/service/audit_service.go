@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/pagination"
+	log "github.com/sirupsen/logrus"
+)
+
+type auditService struct {
+	repo   audit.Repository
+	Logger *log.Logger
+}
+
+// NewAuditService initialize a new audit.Service.
+func NewAuditService(repo audit.Repository, logg *log.Logger) audit.Service {
+	return &auditService{
+		repo:   repo,
+		Logger: logg,
+	}
+}
+
+// ListEvents lists the events that match the filter from the id cursor,
+// the size is capped by MaxSize.
+func (s *auditService) ListEvents(ctx context.Context, filter *audit.Filter, cursor int64, size int) (*domain.CursorPagination[audit.Event], error) {
+	if err := validFilter(filter); err != nil {
+		return nil, err
+	}
+
+	if size <= 0 {
+		size = audit.DefaultSize
+	}
+	size = min(size, audit.MaxSize)
+
+	events, nextCursor, err := s.repo.FindEvents(ctx, filter, cursor, size+1)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	return pagination.NewCursorPagination(events, size, nextCursor), nil
+}
+
+// ExportEvents writes every event that matches the filter as NDJSON, one
+// event per line, the newest first. It's read a page at a time so the
+// export of a large trail doesn't sit in memory.
+func (s *auditService) ExportEvents(ctx context.Context, filter *audit.Filter, w io.Writer, pageWritten func() error) error {
+	if err := validFilter(filter); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	var cursor int64
+	for {
+		events, nextCursor, err := s.repo.FindEvents(ctx, filter, cursor, audit.MaxSize+1)
+		if err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			return err
+		}
+
+		for i := range events {
+			if err := encoder.Encode(&events[i]); err != nil {
+				return err
+			}
+		}
+		if pageWritten != nil {
+			if err := pageWritten(); err != nil {
+				return err
+			}
+		}
+
+		if nextCursor == 0 {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func validFilter(filter *audit.Filter) error {
+	if filter.Outcome != "" && filter.Outcome != audit.OutcomeSuccess && filter.Outcome != audit.OutcomeFailure {
+		return errorhandler.Invalid(errorhandler.ErrInvalidAuditFilter)
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return errorhandler.Invalid(errorhandler.ErrInvalidAuditFilter)
+	}
+	return nil
+}
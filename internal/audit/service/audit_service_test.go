@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/sirupsen/logrus"
+)
+
+type auditRepoMock struct {
+	events []audit.Event
+	err    error
+}
+
+func (mock *auditRepoMock) CreateEvent(ctx context.Context, event *audit.Event) error {
+	if mock.err != nil {
+		return mock.err
+	}
+	event.Id = int64(len(mock.events) + 1)
+	mock.events = append(mock.events, *event)
+	return nil
+}
+
+func (mock *auditRepoMock) FindEvents(ctx context.Context, filter *audit.Filter, cursor int64, size int) ([]audit.Event, int64, error) {
+	events := []audit.Event{}
+	for i := len(mock.events) - 1; i >= 0 && len(events) < size; i-- {
+		e := mock.events[i]
+		if e.OrgId != tenant.IdFrom(ctx) || (cursor != 0 && e.Id > cursor) {
+			continue
+		}
+		if (filter.Action != "" && e.Action != filter.Action) ||
+			(filter.Outcome != "" && e.Outcome != filter.Outcome) ||
+			(filter.Actor != "" && e.Actor != filter.Actor && e.Subject != filter.Actor) ||
+			(filter.Target != "" && e.Target != filter.Target) ||
+			(!filter.From.IsZero() && e.Time.Before(filter.From)) ||
+			(!filter.To.IsZero() && !e.Time.Before(filter.To)) {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	var nextCursor int64
+	if len(events) == size {
+		nextCursor = events[len(events)-1].Id
+		events = events[:len(events)-1]
+	}
+	return events, nextCursor, nil
+}
+
+type recorderMock struct {
+	events []*audit.Event
+}
+
+func (mock *recorderMock) Record(ctx context.Context, event *audit.Event) {
+	mock.events = append(mock.events, event)
+}
+
+var startMock = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func organizationMock() *domain.Organization {
+	return &domain.Organization{Id: 2, Slug: "acme"}
+}
+
+// prepareMocks returns the service with the trail of the default
+// organization, three logins of bob, one of them failed, and one of alice.
+func prepareMocks() (audit.Service, *auditRepoMock) {
+	repo := &auditRepoMock{}
+	recorder := audit.NewRepositoryRecorder(repo, &recorderMock{})
+
+	ctx := context.Background()
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionLogin, Actor: "bob", Time: startMock})
+	recorder.Record(ctx, audit.Failure(&audit.Event{Action: audit.ActionLogin, Actor: "bob", Time: startMock.Add(time.Hour)}, errorhandler.ErrInvalidUsernameOrPassword))
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionLogin, Actor: "alice", Time: startMock.Add(2 * time.Hour)})
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionUserDeleted, Actor: "alice", Target: "bob", Time: startMock.Add(3 * time.Hour)})
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionLogin, Actor: "bob", Time: startMock.Add(4 * time.Hour)})
+
+	return NewAuditService(repo, logrus.New()), repo
+}
+
+// TestListEvents verifies the filters and the cursor of the trail, the
+// newest events first.
+func TestListEvents(t *testing.T) {
+	// given
+	service, _ := prepareMocks()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		filter  audit.Filter
+		wantIds []int64
+	}{
+		{"every event", audit.Filter{}, []int64{5, 4, 3, 2, 1}},
+		{"logins of bob", audit.Filter{Action: audit.ActionLogin, Actor: "bob"}, []int64{5, 2, 1}},
+		{"failures", audit.Filter{Outcome: audit.OutcomeFailure}, []int64{2}},
+		{"target", audit.Filter{Target: "bob"}, []int64{4}},
+		{"time range", audit.Filter{From: startMock.Add(time.Hour), To: startMock.Add(3 * time.Hour)}, []int64{3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			page, err := service.ListEvents(ctx, &tt.filter, 0, 0)
+
+			// then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ids := []int64{}
+			for _, e := range page.Data {
+				ids = append(ids, e.Id)
+			}
+			if len(ids) != len(tt.wantIds) {
+				t.Fatalf("expected the events %v, got %v", tt.wantIds, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIds[i] {
+					t.Fatalf("expected the events %v, got %v", tt.wantIds, ids)
+				}
+			}
+		})
+	}
+
+	// when
+	first, _ := service.ListEvents(ctx, &audit.Filter{}, 0, 2)
+	second, _ := service.ListEvents(ctx, &audit.Filter{}, first.NextCursor, 2)
+	other, _ := service.ListEvents(tenant.WithOrganization(ctx, organizationMock()), &audit.Filter{}, 0, 2)
+	_, invalidErr := service.ListEvents(ctx, &audit.Filter{Outcome: "maybe"}, 0, 2)
+
+	// then
+	if len(first.Data) != 2 || first.NextCursor != 3 || second.Data[0].Id != 3 {
+		t.Fatalf("expected the second page from the event 3, got %+v and %+v", first, second)
+	}
+
+	if len(other.Data) != 0 {
+		t.Fatalf("expected no events of another organization, got %+v", other.Data)
+	}
+
+	if errorhandler.KindOf(invalidErr) != errorhandler.KindInvalid {
+		t.Fatalf("expected the unknown outcome to be rejected, got %v", invalidErr)
+	}
+}
+
+// TestExportEvents verifies the export writes every event that matches as
+// one json object per line.
+func TestExportEvents(t *testing.T) {
+	// given
+	service, _ := prepareMocks()
+	controller := server.NewAuditController(&service)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/audit/events/export?action=user.login&from="+startMock.Add(time.Hour).Format(time.RFC3339), nil)
+
+	// when
+	controller.ExportEvents(w, r)
+
+	// then
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected the ndjson export, got %d %v", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	lines := []audit.Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+	for scanner.Scan() {
+		var event audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("expected a json event per line, got %q", scanner.Text())
+		}
+		lines = append(lines, event)
+	}
+
+	if len(lines) != 3 || lines[0].Id != 5 || lines[2].Outcome != audit.OutcomeFailure || lines[2].Reason == "" {
+		t.Fatalf("expected the logins since the first hour, got %+v", lines)
+	}
+	if !w.Flushed {
+		t.Errorf("expected the page to be flushed")
+	}
+
+	// when
+	w = httptest.NewRecorder()
+	controller.ExportEvents(w, httptest.NewRequest(http.MethodGet, "/api/v1/audit/events/export?from=yesterday", nil))
+
+	// then
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the invalid time to be rejected, got %d", w.Code)
+	}
+}
+
+// TestExportEvents_WriteTimeout verifies the export extends the write
+// deadline of the server, which would cut it otherwise.
+func TestExportEvents_WriteTimeout(t *testing.T) {
+	// given
+	service, _ := prepareMocks()
+	controller := server.NewAuditController(&service)
+	httpServer := httptest.NewUnstartedServer(http.HandlerFunc(controller.ExportEvents))
+	httpServer.Config.WriteTimeout = time.Nanosecond
+	httpServer.Start()
+	defer httpServer.Close()
+
+	// when
+	resp, err := http.Get(httpServer.URL + "/api/v1/audit/events/export")
+
+	// then
+	if err != nil {
+		t.Fatalf("expected the export to be written, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK || bytes.Count(body, []byte("\n")) != 5 {
+		t.Fatalf("expected every event, got %d %q %v", resp.StatusCode, body, err)
+	}
+}
+
+// TestRepositoryRecorder verifies the events carry the client and the
+// organization of the context, and the ones the repository can't save are
+// recorded by the fallback.
+func TestRepositoryRecorder(t *testing.T) {
+	// given
+	repo := &auditRepoMock{}
+	fallback := &recorderMock{}
+	recorder := audit.NewRepositoryRecorder(repo, fallback)
+
+	org := organizationMock()
+	ctx := audit.WithClient(tenant.WithOrganization(context.Background(), org), &audit.Client{Ip: "203.0.113.7", UserAgent: "curl/8.0"})
+
+	// when
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionLogin, Actor: "bob"})
+	repo.err = errors.New("connection refused")
+	recorder.Record(ctx, &audit.Event{Action: audit.ActionLogin, Actor: "alice"})
+
+	// then
+	if len(repo.events) != 1 {
+		t.Fatalf("expected one saved event, got %+v", repo.events)
+	}
+
+	saved := repo.events[0]
+	if saved.OrgId != org.Id || saved.Ip != "203.0.113.7" || saved.UserAgent != "curl/8.0" || saved.Outcome != audit.OutcomeSuccess || saved.Time.IsZero() {
+		t.Fatalf("expected the event completed from the context, got %+v", saved)
+	}
+
+	if len(fallback.events) != 1 || fallback.events[0].Actor != "alice" {
+		t.Fatalf("expected the unsaved event recorded by the fallback, got %+v", fallback.events)
+	}
+}
@@ -12,4 +12,26 @@ type Controller interface {
 	GetAuthCallbackOAuth2Ep(w http.ResponseWriter, r *http.Request)
 	LogoutOAuth2Ep(w http.ResponseWriter, r *http.Request)
 	GetAuthOAuth2Ep(w http.ResponseWriter, r *http.Request)
+	SamlMetadataEp(w http.ResponseWriter, r *http.Request)
+	SamlLoginEp(w http.ResponseWriter, r *http.Request)
+	SamlAcsEp(w http.ResponseWriter, r *http.Request)
+	RegisterClientEp(w http.ResponseWriter, r *http.Request)
+	LoginPageEp(w http.ResponseWriter, r *http.Request)
+	LoginBrowserEp(w http.ResponseWriter, r *http.Request)
+	AuthorizeEp(w http.ResponseWriter, r *http.Request)
+	AuthorizeConsentEp(w http.ResponseWriter, r *http.Request)
+	TokenEp(w http.ResponseWriter, r *http.Request)
+	OpenIdConfigurationEp(w http.ResponseWriter, r *http.Request)
+	JwksEp(w http.ResponseWriter, r *http.Request)
+	UserInfoEp(w http.ResponseWriter, r *http.Request)
+	EndSessionEp(w http.ResponseWriter, r *http.Request)
+	IntrospectEp(w http.ResponseWriter, r *http.Request)
+	RevokeEp(w http.ResponseWriter, r *http.Request)
+	TokenReviewEp(w http.ResponseWriter, r *http.Request)
+	DeviceAuthorizationEp(w http.ResponseWriter, r *http.Request)
+	DevicePageEp(w http.ResponseWriter, r *http.Request)
+	DeviceConsentEp(w http.ResponseWriter, r *http.Request)
+	CreatePersonalAccessTokenEp(w http.ResponseWriter, r *http.Request)
+	ListPersonalAccessTokensEp(w http.ResponseWriter, r *http.Request)
+	DeletePersonalAccessTokenEp(w http.ResponseWriter, r *http.Request)
 }
@@ -1,17 +1,24 @@
 package auth
 
 import (
+	"net/http"
+
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/markbates/goth/providers/google"
 
 	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 )
 
 const (
 	MaxAge = 86400 * 30
 	IsProd = false
+
+	// The browser session of the authorization server, started by /oauth/login.
+	BrowserSessionName   = "fauthless_session"
+	BrowserSessionMaxAge = 8 * 60 * 60
 )
 
 func InitOAuth(config *configs.Configuration) {
@@ -26,3 +33,34 @@ func InitOAuth(config *configs.Configuration) {
 
 	goth.UseProviders(google.New(config.GoogleSecretKey, config.GoogleClientSecret, config.UrlCallback))
 }
+
+// SetCookieSession sends the tokens of the cookie based login, the csrf one
+// is read by the client to send it back in the X-CSRF-Token header.
+func SetCookieSession(w http.ResponseWriter, session *domain.CookieSession) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    session.SessionToken,
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:    "csrf_token",
+		Value:   session.CsrfToken,
+		Expires: session.ExpiresAt,
+	})
+}
+
+// NewBrowserStore creates the cookie store of the browser session, the
+// middlewares use the same secret key to read it.
+func NewBrowserStore(secretKey string) *sessions.CookieStore {
+	var store *sessions.CookieStore = sessions.NewCookieStore([]byte(secretKey))
+	store.MaxAge(BrowserSessionMaxAge)
+
+	store.Options.Path = "/"
+	store.Options.HttpOnly = true
+	store.Options.Secure = IsProd
+	store.Options.SameSite = http.SameSiteLaxMode
+
+	return store
+}
@@ -1,10 +1,38 @@
 package auth
 
-import "github.com/rafaeldepontes/fauthless-go/internal/domain"
+import (
+	"context"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
 
 type Repository interface {
-	CreateSession(session *domain.Session) (string, error)
-	FindSessionById(id string) (*domain.Session, error)
-	RevokeSession(id string) error
-	DeleteSession(id string) error
+	CreateSession(ctx context.Context, session *domain.Session) (string, error)
+	FindSessionById(ctx context.Context, id string) (*domain.Session, error)
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, username string) (int64, error)
+	DeleteSession(ctx context.Context, id string) error
+}
+
+type PersonalAccessTokenRepository interface {
+	CreatePersonalAccessToken(ctx context.Context, pat *domain.PersonalAccessToken) error
+	FindPersonalAccessToken(ctx context.Context, tokenHash string) (*domain.PersonalAccessToken, error)
+	FindPersonalAccessTokensByUsername(ctx context.Context, username string) ([]domain.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id string) error
+	DeletePersonalAccessToken(ctx context.Context, id, username string) error
+}
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *domain.OAuthClient) error
+	FindClientById(ctx context.Context, id string) (*domain.OAuthClient, error)
+	CreateAuthorizationCode(ctx context.Context, code *domain.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error)
+	FindConsent(ctx context.Context, username, clientId string) (*domain.OAuthConsent, error)
+	SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error
+	CreateDeviceCode(ctx context.Context, code *domain.DeviceCode) error
+	FindDeviceCode(ctx context.Context, deviceCodeHash string) (*domain.DeviceCode, error)
+	FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*domain.DeviceCode, error)
+	UpdateDeviceCodeStatus(ctx context.Context, code *domain.DeviceCode) error
+	UpdateDeviceCodePolling(ctx context.Context, code *domain.DeviceCode) error
+	DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error
 }
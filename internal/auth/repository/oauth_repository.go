@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+type oauthRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewOAuthRepository initialize a new OAuthRepository containing
+// a database connection, it returns a pointer to the new OAuthRepository.
+func NewOAuthRepository(conn *sql.DB, queryTimeout time.Duration) auth.OAuthRepository {
+	return &oauthRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// CreateClient saves a new oauth client, the redirect uris and scopes
+// are stored space separated, returns an error if any.
+func (r *oauthRepository) CreateClient(ctx context.Context, client *domain.OAuthClient) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	INSERT INTO oauth_clients (id, secret_hash, name, owner, redirect_uris, scopes, is_confidential)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING created_at
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(ctx,
+		client.Id,
+		client.SecretHash,
+		client.Name,
+		client.Owner,
+		strings.Join(client.RedirectUris, " "),
+		strings.Join(client.Scopes, " "),
+		client.IsConfidential,
+	).Scan(&client.CreatedAt)
+}
+
+// FindClientById searchs for a client based on its identifier, returns
+// the client and an error if any.
+func (r *oauthRepository) FindClientById(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT id, secret_hash, name, owner, redirect_uris, scopes, is_confidential, created_at
+	FROM oauth_clients
+	WHERE id = $1
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		client       domain.OAuthClient
+		redirectUris string
+		scopes       string
+	)
+	err = stmt.QueryRowContext(ctx, id).Scan(&client.Id, &client.SecretHash, &client.Name, &client.Owner, &redirectUris, &scopes, &client.IsConfidential, &client.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrClientNotFound
+		}
+		return nil, err
+	}
+
+	client.RedirectUris = strings.Fields(redirectUris)
+	client.Scopes = strings.Fields(scopes)
+
+	return &client, nil
+}
+
+// CreateAuthorizationCode saves an authorization code, only its hash is
+// stored, returns an error if any.
+func (r *oauthRepository) CreateAuthorizationCode(ctx context.Context, code *domain.AuthorizationCode) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, username, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at, org_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, code.CodeHash, code.ClientId, code.UserId, code.Username, code.RedirectUri, code.Scope, code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime, code.Amr, code.ExpiresAt, code.OrgId)
+	return err
+}
+
+// ConsumeAuthorizationCode removes the authorization code and returns it,
+// deleting it in the same statement makes sure the code is single use.
+func (r *oauthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	DELETE FROM oauth_authorization_codes
+	WHERE code_hash = $1
+	RETURNING code_hash, client_id, user_id, username, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at, org_id
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var code domain.AuthorizationCode
+	err = stmt.QueryRowContext(ctx, codeHash).Scan(&code.CodeHash, &code.ClientId, &code.UserId, &code.Username, &code.RedirectUri, &code.Scope, &code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, &code.Amr, &code.ExpiresAt, &code.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// FindConsent searchs for the scopes an user of the organization of the
+// context already granted to a client, returns the consent and an error if
+// any.
+func (r *oauthRepository) FindConsent(ctx context.Context, username, clientId string) (*domain.OAuthConsent, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT username, client_id, scope
+	FROM oauth_consents
+	WHERE username = $1 AND client_id = $2 AND org_id = $3
+	`
+	var consent domain.OAuthConsent
+	err := r.db.QueryRowContext(ctx, query, username, clientId, tenant.IdFrom(ctx)).Scan(&consent.Username, &consent.ClientId, &consent.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// SaveConsent creates or replaces the scopes granted by an user of the
+// organization of the context to a client, returns an error if any.
+func (r *oauthRepository) SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	INSERT INTO oauth_consents (org_id, username, client_id, scope)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (org_id, username, client_id) DO UPDATE SET scope = EXCLUDED.scope
+	`
+	_, err := r.db.ExecContext(ctx, query, tenant.IdFrom(ctx), consent.Username, consent.ClientId, consent.Scope)
+	return err
+}
+
+// CreateDeviceCode saves a device authorization request, only the hash of
+// the device code is stored, returns an error if any.
+func (r *oauthRepository) CreateDeviceCode(ctx context.Context, code *domain.DeviceCode) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	INSERT INTO oauth_device_codes (device_code_hash, user_code, client_id, scope, status, poll_interval, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, code.DeviceCodeHash, code.UserCode, code.ClientId, code.Scope, code.Status, code.Interval, code.ExpiresAt)
+	return err
+}
+
+// FindDeviceCode searchs for a device authorization request based on the
+// hash of its device code, returns the request and an error if any.
+func (r *oauthRepository) FindDeviceCode(ctx context.Context, deviceCodeHash string) (*domain.DeviceCode, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT device_code_hash, user_code, client_id, scope, status, user_id, username, org_id, poll_interval, last_polled_at, expires_at
+	FROM oauth_device_codes
+	WHERE device_code_hash = $1
+	`
+	return r.findDeviceCode(ctx, query, deviceCodeHash)
+}
+
+// FindDeviceCodeByUserCode searchs for a device authorization request based
+// on the code typed by the user, returns the request and an error if any.
+func (r *oauthRepository) FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*domain.DeviceCode, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT device_code_hash, user_code, client_id, scope, status, user_id, username, org_id, poll_interval, last_polled_at, expires_at
+	FROM oauth_device_codes
+	WHERE user_code = $1
+	`
+	return r.findDeviceCode(ctx, query, userCode)
+}
+
+// UpdateDeviceCodeStatus saves the decision of the user, only pending
+// requests can be decided, returns an error if any.
+func (r *oauthRepository) UpdateDeviceCodeStatus(ctx context.Context, code *domain.DeviceCode) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE oauth_device_codes
+	SET status = $1, user_id = $2, username = $3, org_id = $4
+	WHERE device_code_hash = $5 AND status = 'pending'
+	`
+	result, err := r.db.ExecContext(ctx, query, code.Status, code.UserId, code.Username, code.OrgId, code.DeviceCodeHash)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+// UpdateDeviceCodePolling saves when the device polled and its interval,
+// returns an error if any.
+func (r *oauthRepository) UpdateDeviceCodePolling(ctx context.Context, code *domain.DeviceCode) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE oauth_device_codes
+	SET poll_interval = $1, last_polled_at = $2
+	WHERE device_code_hash = $3
+	`
+	_, err := r.db.ExecContext(ctx, query, code.Interval, code.LastPolledAt, code.DeviceCodeHash)
+	return err
+}
+
+// DeleteDeviceCode removes a device authorization request, it fails when
+// the request was already removed so the device code is single use.
+func (r *oauthRepository) DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	DELETE FROM oauth_device_codes
+	WHERE device_code_hash = $1
+	`
+	result, err := r.db.ExecContext(ctx, query, deviceCodeHash)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+func (r *oauthRepository) findDeviceCode(ctx context.Context, query string, arg string) (*domain.DeviceCode, error) {
+	var code domain.DeviceCode
+	err := r.db.QueryRowContext(ctx, query, arg).Scan(&code.DeviceCodeHash, &code.UserCode, &code.ClientId, &code.Scope, &code.Status, &code.UserId, &code.Username, &code.OrgId, &code.Interval, &code.LastPolledAt, &code.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrInvalidUserCode
+		}
+		return nil, err
+	}
+
+	return &code, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+type personalAccessTokenRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewPersonalAccessTokenRepository initialize a new PersonalAccessTokenRepository
+// containing a database connection, it returns a pointer to the new repository.
+func NewPersonalAccessTokenRepository(conn *sql.DB, queryTimeout time.Duration) auth.PersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// CreatePersonalAccessToken saves a new personal access token of the
+// organization of the context, only the hash of the token is stored, returns
+// an error if any.
+func (r *personalAccessTokenRepository) CreatePersonalAccessToken(ctx context.Context, pat *domain.PersonalAccessToken) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	INSERT INTO personal_access_tokens (id, token_hash, name, user_id, username, expires_at, org_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING created_at
+	`
+	var stmt *sql.Stmt
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	pat.OrgId = tenant.IdFrom(ctx)
+	return stmt.QueryRowContext(ctx, pat.Id, pat.TokenHash, pat.Name, pat.UserId, pat.Username, pat.ExpiresAt, pat.OrgId).Scan(&pat.CreatedAt)
+}
+
+// FindPersonalAccessToken searchs for a token based on its hash in every
+// organization, the token tells which one it belongs to. Returns the token
+// and an error if any.
+func (r *personalAccessTokenRepository) FindPersonalAccessToken(ctx context.Context, tokenHash string) (*domain.PersonalAccessToken, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT id, token_hash, name, user_id, username, org_id, created_at, expires_at, last_used_at
+	FROM personal_access_tokens
+	WHERE token_hash = $1
+	`
+	var pat domain.PersonalAccessToken
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&pat.Id, &pat.TokenHash, &pat.Name, &pat.UserId, &pat.Username, &pat.OrgId, &pat.CreatedAt, &pat.ExpiresAt, &pat.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &pat, nil
+}
+
+// FindPersonalAccessTokensByUsername lists the tokens of the user in the
+// organization of the context, newest first, returns an error if any.
+func (r *personalAccessTokenRepository) FindPersonalAccessTokensByUsername(ctx context.Context, username string) ([]domain.PersonalAccessToken, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	SELECT id, token_hash, name, user_id, username, org_id, created_at, expires_at, last_used_at
+	FROM personal_access_tokens
+	WHERE username = $1 AND org_id = $2
+	ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, username, tenant.IdFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pats := []domain.PersonalAccessToken{}
+	for rows.Next() {
+		var pat domain.PersonalAccessToken
+		if err := rows.Scan(&pat.Id, &pat.TokenHash, &pat.Name, &pat.UserId, &pat.Username, &pat.OrgId, &pat.CreatedAt, &pat.ExpiresAt, &pat.LastUsedAt); err != nil {
+			return nil, err
+		}
+		pats = append(pats, pat)
+	}
+
+	return pats, rows.Err()
+}
+
+// TouchPersonalAccessToken records when the token was last used, returns an
+// error if any.
+func (r *personalAccessTokenRepository) TouchPersonalAccessToken(ctx context.Context, id string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE personal_access_tokens
+	SET last_used_at = now()
+	WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// DeletePersonalAccessToken deletes a token of the user, returns
+// ErrTokenNotFound when the user has no token with that identifier.
+func (r *personalAccessTokenRepository) DeletePersonalAccessToken(ctx context.Context, id, username string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	DELETE FROM personal_access_tokens
+	WHERE id = $1 AND username = $2 AND org_id = $3
+	`
+	result, err := r.db.ExecContext(ctx, query, id, username, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrTokenNotFound
+	}
+
+	return nil
+}
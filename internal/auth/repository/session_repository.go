@@ -1,41 +1,52 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
 )
 
 type sessionRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
 // NewSessionRepository initialize a new Repository containing
 // a database connection, it returns a pointer to the new Repository.
-func NewSessionRepository(conn *sql.DB) auth.Repository {
+func NewSessionRepository(conn *sql.DB, queryTimeout time.Duration) auth.Repository {
 	return &sessionRepository{
-		db: conn,
+		db:           conn,
+		queryTimeout: queryTimeout,
 	}
 }
 
-// CreateSession creates a new session, it expects a session object
-// and returns an error if any.
-func (r *sessionRepository) CreateSession(session *domain.Session) (string, error) {
+// CreateSession creates a new session of the organization of the context,
+// it expects a session object and returns an error if any.
+func (r *sessionRepository) CreateSession(ctx context.Context, session *domain.Session) (string, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
-	INSERT INTO sessions (id, username, is_revoked, refresh_token, expires_at)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO sessions (id, username, is_revoked, refresh_token, expires_at, org_id)
+	VALUES ($1, $2, $3, $4, $5, $6)
 	RETURNING id
 	`
 	var stmt *sql.Stmt
-	stmt, err := r.db.Prepare(query)
+	stmt, err := r.db.PrepareContext(ctx, query)
 	if err != nil {
 		return "", err
 	}
 	defer stmt.Close()
 
 	var id string
-	err = stmt.QueryRow(session.Id, session.Username, session.IsRevoked, session.RefreshToken, session.ExpiresAt).Scan(&id)
+	err = stmt.QueryRowContext(ctx, session.Id, session.Username, session.IsRevoked, session.RefreshToken, session.ExpiresAt, tenant.IdFrom(ctx)).Scan(&id)
 	if err != nil {
 		return "", err
 	}
@@ -43,70 +54,107 @@ func (r *sessionRepository) CreateSession(session *domain.Session) (string, erro
 	return id, nil
 }
 
-// FindSessionById searchs for a session based on its identifier, it
-// expects the session identifier, returns the session and an error if
-// any.
-func (r *sessionRepository) FindSessionById(id string) (*domain.Session, error) {
+// FindSessionById searchs for a session of the organization of the context
+// based on its identifier, it expects the session identifier, returns the
+// session and an error if any, ErrSessionNotFound when there's none.
+func (r *sessionRepository) FindSessionById(ctx context.Context, id string) (*domain.Session, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 	SELECT id, username, is_revoked, refresh_token, created_at, expires_at 
 	FROM sessions
-	WHERE id = $1
+	WHERE id = $1 AND org_id = $2
 	`
 	var stmt *sql.Stmt
-	stmt, err := r.db.Prepare(query)
+	stmt, err := r.db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
 	var session domain.Session
-	err = stmt.QueryRow(id).Scan(&session.Id, &session.Username, &session.IsRevoked, &session.RefreshToken, &session.CreatedAt, &session.ExpiresAt)
+	err = stmt.QueryRowContext(ctx, id, tenant.IdFrom(ctx)).Scan(&session.Id, &session.Username, &session.IsRevoked, &session.RefreshToken, &session.CreatedAt, &session.ExpiresAt)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrSessionNotFound
+		}
 		return nil, err
 	}
 
 	return &session, nil
 }
 
-// RevokeSession revokes a session by its identifier, expects the identifier
-// and returns an error if any.
-func (r *sessionRepository) RevokeSession(id string) error {
+// RevokeSession revokes a session of the organization of the context by its
+// identifier, expects the identifier and returns an error if any,
+// ErrSessionNotFound when there's none.
+func (r *sessionRepository) RevokeSession(ctx context.Context, id string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 	UPDATE sessions
 	SET is_revoked = true
-	WHERE id = $1
+	WHERE id = $1 AND org_id = $2
 	`
 
 	var stmt *sql.Stmt
-	stmt, err := r.db.Prepare(query)
+	stmt, err := r.db.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	result, err := stmt.ExecContext(ctx, id, tenant.IdFrom(ctx))
 	if err != nil {
 		return err
 	}
 
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrSessionNotFound
+	}
 	return nil
 }
 
-// DeleteSession removes a session from the database by its identifier,
-// expects the id and return an error if any.
-func (r *sessionRepository) DeleteSession(id string) error {
+// RevokeUserSessions revokes every session of the user in the organization
+// of the context, expects the username and returns how many sessions were
+// revoked and an error if any.
+func (r *sessionRepository) RevokeUserSessions(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE sessions
+	SET is_revoked = true
+	WHERE username = $1 AND org_id = $2 AND is_revoked = false
+	`
+
+	result, err := r.db.ExecContext(ctx, query, username, tenant.IdFrom(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteSession removes a session of the organization of the context from
+// the database by its identifier, expects the id and return an error if any.
+func (r *sessionRepository) DeleteSession(ctx context.Context, id string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
-	DELETE FROM sessions WHERE id = $1
+	DELETE FROM sessions WHERE id = $1 AND org_id = $2
 	`
 
 	var stmt *sql.Stmt
-	stmt, err := r.db.Prepare(query)
+	stmt, err := r.db.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	_, err = stmt.ExecContext(ctx, id, tenant.IdFrom(ctx))
 	if err != nil {
 		return err
 	}
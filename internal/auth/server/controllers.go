@@ -1,53 +1,327 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
 )
 
+// authController is the http transport of the auth.Service, it decodes the
+// requests, binds the tokens through the Middleware and maps the errors to
+// the status codes. The auth.OAuthServer handlers are http already.
 type authController struct {
-	service *auth.Service
+	service     *auth.Service
+	oauthServer *auth.OAuthServer
+	middleware  *middleware.Middleware
 }
 
-func NewAuthController(s *auth.Service) auth.Controller {
+func NewAuthController(s *auth.Service, oauthServer *auth.OAuthServer, m *middleware.Middleware) auth.Controller {
 	return &authController{
-		service: s,
+		service:     s,
+		oauthServer: oauthServer,
+		middleware:  m,
 	}
 }
 
 func (s *authController) RegisterEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).Register(w, r)
+	if r.Method != http.MethodPost {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidMethod, r.URL.Path)
+		return
+	}
+
+	var user domain.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	if err := (*s.service).Register(r.Context(), &user); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 }
 
 func (s *authController) LoginCookieBasedEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).LoginCookieBased(w, r)
+	credentials, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := (*s.service).LoginCookieBased(r.Context(), credentials)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	auth.SetCookieSession(w, session)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 }
 
 func (s *authController) LoginJwtBasedEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).LoginJwtBased(w, r)
+	cnf, ok := s.tokenConfirmation(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	tokenResponse, err := (*s.service).LoginJwtBased(r.Context(), credentials, cnf)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, tokenResponse)
 }
 
 func (s *authController) LoginJwtRefreshBasedEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).LoginJwtRefreshBased(w, r)
+	cnf, ok := s.tokenConfirmation(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	trResponse, err := (*s.service).LoginJwtRefreshBased(r.Context(), credentials, cnf)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, trResponse)
 }
 
+// RenewAccessTokenEp accepts a json body for the request, in it should have
+// the refresh token available at the login call.
 func (s *authController) RenewAccessTokenEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).RenewAccessToken(w, r)
+	var req domain.RenewAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	cnf, ok := s.tokenConfirmation(w, r)
+	if !ok {
+		return
+	}
+
+	tkResponse, err := (*s.service).RenewAccessToken(r.Context(), req.RefreshToken, cnf)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, tkResponse)
 }
 
 func (s *authController) RevokeSessionEp(w http.ResponseWriter, r *http.Request) {
-	(*s.service).RevokeSession(w, r)
+	if err := (*s.service).RevokeSession(r.Context(), r.PathValue("id")); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *authController) GetAuthCallbackOAuth2Ep(w http.ResponseWriter, r *http.Request) {
-	(*s.service).GetAuthCallbackOAuth2(w, r)
+	(*s.oauthServer).GetAuthCallbackOAuth2(w, r)
 }
 
 func (s *authController) LogoutOAuth2Ep(w http.ResponseWriter, r *http.Request) {
-	(*s.service).LogoutOAuth2(w, r)
+	(*s.oauthServer).LogoutOAuth2(w, r)
 }
 
 func (s *authController) GetAuthOAuth2Ep(w http.ResponseWriter, r *http.Request) {
-	(*s.service).GetAuthOAuth2(w, r)
+	(*s.oauthServer).GetAuthOAuth2(w, r)
+}
+
+func (s *authController) SamlMetadataEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).SamlMetadata(w, r)
+}
+
+func (s *authController) SamlLoginEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).SamlLogin(w, r)
+}
+
+func (s *authController) SamlAcsEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).SamlAcs(w, r)
+}
+
+func (s *authController) RegisterClientEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).RegisterClient(w, r)
+}
+
+func (s *authController) LoginPageEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).LoginPage(w, r)
+}
+
+func (s *authController) LoginBrowserEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).LoginBrowser(w, r)
+}
+
+func (s *authController) AuthorizeEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).Authorize(w, r)
+}
+
+func (s *authController) AuthorizeConsentEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).AuthorizeConsent(w, r)
+}
+
+func (s *authController) TokenEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).Token(w, r)
+}
+
+func (s *authController) OpenIdConfigurationEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).OpenIdConfiguration(w, r)
+}
+
+func (s *authController) JwksEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).Jwks(w, r)
+}
+
+func (s *authController) UserInfoEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).UserInfo(w, r)
+}
+
+func (s *authController) EndSessionEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).EndSession(w, r)
+}
+
+func (s *authController) IntrospectEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).Introspect(w, r)
+}
+
+func (s *authController) RevokeEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).Revoke(w, r)
+}
+
+// TokenReviewEp is the webhook token authentication of Kubernetes, a
+// rejected token is still a 200 with the status not authenticated.
+func (s *authController) TokenReviewEp(w http.ResponseWriter, r *http.Request) {
+	var review domain.TokenReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidTokenReview, r.URL.Path)
+		return
+	}
+
+	answer, err := (*s.service).ReviewToken(r.Context(), &review)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, answer)
+}
+
+func (s *authController) DeviceAuthorizationEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).DeviceAuthorization(w, r)
+}
+
+func (s *authController) DevicePageEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).DevicePage(w, r)
+}
+
+func (s *authController) DeviceConsentEp(w http.ResponseWriter, r *http.Request) {
+	(*s.oauthServer).DeviceConsent(w, r)
+}
+
+// CreatePersonalAccessTokenEp creates a token for the authenticated user,
+// the response is the only time the token is shown.
+func (s *authController) CreatePersonalAccessTokenEp(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	var req domain.PersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	patResponse, err := (*s.service).CreatePersonalAccessToken(r.Context(), userClaims.Id, userClaims.Username, &req)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, patResponse)
+}
+
+func (s *authController) ListPersonalAccessTokensEp(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	patsResponse, err := (*s.service).ListPersonalAccessTokens(r.Context(), userClaims.Username)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, patsResponse)
+}
+
+func (s *authController) DeletePersonalAccessTokenEp(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	if err := (*s.service).DeletePersonalAccessToken(r.Context(), r.PathValue("id"), userClaims.Username); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenConfirmation returns what the tokens should be bound to, it writes
+// the error and returns false when the DPoP proof is invalid.
+func (s *authController) tokenConfirmation(w http.ResponseWriter, r *http.Request) (*domain.Confirmation, bool) {
+	cnf, err := s.middleware.TokenConfirmation(r)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return nil, false
+	}
+	return cnf, true
+}
+
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (*domain.UserLogin, bool) {
+	if r.Method != http.MethodPost {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidMethod, r.URL.Path)
+		return nil, false
+	}
+
+	var credentials domain.UserLogin
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return nil, false
+	}
+	return &credentials, true
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
 }
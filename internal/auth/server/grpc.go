@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	fauthlessv1 "github.com/rafaeldepontes/fauthless-go/pkg/pb/fauthless/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// basicPrefix is the scheme of the client credentials of the Introspect
+// call, like the http basic authentication.
+const basicPrefix = "Basic "
+
+// authGrpcServer is the gRPC transport of the auth.Service, the tokens are
+// issued like the jwt refresh based login without any binding since there
+// is no DPoP proof in gRPC.
+type authGrpcServer struct {
+	fauthlessv1.UnimplementedAuthServiceServer
+	service *auth.Service
+}
+
+func NewAuthGrpcServer(s *auth.Service) fauthlessv1.AuthServiceServer {
+	return &authGrpcServer{
+		service: s,
+	}
+}
+
+func (s *authGrpcServer) Register(ctx context.Context, req *fauthlessv1.RegisterRequest) (*fauthlessv1.RegisterResponse, error) {
+	age := int(req.GetAge())
+	user := &domain.User{
+		Username:       &req.Username,
+		HashedPassword: &req.Password,
+		Age:            &age,
+	}
+	if req.GetEmail() != "" {
+		user.Email = &req.Email
+	}
+
+	if err := (*s.service).Register(ctx, user); err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+	return &fauthlessv1.RegisterResponse{}, nil
+}
+
+func (s *authGrpcServer) Login(ctx context.Context, req *fauthlessv1.LoginRequest) (*fauthlessv1.LoginResponse, error) {
+	credentials := &domain.UserLogin{Username: req.GetUsername(), Password: req.GetPassword()}
+
+	trResponse, err := (*s.service).LoginJwtRefreshBased(ctx, credentials, nil)
+	if err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+
+	return &fauthlessv1.LoginResponse{
+		SessionId:             trResponse.SessionId,
+		AccessToken:           trResponse.AccessToken,
+		RefreshToken:          trResponse.RefreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(trResponse.AccessTokenExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(trResponse.RefreshTokenExpiresAt),
+	}, nil
+}
+
+func (s *authGrpcServer) Renew(ctx context.Context, req *fauthlessv1.RenewRequest) (*fauthlessv1.RenewResponse, error) {
+	tkResponse, err := (*s.service).RenewAccessToken(ctx, req.GetRefreshToken(), nil)
+	if err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+
+	return &fauthlessv1.RenewResponse{
+		AccessToken:          tkResponse.AccessToken,
+		AccessTokenExpiresAt: timestamppb.New(tkResponse.AccessTokenExpiresAt),
+	}, nil
+}
+
+func (s *authGrpcServer) Revoke(ctx context.Context, req *fauthlessv1.RevokeRequest) (*fauthlessv1.RevokeResponse, error) {
+	if err := (*s.service).RevokeSession(ctx, req.GetSessionId()); err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+	return &fauthlessv1.RevokeResponse{}, nil
+}
+
+// Introspect is only answered to the confidential clients, like the
+// /oauth/introspect, which send their credentials in the authorization
+// metadata with the Basic scheme instead of a token.
+func (s *authGrpcServer) Introspect(ctx context.Context, req *fauthlessv1.IntrospectRequest) (*fauthlessv1.IntrospectResponse, error) {
+	clientId, clientSecret := clientCredentials(ctx)
+	if _, err := (*s.service).AuthenticateClient(ctx, clientId, clientSecret); err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+
+	introspection := (*s.service).IntrospectToken(ctx, req.GetToken())
+	if !introspection.Active {
+		return &fauthlessv1.IntrospectResponse{Active: false}, nil
+	}
+
+	return &fauthlessv1.IntrospectResponse{
+		Active:    true,
+		Username:  introspection.Username,
+		Sub:       introspection.Sub,
+		Scope:     introspection.Scope,
+		ClientId:  introspection.ClientId,
+		TokenType: introspection.TokenType,
+		Iss:       introspection.Iss,
+		Jti:       introspection.Jti,
+		ExpiresAt: timestamppb.New(time.Unix(introspection.Exp, 0)),
+		IssuedAt:  timestamppb.New(time.Unix(introspection.Iat, 0)),
+	}, nil
+}
+
+// clientCredentials reads the "Basic <base64(id:secret)>" of the
+// authorization metadata, both are empty when it's missing or malformed.
+func clientCredentials(ctx context.Context) (string, string) {
+	values := metadata.ValueFromIncomingContext(ctx, middleware.AuthorizationMetadata)
+	if len(values) != 1 || !strings.HasPrefix(values[0], basicPrefix) {
+		return "", ""
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(values[0], basicPrefix))
+	if err != nil {
+		return "", ""
+	}
+
+	clientId, clientSecret, _ := strings.Cut(string(decoded), ":")
+	clientId, _ = url.QueryUnescape(clientId)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	return clientId, clientSecret
+}
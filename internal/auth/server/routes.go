@@ -3,6 +3,7 @@ package server
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
 )
 
 func MapAuthRoutes(r *chi.Mux, controller *auth.Controller) {
@@ -13,6 +14,12 @@ func MapAuthRoutesCookie(r *chi.Mux, controller *auth.Controller) {
 	(*r).Post("/login", (*controller).LoginCookieBasedEp)
 }
 
+// MapAuthRoutesCookieMultiMode maps the cookie login of the single binary,
+// /login belongs to the jwt one there.
+func MapAuthRoutesCookieMultiMode(r *chi.Mux, controller *auth.Controller) {
+	(*r).Post("/login/cookie", (*controller).LoginCookieBasedEp)
+}
+
 func MapAuthRoutesJwt(r *chi.Mux, controller *auth.Controller) {
 	(*r).Post("/login", (*controller).LoginJwtBasedEp)
 }
@@ -23,8 +30,52 @@ func MapAuthRoutesJwtRefresh(r *chi.Mux, controller *auth.Controller) {
 	(*r).Patch("/revoke/{id}", (*controller).RevokeSessionEp)
 }
 
+// MapTokenReviewRoutes maps the Kubernetes webhook token authentication,
+// only the API server with the TOKEN_REVIEW_TOKEN can ask for the reviews.
+func MapTokenReviewRoutes(r *chi.Mux, controller *auth.Controller, m *middleware.Middleware) {
+	(*r).With(m.TokenReviewAuthenticated).Post("/k8s/tokenreview", (*controller).TokenReviewEp)
+}
+
 func MapAuthRoutesOAuth2(r *chi.Mux, controller *auth.Controller) {
 	(*r).Get("/auth/{prodiver}/callback", (*controller).GetAuthCallbackOAuth2Ep)
 	(*r).Get("/logout/{provider}", (*controller).LogoutOAuth2Ep)
 	(*r).Get("/auth/{provider}", (*controller).GetAuthOAuth2Ep)
+	MapAuthRoutesSaml(r, controller)
+}
+
+// MapAuthRoutesSaml maps the SAML service provider, they answer 404 until
+// the identity provider is configured.
+func MapAuthRoutesSaml(r *chi.Mux, controller *auth.Controller) {
+	(*r).Get("/saml/metadata", (*controller).SamlMetadataEp)
+	(*r).Get("/saml/login", (*controller).SamlLoginEp)
+	(*r).Post("/saml/acs", (*controller).SamlAcsEp)
+}
+
+func MapAuthRoutesOAuthServer(r *chi.Mux, controller *auth.Controller) {
+	(*r).Get("/oauth/login", (*controller).LoginPageEp)
+	(*r).Post("/oauth/login", (*controller).LoginBrowserEp)
+	(*r).Get("/oauth/authorize", (*controller).AuthorizeEp)
+	(*r).Post("/oauth/authorize", (*controller).AuthorizeConsentEp)
+	(*r).Post("/oauth/token", (*controller).TokenEp)
+	(*r).Post("/oauth/introspect", (*controller).IntrospectEp)
+	(*r).Post("/oauth/revoke", (*controller).RevokeEp)
+	(*r).Post("/oauth/device_authorization", (*controller).DeviceAuthorizationEp)
+	(*r).Get("/oauth/device", (*controller).DevicePageEp)
+	(*r).Post("/oauth/device", (*controller).DeviceConsentEp)
+	(*r).Get("/oauth/logout", (*controller).EndSessionEp)
+	(*r).Post("/oauth/logout", (*controller).EndSessionEp)
+	(*r).Get("/userinfo", (*controller).UserInfoEp)
+	(*r).Post("/userinfo", (*controller).UserInfoEp)
+	(*r).Get("/.well-known/openid-configuration", (*controller).OpenIdConfigurationEp)
+	(*r).Get("/.well-known/jwks.json", (*controller).JwksEp)
+}
+
+func MapOAuthClientRoutes(route *chi.Router, controller *auth.Controller) {
+	(*route).Post("/oauth/clients", (*controller).RegisterClientEp)
+}
+
+func MapPersonalAccessTokenRoutes(route *chi.Router, controller *auth.Controller) {
+	(*route).Post("/tokens", (*controller).CreatePersonalAccessTokenEp)
+	(*route).Get("/tokens", (*controller).ListPersonalAccessTokensEp)
+	(*route).Delete("/tokens/{id}", (*controller).DeletePersonalAccessTokenEp)
 }
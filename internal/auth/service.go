@@ -1,15 +1,61 @@
 package auth
 
-import "net/http"
+import (
+	"context"
+	"net/http"
 
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// Service is the authentication without any transport, the errors are
+// classified with the errorhandler kinds so each transport reports them
+// its own way. cnf is what the tokens should be bound to, nil for bearer
+// tokens.
 type Service interface {
-	Register(w http.ResponseWriter, r *http.Request)
-	LoginCookieBased(w http.ResponseWriter, r *http.Request)
-	LoginJwtBased(w http.ResponseWriter, r *http.Request)
-	LoginJwtRefreshBased(w http.ResponseWriter, r *http.Request)
-	RenewAccessToken(w http.ResponseWriter, r *http.Request)
-	RevokeSession(w http.ResponseWriter, r *http.Request)
+	Register(ctx context.Context, user *domain.User) error
+	LoginCookieBased(ctx context.Context, credentials *domain.UserLogin) (*domain.CookieSession, error)
+	LoginJwtBased(ctx context.Context, credentials *domain.UserLogin, cnf *domain.Confirmation) (*domain.TokenResponse, error)
+	LoginJwtRefreshBased(ctx context.Context, credentials *domain.UserLogin, cnf *domain.Confirmation) (*domain.TokenRefreshResponse, error)
+	RenewAccessToken(ctx context.Context, refreshToken string, cnf *domain.Confirmation) (*domain.RenewAccessTokenResponse, error)
+	RevokeSession(ctx context.Context, id string) error
+	AuthenticateClient(ctx context.Context, clientId, clientSecret string) (*domain.OAuthClient, error)
+	IntrospectToken(ctx context.Context, rawToken string) *domain.IntrospectionResponse
+	ReviewToken(ctx context.Context, review *domain.TokenReview) (*domain.TokenReview, error)
+	CreatePersonalAccessToken(ctx context.Context, userId int64, username string, req *domain.PersonalAccessTokenRequest) (*domain.PersonalAccessTokenResponse, error)
+	ListPersonalAccessTokens(ctx context.Context, username string) ([]domain.PersonalAccessTokenResponse, error)
+	DeletePersonalAccessToken(ctx context.Context, id, username string) error
+}
+
+// CredentialVerifier checks the username and password of the logins, the
+// users table or a directory. VerifyCredentials returns ErrUserNotFound
+// when it doesn't know the user, so the next verifier is tried.
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, login *domain.UserLogin) (*domain.User, error)
+}
+
+// OAuthServer is the authorization server, OpenID Connect, Google and SAML
+// endpoints, their protocols are defined over http (redirects, forms and
+// pages) so they stay as handlers.
+type OAuthServer interface {
 	GetAuthCallbackOAuth2(w http.ResponseWriter, r *http.Request)
 	LogoutOAuth2(w http.ResponseWriter, r *http.Request)
 	GetAuthOAuth2(w http.ResponseWriter, r *http.Request)
+	SamlMetadata(w http.ResponseWriter, r *http.Request)
+	SamlLogin(w http.ResponseWriter, r *http.Request)
+	SamlAcs(w http.ResponseWriter, r *http.Request)
+	RegisterClient(w http.ResponseWriter, r *http.Request)
+	LoginPage(w http.ResponseWriter, r *http.Request)
+	LoginBrowser(w http.ResponseWriter, r *http.Request)
+	Authorize(w http.ResponseWriter, r *http.Request)
+	AuthorizeConsent(w http.ResponseWriter, r *http.Request)
+	Token(w http.ResponseWriter, r *http.Request)
+	OpenIdConfiguration(w http.ResponseWriter, r *http.Request)
+	Jwks(w http.ResponseWriter, r *http.Request)
+	UserInfo(w http.ResponseWriter, r *http.Request)
+	EndSession(w http.ResponseWriter, r *http.Request)
+	Introspect(w http.ResponseWriter, r *http.Request)
+	Revoke(w http.ResponseWriter, r *http.Request)
+	DeviceAuthorization(w http.ResponseWriter, r *http.Request)
+	DevicePage(w http.ResponseWriter, r *http.Request)
+	DeviceConsent(w http.ResponseWriter, r *http.Request)
 }
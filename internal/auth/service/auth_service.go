@@ -2,18 +2,24 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
-	"strconv"
+	"net/mail"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/sessions"
 	"github.com/markbates/goth/gothic"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
 	"github.com/rafaeldepontes/fauthless-go/internal/cache"
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/ldap"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/saml"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
 	"github.com/rafaeldepontes/fauthless-go/internal/token"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
 	log "github.com/sirupsen/logrus"
@@ -29,176 +35,213 @@ type authService struct {
 	jwtMaker          *token.JwtBuilder
 	userRepository    user.Repository
 	sessionRepository auth.Repository
+	oauthRepository   auth.OAuthRepository
+	patRepository     auth.PersonalAccessTokenRepository
+	browserStore      *sessions.CookieStore
+	keySet            *token.KeySet
+	audit             audit.Recorder
+	credentials       []auth.CredentialVerifier
+	samlProvider      *saml.ServiceProvider
 	Logger            *log.Logger
 	Cache             *cache.Caches
+
+	tokenDuration     time.Duration
+	issuerUrl         string
+	authModes         []string
+	passwordMinLength int
 }
 
 // NewAuthService initialize a new AuthService containing a UserRepository for
-// login and register operations ONLY.
-func NewAuthService(userRepo user.Repository, sessionRepo auth.Repository, logg *log.Logger, secretKey string, cache *cache.Caches) auth.Service {
+// login and register operations ONLY, the PersonalAccessTokenRepository
+// keeps the personal access tokens.
+func NewAuthService(userRepo user.Repository, sessionRepo auth.Repository, oauthRepo auth.OAuthRepository, patRepo auth.PersonalAccessTokenRepository, logg *log.Logger, config *configs.Configuration, keySet *token.KeySet, recorder audit.Recorder, cache *cache.Caches) auth.Service {
+	return newAuthService(userRepo, sessionRepo, oauthRepo, patRepo, logg, config, keySet, recorder, cache)
+}
+
+// NewOAuthServer initialize the handlers of the authorization server and
+// OpenID Connect flows, the OAuthRepository keeps the clients and codes,
+// the KeySet signs the ID tokens and the Recorder keeps the audit trail of
+// the impersonations. samlProvider is nil when the SAML login is disabled.
+func NewOAuthServer(userRepo user.Repository, sessionRepo auth.Repository, oauthRepo auth.OAuthRepository, patRepo auth.PersonalAccessTokenRepository, logg *log.Logger, config *configs.Configuration, keySet *token.KeySet, recorder audit.Recorder, cache *cache.Caches, samlProvider *saml.ServiceProvider) auth.OAuthServer {
+	s := newAuthService(userRepo, sessionRepo, oauthRepo, patRepo, logg, config, keySet, recorder, cache)
+	s.samlProvider = samlProvider
+	return s
+}
+
+func newAuthService(userRepo user.Repository, sessionRepo auth.Repository, oauthRepo auth.OAuthRepository, patRepo auth.PersonalAccessTokenRepository, logg *log.Logger, config *configs.Configuration, keySet *token.KeySet, recorder audit.Recorder, cache *cache.Caches) *authService {
 	return &authService{
 		userRepository:    userRepo,
 		sessionRepository: sessionRepo,
+		oauthRepository:   oauthRepo,
+		patRepository:     patRepo,
+		browserStore:      auth.NewBrowserStore(config.JwtSecretKey),
 		Logger:            logg,
-		jwtMaker:          token.NewJwtBuilder(secretKey),
+		jwtMaker:          newJwtBuilder(config, keySet),
+		keySet:            keySet,
+		audit:             recorder,
+		credentials:       newCredentialVerifiers(config, userRepo),
 		Cache:             cache,
+		tokenDuration:     config.TokenDuration,
+		issuerUrl:         config.IssuerUrl,
+		authModes:         config.AuthModes,
+		passwordMinLength: config.PasswordMinLength,
+	}
+}
+
+// newJwtBuilder signs the access tokens with the KeySet when
+// ACCESS_TOKEN_ALG is RS256, so the other services can verify them with
+// the jwks_uri.
+func newJwtBuilder(config *configs.Configuration, keySet *token.KeySet) *token.JwtBuilder {
+	builder := token.NewJwtBuilder(config.JwtSecretKey, config.Issuer)
+	if config.AccessTokenAlg == token.SigningAlg && keySet != nil {
+		return builder.WithKeySet(keySet)
 	}
+	return builder
 }
 
 // Register is a generic register system that can be use in any case,
 // it doesnt returns nothing and only insert a new user into the database
 // after a bunch of validations.
-func (s *authService) Register(w http.ResponseWriter, r *http.Request) {
+func (s *authService) Register(ctx context.Context, user *domain.User) error {
 	s.Logger.Infoln("Registering a new user")
 
-	if r.Method != http.MethodPost {
-		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidMethod)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidMethod, r.URL.Path)
-		return
+	event := &audit.Event{Action: audit.ActionRegister}
+	if user.Username != nil {
+		event.Actor = *user.Username
 	}
 
-	var user domain.User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
+	if ok, err := isValidUser(ctx, user, s); !ok {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
-	}
-
-	if ok, err := isValidUser(&user, s); !ok {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
-		return
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return errorhandler.Invalid(err)
 	}
 
 	password := user.HashedPassword
 
-	var hashedPassword []byte
-	hashedPassword, err = bcrypt.GenerateFromPassword([]byte(*password), Cost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), Cost)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return err
 	}
 
 	*password = string(hashedPassword)
 
-	err = s.userRepository.RegisterUser(&user)
+	err = s.userRepository.RegisterUser(ctx, user)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return err
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	s.audit.Record(ctx, event)
 
 	s.Logger.Infoln("The user registered successfully.")
+	return nil
 }
 
 // LoginCookieBased uses the cookie authorization flow, creating a token that needs to be
 // in the request cookie.
-func (s *authService) LoginCookieBased(w http.ResponseWriter, r *http.Request) {
-	var user *domain.User = loginFlow(s, w, r)
-	if user == nil {
-		return
+func (s *authService) LoginCookieBased(ctx context.Context, credentials *domain.UserLogin) (*domain.CookieSession, error) {
+	if err := s.checkLoginMode(ctx, middleware.AuthMethodCookie); err != nil {
+		return nil, err
+	}
+
+	user, err := loginFlow(ctx, s, credentials)
+	if err != nil {
+		return nil, err
 	}
 
+	return s.startCookieSession(ctx, user)
+}
+
+// startCookieSession creates the session of the cookie based login for a user
+// already authenticated, by the password or by an identity provider.
+func (s *authService) startCookieSession(ctx context.Context, user *domain.User) (*domain.CookieSession, error) {
 	token := token.CookieBased{}
 
-	sessionToken := token.GenerateToken(Token_Length)
-	csrfToken := token.GenerateToken(Token_Length)
+	session := &domain.CookieSession{
+		SessionToken: token.GenerateToken(Token_Length),
+		CsrfToken:    token.GenerateToken(Token_Length),
+		ExpiresAt:    time.Now().Add(30 * time.Minute),
+	}
 
-	err := s.userRepository.SetUserToken(sessionToken, csrfToken, *user.Id)
+	err := s.userRepository.SetUserToken(ctx, session.SessionToken, session.CsrfToken, *user.Id)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Expires:  time.Now().Add(30 * time.Minute),
-		HttpOnly: true,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:    "csrf_token",
-		Value:   csrfToken,
-		Expires: time.Now().Add(30 * time.Minute),
-	})
-
-	durationInt, _ := strconv.Atoi(os.Getenv("TOKEN_DURATION"))
-	var duration time.Duration = time.Duration(durationInt)
-
 	userCache := s.Cache.UserCache
-	userCache.Set(sessionToken, *user.Username, time.Now().Add(duration*time.Minute))
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	userCache.Set(tenant.Key(ctx, session.SessionToken), *user.Username, time.Now().Add(s.accessTokenDuration(ctx)))
 
 	s.Logger.Infoln("The user logged in successfully.")
+	return session, nil
 }
 
 // LoginJwtBased uses the Jwt method to create a access token, with it
 // all the features are available until it expires.
-func (s *authService) LoginJwtBased(w http.ResponseWriter, r *http.Request) {
-	var user *domain.User = loginFlow(s, w, r)
-	if user == nil {
-		return
+func (s *authService) LoginJwtBased(ctx context.Context, credentials *domain.UserLogin, cnf *domain.Confirmation) (*domain.TokenResponse, error) {
+	if err := s.checkLoginMode(ctx, middleware.AuthMethodJwt); err != nil {
+		return nil, err
+	}
+
+	user, err := loginFlow(ctx, s, credentials)
+	if err != nil {
+		return nil, err
 	}
 
 	var maker *token.JwtBuilder = s.jwtMaker
 
-	durationInt, _ := strconv.Atoi(os.Getenv("TOKEN_DURATION"))
-	var duration time.Duration = time.Duration(durationInt)
-	token, _, err := maker.GenerateToken(*user.Id, *user.Username, duration*time.Minute)
+	duration := s.accessTokenDuration(ctx)
+	token, _, err := generateAccessToken(maker, tenant.IdFrom(ctx), *user.Id, *user.Username, "", cnf, duration)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
 	tokenCache := s.Cache.TokenCache
 	invalid := false
-	tokenCache.Set(token, invalid, time.Now().Add(duration*time.Minute))
-
-	userResponse := domain.TokenResponse{
-		Token: token,
-	}
+	tokenCache.Set(token, invalid, time.Now().Add(duration))
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(userResponse)
+	return &domain.TokenResponse{
+		Token:     token,
+		TokenType: tokenType(cnf),
+	}, nil
 }
 
 // LoginJwtRefreshBased uses the Jwt method to create a access token, with it
 // all the features are available until it expires, but it cames with a refresh
 // token that can be used in another call to gain access again until the refresh
 // one expires...
-func (s *authService) LoginJwtRefreshBased(w http.ResponseWriter, r *http.Request) {
-	var user *domain.User = loginFlow(s, w, r)
-	if user == nil {
-		return
+func (s *authService) LoginJwtRefreshBased(ctx context.Context, credentials *domain.UserLogin, cnf *domain.Confirmation) (*domain.TokenRefreshResponse, error) {
+	if err := s.checkLoginMode(ctx, middleware.AuthMethodJwt); err != nil {
+		return nil, err
+	}
+
+	user, err := loginFlow(ctx, s, credentials)
+	if err != nil {
+		return nil, err
 	}
 
+	return s.issueTokenRefresh(ctx, user, cnf)
+}
+
+// issueTokenRefresh creates the access and refresh tokens of a session for
+// a user already authenticated, by the password or by an identity provider.
+func (s *authService) issueTokenRefresh(ctx context.Context, user *domain.User, cnf *domain.Confirmation) (*domain.TokenRefreshResponse, error) {
 	var maker *token.JwtBuilder = s.jwtMaker
-	accessToken, accessClaims, err := generateAccessToken(maker, *user.Id, *user.Username, time.Minute)
+	refreshToken, refreshClaims, err := generateTokenRefresh(maker, tenant.IdFrom(ctx), *user.Id, *user.Username, cnf, s.refreshTokenDuration(ctx))
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	refreshToken, refreshClaims, err := generateTokenRefresh(maker, *user.Id, *user.Username, time.Hour)
+	accessToken, accessClaims, err := generateAccessToken(maker, tenant.IdFrom(ctx), *user.Id, *user.Username, refreshClaims.ID, cnf, s.accessTokenDuration(ctx))
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	sessionId, err := s.sessionRepository.CreateSession(&domain.Session{
+	sessionId, err := s.sessionRepository.CreateSession(ctx, &domain.Session{
 		Id:           refreshClaims.RegisteredClaims.ID,
 		Username:     *user.Username,
 		RefreshToken: refreshToken,
@@ -207,97 +250,99 @@ func (s *authService) LoginJwtRefreshBased(w http.ResponseWriter, r *http.Reques
 	})
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	trResponse := domain.TokenRefreshResponse{
+	return &domain.TokenRefreshResponse{
 		SessionId:             sessionId,
 		AccessToken:           accessToken,
 		RefreshToken:          refreshToken,
 		AccessTokenExpiresAt:  accessClaims.ExpiresAt.Time,
 		RefreshTokenExpiresAt: refreshClaims.ExpiresAt.Time,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(trResponse)
+		TokenType:             tokenType(cnf),
+	}, nil
 }
 
-// RenewAccessToken accepts a json body for the request, in it should have the
-// refresh token available at the login call. After called and with a proper token
-// it gives another access token for futher uses.
-func (s *authService) RenewAccessToken(w http.ResponseWriter, r *http.Request) {
+// RenewAccessToken gives another access token for futher uses when the
+// refresh token of the login is still valid. A bound refresh token needs
+// the same confirmation it was issued with, and the organization of the
+// request has to be the one that issued it. The user must still exist and
+// be unlocked.
+func (s *authService) RenewAccessToken(ctx context.Context, refreshToken string, cnf *domain.Confirmation) (*domain.RenewAccessTokenResponse, error) {
 	var maker *token.JwtBuilder = s.jwtMaker
 
-	var req domain.RenewAccessTokenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	refreshClaims, err := s.jwtMaker.VerifyToken(refreshToken)
+	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, errorhandler.Invalid(err)
 	}
 
-	refreshClaims, err := s.jwtMaker.VerifyToken(req.RefreshToken)
-	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
-		return
+	if !tenant.Matches(ctx, refreshClaims.TenantId) {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrWrongOrganization)
+		return nil, errorhandler.Invalid(errorhandler.ErrWrongOrganization)
 	}
 
 	var session *domain.Session
-	session, err = s.sessionRepository.FindSessionById(refreshClaims.ID)
+	session, err = s.sessionRepository.FindSessionById(ctx, refreshClaims.ID)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidToken, r.URL.Path)
-		return
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidToken)
 	}
 
 	if session.IsRevoked {
 		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrTokenRevoked)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrTokenRevoked, r.URL.Path)
-		return
+		return nil, errorhandler.Invalid(errorhandler.ErrTokenRevoked)
 	}
 
 	if session.Username != refreshClaims.Username {
 		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrTokenRevoked)
-		errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrTokenRevoked)
-		return
+		return nil, errorhandler.Forbidden(errorhandler.ErrTokenRevoked)
+	}
+
+	if err := s.activeUser(ctx, refreshClaims.Username); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		if errors.Is(err, errorhandler.ErrUserNotFound) || errors.Is(err, errorhandler.ErrUserLocked) {
+			return nil, errorhandler.Forbidden(err)
+		}
+		return nil, err
 	}
 
-	accessToken, accessClaims, err := generateAccessToken(maker, refreshClaims.Id, refreshClaims.Username, time.Minute)
+	// A bound refresh token can only be used with a proof of the same key.
+	if refreshClaims.Cnf != nil && (cnf == nil || *cnf != *refreshClaims.Cnf) {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidDPoPProof)
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidDPoPProof)
+	}
+
+	accessToken, accessClaims, err := generateAccessToken(maker, refreshClaims.TenantId, refreshClaims.Id, refreshClaims.Username, session.Id, cnf, s.accessTokenDuration(ctx))
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	tkResponse := &domain.RenewAccessTokenResponse{
+	return &domain.RenewAccessTokenResponse{
 		AccessToken:          accessToken,
 		AccessTokenExpiresAt: accessClaims.ExpiresAt.Time,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(tkResponse)
+		TokenType:            tokenType(cnf),
+	}, nil
 }
 
 // RevokeSession disable a refresh token, preventing futher requests.
-func (s *authService) RevokeSession(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+func (s *authService) RevokeSession(ctx context.Context, id string) error {
 	if id == "" {
 		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrIdIsRequired)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrIdIsRequired, r.URL.Path)
-		return
+		return errorhandler.Invalid(errorhandler.ErrIdIsRequired)
 	}
 
-	err := s.sessionRepository.RevokeSession(id)
+	event := middleware.AuditEvent(ctx, audit.ActionSessionRevoked, id)
+	err := s.sessionRepository.RevokeSession(ctx, id)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrSessionNotFound, r.URL.Path)
-		return
+		s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrSessionNotFound))
+		return errorhandler.Invalid(errorhandler.ErrSessionNotFound)
 	}
+	s.audit.Record(ctx, event)
 
-	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 func (s *authService) GetAuthCallbackOAuth2(w http.ResponseWriter, r *http.Request) {
@@ -328,7 +373,7 @@ func (s *authService) GetAuthOAuth2(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func isValidUser(newUser *domain.User, s *authService) (bool, error) {
+func isValidUser(ctx context.Context, newUser *domain.User, s *authService) (bool, error) {
 	if username := newUser.Username; *username == "" {
 		return false, errorhandler.ErrUsernameIsRequired
 	}
@@ -341,7 +386,17 @@ func isValidUser(newUser *domain.User, s *authService) (bool, error) {
 		return false, errorhandler.ErrAgeIsRequired
 	}
 
-	user, err := s.userRepository.FindUserByUsername(*newUser.Username)
+	if len(*newUser.HashedPassword) < tenant.PasswordMinLength(ctx, s.passwordMinLength) {
+		return false, errorhandler.ErrPasswordTooShort
+	}
+
+	if email := newUser.Email; email != nil {
+		if _, err := mail.ParseAddress(*email); err != nil {
+			return false, errorhandler.ErrInvalidEmail
+		}
+	}
+
+	user, err := s.userRepository.FindUserByUsername(ctx, *newUser.Username)
 	if user != nil {
 		s.Logger.Errorf("An error occurred: %v\n", err)
 		return false, errorhandler.ErrUserAlreadyExists
@@ -350,58 +405,158 @@ func isValidUser(newUser *domain.User, s *authService) (bool, error) {
 	return true, nil
 }
 
-func loginFlow(s *authService, w http.ResponseWriter, r *http.Request) *domain.User {
+func loginFlow(ctx context.Context, s *authService, credentials *domain.UserLogin) (*domain.User, error) {
 	s.Logger.Infoln("Trying to login user")
 
-	if r.Method != http.MethodPost {
-		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidMethod)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidMethod, r.URL.Path)
-		return nil
+	userInTheDatabase, err := verifyCredentials(ctx, s, credentials)
+	if errors.Is(err, errorhandler.ErrDirectoryUnavailable) {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
 	}
-
-	var user domain.UserLogin
-	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return nil
+		return nil, errorhandler.Invalid(err)
 	}
 
-	var userInTheDatabase *domain.User
-	userInTheDatabase, err = s.userRepository.FindUserByUsername(user.Username)
+	s.Logger.Infoln("Valid user, following the next steps...")
+	return userInTheDatabase, nil
+}
+
+// activeUser checks the user of a refresh token can still get access
+// tokens, it may have been deleted or locked since the login.
+func (s *authService) activeUser(ctx context.Context, username string) error {
+	u, err := s.userRepository.FindUserByUsername(ctx, username)
 	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrUserNotFound)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrUserNotFound, r.URL.Path)
-		return nil
+		return err
+	}
+	if u.Locked {
+		return errorhandler.ErrUserLocked
+	}
+	return nil
+}
+
+// newCredentialVerifiers returns the verifiers of the logins, the directory
+// comes first when LDAP_URL is set. It's only the one of the default
+// organization, the others use the users table.
+func newCredentialVerifiers(config *configs.Configuration, userRepo user.Repository) []auth.CredentialVerifier {
+	verifiers := []auth.CredentialVerifier{}
+	if config.LdapUrl != "" {
+		verifiers = append(verifiers, ldap.NewVerifier(config, userRepo, ldap.DialUrl(config)))
+	}
+	return append(verifiers, &databaseVerifier{userRepository: userRepo})
+}
+
+// verifyCredentials tries the verifiers in order, returns the user when the
+// username and password match or the error that should be shown. Every
+// attempt is recorded as a user.login event.
+func verifyCredentials(ctx context.Context, s *authService, login *domain.UserLogin) (*domain.User, error) {
+	event := &audit.Event{Action: audit.ActionLogin, Actor: login.Username}
+	for _, verifier := range s.credentials {
+		user, err := verifier.VerifyCredentials(ctx, login)
+		if errors.Is(err, errorhandler.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			event = audit.Failure(event, err)
+		}
+		s.audit.Record(ctx, event)
+		return user, err
+	}
+	s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrUserNotFound))
+	return nil, errorhandler.ErrUserNotFound
+}
+
+type databaseVerifier struct {
+	userRepository user.Repository
+}
+
+// VerifyCredentials checks the username and password against the users
+// table.
+func (v *databaseVerifier) VerifyCredentials(ctx context.Context, login *domain.UserLogin) (*domain.User, error) {
+	userInTheDatabase, err := v.userRepository.FindUserByUsername(ctx, login.Username)
+	if err != nil {
+		return nil, errorhandler.ErrUserNotFound
 	}
 
 	password := *userInTheDatabase.HashedPassword
-	err = bcrypt.CompareHashAndPassword([]byte(password), []byte(user.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(password), []byte(login.Password))
 	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidUsernameOrPassword)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidUsernameOrPassword, r.URL.Path)
-		return nil
+		return nil, errorhandler.ErrInvalidUsernameOrPassword
 	}
 
-	s.Logger.Infoln("Valid user, following the next steps...")
-	return userInTheDatabase
-}
+	if userInTheDatabase.Locked {
+		return nil, errorhandler.ErrUserLocked
+	}
 
-func generateTokenRefresh(maker *token.JwtBuilder, id int64, username string, timer time.Duration) (string, *token.UserClaims, error) {
-	return generateToken(maker, id, username, 24, timer)
+	return userInTheDatabase, nil
 }
 
-func generateAccessToken(maker *token.JwtBuilder, id int64, username string, timer time.Duration) (string, *token.UserClaims, error) {
-	durationInt, _ := strconv.Atoi(os.Getenv("TOKEN_DURATION"))
-	var duration time.Duration = time.Duration(durationInt)
-	return generateToken(maker, id, username, duration, timer)
+// generateTokenRefresh creates the refresh token of a session of the
+// organization tenantId, bound to the key of the client with a DPoP
+// confirmation.
+func generateTokenRefresh(maker *token.JwtBuilder, tenantId, id int64, username string, cnf *domain.Confirmation, duration time.Duration) (string, *token.UserClaims, error) {
+	userClaims, err := maker.NewUserClaims(id, username, duration)
+	if err != nil {
+		return "", nil, err
+	}
+	userClaims.TenantId = tenantId
+	userClaims.Cnf = cnf
+
+	refreshToken, err := maker.SignClaims(userClaims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, userClaims, nil
 }
 
-func generateToken(maker *token.JwtBuilder, id int64, username string, timer time.Duration, duration time.Duration) (string, *token.UserClaims, error) {
-	token, userClaims, err := maker.GenerateToken(id, username, duration*timer)
+// generateAccessToken creates an access token tied to the session of the
+// refresh token, so revoking the session also deactivates it. With a DPoP
+// confirmation the token is bound to the key of the client.
+func generateAccessToken(maker *token.JwtBuilder, tenantId, id int64, username, sessionId string, cnf *domain.Confirmation, duration time.Duration) (string, *token.UserClaims, error) {
+	userClaims, err := maker.NewUserClaims(id, username, duration)
 	if err != nil {
 		return "", nil, err
 	}
+	userClaims.TenantId = tenantId
+	userClaims.SessionId = sessionId
+	userClaims.Cnf = cnf
 
-	return token, userClaims, nil
+	accessToken, err := maker.SignAccessClaims(userClaims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return accessToken, userClaims, nil
+}
+
+// accessTokenDuration is TOKEN_DURATION unless the organization of the
+// context has its own.
+func (s *authService) accessTokenDuration(ctx context.Context) time.Duration {
+	return tenant.AccessTokenDuration(ctx, s.tokenDuration)
+}
+
+// refreshTokenDuration is RefreshTokenDuration unless the organization of
+// the context has its own.
+func (s *authService) refreshTokenDuration(ctx context.Context) time.Duration {
+	return tenant.RefreshTokenDuration(ctx, RefreshTokenDuration)
+}
+
+// checkLoginMode forbids the logins with a mode the organization of the
+// context doesn't allow.
+func (s *authService) checkLoginMode(ctx context.Context, modes ...string) error {
+	for _, mode := range modes {
+		if tenant.AllowsMode(ctx, mode) {
+			return nil
+		}
+	}
+	s.Logger.Errorf("An error occurred: %v", errorhandler.ErrLoginModeNotAllowed)
+	return errorhandler.Forbidden(errorhandler.ErrLoginModeNotAllowed)
+}
+
+func tokenType(cnf *domain.Confirmation) string {
+	if cnf == nil || cnf.JwkThumbprint == "" {
+		return ""
+	}
+	return token.DPoPScheme
 }
@@ -2,16 +2,23 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
 	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/server"
 	"github.com/rafaeldepontes/fauthless-go/internal/cache"
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -37,7 +44,7 @@ func newMockUserRepo() *userRepoMock {
 	return &userRepoMock{users: make(map[string]*domain.User)}
 }
 
-func (mock *userRepoMock) FindUserByUsername(username string) (*domain.User, error) {
+func (mock *userRepoMock) FindUserByUsername(ctx context.Context, username string) (*domain.User, error) {
 	user, ok := mock.users[username]
 	if !ok {
 		return nil, errorhandler.ErrUserNotFound
@@ -46,33 +53,66 @@ func (mock *userRepoMock) FindUserByUsername(username string) (*domain.User, err
 	return user, nil
 }
 
-func (mock *userRepoMock) RegisterUser(u *domain.User) error {
+func (mock *userRepoMock) RegisterUser(ctx context.Context, u *domain.User) error {
 	if _, ok := mock.users[*u.Username]; ok {
 		return errorhandler.ErrUserAlreadyExists
 	}
+	if u.Id == nil {
+		u.Id = ptrInt64(int64(len(mock.users) + 1))
+	}
 	mock.users[*u.Username] = u
 	return nil
 }
 
-func (mock *userRepoMock) SetUserToken(token, csrfToken string, userId int64) error {
+func (mock *userRepoMock) SetUserToken(ctx context.Context, token, csrfToken string, userId int64) error {
 	mock.lastSessionToken = token
 	mock.lastCSRFToken = csrfToken
 	return nil
 }
 
-func (mock *userRepoMock) UpdateUserDetails(user *domain.User) error { return nil }
+func (mock *userRepoMock) UpdateUserDetails(ctx context.Context, user *domain.User) error { return nil }
+
+func (mock *userRepoMock) DeleteAccount(ctx context.Context, username string) error { return nil }
+
+func (mock *userRepoMock) LockUser(ctx context.Context, username string, locked bool) error {
+	return nil
+}
 
-func (mock *userRepoMock) DeleteAccount(username string) error { return nil }
+func (mock *userRepoMock) UpdatePassword(ctx context.Context, username, hashedPassword string) error {
+	return nil
+}
+
+func (mock *userRepoMock) UpdateRoles(ctx context.Context, username string, roles []string) error {
+	user, ok := mock.users[username]
+	if !ok {
+		return errorhandler.ErrUserNotFound
+	}
+	user.Roles = roles
+	return nil
+}
 
-func (mock *userRepoMock) FindAllUsersCursor(cursor int64, size int) ([]domain.User, int64, error) {
+func (mock *userRepoMock) FindAllUsersCursor(ctx context.Context, cursor int64, size int) ([]domain.User, int64, error) {
 	return nil, 0, nil
 }
 
-func (mock *userRepoMock) FindAllUsers(size, page int) ([]domain.User, int, error) {
+func (mock *userRepoMock) FindAllUsers(ctx context.Context, size, page int) ([]domain.User, int, error) {
 	return nil, 0, nil
 }
 
-func (mock *userRepoMock) FindUserById(id int64) (*domain.User, error) { return nil, nil }
+func (mock *userRepoMock) FindUserById(ctx context.Context, id int64) (*domain.User, error) {
+	for _, user := range mock.users {
+		if user.Id != nil && *user.Id == id {
+			return user, nil
+		}
+	}
+	return nil, errorhandler.ErrUserNotFound
+}
+
+func (mock *userRepoMock) FindUsers(ctx context.Context, offset, limit int) ([]domain.User, int, error) {
+	return nil, 0, nil
+}
+
+func (mock *userRepoMock) UpdateUser(ctx context.Context, u *domain.User) error { return nil }
 
 type mockSessionRepo struct {
 	sessions map[string]*domain.Session
@@ -82,20 +122,20 @@ func newMockSessionRepo() *mockSessionRepo {
 	return &mockSessionRepo{sessions: map[string]*domain.Session{}}
 }
 
-func (mock *mockSessionRepo) CreateSession(s *domain.Session) (string, error) {
+func (mock *mockSessionRepo) CreateSession(ctx context.Context, s *domain.Session) (string, error) {
 	id := s.Id
 	mock.sessions[id] = s
 	return id, nil
 }
 
-func (mock *mockSessionRepo) FindSessionById(id string) (*domain.Session, error) {
+func (mock *mockSessionRepo) FindSessionById(ctx context.Context, id string) (*domain.Session, error) {
 	if s, ok := mock.sessions[id]; ok {
 		return s, nil
 	}
 	return nil, errorhandler.ErrSessionNotFound
 }
 
-func (mock *mockSessionRepo) RevokeSession(id string) error {
+func (mock *mockSessionRepo) RevokeSession(ctx context.Context, id string) error {
 	if s, ok := mock.sessions[id]; ok {
 		s.IsRevoked = true
 		return nil
@@ -103,17 +143,45 @@ func (mock *mockSessionRepo) RevokeSession(id string) error {
 	return errorhandler.ErrSessionNotFound
 }
 
-func (mock *mockSessionRepo) DeleteSession(id string) error { return nil }
+func (mock *mockSessionRepo) RevokeUserSessions(ctx context.Context, username string) (int64, error) {
+	var revoked int64
+	for _, s := range mock.sessions {
+		if s.Username == username && !s.IsRevoked {
+			s.IsRevoked = true
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (mock *mockSessionRepo) DeleteSession(ctx context.Context, id string) error { return nil }
 
 func prepareMocks() (auth.Service, *userRepoMock, *mockSessionRepo, *cache.Caches) {
 	// given
 	userRepo := newMockUserRepo()
 	sessRepo := newMockSessionRepo()
 	logg := logrus.New()
-	secretKey := "secret-key"
 	cache := cache.NewCacheStorage()
+	signingKey, _ := token.GenerateSigningKey()
 
-	return NewAuthService(userRepo, sessRepo, logg, secretKey, cache), userRepo, sessRepo, cache
+	return NewAuthService(userRepo, sessRepo, newMockOAuthRepo(), newMockPatRepo(), logg, configMock(), token.NewKeySet(signingKey), audit.NewLogRecorder(logg), cache), userRepo, sessRepo, cache
+}
+
+// controllerMock returns the http transport of the service, the endpoints
+// are tested through it like the requests reach them.
+func controllerMock(service auth.Service) auth.Controller {
+	s := service.(*authService)
+	var oauthServer auth.OAuthServer = s
+	m := middleware.NewMiddleware(configMock(), s.userRepository, s.audit, s.Cache)
+	return server.NewAuthController(&service, &oauthServer, m)
+}
+
+func configMock() *configs.Configuration {
+	return &configs.Configuration{
+		JwtSecretKey:  "secret-key",
+		Issuer:        "golang",
+		TokenDuration: 15 * time.Minute,
+	}
 }
 
 func loginFlowMock(userRepo *userRepoMock) (*httptest.ResponseRecorder, *http.Request) {
@@ -132,7 +200,7 @@ func loginFlowMock(userRepo *userRepoMock) (*httptest.ResponseRecorder, *http.Re
 		HashedPassword: ptrString(string(hashed)),
 		Age:            ptrInt(28),
 	}
-	userRepo.RegisterUser(u)
+	userRepo.RegisterUser(context.Background(), u)
 
 	return w, r
 }
@@ -226,7 +294,7 @@ func TestIsValidUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ok, err := isValidUser(tt.input, auth)
+			ok, err := isValidUser(context.Background(), tt.input, auth)
 			if ok != tt.wantOk {
 				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
 			}
@@ -255,7 +323,7 @@ func TestRegister_Success(t *testing.T) {
 	var w *httptest.ResponseRecorder = httptest.NewRecorder()
 
 	// when
-	auth.Register(w, r)
+	controllerMock(auth).RegisterEp(w, r)
 
 	// then
 	resp := w.Result()
@@ -264,7 +332,7 @@ func TestRegister_Success(t *testing.T) {
 		t.Fatalf("expected status code 201, but it was %v", resp.StatusCode)
 	}
 
-	if _, err := userRepo.FindUserByUsername(usernameMockTest); err != nil {
+	if _, err := userRepo.FindUserByUsername(context.Background(), usernameMockTest); err != nil {
 		t.Fatalf("expected user to be saved, err: %v", err)
 	}
 }
@@ -277,7 +345,7 @@ func TestLoginCookieBased_Success(t *testing.T) {
 	w, r := loginFlowMock(userRepo)
 
 	//when
-	auth.LoginCookieBased(w, r)
+	controllerMock(auth).LoginCookieBasedEp(w, r)
 	resp := w.Result()
 
 	//then
@@ -302,7 +370,7 @@ func TestLoginJwtBased_Success(t *testing.T) {
 	w, r := loginFlowMock(userRepo)
 
 	// when
-	auth.LoginJwtBased(w, r)
+	controllerMock(auth).LoginJwtBasedEp(w, r)
 	resp := w.Result()
 
 	var tr domain.TokenResponse
@@ -321,6 +389,62 @@ func TestLoginJwtBased_Success(t *testing.T) {
 	}
 }
 
+// TestLoginJwtBased_LockedUser verifies a user locked through the cli
+// can't log in, even with the right password.
+func TestLoginJwtBased_LockedUser(t *testing.T) {
+	// given
+	auth, userRepo, _, _ := prepareMocks()
+	w, r := loginFlowMock(userRepo)
+	userRepo.users[usernameMockTest].Locked = true
+
+	// when
+	controllerMock(auth).LoginJwtBasedEp(w, r)
+	resp := w.Result()
+
+	// then
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request, got %d", resp.StatusCode)
+	}
+}
+
+// TestLoginAudit verifies every login is recorded with the client of the
+// request, the failed ones with why they failed.
+func TestLoginAudit(t *testing.T) {
+	// given
+	auth, userRepo, _, _ := prepareMocks()
+	recorder := &recorderMock{}
+	auth.(*authService).audit = recorder
+	loginFlowMock(userRepo)
+	ctx := audit.WithClient(context.Background(), &audit.Client{Ip: "203.0.113.7", UserAgent: "curl/8.0"})
+
+	// when
+	_, wrongErr := auth.LoginJwtBased(ctx, &domain.UserLogin{Username: usernameMockTest, Password: "wrong"}, nil)
+	_, unknownErr := auth.LoginJwtBased(ctx, &domain.UserLogin{Username: usernameMockBob, Password: hashedPasswordMock}, nil)
+	_, err := auth.LoginJwtBased(ctx, &domain.UserLogin{Username: usernameMockTest, Password: hashedPasswordMock}, nil)
+
+	// then
+	if wrongErr == nil || unknownErr == nil || err != nil {
+		t.Fatalf("unexpected login results: %v, %v, %v", wrongErr, unknownErr, err)
+	}
+
+	if len(recorder.events) != 3 {
+		t.Fatalf("expected the three logins recorded, got %d", len(recorder.events))
+	}
+
+	wrong, unknown, success := recorder.events[0], recorder.events[1], recorder.events[2]
+	if wrong.Action != audit.ActionLogin || wrong.Outcome != audit.OutcomeFailure || wrong.Actor != usernameMockTest || wrong.Reason != errorhandler.ErrInvalidUsernameOrPassword.Error() {
+		t.Fatalf("expected the wrong password recorded as a failure, got %+v", wrong)
+	}
+
+	if unknown.Outcome != audit.OutcomeFailure || unknown.Actor != usernameMockBob {
+		t.Fatalf("expected the unknown user recorded as a failure, got %+v", unknown)
+	}
+
+	if success.Outcome == audit.OutcomeFailure || success.Actor != usernameMockTest {
+		t.Fatalf("expected the login recorded, got %+v", success)
+	}
+}
+
 // TestLoginJwtBased_Success verifies LoginJwtRefreshBased and expects a
 // success when log in and a access token, a refresh token, the time both
 // will expire and the session id in the request body.
@@ -330,7 +454,7 @@ func TestLoginJwtRefreshBased_Success(t *testing.T) {
 	w, r := loginFlowMock(userRepo)
 
 	// when
-	auth.LoginJwtRefreshBased(w, r)
+	controllerMock(auth).LoginJwtRefreshBasedEp(w, r)
 	resp := w.Result()
 
 	var tr domain.TokenRefreshResponse
@@ -352,7 +476,7 @@ func TestLoginJwtRefreshBased_Success(t *testing.T) {
 		t.Fatalf("expected refresh token in response")
 	}
 
-	if _, err := sessionRepo.FindSessionById(tr.SessionId); err != nil {
+	if _, err := sessionRepo.FindSessionById(context.Background(), tr.SessionId); err != nil {
 		t.Fatalf("Got an error trying to get the session by its id: %v", err)
 	}
 }
@@ -366,7 +490,7 @@ func TestRenewAccessToken_Success(t *testing.T) {
 	auth, userRepo, _, _ := prepareMocks()
 
 	w, r := loginFlowMock(userRepo)
-	auth.LoginJwtRefreshBased(w, r)
+	controllerMock(auth).LoginJwtRefreshBasedEp(w, r)
 	resp := w.Result()
 
 	var tr domain.TokenRefreshResponse
@@ -384,7 +508,7 @@ func TestRenewAccessToken_Success(t *testing.T) {
 	var rr *httptest.ResponseRecorder = httptest.NewRecorder()
 
 	// when
-	auth.RenewAccessToken(rr, req)
+	controllerMock(auth).RenewAccessTokenEp(rr, req)
 	resp = rr.Result()
 
 	var ratr domain.RenewAccessTokenResponse
@@ -406,3 +530,31 @@ func TestRenewAccessToken_Success(t *testing.T) {
 		t.Fatal("expected new expire date for the access token in response")
 	}
 }
+
+// TestRenewAccessToken_InactiveUser verifies the refresh token of a user
+// locked or deleted since the login doesn't give access tokens anymore.
+func TestRenewAccessToken_InactiveUser(t *testing.T) {
+	// given
+	auth, userRepo, _, _ := prepareMocks()
+	w, r := loginFlowMock(userRepo)
+	controllerMock(auth).LoginJwtRefreshBasedEp(w, r)
+
+	var tr domain.TokenRefreshResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&tr); err != nil {
+		t.Fatalf("failed decoding token response: %v", err)
+	}
+
+	// when
+	userRepo.users[usernameMockTest].Locked = true
+	_, lockedErr := auth.RenewAccessToken(context.Background(), tr.RefreshToken, nil)
+	delete(userRepo.users, usernameMockTest)
+	_, deletedErr := auth.RenewAccessToken(context.Background(), tr.RefreshToken, nil)
+
+	// then
+	if !errors.Is(lockedErr, errorhandler.ErrUserLocked) || errorhandler.KindOf(lockedErr) != errorhandler.KindForbidden {
+		t.Errorf("expected the locked user to be forbidden, got %v", lockedErr)
+	}
+	if !errors.Is(deletedErr, errorhandler.ErrUserNotFound) || errorhandler.KindOf(deletedErr) != errorhandler.KindForbidden {
+		t.Errorf("expected the deleted user to be forbidden, got %v", deletedErr)
+	}
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"google.golang.org/grpc/codes"
+)
+
+type mockPatRepo struct {
+	pats map[string]*domain.PersonalAccessToken
+}
+
+func newMockPatRepo() *mockPatRepo {
+	return &mockPatRepo{pats: map[string]*domain.PersonalAccessToken{}}
+}
+
+func (mock *mockPatRepo) CreatePersonalAccessToken(ctx context.Context, pat *domain.PersonalAccessToken) error {
+	pat.CreatedAt = time.Now()
+	mock.pats[pat.TokenHash] = pat
+	return nil
+}
+
+func (mock *mockPatRepo) FindPersonalAccessToken(ctx context.Context, tokenHash string) (*domain.PersonalAccessToken, error) {
+	if pat, ok := mock.pats[tokenHash]; ok {
+		return pat, nil
+	}
+	return nil, errorhandler.ErrTokenNotFound
+}
+
+func (mock *mockPatRepo) FindPersonalAccessTokensByUsername(ctx context.Context, username string) ([]domain.PersonalAccessToken, error) {
+	var pats []domain.PersonalAccessToken
+	for _, pat := range mock.pats {
+		if pat.Username == username {
+			pats = append(pats, *pat)
+		}
+	}
+	return pats, nil
+}
+
+func (mock *mockPatRepo) TouchPersonalAccessToken(ctx context.Context, id string) error {
+	now := time.Now()
+	for _, pat := range mock.pats {
+		if pat.Id == id {
+			pat.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (mock *mockPatRepo) DeletePersonalAccessToken(ctx context.Context, id, username string) error {
+	for hash, pat := range mock.pats {
+		if pat.Id == id && pat.Username == username {
+			delete(mock.pats, hash)
+			return nil
+		}
+	}
+	return errorhandler.ErrTokenNotFound
+}
+
+// TestAuthenticate verifies the chain accepts the credentials of every mode
+// and records which one authenticated the request.
+func TestAuthenticate(t *testing.T) {
+	// given
+	s, _, browserCookies := prepareAuthorizationServer(t)
+	userRepo := s.userRepository.(*userRepoMock)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(1), Username: ptrString(usernameMockTest)})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	chain := m.Authenticate(
+		m.CookieAuthenticator(),
+		m.BearerAuthenticator(),
+		m.PersonalAccessTokenAuthenticator(s.patRepository),
+		m.OAuthSessionAuthenticator(auth.NewBrowserStore("secret-key")),
+	)
+
+	var method string
+	protected := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, _ = middleware.AuthMethodFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	claims, _ := token.NewUserClaims(1, usernameMockTest, "golang", time.Minute)
+	accessToken, _ := s.jwtMaker.SignClaims(claims)
+
+	// the personal access token is created with the access token
+	createPat := m.Authenticate(m.BearerAuthenticator())(http.HandlerFunc(controllerMock(s).CreatePersonalAccessTokenEp))
+	pw := httptest.NewRecorder()
+	pr := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", bytes.NewBufferString(`{"name":"ci"}`))
+	pr.Header.Set("Authorization", "Bearer "+accessToken)
+	createPat.ServeHTTP(pw, pr)
+
+	var pat domain.PersonalAccessTokenResponse
+	json.NewDecoder(pw.Result().Body).Decode(&pat)
+	if pw.Result().StatusCode != http.StatusCreated || !token.IsPersonalAccessToken(pat.Token) {
+		t.Fatalf("expected a personal access token, got %d %+v", pw.Result().StatusCode, pat)
+	}
+
+	sessionToken := "session-token"
+	s.Cache.UserCache.Set(sessionToken, usernameMockTest, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		cookies    []*http.Cookie
+		want       int
+		wantMethod string
+	}{
+		{"no credentials", http.MethodGet, "", nil, http.StatusUnauthorized, ""},
+		{"cookie", http.MethodGet, "", []*http.Cookie{{Name: "session_token", Value: sessionToken}}, http.StatusOK, middleware.AuthMethodCookie},
+		{"unknown cookie", http.MethodGet, "", []*http.Cookie{{Name: "session_token", Value: "unknown"}}, http.StatusUnauthorized, ""},
+		{"bearer jwt", http.MethodGet, "Bearer " + accessToken, nil, http.StatusOK, middleware.AuthMethodJwt},
+		{"personal access token", http.MethodGet, "Bearer " + pat.Token, nil, http.StatusOK, middleware.AuthMethodPersonalAccessToken},
+		{"unknown personal access token", http.MethodGet, "Bearer " + token.PersonalAccessTokenPrefix + "unknown", nil, http.StatusUnauthorized, ""},
+		{"oauth session", http.MethodGet, "", browserCookies, http.StatusOK, middleware.AuthMethodOAuthSession},
+		{"oauth session without csrf", http.MethodDelete, "", browserCookies, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method = ""
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "/api/v1/sessions", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			for _, cookie := range tt.cookies {
+				r.AddCookie(cookie)
+			}
+
+			// when
+			protected.ServeHTTP(w, r)
+
+			// then
+			if w.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Result().StatusCode)
+			}
+
+			if method != tt.wantMethod {
+				t.Fatalf("expected the method %q, got %q", tt.wantMethod, method)
+			}
+		})
+	}
+}
+
+// TestForwardAuth verifies the answers to the reverse proxies, the
+// identity headers, the 401 and the redirect of the browsers.
+func TestForwardAuth(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	s := service.(*authService)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(7), Username: ptrString(usernameMockTest), Roles: []string{domain.RoleAdmin, "billing"}})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	verify := m.ForwardAuth(m.CookieAuthenticator(), m.BearerAuthenticator())
+
+	claims, _ := token.NewUserClaims(7, usernameMockTest, "golang", time.Minute)
+	accessToken, _ := s.jwtMaker.SignClaims(claims)
+
+	sessionToken := "session-token"
+	s.Cache.UserCache.Set(sessionToken, usernameMockTest, time.Now().Add(time.Minute))
+
+	// when
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	verify.ServeHTTP(w, r)
+
+	// then
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Header().Get(middleware.AuthUserHeader) != usernameMockTest || w.Header().Get(middleware.AuthIdHeader) != "7" || w.Header().Get(middleware.AuthRolesHeader) != "admin,billing" {
+		t.Errorf("unexpected identity headers: %v", w.Header())
+	}
+
+	// when the original request changes something without the csrf token
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+	r.Header.Set(middleware.ForwardedMethodHeader, http.MethodPost)
+	r.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+	verify.ServeHTTP(w, r)
+
+	// then
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the csrf token, got %d", w.Code)
+	}
+
+	// when a browser isn't logged in
+	m.ForwardAuthLoginUrl = "https://auth.example.com/login"
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	r.Header.Set(middleware.ForwardedHostHeader, "app.example.com")
+	r.Header.Set(middleware.ForwardedUriHeader, "/reports?year=2024")
+	verify.ServeHTTP(w, r)
+
+	// then
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://auth.example.com/login?rd=https%3A%2F%2Fapp.example.com%2Freports%3Fyear%3D2024" {
+		t.Errorf("unexpected redirect: %v", location)
+	}
+}
+
+// TestForwardAuth_DPoP verifies the proofs of the DPoP bound tokens are
+// checked against the method and url of the original request.
+func TestForwardAuth_DPoP(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	s := service.(*authService)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(7), Username: ptrString(usernameMockTest)})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	verify := m.ForwardAuth(m.BearerAuthenticator())
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	point, _ := key.PublicKey.Bytes()
+	claims, _ := token.NewUserClaims(7, usernameMockTest, "golang", time.Minute)
+	claims.Cnf = &domain.Confirmation{JwkThumbprint: token.Thumbprint(domain.JSONWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+	})}
+	accessToken, _ := s.jwtMaker.SignClaims(claims)
+
+	verifyMock := func(method, url string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+		r.Header.Set("Authorization", "DPoP "+accessToken)
+		r.Header.Set(token.DPoPHeader, dpopProofMock(t, key, method, url, accessToken))
+		r.Header.Set(middleware.ForwardedMethodHeader, http.MethodPost)
+		r.Header.Set(middleware.ForwardedProtoHeader, "https")
+		r.Header.Set(middleware.ForwardedHostHeader, "app.example.com")
+		r.Header.Set(middleware.ForwardedUriHeader, "/reports?year=2024")
+		verify.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// when
+	status := verifyMock(http.MethodPost, "https://app.example.com/reports")
+
+	// then
+	if status != http.StatusOK {
+		t.Fatalf("expected the proof of the original request to be accepted, got %d", status)
+	}
+
+	for name, target := range map[string][2]string{
+		"verify url":   {http.MethodPost, "http://example.com/auth/verify"},
+		"other url":    {http.MethodPost, "https://app.example.com/admin"},
+		"other method": {http.MethodGet, "https://app.example.com/reports"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// when
+			status := verifyMock(target[0], target[1])
+
+			// then
+			if status != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d", status)
+			}
+		})
+	}
+}
+
+// TestExtAuthz verifies the Check of Envoy allows the requests with valid
+// credentials, with the identity headers, and denies the others with the
+// reason.
+func TestExtAuthz(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	s := service.(*authService)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(7), Username: ptrString(usernameMockTest), Roles: []string{"billing"}})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	server := m.ExtAuthzServer(m.CookieAuthenticator(), m.BearerAuthenticator())
+
+	claims, _ := token.NewUserClaims(7, usernameMockTest, "golang", time.Minute)
+	accessToken, _ := s.jwtMaker.SignClaims(claims)
+
+	checkRequest := func(headers map[string]string) *authv3.CheckRequest {
+		return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+				Method:  http.MethodGet,
+				Path:    "/orders?page=2",
+				Host:    "orders.internal",
+				Headers: headers,
+			}},
+		}}
+	}
+
+	// when
+	allowed, err := server.Check(context.Background(), checkRequest(map[string]string{
+		":authority":    "orders.internal",
+		"authorization": "Bearer " + accessToken,
+		"x-auth-user":   "someone-else",
+	}))
+	denied, deniedErr := server.Check(context.Background(), checkRequest(map[string]string{
+		"authorization": "Bearer invalid",
+	}))
+
+	// then
+	if err != nil || codes.Code(allowed.GetStatus().GetCode()) != codes.OK {
+		t.Fatalf("expected the request to be allowed, got %v %v", allowed, err)
+	}
+	headers := map[string]string{}
+	for _, header := range allowed.GetOkResponse().GetHeaders() {
+		headers[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+	}
+	if headers[middleware.AuthUserHeader] != usernameMockTest || headers[middleware.AuthIdHeader] != "7" || headers[middleware.AuthRolesHeader] != "billing" {
+		t.Errorf("unexpected identity headers: %v", headers)
+	}
+
+	if deniedErr != nil || codes.Code(denied.GetStatus().GetCode()) != codes.Unauthenticated {
+		t.Fatalf("expected the request to be denied, got %v %v", denied, deniedErr)
+	}
+	if denied.GetDeniedResponse().GetStatus().GetCode() != http.StatusUnauthorized {
+		t.Errorf("expected a 401, got %v", denied.GetDeniedResponse().GetStatus())
+	}
+	var body errorhandler.Error
+	if err := json.Unmarshal([]byte(denied.GetDeniedResponse().GetBody()), &body); err != nil || body.Message == "" {
+		t.Errorf("expected the reason in the body, got %q", denied.GetDeniedResponse().GetBody())
+	}
+}
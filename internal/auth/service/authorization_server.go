@@ -0,0 +1,825 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+const (
+	AuthorizationCodeDuration  = 10 * time.Minute
+	RefreshTokenDuration       = 24 * time.Hour
+	CodeChallengeMethodS256    = "S256"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// RFC 7636 section 4.1, the verifier uses only unreserved characters.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type browserSession struct {
+	UserId    int64
+	Username  string
+	AuthTime  time.Time
+	Amr       []string
+	CsrfToken string
+}
+
+type authorizeError struct {
+	code        string
+	description string
+}
+
+type loginPage struct {
+	ReturnTo   string
+	Error      string
+	SignedInAs string
+}
+
+type consentPage struct {
+	ClientName string
+	Username   string
+	Scopes     []string
+	CsrfToken  string
+	Request    *domain.AuthorizeRequest
+}
+
+// RegisterClient registers a new oauth client owned by the authenticated
+// user. Confidential clients get a secret that is only shown once.
+func (s *authService) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	s.Logger.Infoln("Registering a new oauth client")
+
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidToken)
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	var req domain.OAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	if err := isValidClient(&req); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	client := &domain.OAuthClient{
+		Id:             uuid.NewString(),
+		Name:           req.Name,
+		Owner:          userClaims.Username,
+		RedirectUris:   req.RedirectUris,
+		Scopes:         req.Scopes,
+		IsConfidential: req.IsConfidential,
+	}
+
+	var secret string
+	if client.IsConfidential {
+		secret = token.CookieBased{}.GenerateToken(Token_Length)
+		secretHash := hashToken(secret)
+		client.SecretHash = &secretHash
+	}
+
+	if err := s.oauthRepository.CreateClient(r.Context(), client); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	clientResponse := domain.OAuthClientResponse{
+		ClientId:       client.Id,
+		ClientSecret:   secret,
+		Name:           client.Name,
+		RedirectUris:   client.RedirectUris,
+		Scopes:         client.Scopes,
+		IsConfidential: client.IsConfidential,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clientResponse)
+
+	s.Logger.Infof("The oauth client %v was registered successfully.", client.Id)
+}
+
+// LoginPage renders the login form used by the authorization server, after
+// the login the browser is sent back to the authorization request.
+func (s *authService) LoginPage(w http.ResponseWriter, r *http.Request) {
+	page := loginPage{ReturnTo: safeReturnTo(r.URL.Query().Get("return_to"))}
+	if session, ok := s.currentBrowserSession(r); ok {
+		page.SignedInAs = session.Username
+	}
+
+	renderTemplate(s, w, http.StatusOK, "login.html", page)
+}
+
+// LoginBrowser checks the credentials sent by the login form and starts the
+// browser session of the authorization server.
+func (s *authService) LoginBrowser(w http.ResponseWriter, r *http.Request) {
+	s.Logger.Infoln("Trying to login user in the browser")
+
+	if err := r.ParseForm(); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	returnTo := safeReturnTo(r.PostForm.Get("return_to"))
+	login := domain.UserLogin{
+		Username: r.PostForm.Get("username"),
+		Password: r.PostForm.Get("password"),
+	}
+
+	if err := s.checkLoginMode(r.Context(), middleware.AuthMethodOAuthSession, middleware.AuthMethodJwt); err != nil {
+		renderTemplate(s, w, http.StatusForbidden, "login.html", loginPage{ReturnTo: returnTo, Error: errorhandler.ErrLoginModeNotAllowed.Error()})
+		return
+	}
+
+	user, err := verifyCredentials(r.Context(), s, &login)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		// what the directory answered isn't shown
+		if errors.Is(err, errorhandler.ErrDirectoryUnavailable) {
+			err = errorhandler.ErrDirectoryUnavailable
+		}
+		renderTemplate(s, w, http.StatusUnauthorized, "login.html", loginPage{ReturnTo: returnTo, Error: err.Error()})
+		return
+	}
+
+	if err := s.startBrowserSession(w, r, user, []string{token.AmrPassword}); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	s.Logger.Infoln("The user logged in the browser successfully.")
+
+	if returnTo == "" {
+		renderTemplate(s, w, http.StatusOK, "login.html", loginPage{SignedInAs: *user.Username})
+		return
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// Authorize handles the authorization request of the authorization code flow,
+// PKCE is mandatory. Users that are not logged in are sent to the login page
+// and the ones that didn't consent yet are asked for it.
+func (s *authService) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r.URL.Query())
+
+	client, err := s.findAuthorizeClient(r.Context(), req)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	if aerr := validateAuthorizeRequest(client, req); aerr != nil {
+		s.Logger.Errorf("An error occurred: %v", aerr.description)
+		redirectAuthorizeError(w, r, req, aerr)
+		return
+	}
+
+	session, ok := s.currentBrowserSession(r)
+	if !ok {
+		loginUrl := "/oauth/login?return_to=" + url.QueryEscape(r.URL.RequestURI())
+		http.Redirect(w, r, loginUrl, http.StatusFound)
+		return
+	}
+
+	consent, err := s.oauthRepository.FindConsent(r.Context(), session.Username, client.Id)
+	if err == nil && containsScopes(consent.Scope, req.Scope) {
+		s.issueAuthorizationCode(w, r, req, session)
+		return
+	}
+
+	page := consentPage{
+		ClientName: client.Name,
+		Username:   session.Username,
+		Scopes:     strings.Fields(req.Scope),
+		CsrfToken:  session.CsrfToken,
+		Request:    req,
+	}
+	renderTemplate(s, w, http.StatusOK, "consent.html", page)
+}
+
+// AuthorizeConsent receives the decision of the consent form, approving it
+// stores the consent and sends the authorization code back to the client.
+func (s *authService) AuthorizeConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	session, ok := s.currentBrowserSession(r)
+	if !ok {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidSession)
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidSession)
+		return
+	}
+
+	csrfToken := r.PostForm.Get("csrf_token")
+	if subtle.ConstantTimeCompare([]byte(csrfToken), []byte(session.CsrfToken)) != 1 {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidCSRFToken)
+		errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrInvalidCSRFToken)
+		return
+	}
+
+	req := parseAuthorizeRequest(r.PostForm)
+
+	client, err := s.findAuthorizeClient(r.Context(), req)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	if aerr := validateAuthorizeRequest(client, req); aerr != nil {
+		s.Logger.Errorf("An error occurred: %v", aerr.description)
+		redirectAuthorizeError(w, r, req, aerr)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		s.Logger.Infof("The user %v denied the access to %v", session.Username, client.Id)
+		redirectAuthorizeError(w, r, req, &authorizeError{errorhandler.OAuthAccessDenied, "the user denied the request"})
+		return
+	}
+
+	scope := req.Scope
+	if consent, err := s.oauthRepository.FindConsent(r.Context(), session.Username, client.Id); err == nil {
+		scope = mergeScopes(consent.Scope, req.Scope)
+	}
+
+	err = s.oauthRepository.SaveConsent(r.Context(), &domain.OAuthConsent{
+		Username: session.Username,
+		ClientId: client.Id,
+		Scope:    scope,
+	})
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	s.issueAuthorizationCode(w, r, req, session)
+}
+
+// Token is the token endpoint of the authorization server, it exchanges an
+// authorization code (with its PKCE verifier), a refresh token or an approved
+// device code for a new access and refresh token pair. Admins can also
+// exchange their token for an impersonation one.
+func (s *authService) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "the token endpoint only accepts POST", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case GrantTypeAuthorizationCode:
+		s.exchangeAuthorizationCode(w, r, client)
+	case GrantTypeRefreshToken:
+		s.exchangeRefreshToken(w, r, client)
+	case GrantTypeDeviceCode:
+		s.exchangeDeviceCode(w, r, client)
+	case GrantTypeTokenExchange:
+		s.exchangeToken(w, r, client)
+	default:
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthUnsupportedGrantType, "", http.StatusBadRequest)
+	}
+}
+
+func (s *authService) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	code, err := s.oauthRepository.ConsumeAuthorizationCode(r.Context(), hashToken(r.PostForm.Get("code")))
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "authorization code is invalid or was already used", http.StatusBadRequest)
+		return
+	}
+
+	if code.ExpiresAt.Before(time.Now()) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "authorization code expired", http.StatusBadRequest)
+		return
+	}
+
+	if code.ClientId != client.Id || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "authorization code was issued to another client or redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	if !verifyCodeChallenge(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "code verifier does not match the code challenge", http.StatusBadRequest)
+		return
+	}
+
+	// The clients are shared by the organizations, the code is only
+	// exchanged in the organization its user logged in.
+	if !tenant.Matches(r.Context(), code.OrgId) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, errorhandler.ErrWrongOrganization.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokenResponse, err := s.issueOAuthTokens(r.Context(), client, code.UserId, code.Username, code.Scope)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	if slices.Contains(strings.Fields(code.Scope), ScopeOpenId) {
+		tokenResponse.IdToken, err = s.generateIdToken(r, code)
+		if err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeTokenResponse(w, tokenResponse)
+}
+
+func (s *authService) exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	refreshClaims, err := s.jwtMaker.VerifyToken(r.PostForm.Get("refresh_token"))
+	if err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if refreshClaims.ClientId != client.Id {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "refresh token was issued to another client", http.StatusBadRequest)
+		return
+	}
+
+	if !tenant.Matches(r.Context(), refreshClaims.TenantId) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, errorhandler.ErrWrongOrganization.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := s.sessionRepository.FindSessionById(r.Context(), refreshClaims.ID)
+	if err != nil || session.IsRevoked || session.Username != refreshClaims.Username {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, errorhandler.ErrTokenRevoked.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.activeUser(r.Context(), refreshClaims.Username); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		if errors.Is(err, errorhandler.ErrUserNotFound) || errors.Is(err, errorhandler.ErrUserLocked) {
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, err.Error(), http.StatusBadRequest)
+			return
+		}
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	scope := refreshClaims.Scope
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		if !containsScopes(refreshClaims.Scope, requested) {
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidScope, "", http.StatusBadRequest)
+			return
+		}
+		scope = requested
+	}
+
+	// Refresh tokens are rotated, the one used here can't be used again.
+	if err := s.sessionRepository.RevokeSession(r.Context(), session.Id); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	tokenResponse, err := s.issueOAuthTokens(r.Context(), client, refreshClaims.Id, refreshClaims.Username, scope)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenResponse(w, tokenResponse)
+}
+
+// issueOAuthTokens creates the access token with the JwtBuilder and the
+// refresh token backed by a session, same as the jwt refresh login.
+func (s *authService) issueOAuthTokens(ctx context.Context, client *domain.OAuthClient, userId int64, username, scope string) (*domain.OAuthTokenResponse, error) {
+	refreshClaims, err := s.jwtMaker.NewUserClaims(userId, username, s.refreshTokenDuration(ctx))
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims.TenantId = tenant.IdFrom(ctx)
+	refreshClaims.Scope = scope
+	refreshClaims.ClientId = client.Id
+
+	refreshToken, err := s.jwtMaker.SignClaims(refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := s.accessTokenDuration(ctx)
+	accessClaims, err := s.jwtMaker.NewUserClaims(userId, username, duration)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims.TenantId = refreshClaims.TenantId
+	accessClaims.Scope = scope
+	accessClaims.ClientId = client.Id
+	accessClaims.SessionId = refreshClaims.ID
+
+	accessToken, err := s.jwtMaker.SignAccessClaims(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.sessionRepository.CreateSession(ctx, &domain.Session{
+		Id:           refreshClaims.RegisteredClaims.ID,
+		Username:     username,
+		RefreshToken: refreshToken,
+		IsRevoked:    false,
+		ExpiresAt:    refreshClaims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(duration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}, nil
+}
+
+// authenticateClient authenticates the client on the token endpoint using
+// client_secret_basic or client_secret_post, public clients only send their
+// client_id. It writes the error and returns nil when it fails.
+func (s *authService) authenticateClient(w http.ResponseWriter, r *http.Request) *domain.OAuthClient {
+	clientId, clientSecret, hasBasic := r.BasicAuth()
+	if hasBasic {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientId == "" {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidClient, "client_id is required", http.StatusUnauthorized)
+		return nil
+	}
+
+	client, err := s.oauthRepository.FindClientById(r.Context(), clientId)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidClient, "", http.StatusUnauthorized)
+		return nil
+	}
+
+	if !client.IsConfidential {
+		if clientSecret != "" {
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidClient, "public clients can't use a secret", http.StatusUnauthorized)
+			return nil
+		}
+		return client
+	}
+
+	if !clientSecretMatches(client, clientSecret) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidClient, "", http.StatusUnauthorized)
+		return nil
+	}
+
+	return client
+}
+
+// AuthenticateClient checks the credentials of a confidential client outside
+// of http, like the gRPC introspection, returns the client and an error if
+// any.
+func (s *authService) AuthenticateClient(ctx context.Context, clientId, clientSecret string) (*domain.OAuthClient, error) {
+	if clientId == "" {
+		return nil, errorhandler.Unauthorized(errorhandler.ErrInvalidClientCredentials)
+	}
+
+	client, err := s.oauthRepository.FindClientById(ctx, clientId)
+	if err != nil || !client.IsConfidential || !clientSecretMatches(client, clientSecret) {
+		return nil, errorhandler.Unauthorized(errorhandler.ErrInvalidClientCredentials)
+	}
+
+	return client, nil
+}
+
+func clientSecretMatches(client *domain.OAuthClient, clientSecret string) bool {
+	return client.SecretHash != nil && subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(*client.SecretHash)) == 1
+}
+
+// findAuthorizeClient finds the client and the redirect uri, errors here
+// can't be sent to the redirect uri since it couldn't be trusted.
+func (s *authService) findAuthorizeClient(ctx context.Context, req *domain.AuthorizeRequest) (*domain.OAuthClient, error) {
+	client, err := s.oauthRepository.FindClientById(ctx, req.ClientId)
+	if err != nil {
+		return nil, errorhandler.ErrClientNotFound
+	}
+
+	if req.RedirectUri == "" && len(client.RedirectUris) == 1 {
+		req.RedirectUri = client.RedirectUris[0]
+	}
+
+	if !slices.Contains(client.RedirectUris, req.RedirectUri) {
+		return nil, errorhandler.ErrInvalidRedirectUri
+	}
+
+	return client, nil
+}
+
+func (s *authService) issueAuthorizationCode(w http.ResponseWriter, r *http.Request, req *domain.AuthorizeRequest, session *browserSession) {
+	code := token.CookieBased{}.GenerateToken(Token_Length)
+
+	err := s.oauthRepository.CreateAuthorizationCode(r.Context(), &domain.AuthorizationCode{
+		CodeHash:            hashToken(code),
+		ClientId:            req.ClientId,
+		UserId:              session.UserId,
+		Username:            session.Username,
+		OrgId:               tenant.IdFrom(r.Context()),
+		RedirectUri:         req.RedirectUri,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            session.AuthTime,
+		Amr:                 strings.Join(session.Amr, " "),
+		ExpiresAt:           time.Now().Add(AuthorizationCodeDuration),
+	})
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		redirectAuthorizeError(w, r, req, &authorizeError{errorhandler.OAuthServerError, ""})
+		return
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	redirectWithParams(w, r, req, params)
+}
+
+func (s *authService) currentBrowserSession(r *http.Request) (*browserSession, bool) {
+	session, err := s.browserStore.Get(r, auth.BrowserSessionName)
+	if err != nil || session.IsNew {
+		return nil, false
+	}
+
+	userId, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return nil, false
+	}
+	username, _ := session.Values["username"].(string)
+	authTime, _ := session.Values["auth_time"].(int64)
+	amr, _ := session.Values["amr"].(string)
+	csrfToken, _ := session.Values["csrf_token"].(string)
+
+	// the session of another organization isn't a login of this one
+	if tenantId, _ := session.Values["tenant_id"].(int64); !tenant.Matches(r.Context(), tenantId) {
+		return nil, false
+	}
+
+	return &browserSession{
+		UserId:    userId,
+		Username:  username,
+		AuthTime:  time.Unix(authTime, 0),
+		Amr:       strings.Fields(amr),
+		CsrfToken: csrfToken,
+	}, true
+}
+
+// startBrowserSession logs the user in the browser, amr holds the methods
+// used to authenticate (RFC 8176), they end up in the ID token.
+func (s *authService) startBrowserSession(w http.ResponseWriter, r *http.Request, user *domain.User, amr []string) error {
+	session, _ := s.browserStore.Get(r, auth.BrowserSessionName)
+	session.Values["user_id"] = *user.Id
+	session.Values["username"] = *user.Username
+	session.Values["tenant_id"] = tenant.IdFrom(r.Context())
+	session.Values["auth_time"] = time.Now().Unix()
+	session.Values["amr"] = strings.Join(amr, " ")
+	session.Values["csrf_token"] = token.CookieBased{}.GenerateToken(Token_Length)
+	return session.Save(r, w)
+}
+
+func (s *authService) endBrowserSession(w http.ResponseWriter, r *http.Request) error {
+	session, _ := s.browserStore.Get(r, auth.BrowserSessionName)
+	session.Values = map[any]any{}
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+func parseAuthorizeRequest(values url.Values) *domain.AuthorizeRequest {
+	return &domain.AuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientId:            values.Get("client_id"),
+		RedirectUri:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+// validateAuthorizeRequest validates everything that can be reported back
+// to the client through its redirect uri.
+func validateAuthorizeRequest(client *domain.OAuthClient, req *domain.AuthorizeRequest) *authorizeError {
+	if req.ResponseType != "code" {
+		return &authorizeError{errorhandler.OAuthUnsupportedResponseType, "only the code response type is supported"}
+	}
+
+	if req.CodeChallenge == "" {
+		return &authorizeError{errorhandler.OAuthInvalidRequest, "code_challenge is required"}
+	}
+
+	if req.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return &authorizeError{errorhandler.OAuthInvalidRequest, "code_challenge_method must be S256"}
+	}
+
+	if req.Scope == "" {
+		req.Scope = strings.Join(client.Scopes, " ")
+	}
+
+	if !containsScopes(strings.Join(client.Scopes, " "), req.Scope) {
+		return &authorizeError{errorhandler.OAuthInvalidScope, "the client is not allowed to request this scope"}
+	}
+
+	return nil
+}
+
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, req *domain.AuthorizeRequest, aerr *authorizeError) {
+	params := url.Values{}
+	params.Set("error", aerr.code)
+	if aerr.description != "" {
+		params.Set("error_description", aerr.description)
+	}
+	redirectWithParams(w, r, req, params)
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, req *domain.AuthorizeRequest, params url.Values) {
+	redirectUri, err := url.Parse(req.RedirectUri)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidRedirectUri, r.URL.Path)
+		return
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	query := redirectUri.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	redirectUri.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func writeTokenResponse(w http.ResponseWriter, tokenResponse *domain.OAuthTokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokenResponse)
+}
+
+func renderTemplate(s *authService, w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+	}
+}
+
+func isValidClient(req *domain.OAuthClientRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return errorhandler.ErrClientNameIsRequired
+	}
+
+	if len(req.RedirectUris) == 0 {
+		return errorhandler.ErrRedirectUriIsRequired
+	}
+
+	for _, redirectUri := range req.RedirectUris {
+		if !isValidRedirectUri(redirectUri) {
+			return errorhandler.ErrInvalidRedirectUri
+		}
+	}
+
+	for _, scope := range req.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \"\\") {
+			return errorhandler.ErrInvalidScope
+		}
+	}
+
+	return nil
+}
+
+// isValidRedirectUri accepts https uris, http only for loopback addresses
+// and private-use schemes (com.example.app:/callback) for native apps.
+func isValidRedirectUri(raw string) bool {
+	redirectUri, err := url.Parse(raw)
+	if err != nil || !redirectUri.IsAbs() || redirectUri.Fragment != "" || strings.Contains(raw, " ") {
+		return false
+	}
+
+	switch redirectUri.Scheme {
+	case "https":
+		return redirectUri.Host != ""
+	case "http":
+		host := redirectUri.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return strings.Contains(redirectUri.Scheme, ".")
+	}
+}
+
+// safeReturnTo only allows going back to the authorization server itself,
+// preventing the login page from becoming an open redirect.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/oauth/") || strings.HasPrefix(returnTo, "//") || strings.Contains(returnTo, "\\") {
+		return ""
+	}
+	return returnTo
+}
+
+// verifyCodeChallenge checks the PKCE verifier against the S256 challenge.
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// containsScopes tells if every scope requested was granted.
+func containsScopes(granted, requested string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(grantedScopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeScopes(granted, requested string) string {
+	scopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// hashToken is used for values that only need to be compared later, like
+// client secrets and authorization codes, they're random so sha256 is enough.
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+const (
+	clientIdMock     = "client-id"
+	redirectUriMock  = "https://app.example.com/callback"
+	codeVerifierMock = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type mockOAuthRepo struct {
+	clients  map[string]*domain.OAuthClient
+	codes    map[string]*domain.AuthorizationCode
+	consents map[string]*domain.OAuthConsent
+	devices  map[string]*domain.DeviceCode
+}
+
+func newMockOAuthRepo() *mockOAuthRepo {
+	return &mockOAuthRepo{
+		clients:  map[string]*domain.OAuthClient{},
+		codes:    map[string]*domain.AuthorizationCode{},
+		consents: map[string]*domain.OAuthConsent{},
+		devices:  map[string]*domain.DeviceCode{},
+	}
+}
+
+func (mock *mockOAuthRepo) CreateClient(ctx context.Context, client *domain.OAuthClient) error {
+	mock.clients[client.Id] = client
+	return nil
+}
+
+func (mock *mockOAuthRepo) FindClientById(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	if client, ok := mock.clients[id]; ok {
+		return client, nil
+	}
+	return nil, errorhandler.ErrClientNotFound
+}
+
+func (mock *mockOAuthRepo) CreateAuthorizationCode(ctx context.Context, code *domain.AuthorizationCode) error {
+	mock.codes[code.CodeHash] = code
+	return nil
+}
+
+func (mock *mockOAuthRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	code, ok := mock.codes[codeHash]
+	if !ok {
+		return nil, errorhandler.ErrInvalidToken
+	}
+	delete(mock.codes, codeHash)
+	return code, nil
+}
+
+func (mock *mockOAuthRepo) FindConsent(ctx context.Context, username, clientId string) (*domain.OAuthConsent, error) {
+	if consent, ok := mock.consents[tenant.Key(ctx, username+clientId)]; ok {
+		return consent, nil
+	}
+	return nil, errorhandler.ErrUserNotFound
+}
+
+func (mock *mockOAuthRepo) SaveConsent(ctx context.Context, consent *domain.OAuthConsent) error {
+	mock.consents[tenant.Key(ctx, consent.Username+consent.ClientId)] = consent
+	return nil
+}
+
+func (mock *mockOAuthRepo) CreateDeviceCode(ctx context.Context, code *domain.DeviceCode) error {
+	mock.devices[code.DeviceCodeHash] = code
+	return nil
+}
+
+func (mock *mockOAuthRepo) FindDeviceCode(ctx context.Context, deviceCodeHash string) (*domain.DeviceCode, error) {
+	if code, ok := mock.devices[deviceCodeHash]; ok {
+		copied := *code
+		return &copied, nil
+	}
+	return nil, errorhandler.ErrInvalidUserCode
+}
+
+func (mock *mockOAuthRepo) FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*domain.DeviceCode, error) {
+	for _, code := range mock.devices {
+		if code.UserCode == userCode {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errorhandler.ErrInvalidUserCode
+}
+
+func (mock *mockOAuthRepo) UpdateDeviceCodeStatus(ctx context.Context, code *domain.DeviceCode) error {
+	stored, ok := mock.devices[code.DeviceCodeHash]
+	if !ok || stored.Status != domain.DeviceCodePending {
+		return errorhandler.ErrInvalidUserCode
+	}
+	stored.Status, stored.UserId, stored.Username, stored.OrgId = code.Status, code.UserId, code.Username, code.OrgId
+	return nil
+}
+
+func (mock *mockOAuthRepo) UpdateDeviceCodePolling(ctx context.Context, code *domain.DeviceCode) error {
+	if stored, ok := mock.devices[code.DeviceCodeHash]; ok {
+		stored.Interval, stored.LastPolledAt = code.Interval, code.LastPolledAt
+	}
+	return nil
+}
+
+func (mock *mockOAuthRepo) DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	if _, ok := mock.devices[deviceCodeHash]; !ok {
+		return errorhandler.ErrInvalidUserCode
+	}
+	delete(mock.devices, deviceCodeHash)
+	return nil
+}
+
+func codeChallengeMock() string {
+	sum := sha256.Sum256([]byte(codeVerifierMock))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// prepareAuthorizationServer returns the service with a public client
+// registered and the cookies of a logged in browser.
+func prepareAuthorizationServer(t *testing.T) (*authService, *mockOAuthRepo, []*http.Cookie) {
+	service, _, _, _ := prepareMocks()
+	s := service.(*authService)
+	oauthRepo := s.oauthRepository.(*mockOAuthRepo)
+
+	oauthRepo.CreateClient(context.Background(), &domain.OAuthClient{
+		Id:           clientIdMock,
+		Name:         "Test app",
+		RedirectUris: []string{redirectUriMock},
+		Scopes:       []string{"openid", "profile", "email"},
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/oauth/login", nil)
+	user := &domain.User{Id: ptrInt64(1), Username: ptrString(usernameMockTest)}
+	if err := s.startBrowserSession(w, r, user, []string{token.AmrPassword}); err != nil {
+		t.Fatalf("failed starting the browser session: %v", err)
+	}
+
+	return s, oauthRepo, w.Result().Cookies()
+}
+
+func authorizeRequestMock(cookies []*http.Cookie) *http.Request {
+	return authorizeRequestWithScopeMock(cookies, "profile")
+}
+
+func authorizeRequestWithScopeMock(cookies []*http.Cookie, scope string) *http.Request {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", clientIdMock)
+	params.Set("redirect_uri", redirectUriMock)
+	params.Set("scope", scope)
+	params.Set("nonce", "n-0S6_WzA2Mj")
+	params.Set("state", "xyz")
+	params.Set("code_challenge", codeChallengeMock())
+	params.Set("code_challenge_method", CodeChallengeMethodS256)
+
+	r := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+params.Encode(), nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// TestVerifyCodeChallenge verifies verifyCodeChallenge with the example
+// from RFC 7636 appendix B.
+func TestVerifyCodeChallenge(t *testing.T) {
+	if !verifyCodeChallenge(codeVerifierMock, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM") {
+		t.Fatal("expected the RFC 7636 verifier to match its challenge")
+	}
+
+	if verifyCodeChallenge("short", codeChallengeMock()) {
+		t.Fatal("expected a verifier shorter than 43 characters to be rejected")
+	}
+}
+
+// TestIsValidRedirectUri verifies isValidRedirectUri with a test driven table.
+func TestIsValidRedirectUri(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want bool
+	}{
+		{"https", "https://app.example.com/callback", true},
+		{"loopback", "http://127.0.0.1:8080/callback", true},
+		{"native app", "com.example.app:/callback", true},
+		{"plain http", "http://app.example.com/callback", false},
+		{"fragment", "https://app.example.com/callback#frag", false},
+		{"relative", "/callback", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isValidRedirectUri(tt.uri); got != tt.want {
+				t.Fatalf("isValidRedirectUri(%q) = %v, want %v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAuthorize_WithoutSession verifies Authorize sends the browser to
+// the login page when there is no session.
+func TestAuthorize_WithoutSession(t *testing.T) {
+	// given
+	s, _, _ := prepareAuthorizationServer(t)
+	w := httptest.NewRecorder()
+
+	// when
+	s.Authorize(w, authorizeRequestMock(nil))
+	resp := w.Result()
+
+	// then
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected 302 Found, got %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); !strings.HasPrefix(location, "/oauth/login?return_to=") {
+		t.Fatalf("expected a redirect to the login page, got %v", location)
+	}
+}
+
+// TestAuthorize_MissingCodeChallenge verifies Authorize refuses requests
+// without PKCE, sending the error back to the client.
+func TestAuthorize_MissingCodeChallenge(t *testing.T) {
+	// given
+	s, _, cookies := prepareAuthorizationServer(t)
+	r := authorizeRequestMock(cookies)
+	query := r.URL.Query()
+	query.Del("code_challenge")
+	r.URL.RawQuery = query.Encode()
+	w := httptest.NewRecorder()
+
+	// when
+	s.Authorize(w, r)
+	resp := w.Result()
+
+	// then
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if location.Query().Get("error") != errorhandler.OAuthInvalidRequest {
+		t.Fatalf("expected invalid_request, got %v", location)
+	}
+}
+
+// TestAuthorizationCodeFlow_Success verifies the whole authorization code
+// flow with an already given consent, from Authorize to Token.
+func TestAuthorizationCodeFlow_Success(t *testing.T) {
+	// given
+	s, oauthRepo, cookies := prepareAuthorizationServer(t)
+	oauthRepo.SaveConsent(context.Background(), &domain.OAuthConsent{Username: usernameMockTest, ClientId: clientIdMock, Scope: "profile"})
+	w := httptest.NewRecorder()
+
+	// when
+	s.Authorize(w, authorizeRequestMock(cookies))
+	location, _ := url.Parse(w.Result().Header.Get("Location"))
+
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeAuthorizationCode)
+	form.Set("client_id", clientIdMock)
+	form.Set("redirect_uri", redirectUriMock)
+	form.Set("code", location.Query().Get("code"))
+	form.Set("code_verifier", codeVerifierMock)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	s.Token(rr, r)
+	resp := rr.Result()
+
+	var tr domain.OAuthTokenResponse
+
+	// then
+	if location.Query().Get("state") != "xyz" {
+		t.Fatalf("expected the state to be sent back, got %v", location)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		t.Fatalf("failed decoding token response: %v", err)
+	}
+
+	if tr.AccessToken == "" || tr.RefreshToken == "" {
+		t.Fatal("expected both access and refresh tokens in response")
+	}
+
+	claims, err := s.jwtMaker.VerifyToken(tr.AccessToken)
+	if err != nil {
+		t.Fatalf("failed verifying the access token: %v", err)
+	}
+
+	if claims.ClientId != clientIdMock || claims.Scope != "profile" {
+		t.Fatalf("unexpected claims, client_id: %v, scope: %v", claims.ClientId, claims.Scope)
+	}
+
+	// the code is single use
+	r = httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	s.Token(rr, r)
+
+	if rr.Result().StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the code reuse to fail, got %d", rr.Result().StatusCode)
+	}
+}
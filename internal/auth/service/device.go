@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+const (
+	GrantTypeDeviceCode    = "urn:ietf:params:oauth:grant-type:device_code"
+	DeviceCodeDuration     = 10 * time.Minute
+	DevicePollInterval     = 5
+	DeviceSlowDownInterval = 5
+	// RFC 8628 section 6.1, no vowels so the codes can't spell words and
+	// no characters that look alike.
+	UserCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	UserCodeLength  = 8
+)
+
+type devicePage struct {
+	Username   string
+	ClientName string
+	UserCode   string
+	Scopes     []string
+	CsrfToken  string
+	Error      string
+	Result     string
+}
+
+// DeviceAuthorization starts the device authorization grant (RFC 8628), the
+// device shows the user code and the verification uri to the user and then
+// polls the token endpoint with the device code.
+func (s *authService) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	scope := r.PostForm.Get("scope")
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	}
+
+	if !containsScopes(strings.Join(client.Scopes, " "), scope) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidScope, "the client is not allowed to request this scope", http.StatusBadRequest)
+		return
+	}
+
+	deviceCode := token.CookieBased{}.GenerateToken(Token_Length)
+	userCode, err := generateUserCode()
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.oauthRepository.CreateDeviceCode(r.Context(), &domain.DeviceCode{
+		DeviceCodeHash: hashToken(deviceCode),
+		UserCode:       userCode,
+		ClientId:       client.Id,
+		Scope:          scope,
+		Status:         domain.DeviceCodePending,
+		Interval:       DevicePollInterval,
+		ExpiresAt:      time.Now().Add(DeviceCodeDuration),
+	})
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	verificationUri := s.issuer(r) + "/oauth/device"
+	deviceResponse := domain.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationUri:         verificationUri,
+		VerificationUriComplete: verificationUri + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int64(DeviceCodeDuration.Seconds()),
+		Interval:                DevicePollInterval,
+	}
+
+	s.Logger.Infof("The client %v started a device authorization.", client.Id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deviceResponse)
+}
+
+// DevicePage is the verification page, a logged in user types the code shown
+// by the device (or follows the complete verification uri) and sees which
+// client is asking for access.
+func (s *authService) DevicePage(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.currentBrowserSession(r)
+	if !ok {
+		loginUrl := "/oauth/login?return_to=" + url.QueryEscape(r.URL.RequestURI())
+		http.Redirect(w, r, loginUrl, http.StatusFound)
+		return
+	}
+
+	page := devicePage{Username: session.Username, CsrfToken: session.CsrfToken}
+
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		renderTemplate(s, w, http.StatusOK, "device.html", page)
+		return
+	}
+
+	code, client, err := s.findPendingDeviceCode(r.Context(), userCode)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		page.Error = errorhandler.ErrInvalidUserCode.Error()
+		renderTemplate(s, w, http.StatusBadRequest, "device.html", page)
+		return
+	}
+
+	page.ClientName = client.Name
+	page.UserCode = formatUserCode(code.UserCode)
+	page.Scopes = strings.Fields(code.Scope)
+	renderTemplate(s, w, http.StatusOK, "device.html", page)
+}
+
+// DeviceConsent receives the decision of the user about the device, the
+// next poll of the device gets the tokens or access_denied.
+func (s *authService) DeviceConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	session, ok := s.currentBrowserSession(r)
+	if !ok {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidSession)
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidSession)
+		return
+	}
+
+	csrfToken := r.PostForm.Get("csrf_token")
+	if subtle.ConstantTimeCompare([]byte(csrfToken), []byte(session.CsrfToken)) != 1 {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidCSRFToken)
+		errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrInvalidCSRFToken)
+		return
+	}
+
+	page := devicePage{Username: session.Username, CsrfToken: session.CsrfToken}
+
+	code, client, err := s.findPendingDeviceCode(r.Context(), r.PostForm.Get("user_code"))
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		page.Error = errorhandler.ErrInvalidUserCode.Error()
+		renderTemplate(s, w, http.StatusBadRequest, "device.html", page)
+		return
+	}
+
+	code.Status = domain.DeviceCodeDenied
+	page.Result = "Access denied, you can close this window."
+	if r.PostForm.Get("decision") == "approve" {
+		code.Status = domain.DeviceCodeApproved
+		code.UserId = &session.UserId
+		code.Username = &session.Username
+		code.OrgId = tenant.IdFrom(r.Context())
+		page.Result = "Your device is connected, you can go back to it."
+	}
+
+	if err := s.oauthRepository.UpdateDeviceCodeStatus(r.Context(), code); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		page.Result = ""
+		page.Error = errorhandler.ErrInvalidUserCode.Error()
+		renderTemplate(s, w, http.StatusBadRequest, "device.html", page)
+		return
+	}
+
+	s.Logger.Infof("The user %v %v the device of %v", session.Username, code.Status, client.Id)
+
+	renderTemplate(s, w, http.StatusOK, "device.html", page)
+}
+
+// exchangeDeviceCode is the polling of the device on the token endpoint,
+// polling faster than the interval slows the device down.
+func (s *authService) exchangeDeviceCode(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	deviceCodeHash := hashToken(r.PostForm.Get("device_code"))
+
+	code, err := s.oauthRepository.FindDeviceCode(r.Context(), deviceCodeHash)
+	if err != nil || code.ClientId != client.Id {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "device code is invalid or was already used", http.StatusBadRequest)
+		return
+	}
+
+	if code.ExpiresAt.Before(time.Now()) {
+		s.oauthRepository.DeleteDeviceCode(r.Context(), deviceCodeHash)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthExpiredToken, "", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	tooFast := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < time.Duration(code.Interval)*time.Second
+	code.LastPolledAt = &now
+	if tooFast {
+		code.Interval += DeviceSlowDownInterval
+	}
+
+	if err := s.oauthRepository.UpdateDeviceCodePolling(r.Context(), code); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	if tooFast {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthSlowDown, "", http.StatusBadRequest)
+		return
+	}
+
+	switch code.Status {
+	case domain.DeviceCodePending:
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthAuthorizationPending, "", http.StatusBadRequest)
+		return
+	case domain.DeviceCodeDenied:
+		s.oauthRepository.DeleteDeviceCode(r.Context(), deviceCodeHash)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthAccessDenied, "the user denied the request", http.StatusBadRequest)
+		return
+	}
+
+	// The clients are shared by the organizations, the device gets the
+	// tokens in the organization the user approved it.
+	if !tenant.Matches(r.Context(), code.OrgId) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, errorhandler.ErrWrongOrganization.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Deleting it before issuing the tokens makes sure the device code is
+	// exchanged only once, even with concurrent polls.
+	if err := s.oauthRepository.DeleteDeviceCode(r.Context(), deviceCodeHash); err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "device code is invalid or was already used", http.StatusBadRequest)
+		return
+	}
+
+	tokenResponse, err := s.issueOAuthTokens(r.Context(), client, *code.UserId, *code.Username, code.Scope)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Infof("The device of %v got its tokens for %v", client.Id, *code.Username)
+
+	writeTokenResponse(w, tokenResponse)
+}
+
+func (s *authService) findPendingDeviceCode(ctx context.Context, userCode string) (*domain.DeviceCode, *domain.OAuthClient, error) {
+	code, err := s.oauthRepository.FindDeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if code.Status != domain.DeviceCodePending || code.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errorhandler.ErrInvalidUserCode
+	}
+
+	client, err := s.oauthRepository.FindClientById(ctx, code.ClientId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return code, client, nil
+}
+
+func generateUserCode() (string, error) {
+	userCode := make([]byte, UserCodeLength)
+	for i := range userCode {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(UserCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+		userCode[i] = UserCodeCharset[n.Int64()]
+	}
+	return string(userCode), nil
+}
+
+// formatUserCode splits the code in two halves (WDJB-MJHT), easier to read
+// and type.
+func formatUserCode(userCode string) string {
+	return userCode[:UserCodeLength/2] + "-" + userCode[UserCodeLength/2:]
+}
+
+// normalizeUserCode accepts the code as typed by the user, lowercase and
+// with or without separators.
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(UserCodeCharset, c) {
+			return c
+		}
+		return -1
+	}, userCode)
+}
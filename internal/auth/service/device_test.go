@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+func deviceAuthorizationMock(t *testing.T, s *authService) domain.DeviceAuthorizationResponse {
+	form := url.Values{}
+	form.Set("client_id", clientIdMock)
+	form.Set("scope", "profile")
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/device_authorization", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.DeviceAuthorization(w, r)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Result().StatusCode)
+	}
+
+	var deviceResponse domain.DeviceAuthorizationResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&deviceResponse); err != nil {
+		t.Fatalf("failed decoding device authorization response: %v", err)
+	}
+	return deviceResponse
+}
+
+func pollDeviceMock(s *authService, deviceCode string) *http.Response {
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeDeviceCode)
+	form.Set("client_id", clientIdMock)
+	form.Set("device_code", deviceCode)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.Token(w, r)
+	return w.Result()
+}
+
+func deviceConsentMock(s *authService, cookies []*http.Cookie, userCode, decision string) *http.Response {
+	session, _ := s.currentBrowserSession(authorizeRequestMock(cookies))
+
+	form := url.Values{}
+	form.Set("csrf_token", session.CsrfToken)
+	form.Set("user_code", userCode)
+	form.Set("decision", decision)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/device", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.DeviceConsent(w, r)
+	return w.Result()
+}
+
+func oauthErrorMock(t *testing.T, resp *http.Response) string {
+	var oauthError errorhandler.OAuthError
+	if err := json.NewDecoder(resp.Body).Decode(&oauthError); err != nil {
+		t.Fatalf("failed decoding the error response: %v", err)
+	}
+	return oauthError.Error
+}
+
+// allowNextPoll moves the last poll back in time, as if the device waited
+// for the interval.
+func allowNextPoll(oauthRepo *mockOAuthRepo) {
+	for _, code := range oauthRepo.devices {
+		polledAt := time.Now().Add(-time.Minute)
+		code.LastPolledAt = &polledAt
+	}
+}
+
+// TestNormalizeUserCode verifies the user code is accepted as typed by the
+// user.
+func TestNormalizeUserCode(t *testing.T) {
+	for _, typed := range []string{"WDJB-MJHT", "wdjb-mjht", "WDJB MJHT", "wdjbmjht"} {
+		if got := normalizeUserCode(typed); got != "WDJBMJHT" {
+			t.Fatalf("normalizeUserCode(%q) = %q, want WDJBMJHT", typed, got)
+		}
+	}
+}
+
+// TestDevicePage_WithoutSession verifies the verification page sends the
+// browser to the login page when there is no session.
+func TestDevicePage_WithoutSession(t *testing.T) {
+	// given
+	s, _, _ := prepareAuthorizationServer(t)
+	r := httptest.NewRequest(http.MethodGet, "/oauth/device?user_code=WDJB-MJHT", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	s.DevicePage(w, r)
+	resp := w.Result()
+
+	// then
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected 302 Found, got %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); !strings.HasPrefix(location, "/oauth/login?return_to=") {
+		t.Fatalf("expected a redirect to the login page, got %v", location)
+	}
+}
+
+// TestDeviceFlow_Success verifies the whole device flow, the device polls
+// while the user didn't approve, is slowed down when polling too fast and
+// gets the tokens after the approval.
+func TestDeviceFlow_Success(t *testing.T) {
+	// given
+	s, oauthRepo, cookies := prepareAuthorizationServer(t)
+	deviceResponse := deviceAuthorizationMock(t, s)
+
+	// when
+	pending := pollDeviceMock(s, deviceResponse.DeviceCode)
+	slowDown := pollDeviceMock(s, deviceResponse.DeviceCode)
+	consent := deviceConsentMock(s, cookies, strings.ToLower(deviceResponse.UserCode), "approve")
+	allowNextPoll(oauthRepo)
+	approved := pollDeviceMock(s, deviceResponse.DeviceCode)
+
+	// then
+	if code := oauthErrorMock(t, pending); code != errorhandler.OAuthAuthorizationPending {
+		t.Fatalf("expected authorization_pending, got %v", code)
+	}
+
+	if code := oauthErrorMock(t, slowDown); code != errorhandler.OAuthSlowDown {
+		t.Fatalf("expected slow_down, got %v", code)
+	}
+
+	if consent.StatusCode != http.StatusOK {
+		t.Fatalf("expected the approval to succeed, got %d", consent.StatusCode)
+	}
+
+	if approved.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", approved.StatusCode)
+	}
+
+	var tr domain.OAuthTokenResponse
+	if err := json.NewDecoder(approved.Body).Decode(&tr); err != nil {
+		t.Fatalf("failed decoding token response: %v", err)
+	}
+
+	claims, err := s.jwtMaker.VerifyToken(tr.AccessToken)
+	if err != nil {
+		t.Fatalf("failed verifying the access token: %v", err)
+	}
+
+	if claims.Username != usernameMockTest || claims.ClientId != clientIdMock || tr.RefreshToken == "" {
+		t.Fatalf("unexpected tokens, username: %v, client_id: %v", claims.Username, claims.ClientId)
+	}
+
+	// the device code is single use
+	allowNextPoll(oauthRepo)
+	if code := oauthErrorMock(t, pollDeviceMock(s, deviceResponse.DeviceCode)); code != errorhandler.OAuthInvalidGrant {
+		t.Fatalf("expected invalid_grant on reuse, got %v", code)
+	}
+}
+
+// TestDeviceFlow_OtherOrganization verifies the device only gets its tokens
+// in the organization the user approved it.
+func TestDeviceFlow_OtherOrganization(t *testing.T) {
+	// given
+	s, oauthRepo, cookies := prepareAuthorizationServer(t)
+	acme, _, _ := organizationsMock()
+	deviceResponse := deviceAuthorizationMock(t, s)
+	deviceConsentMock(s, cookies, deviceResponse.UserCode, "approve")
+	allowNextPoll(oauthRepo)
+
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeDeviceCode)
+	form.Set("client_id", clientIdMock)
+	form.Set("device_code", deviceResponse.DeviceCode)
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	// when
+	s.Token(w, r.WithContext(tenant.WithOrganization(r.Context(), acme)))
+
+	// then
+	if code := oauthErrorMock(t, w.Result()); code != errorhandler.OAuthInvalidGrant {
+		t.Fatalf("expected invalid_grant in another organization, got %v", code)
+	}
+
+	// the device code is still there for the organization of the approval
+	allowNextPoll(oauthRepo)
+	if resp := pollDeviceMock(s, deviceResponse.DeviceCode); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the tokens in the organization of the approval, got %d", resp.StatusCode)
+	}
+}
+
+// TestDeviceFlow_Denied verifies the device gets access_denied when the
+// user denies the request.
+func TestDeviceFlow_Denied(t *testing.T) {
+	// given
+	s, _, cookies := prepareAuthorizationServer(t)
+	deviceResponse := deviceAuthorizationMock(t, s)
+
+	// when
+	deviceConsentMock(s, cookies, deviceResponse.UserCode, "deny")
+	resp := pollDeviceMock(s, deviceResponse.DeviceCode)
+
+	// then
+	if code := oauthErrorMock(t, resp); code != errorhandler.OAuthAccessDenied {
+		t.Fatalf("expected access_denied, got %v", code)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// dpopProofMock signs a DPoP proof for the method and url with the key,
+// accessToken fills the ath claim when set.
+func dpopProofMock(t *testing.T, key *ecdsa.PrivateKey, method, url, accessToken string) string {
+	point, _ := key.PublicKey.Bytes()
+	claims := token.DPoPProofClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.NewString(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Htm: method,
+		Htu: url,
+	}
+	if accessToken != "" {
+		claims.Ath = token.AccessTokenHash(accessToken)
+	}
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	proof.Header["typ"] = token.DPoPProofType
+	proof.Header["jwk"] = map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}
+
+	signed, err := proof.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed signing the proof: %v", err)
+	}
+	return signed
+}
+
+func renewRequestMock(refreshToken string) *http.Request {
+	jsonReq, _ := json.Marshal(domain.RenewAccessTokenRequest{RefreshToken: refreshToken})
+	return httptest.NewRequest(http.MethodPost, "/renew", bytes.NewReader(jsonReq))
+}
+
+// TestLoginJwtRefreshBased_DPoP verifies the tokens are bound to the key of
+// the proof, the renewal needs a proof of the same key and the middleware
+// only accepts the access token with a fresh proof.
+func TestLoginJwtRefreshBased_DPoP(t *testing.T) {
+	// given
+	service, userRepo, _, caches := prepareMocks()
+	s := service.(*authService)
+	controller := controllerMock(service)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	w, r := loginFlowMock(userRepo)
+	r.Header.Set(token.DPoPHeader, dpopProofMock(t, key, http.MethodPost, "http://example.com/login", ""))
+
+	// when
+	controller.LoginJwtRefreshBasedEp(w, r)
+
+	var tr domain.TokenRefreshResponse
+	json.NewDecoder(w.Result().Body).Decode(&tr)
+
+	// then
+	if w.Result().StatusCode != http.StatusCreated || tr.TokenType != token.DPoPScheme {
+		t.Fatalf("expected a DPoP bound login, got %d %+v", w.Result().StatusCode, tr)
+	}
+
+	claims, _ := s.jwtMaker.VerifyToken(tr.AccessToken)
+	if claims.Cnf == nil || claims.Cnf.JwkThumbprint == "" {
+		t.Fatal("expected the cnf claim in the access token")
+	}
+
+	// renewal with another key
+	rw := httptest.NewRecorder()
+	rr := renewRequestMock(tr.RefreshToken)
+	rr.Header.Set(token.DPoPHeader, dpopProofMock(t, otherKey, http.MethodPost, "http://example.com/renew", ""))
+	controller.RenewAccessTokenEp(rw, rr)
+	if rw.Result().StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the renewal with another key to fail, got %d", rw.Result().StatusCode)
+	}
+
+	// renewal with the same key
+	rw = httptest.NewRecorder()
+	rr = renewRequestMock(tr.RefreshToken)
+	rr.Header.Set(token.DPoPHeader, dpopProofMock(t, key, http.MethodPost, "http://example.com/renew", ""))
+	controller.RenewAccessTokenEp(rw, rr)
+	if rw.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected the renewal with the same key to succeed, got %d", rw.Result().StatusCode)
+	}
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, caches)
+	protected := m.JwtRefreshBased(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	proof := dpopProofMock(t, key, http.MethodGet, "http://example.com/api/v1/sessions", tr.AccessToken)
+	tests := []struct {
+		name   string
+		scheme string
+		proof  string
+		want   int
+	}{
+		{"bearer scheme", "Bearer ", "", http.StatusUnauthorized},
+		{"missing proof", "DPoP ", "", http.StatusUnauthorized},
+		{"valid proof", "DPoP ", proof, http.StatusOK},
+		{"replayed proof", "DPoP ", proof, http.StatusUnauthorized},
+		{"wrong url", "DPoP ", dpopProofMock(t, key, http.MethodGet, "http://example.com/other", tr.AccessToken), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := httptest.NewRecorder()
+			mr := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			mr.Header.Set("Authorization", tt.scheme+tr.AccessToken)
+			if tt.proof != "" {
+				mr.Header.Set(token.DPoPHeader, tt.proof)
+			}
+
+			protected.ServeHTTP(mw, mr)
+
+			if mw.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, mw.Result().StatusCode)
+			}
+		})
+	}
+}
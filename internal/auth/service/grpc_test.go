@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	fauthlessv1 "github.com/rafaeldepontes/fauthless-go/pkg/pb/fauthless/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcClientMock serves the AuthService of the service in memory, with the
+// interceptors of the middleware, and returns a client connected to it.
+func grpcClientMock(t *testing.T, service auth.Service) fauthlessv1.AuthServiceClient {
+	s := service.(*authService)
+	m := middleware.NewMiddleware(configMock(), s.userRepository, s.audit, s.Cache)
+	public := []string{fauthlessv1.AuthService_Login_FullMethodName, fauthlessv1.AuthService_Introspect_FullMethodName}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(m.UnaryInterceptor(public...)),
+		grpc.ChainStreamInterceptor(m.StreamInterceptor(public...)),
+	)
+	fauthlessv1.RegisterAuthServiceServer(grpcServer, server.NewAuthGrpcServer(&service))
+
+	listener := bufconn.Listen(1024 * 1024)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed connecting to the grpc server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return fauthlessv1.NewAuthServiceClient(conn)
+}
+
+// TestGrpcAuthService verifies the login over gRPC and that the calls
+// behind the interceptor need a valid token that isn't denylisted.
+func TestGrpcAuthService(t *testing.T) {
+	// given
+	service, userRepo, _, caches := prepareMocks()
+	loginFlowMock(userRepo)
+	client := grpcClientMock(t, service)
+	ctx := context.Background()
+
+	// when
+	login, err := client.Login(ctx, &fauthlessv1.LoginRequest{Username: usernameMockTest, Password: hashedPasswordMock})
+
+	// then
+	if err != nil || login.AccessToken == "" || login.RefreshToken == "" {
+		t.Fatalf("expected the tokens of the login, got %v %v", login, err)
+	}
+
+	if _, err := client.Login(ctx, &fauthlessv1.LoginRequest{Username: usernameMockTest, Password: "wrong"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for the wrong password, got %v", err)
+	}
+
+	revoke := &fauthlessv1.RevokeRequest{SessionId: login.SessionId}
+	tests := []struct {
+		name   string
+		header string
+		want   codes.Code
+	}{
+		{"no token", "", codes.Unauthenticated},
+		{"invalid token", "Bearer invalid", codes.Unauthenticated},
+		{"valid token", "Bearer " + login.AccessToken, codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCtx := ctx
+			if tt.header != "" {
+				callCtx = metadata.AppendToOutgoingContext(ctx, middleware.AuthorizationMetadata, tt.header)
+			}
+
+			_, err := client.Revoke(callCtx, revoke)
+
+			if status.Code(err) != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// the denylisted tokens are rejected like in http
+	caches.TokenCache.Set(login.AccessToken, true, login.AccessTokenExpiresAt.AsTime())
+	callCtx := metadata.AppendToOutgoingContext(ctx, middleware.AuthorizationMetadata, "Bearer "+login.AccessToken)
+	if _, err := client.Revoke(callCtx, revoke); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the denylisted token to be rejected, got %v", err)
+	}
+}
+
+// TestGrpcIntrospect verifies only the confidential clients, with their
+// credentials in the metadata, can introspect the tokens.
+func TestGrpcIntrospect(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	loginFlowMock(userRepo)
+	s := service.(*authService)
+	secretHash := hashToken(resourceServerSecretMock)
+	s.oauthRepository.CreateClient(context.Background(), &domain.OAuthClient{Id: resourceServerIdMock, SecretHash: &secretHash, IsConfidential: true})
+	s.oauthRepository.CreateClient(context.Background(), &domain.OAuthClient{Id: clientIdMock})
+	client := grpcClientMock(t, service)
+	ctx := context.Background()
+
+	login, err := client.Login(ctx, &fauthlessv1.LoginRequest{Username: usernameMockTest, Password: hashedPasswordMock})
+	if err != nil {
+		t.Fatalf("failed logging in: %v", err)
+	}
+	basic := func(clientId, clientSecret string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(clientId+":"+clientSecret))
+	}
+
+	introspect := &fauthlessv1.IntrospectRequest{Token: login.RefreshToken}
+	tests := []struct {
+		name   string
+		header string
+		want   codes.Code
+	}{
+		{"no credentials", "", codes.Unauthenticated},
+		{"access token", "Bearer " + login.AccessToken, codes.Unauthenticated},
+		{"wrong secret", basic(resourceServerIdMock, "wrong"), codes.Unauthenticated},
+		{"public client", basic(clientIdMock, ""), codes.Unauthenticated},
+		{"confidential client", basic(resourceServerIdMock, resourceServerSecretMock), codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCtx := ctx
+			if tt.header != "" {
+				callCtx = metadata.AppendToOutgoingContext(ctx, middleware.AuthorizationMetadata, tt.header)
+			}
+
+			// when
+			resp, err := client.Introspect(callCtx, introspect)
+
+			// then
+			if status.Code(err) != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if tt.want == codes.OK && (!resp.Active || resp.Username != usernameMockTest) {
+				t.Fatalf("expected the refresh token to be active, got %v", resp)
+			}
+		})
+	}
+
+	// when the token is introspected in another organization
+	acme, _, _ := organizationsMock()
+	callCtx := metadata.NewIncomingContext(tenant.WithOrganization(ctx, acme), metadata.Pairs(middleware.AuthorizationMetadata, basic(resourceServerIdMock, resourceServerSecretMock)))
+	resp, err := server.NewAuthGrpcServer(&service).Introspect(callCtx, introspect)
+
+	// then
+	if err != nil || resp.Active || resp.Username != "" {
+		t.Fatalf("expected the token of the default organization to be inactive, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Introspect implements RFC 7662, it tells resource servers if a token is
+// still active after checking its signature, the denylist and the session
+// it belongs to. Only confidential clients can introspect tokens.
+func (s *authService) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	if !client.IsConfidential {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidClient, "only confidential clients can introspect tokens", http.StatusUnauthorized)
+		return
+	}
+
+	rawToken := r.PostForm.Get("token")
+	if rawToken == "" {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	introspection := s.IntrospectToken(r.Context(), rawToken)
+
+	s.Logger.Infof("The client %v introspected a token, active: %v", client.Id, introspection.Active)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(introspection)
+}
+
+// IntrospectToken tells if the token is still active and what it carries,
+// the inactive tokens have nothing else. The tokens of another organization
+// are inactive, the clients are shared by every organization.
+func (s *authService) IntrospectToken(ctx context.Context, rawToken string) *domain.IntrospectionResponse {
+	userClaims, tokenType, ok := s.activeToken(ctx, rawToken)
+	if !ok || !tenant.Matches(ctx, userClaims.TenantId) {
+		return &domain.IntrospectionResponse{Active: false}
+	}
+
+	return &domain.IntrospectionResponse{
+		Active:    true,
+		Scope:     userClaims.Scope,
+		ClientId:  userClaims.ClientId,
+		Username:  userClaims.Username,
+		TokenType: tokenType,
+		Exp:       userClaims.ExpiresAt.Unix(),
+		Iat:       userClaims.IssuedAt.Unix(),
+		Sub:       userClaims.Subject,
+		Iss:       userClaims.Issuer,
+		Jti:       userClaims.ID,
+		Act:       userClaims.Act,
+		Cnf:       userClaims.Cnf,
+	}
+}
+
+// Revoke implements RFC 7009, refresh tokens have their session revoked and
+// access tokens are added to the denylist. Clients can only revoke their own
+// tokens, invalid tokens are ignored as the RFC says.
+func (s *authService) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := s.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	rawToken := r.PostForm.Get("token")
+	if rawToken == "" {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, err := s.jwtMaker.VerifyToken(rawToken)
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if userClaims.ClientId != client.Id {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthUnauthorizedClient, "the token was issued to another client", http.StatusBadRequest)
+		return
+	}
+
+	if session, err := s.sessionRepository.FindSessionById(r.Context(), userClaims.ID); err == nil && session.RefreshToken == rawToken {
+		if err := s.sessionRepository.RevokeSession(r.Context(), session.Id); err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusServiceUnavailable)
+			return
+		}
+		s.Logger.Infof("The client %v revoked the session %v", client.Id, session.Id)
+	} else {
+		denyToken(s, rawToken, userClaims)
+		s.Logger.Infof("The client %v revoked the access token %v", client.Id, userClaims.ID)
+	}
+
+	s.audit.Record(r.Context(), &audit.Event{
+		Action:   audit.ActionTokenRevoked,
+		Subject:  userClaims.Username,
+		Target:   userClaims.ID,
+		ClientId: client.Id,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// activeToken checks a token the same way the middlewares and the renew flow
+// do, returns its claims and its type when it's still active.
+func (s *authService) activeToken(ctx context.Context, rawToken string) (*token.UserClaims, string, bool) {
+	userClaims, err := s.jwtMaker.VerifyToken(rawToken)
+	if err != nil {
+		return nil, "", false
+	}
+
+	if denied, ok := s.Cache.TokenCache.Get(rawToken); ok && denied {
+		return nil, "", false
+	}
+
+	if session, err := s.sessionRepository.FindSessionById(ctx, userClaims.ID); err == nil && session.RefreshToken == rawToken {
+		if session.IsRevoked || session.Username != userClaims.Username {
+			return nil, "", false
+		}
+		return userClaims, TokenTypeHintRefreshToken, true
+	}
+
+	if userClaims.SessionId != "" {
+		session, err := s.sessionRepository.FindSessionById(ctx, userClaims.SessionId)
+		if err != nil || session.IsRevoked {
+			return nil, "", false
+		}
+	}
+
+	return userClaims, TokenTypeHintAccessToken, true
+}
+
+func denyToken(s *authService, rawToken string, userClaims *token.UserClaims) {
+	invalid := true
+	s.Cache.TokenCache.Set(rawToken, invalid, userClaims.ExpiresAt.Time)
+}
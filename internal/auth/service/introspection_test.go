@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+const (
+	resourceServerIdMock     = "resource-server"
+	resourceServerSecretMock = "resource-server-secret"
+)
+
+func introspectMock(t *testing.T, s *authService, rawToken string) domain.IntrospectionResponse {
+	form := url.Values{}
+	form.Set("token", rawToken)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(resourceServerIdMock, resourceServerSecretMock)
+	w := httptest.NewRecorder()
+	s.Introspect(w, r)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Result().StatusCode)
+	}
+
+	var introspection domain.IntrospectionResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&introspection); err != nil {
+		t.Fatalf("failed decoding introspection response: %v", err)
+	}
+	return introspection
+}
+
+func revokeMock(s *authService, rawToken string) *http.Response {
+	form := url.Values{}
+	form.Set("token", rawToken)
+	form.Set("client_id", clientIdMock)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.Revoke(w, r)
+	return w.Result()
+}
+
+func prepareIntrospection(t *testing.T) (*authService, domain.OAuthTokenResponse) {
+	s, oauthRepo, cookies := prepareAuthorizationServer(t)
+	secretHash := hashToken(resourceServerSecretMock)
+	oauthRepo.CreateClient(context.Background(), &domain.OAuthClient{
+		Id:             resourceServerIdMock,
+		SecretHash:     &secretHash,
+		Name:           "Resource server",
+		IsConfidential: true,
+	})
+
+	return s, authorizeAndExchangeMock(t, s, cookies, "profile")
+}
+
+// TestIntrospect_PublicClient verifies public clients can't introspect
+// tokens.
+func TestIntrospect_PublicClient(t *testing.T) {
+	// given
+	s, tr := prepareIntrospection(t)
+	form := url.Values{}
+	form.Set("token", tr.AccessToken)
+	form.Set("client_id", clientIdMock)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	// when
+	s.Introspect(w, r)
+
+	// then
+	if w.Result().StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 Unauthorized, got %d", w.Result().StatusCode)
+	}
+}
+
+// TestIntrospect_Success verifies both tokens are active with their
+// metadata after the exchange.
+func TestIntrospect_Success(t *testing.T) {
+	// given
+	s, tr := prepareIntrospection(t)
+
+	// when
+	access := introspectMock(t, s, tr.AccessToken)
+	refresh := introspectMock(t, s, tr.RefreshToken)
+
+	// then
+	if !access.Active || access.TokenType != TokenTypeHintAccessToken {
+		t.Fatalf("expected an active access token, got %+v", access)
+	}
+
+	if access.ClientId != clientIdMock || access.Username != usernameMockTest || access.Scope != "profile" {
+		t.Fatalf("unexpected access token metadata: %+v", access)
+	}
+
+	if !refresh.Active || refresh.TokenType != TokenTypeHintRefreshToken {
+		t.Fatalf("expected an active refresh token, got %+v", refresh)
+	}
+
+	if invalid := introspectMock(t, s, "not-a-token"); invalid.Active {
+		t.Fatal("expected an invalid token to be inactive")
+	}
+}
+
+// TestIntrospect_OtherOrganization verifies the tokens of another
+// organization are inactive, the clients are shared by every organization.
+func TestIntrospect_OtherOrganization(t *testing.T) {
+	// given
+	s, tr := prepareIntrospection(t)
+	acme, _, _ := organizationsMock()
+	form := url.Values{}
+	form.Set("token", tr.AccessToken)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(resourceServerIdMock, resourceServerSecretMock)
+	w := httptest.NewRecorder()
+
+	// when
+	s.Introspect(w, r.WithContext(tenant.WithOrganization(r.Context(), acme)))
+
+	// then
+	var introspection domain.IntrospectionResponse
+	json.NewDecoder(w.Result().Body).Decode(&introspection)
+	if w.Result().StatusCode != http.StatusOK || introspection.Active || introspection.Username != "" {
+		t.Fatalf("expected the token of the default organization to be inactive, got %d %+v", w.Result().StatusCode, introspection)
+	}
+
+	if !introspectMock(t, s, tr.AccessToken).Active {
+		t.Fatal("expected the token to stay active in its organization")
+	}
+}
+
+// TestRevoke_RefreshToken verifies revoking the refresh token also makes
+// the access tokens of its session inactive.
+func TestRevoke_RefreshToken(t *testing.T) {
+	// given
+	s, tr := prepareIntrospection(t)
+
+	// when
+	resp := revokeMock(s, tr.RefreshToken)
+
+	// then
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	if introspectMock(t, s, tr.RefreshToken).Active {
+		t.Fatal("expected the refresh token to be inactive after the revocation")
+	}
+
+	if introspectMock(t, s, tr.AccessToken).Active {
+		t.Fatal("expected the access token of the session to be inactive after the revocation")
+	}
+}
+
+// TestRevoke_AccessToken verifies a revoked access token is denylisted
+// while its refresh token stays active.
+func TestRevoke_AccessToken(t *testing.T) {
+	// given
+	s, tr := prepareIntrospection(t)
+
+	// when
+	resp := revokeMock(s, tr.AccessToken)
+
+	// then
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	if introspectMock(t, s, tr.AccessToken).Active {
+		t.Fatal("expected the access token to be inactive after the revocation")
+	}
+
+	if !introspectMock(t, s, tr.RefreshToken).Active {
+		t.Fatal("expected the refresh token to stay active")
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/ldap"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ldapBindDnMock       = "cn=fauthless,ou=services,dc=example,dc=com"
+	ldapBindPasswordMock = "service-password"
+)
+
+type ldapEntryMock struct {
+	password   string
+	attributes map[string][]string
+}
+
+// ldapStub is an in-process directory, its connections answer the binds
+// and the searches by the username attribute.
+type ldapStub struct {
+	entries  map[string]ldapEntryMock
+	filters  []string
+	dialErr  error
+	boundDns []string
+}
+
+func (stub *ldapStub) dial(ctx context.Context) (ldap.Conn, error) {
+	if stub.dialErr != nil {
+		return nil, stub.dialErr
+	}
+	return &ldapConnMock{stub: stub}, nil
+}
+
+type ldapConnMock struct {
+	stub *ldapStub
+}
+
+func (conn *ldapConnMock) Bind(username, password string) error {
+	if username == ldapBindDnMock && password == ldapBindPasswordMock {
+		return nil
+	}
+	if entry, ok := conn.stub.entries[username]; ok && entry.password == password {
+		conn.stub.boundDns = append(conn.stub.boundDns, username)
+		return nil
+	}
+	return goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (conn *ldapConnMock) Search(req *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	conn.stub.filters = append(conn.stub.filters, req.Filter)
+
+	result := &goldap.SearchResult{}
+	for dn, entry := range conn.stub.entries {
+		for _, uid := range entry.attributes["uid"] {
+			if strings.Contains(req.Filter, "(uid="+goldap.EscapeFilter(uid)+")") {
+				result.Entries = append(result.Entries, goldap.NewEntry(dn, entry.attributes))
+			}
+		}
+	}
+	return result, nil
+}
+
+func (conn *ldapConnMock) Close() error { return nil }
+
+func prepareLdap() (auth.Service, *userRepoMock, *ldapStub) {
+	service, userRepo, _, _ := prepareMocks()
+	stub := &ldapStub{entries: map[string]ldapEntryMock{
+		"uid=alice,ou=people,dc=example,dc=com": {
+			password: "alice-password",
+			attributes: map[string][]string{
+				"uid":      {"alice"},
+				"mail":     {"alice@example.com"},
+				"memberOf": {"cn=Domain Admins,ou=groups,dc=example,dc=com", "cn=Interns,ou=groups,dc=example,dc=com"},
+			},
+		},
+	}}
+
+	config := &configs.Configuration{
+		LdapBindDn:            ldapBindDnMock,
+		LdapBindPassword:      ldapBindPasswordMock,
+		LdapBaseDn:            "dc=example,dc=com",
+		LdapUserFilter:        "(objectClass=person)",
+		LdapUsernameAttribute: "uid",
+		LdapEmailAttribute:    "mail",
+		LdapGroupAttribute:    "memberOf",
+		LdapGroupRoles:        []string{"Domain Admins=admin"},
+	}
+	s := service.(*authService)
+	s.credentials = []auth.CredentialVerifier{ldap.NewVerifier(config, userRepo, stub.dial), &databaseVerifier{userRepository: userRepo}}
+
+	return service, userRepo, stub
+}
+
+func ldapLoginMock(service auth.Service, username, password string) *http.Response {
+	body, _ := json.Marshal(domain.UserLogin{Username: username, Password: password})
+	w := httptest.NewRecorder()
+	controllerMock(service).LoginJwtBasedEp(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+	return w.Result()
+}
+
+// TestLogin_Ldap verifies the directory users log in with the jwt mode,
+// they are provisioned with the roles of their groups and can't log in
+// with a local password.
+func TestLogin_Ldap(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareLdap()
+
+	// when
+	resp := ldapLoginMock(service, "alice", "alice-password")
+
+	// then
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", resp.StatusCode)
+	}
+	if !slices.Equal(stub.boundDns, []string{"uid=alice,ou=people,dc=example,dc=com"}) {
+		t.Errorf("expected a bind as the user, got %v", stub.boundDns)
+	}
+
+	alice, ok := userRepo.users["alice"]
+	if !ok {
+		t.Fatal("expected the user to be provisioned")
+	}
+	if *alice.HashedPassword != domain.NoPassword || *alice.Email != "alice@example.com" {
+		t.Errorf("unexpected provisioned user: %+v", alice)
+	}
+	if !slices.Equal(alice.Roles, []string{domain.RoleAdmin}) {
+		t.Errorf("expected the roles of the groups, got %v", alice.Roles)
+	}
+
+	// when logging in again with the cookie mode
+	body, _ := json.Marshal(domain.UserLogin{Username: "alice", Password: "alice-password"})
+	w := httptest.NewRecorder()
+	controllerMock(service).LoginCookieBasedEp(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+
+	// then
+	if w.Result().StatusCode != http.StatusOK || len(userRepo.users) != 1 {
+		t.Errorf("expected the same user to log in, got %d with %v users", w.Result().StatusCode, len(userRepo.users))
+	}
+}
+
+// TestLogin_LdapRejected verifies the wrong passwords, the filters with
+// special characters and the unreachable directory.
+func TestLogin_LdapRejected(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareLdap()
+
+	// when
+	wrongPassword := ldapLoginMock(service, "alice", "wrong")
+	emptyPassword := ldapLoginMock(service, "alice", "")
+	injection := ldapLoginMock(service, "*)(uid=*", "alice-password")
+
+	// then
+	for name, resp := range map[string]*http.Response{"wrong password": wrongPassword, "empty password": emptyPassword, "injection": injection} {
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: expected 400 Bad Request, got %d", name, resp.StatusCode)
+		}
+	}
+	if len(userRepo.users) != 0 {
+		t.Errorf("expected no user to be provisioned, got %v", userRepo.users)
+	}
+	if !slices.ContainsFunc(stub.filters, func(filter string) bool { return strings.Contains(filter, `\2a\29\28uid=\2a`) }) {
+		t.Errorf("expected the username to be escaped, got %v", stub.filters)
+	}
+
+	// when the directory is down
+	stub.dialErr = errors.New("connection refused")
+	resp := ldapLoginMock(service, "alice", "alice-password")
+
+	// then
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", resp.StatusCode)
+	}
+}
+
+// TestLogin_LdapLocalUsers verifies the users unknown by the directory use
+// the users table, and that a local user isn't taken over by the directory
+// user with the same name.
+func TestLogin_LdapLocalUsers(t *testing.T) {
+	// given
+	service, userRepo, _ := prepareLdap()
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("local-password"), bcrypt.MinCost)
+	for _, username := range []string{usernameMockBob, "alice"} {
+		userRepo.RegisterUser(context.Background(), &domain.User{Username: ptrString(username), HashedPassword: ptrString(string(hashed)), Age: ptrInt(ageMock)})
+	}
+
+	// when
+	local := ldapLoginMock(service, usernameMockBob, "local-password")
+	takeover := ldapLoginMock(service, "alice", "alice-password")
+
+	// then
+	if local.StatusCode != http.StatusCreated {
+		t.Errorf("expected the local user to log in, got %d", local.StatusCode)
+	}
+	if takeover.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected the directory user to be rejected, got %d", takeover.StatusCode)
+	}
+}
+
+// TestLogin_LdapOtherOrganization verifies the directory isn't used by the
+// logins of another organization, its users aren't provisioned there.
+func TestLogin_LdapOtherOrganization(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareLdap()
+	acme, _, _ := organizationsMock()
+	body, _ := json.Marshal(domain.UserLogin{Username: "alice", Password: "alice-password"})
+	r := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+
+	// when
+	w := httptest.NewRecorder()
+	controllerMock(service).LoginJwtBasedEp(w, r.WithContext(tenant.WithOrganization(r.Context(), acme)))
+
+	// then
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+	if len(userRepo.users) != 0 || len(stub.boundDns) != 0 {
+		t.Errorf("expected the directory to be skipped, got %v users and binds %v", len(userRepo.users), stub.boundDns)
+	}
+}
+
+// lookupErrUserRepoMock fails to look up the users, like a database that
+// can't be reached.
+type lookupErrUserRepoMock struct {
+	*userRepoMock
+}
+
+func (mock *lookupErrUserRepoMock) FindUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+// TestLogin_LdapLookupError verifies a directory user isn't provisioned
+// again when the users table can't be read.
+func TestLogin_LdapLookupError(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareLdap()
+	failing := &lookupErrUserRepoMock{userRepo}
+	service.(*authService).credentials[0] = ldap.NewVerifier(&configs.Configuration{
+		LdapBindDn:            ldapBindDnMock,
+		LdapBindPassword:      ldapBindPasswordMock,
+		LdapBaseDn:            "dc=example,dc=com",
+		LdapUserFilter:        "(objectClass=person)",
+		LdapUsernameAttribute: "uid",
+		LdapEmailAttribute:    "mail",
+	}, failing, stub.dial)
+
+	// when
+	res := ldapLoginMock(service, "alice", "alice-password")
+
+	// then
+	if res.StatusCode == http.StatusCreated {
+		t.Errorf("expected the login to fail, got %d", res.StatusCode)
+	}
+	if len(userRepo.users) != 0 {
+		t.Errorf("expected no user to be registered, got %v", len(userRepo.users))
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+)
+
+func clientCertificateMock(t *testing.T, commonName string) *x509.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating the certificate: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func withClientCertificate(r *http.Request, cert *x509.Certificate) *http.Request {
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+// TestMutualTLS verifies the client certificate is mapped to its user and
+// the requests without a known certificate are rejected.
+func TestMutualTLS(t *testing.T) {
+	// given
+	service, userRepo, _, caches := prepareMocks()
+	s := service.(*authService)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(1), Username: ptrString(usernameMockTest)})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, caches)
+	var username string
+	protected := m.MutualTLS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userClaims, _ := middleware.UserClaimsFromContext(r.Context())
+		username = userClaims.Username
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want int
+	}{
+		{"no certificate", nil, http.StatusUnauthorized},
+		{"unknown user", clientCertificateMock(t, usernameMockBob), http.StatusUnauthorized},
+		{"known user", clientCertificateMock(t, usernameMockTest), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			if tt.cert != nil {
+				r = withClientCertificate(r, tt.cert)
+			}
+
+			// when
+			protected.ServeHTTP(w, r)
+
+			// then
+			if w.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Result().StatusCode)
+			}
+
+			if tt.want == http.StatusOK && username != usernameMockTest {
+				t.Fatalf("expected the claims of %v, got %v", usernameMockTest, username)
+			}
+		})
+	}
+}
+
+// TestLoginJwtBased_CertificateBound verifies a login over mutual TLS binds
+// the access token to the certificate, RFC 8705.
+func TestLoginJwtBased_CertificateBound(t *testing.T) {
+	// given
+	service, userRepo, _, caches := prepareMocks()
+	s := service.(*authService)
+	cert := clientCertificateMock(t, usernameMockTest)
+
+	w, r := loginFlowMock(userRepo)
+	r = withClientCertificate(r, cert)
+
+	// when
+	controllerMock(service).LoginJwtBasedEp(w, r)
+
+	var tr domain.TokenResponse
+	json.NewDecoder(w.Result().Body).Decode(&tr)
+
+	// then
+	if w.Result().StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", w.Result().StatusCode)
+	}
+
+	claims, _ := s.jwtMaker.VerifyToken(tr.Token)
+	if claims.Cnf == nil || claims.Cnf.CertificateThumbprint != middleware.CertificateThumbprint(cert) {
+		t.Fatal("expected the certificate thumbprint in the cnf claim")
+	}
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, caches)
+	protected := m.JwtBased(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want int
+	}{
+		{"without certificate", nil, http.StatusUnauthorized},
+		{"another certificate", clientCertificateMock(t, usernameMockTest), http.StatusUnauthorized},
+		{"same certificate", cert, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := httptest.NewRecorder()
+			mr := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			mr.Header.Set("Authorization", "Bearer "+tr.Token)
+			if tt.cert != nil {
+				mr = withClientCertificate(mr, tt.cert)
+			}
+
+			protected.ServeHTTP(mw, mr)
+
+			if mw.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, mw.Result().StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"github.com/rafaeldepontes/fauthless-go/internal/tool"
+)
+
+const (
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// OpenIdConfiguration serves the OpenID Connect discovery document.
+func (s *authService) OpenIdConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := s.issuer(r)
+
+	configuration := domain.OpenIdConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JwksUri:                           issuer + "/.well-known/jwks.json",
+		EndSessionEndpoint:                issuer + "/oauth/logout",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		ScopesSupported:                   []string{ScopeOpenId, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeDeviceCode, GrantTypeTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{token.SigningAlg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr", "azp", "preferred_username", "age", "email", "email_verified"},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(configuration)
+}
+
+// Jwks serves the public keys used to sign the ID tokens, and the access
+// tokens when ACCESS_TOKEN_ALG is RS256.
+func (s *authService) Jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.keySet.JWKS())
+}
+
+// UserInfo returns the claims about the owner of the access token, only the
+// ones allowed by the scopes granted (profile, email) are sent.
+func (s *authService) UserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	userClaims, err := s.jwtMaker.VerifyToken(accessToken)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		errorhandler.UnauthroizedErrorHandler(w, err)
+		return
+	}
+
+	scopes := strings.Fields(userClaims.Scope)
+	if !slices.Contains(scopes, ScopeOpenId) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrInvalidScope)
+		return
+	}
+
+	user, err := s.userRepository.FindUserByUsername(r.Context(), userClaims.Username)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrUserNotFound)
+		return
+	}
+
+	userInfo := domain.UserInfo{Subject: userClaims.Subject}
+	if slices.Contains(scopes, ScopeProfile) {
+		userInfo.PreferredUsername = *user.Username
+		userInfo.Age = user.Age
+	}
+	if slices.Contains(scopes, ScopeEmail) && user.Email != nil {
+		emailVerified := false
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = &emailVerified
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(userInfo)
+}
+
+// EndSession is the RP-initiated logout endpoint, it ends the browser session
+// and sends the user back to the client when the post logout redirect uri
+// is registered for it.
+func (s *authService) EndSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	clientId := r.Form.Get("client_id")
+	if idTokenHint := r.Form.Get("id_token_hint"); idTokenHint != "" {
+		var idTokenClaims token.IdTokenClaims
+		err := s.keySet.Verify(idTokenHint, &idTokenClaims, jwt.WithoutClaimsValidation())
+		if err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+			return
+		}
+
+		if len(idTokenClaims.Audience) > 0 {
+			if clientId != "" && clientId != idTokenClaims.Audience[0] {
+				errorhandler.BadRequestErrorHandler(w, errorhandler.ErrClientNotFound, r.URL.Path)
+				return
+			}
+			clientId = idTokenClaims.Audience[0]
+		}
+	}
+
+	postLogoutRedirectUri := r.Form.Get("post_logout_redirect_uri")
+	if postLogoutRedirectUri != "" {
+		client, err := s.oauthRepository.FindClientById(r.Context(), clientId)
+		if err != nil || !slices.Contains(client.RedirectUris, postLogoutRedirectUri) {
+			s.Logger.Errorf("An error occurred: %v", errorhandler.ErrInvalidRedirectUri)
+			errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidRedirectUri, r.URL.Path)
+			return
+		}
+	}
+
+	if err := s.endBrowserSession(w, r); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	s.Logger.Infoln("The user logged out of the browser session.")
+
+	if postLogoutRedirectUri == "" {
+		renderTemplate(s, w, http.StatusOK, "logout.html", nil)
+		return
+	}
+
+	redirectUri, _ := url.Parse(postLogoutRedirectUri)
+	if state := r.Form.Get("state"); state != "" {
+		query := redirectUri.Query()
+		query.Set("state", state)
+		redirectUri.RawQuery = query.Encode()
+	}
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+// generateIdToken creates the ID token for the authorization code exchanged,
+// signed with the asymmetric key so the client can verify it with the JWKS.
+func (s *authService) generateIdToken(r *http.Request, code *domain.AuthorizationCode) (string, error) {
+	idTokenClaims := token.NewIdTokenClaims(
+		s.issuer(r),
+		code.Username,
+		code.ClientId,
+		code.Nonce,
+		code.AuthTime,
+		strings.Fields(code.Amr),
+		s.accessTokenDuration(r.Context()),
+	)
+	return s.keySet.Sign(idTokenClaims)
+}
+
+// issuer is the public url of the server, used as the issuer of the
+// OpenID Connect provider.
+func (s *authService) issuer(r *http.Request) string {
+	return tool.BaseUrl(r, s.issuerUrl)
+}
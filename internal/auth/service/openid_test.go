@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"github.com/rafaeldepontes/fauthless-go/pkg/authn"
+)
+
+const emailMock = "test@example.com"
+
+// authorizeAndExchangeMock goes through Authorize and Token with an already
+// given consent and returns the token response.
+func authorizeAndExchangeMock(t *testing.T, s *authService, cookies []*http.Cookie, scope string) domain.OAuthTokenResponse {
+	s.oauthRepository.SaveConsent(context.Background(), &domain.OAuthConsent{Username: usernameMockTest, ClientId: clientIdMock, Scope: scope})
+
+	w := httptest.NewRecorder()
+	s.Authorize(w, authorizeRequestWithScopeMock(cookies, scope))
+	location, _ := url.Parse(w.Result().Header.Get("Location"))
+
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeAuthorizationCode)
+	form.Set("client_id", clientIdMock)
+	form.Set("redirect_uri", redirectUriMock)
+	form.Set("code", location.Query().Get("code"))
+	form.Set("code_verifier", codeVerifierMock)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	s.Token(rr, r)
+
+	var tr domain.OAuthTokenResponse
+	if err := json.NewDecoder(rr.Result().Body).Decode(&tr); err != nil {
+		t.Fatalf("failed decoding token response: %v", err)
+	}
+	return tr
+}
+
+// TestOpenIdConfiguration verifies the discovery document points to the
+// endpoints of the issuer.
+func TestOpenIdConfiguration(t *testing.T) {
+	// given
+	s, _, _ := prepareAuthorizationServer(t)
+	r := httptest.NewRequest(http.MethodGet, "http://auth.example.com/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	s.OpenIdConfiguration(w, r)
+
+	var configuration domain.OpenIdConfiguration
+	json.NewDecoder(w.Result().Body).Decode(&configuration)
+
+	// then
+	if configuration.Issuer != "http://auth.example.com" {
+		t.Fatalf("unexpected issuer: %v", configuration.Issuer)
+	}
+
+	if configuration.JwksUri != "http://auth.example.com/.well-known/jwks.json" {
+		t.Fatalf("unexpected jwks_uri: %v", configuration.JwksUri)
+	}
+}
+
+// TestIdToken_Success verifies the ID token is issued for the openid scope
+// with the nonce, auth_time, amr and acr claims.
+func TestIdToken_Success(t *testing.T) {
+	// given
+	s, _, cookies := prepareAuthorizationServer(t)
+
+	// when
+	tr := authorizeAndExchangeMock(t, s, cookies, "openid profile")
+
+	// then
+	if tr.IdToken == "" {
+		t.Fatal("expected an id token in response")
+	}
+
+	var claims token.IdTokenClaims
+	if err := s.keySet.Verify(tr.IdToken, &claims); err != nil {
+		t.Fatalf("failed verifying the id token: %v", err)
+	}
+
+	if claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Fatalf("expected the nonce to be sent back, got %v", claims.Nonce)
+	}
+
+	if claims.AuthTime == nil || !slices.Contains(claims.Amr, token.AmrPassword) || claims.Acr == "" {
+		t.Fatalf("expected auth_time, amr and acr claims, got %+v", claims)
+	}
+
+	if !slices.Contains(claims.Audience, clientIdMock) || claims.Subject != usernameMockTest {
+		t.Fatalf("unexpected aud or sub: %v, %v", claims.Audience, claims.Subject)
+	}
+}
+
+// TestJwks_AccessTokens verifies the access tokens signed with
+// ACCESS_TOKEN_ALG=RS256 are verified by pkg/authn with the jwks_uri, and
+// that neither accepts the ID tokens signed by the same keys.
+func TestJwks_AccessTokens(t *testing.T) {
+	// given
+	s, _, cookies := prepareAuthorizationServer(t)
+	config := configMock()
+	config.AccessTokenAlg = token.SigningAlg
+	s.jwtMaker = newJwtBuilder(config, s.keySet)
+	jwksServer := httptest.NewServer(http.HandlerFunc(s.Jwks))
+	defer jwksServer.Close()
+	verifier, _ := authn.NewVerifier(authn.Config{JwksUrl: jwksServer.URL, Issuer: config.Issuer})
+
+	// when
+	tr := authorizeAndExchangeMock(t, s, cookies, "openid profile")
+	claims, err := verifier.Verify(context.Background(), tr.AccessToken)
+
+	// then
+	if err != nil || claims.Username != usernameMockTest || claims.Scope != "openid profile" {
+		t.Fatalf("expected the access token to be verified with the jwks, got %+v %v", claims, err)
+	}
+	if userClaims, err := s.jwtMaker.VerifyToken(tr.AccessToken); err != nil || userClaims.Username != usernameMockTest {
+		t.Errorf("expected the server to verify its access token, got %+v %v", userClaims, err)
+	}
+
+	// when the ID token is sent as an access token
+	_, authnErr := verifier.Verify(context.Background(), tr.IdToken)
+	_, serverErr := s.jwtMaker.VerifyToken(tr.IdToken)
+
+	// then
+	if !errors.Is(authnErr, authn.ErrInvalidToken) || serverErr == nil {
+		t.Errorf("expected the ID token to be rejected, got %v and %v", authnErr, serverErr)
+	}
+}
+
+// TestUserInfo_Scopes verifies UserInfo only returns the claims allowed
+// by the scopes of the access token.
+func TestUserInfo_Scopes(t *testing.T) {
+	// given
+	s, _, cookies := prepareAuthorizationServer(t)
+	userRepo := s.userRepository.(*userRepoMock)
+	userRepo.RegisterUser(context.Background(), &domain.User{
+		Id:       ptrInt64(1),
+		Username: ptrString(usernameMockTest),
+		Age:      ptrInt(ageMock),
+		Email:    ptrString(emailMock),
+	})
+
+	tests := []struct {
+		name      string
+		scope     string
+		wantName  bool
+		wantEmail bool
+	}{
+		{"profile only", "openid profile", true, false},
+		{"email only", "openid email", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := authorizeAndExchangeMock(t, s, cookies, tt.scope)
+
+			r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			r.Header.Set("Authorization", "Bearer "+tr.AccessToken)
+			w := httptest.NewRecorder()
+
+			// when
+			s.UserInfo(w, r)
+
+			var userInfo domain.UserInfo
+			json.NewDecoder(w.Result().Body).Decode(&userInfo)
+
+			// then
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %d", w.Result().StatusCode)
+			}
+
+			if userInfo.Subject != usernameMockTest {
+				t.Fatalf("unexpected sub: %v", userInfo.Subject)
+			}
+
+			if (userInfo.PreferredUsername != "") != tt.wantName {
+				t.Fatalf("preferred_username = %q, want it: %v", userInfo.PreferredUsername, tt.wantName)
+			}
+
+			if (userInfo.Email != nil) != tt.wantEmail {
+				t.Fatalf("email = %v, want it: %v", userInfo.Email, tt.wantEmail)
+			}
+		})
+	}
+}
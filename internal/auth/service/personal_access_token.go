@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// CreatePersonalAccessToken creates a long lived token for scripts and CI,
+// it authenticates as the user until it expires or is deleted. The token is
+// only shown once.
+func (s *authService) CreatePersonalAccessToken(ctx context.Context, userId int64, username string, req *domain.PersonalAccessTokenRequest) (*domain.PersonalAccessTokenResponse, error) {
+	if req.Name == "" {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrTokenNameIsRequired)
+		return nil, errorhandler.Invalid(errorhandler.ErrTokenNameIsRequired)
+	}
+
+	if err := s.checkLoginMode(ctx, middleware.AuthMethodPersonalAccessToken); err != nil {
+		return nil, err
+	}
+
+	rawToken := token.NewPersonalAccessToken(Token_Length)
+	pat := &domain.PersonalAccessToken{
+		Id:        uuid.NewString(),
+		TokenHash: token.HashPersonalAccessToken(rawToken),
+		Name:      req.Name,
+		UserId:    userId,
+		Username:  username,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionPersonalAccessTokenCreated, pat.Id)
+	if err := s.patRepository.CreatePersonalAccessToken(ctx, pat); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return nil, err
+	}
+	s.audit.Record(ctx, event)
+
+	patResponse := personalAccessTokenResponse(pat)
+	patResponse.Token = rawToken
+
+	s.Logger.Infof("The user %v created the personal access token %v", pat.Username, pat.Id)
+	return &patResponse, nil
+}
+
+// ListPersonalAccessTokens lists the tokens of the user, without the tokens
+// themselves.
+func (s *authService) ListPersonalAccessTokens(ctx context.Context, username string) ([]domain.PersonalAccessTokenResponse, error) {
+	pats, err := s.patRepository.FindPersonalAccessTokensByUsername(ctx, username)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	patsResponse := make([]domain.PersonalAccessTokenResponse, 0, len(pats))
+	for i := range pats {
+		patsResponse = append(patsResponse, personalAccessTokenResponse(&pats[i]))
+	}
+
+	return patsResponse, nil
+}
+
+// DeletePersonalAccessToken deletes one of the tokens of the user, it stops
+// working right away.
+func (s *authService) DeletePersonalAccessToken(ctx context.Context, id, username string) error {
+	if id == "" {
+		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrIdIsRequired)
+		return errorhandler.Invalid(errorhandler.ErrIdIsRequired)
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionPersonalAccessTokenDeleted, id)
+	if err := s.patRepository.DeletePersonalAccessToken(ctx, id, username); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrTokenNotFound))
+		return errorhandler.Invalid(errorhandler.ErrTokenNotFound)
+	}
+	s.audit.Record(ctx, event)
+
+	s.Logger.Infof("The user %v deleted the personal access token %v", username, id)
+	return nil
+}
+
+func personalAccessTokenResponse(pat *domain.PersonalAccessToken) domain.PersonalAccessTokenResponse {
+	return domain.PersonalAccessTokenResponse{
+		Id:         pat.Id,
+		Name:       pat.Name,
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// SamlRequestCookie binds the SAML login to the browser that started it, a
+// relay state alone could be posted to the ACS from any other one.
+const (
+	SamlRequestCookie   = "saml_request"
+	SamlRequestDuration = 5 * time.Minute
+)
+
+// SamlMetadata serves the metadata of the service provider, what the
+// identity provider is configured with.
+func (s *authService) SamlMetadata(w http.ResponseWriter, r *http.Request) {
+	if s.samlProvider == nil {
+		errorhandler.RequestErrorHandler(w, errorhandler.ErrSamlNotConfigured, http.StatusNotFound, r.URL.Path)
+		return
+	}
+
+	metadata, err := s.samlProvider.Metadata()
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// SamlLogin sends the browser to the identity provider with an AuthnRequest,
+// return_to is where it goes after the login, like in /oauth/login.
+func (s *authService) SamlLogin(w http.ResponseWriter, r *http.Request) {
+	if s.samlProvider == nil {
+		errorhandler.RequestErrorHandler(w, errorhandler.ErrSamlNotConfigured, http.StatusNotFound, r.URL.Path)
+		return
+	}
+
+	relayState := token.CookieBased{}.GenerateToken(Token_Length)
+	redirect, requestId, err := s.samlProvider.AuthnRequest(relayState)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	s.Cache.SamlRequestCache.Set(relayState, domain.SamlRequest{
+		Id:       requestId,
+		ReturnTo: safeReturnTo(r.URL.Query().Get("return_to")),
+	}, time.Now().Add(SamlRequestDuration))
+	setSamlRequestCookie(w, relayState, int(SamlRequestDuration.Seconds()))
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// SamlAcs is the Assertion Consumer Service, the identity provider posts
+// the response of the login to it. The user gets the session or tokens of
+// the configured mode, see completeSamlLogin.
+func (s *authService) SamlAcs(w http.ResponseWriter, r *http.Request) {
+	s.Logger.Infoln("Trying to login user with SAML")
+
+	if s.samlProvider == nil {
+		errorhandler.RequestErrorHandler(w, errorhandler.ErrSamlNotConfigured, http.StatusNotFound, r.URL.Path)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	samlRequest, err := s.samlRequest(w, r)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.UnauthroizedErrorHandler(w, err)
+		return
+	}
+
+	var requestIds []string
+	if samlRequest.Id != "" {
+		requestIds = []string{samlRequest.Id}
+	}
+
+	event := &audit.Event{Action: audit.ActionLogin, Method: r.Method, Path: r.URL.Path}
+	user, err := s.samlProvider.ParseResponse(r, requestIds)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		s.audit.Record(r.Context(), audit.Failure(event, err))
+		switch {
+		// why the response is invalid is only logged
+		case errors.Is(err, errorhandler.ErrInvalidSamlResponse):
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidSamlResponse)
+		case errors.Is(err, errorhandler.ErrUserAlreadyExists), errors.Is(err, errorhandler.ErrUserLocked),
+			errors.Is(err, errorhandler.ErrProvisioningNotAllowed):
+			errorhandler.ForbiddenErrorHandler(w, err)
+		default:
+			errorhandler.InternalErrorHandler(w)
+		}
+		return
+	}
+
+	event.Actor = *user.Username
+	s.audit.Record(r.Context(), event)
+
+	s.completeSamlLogin(w, r, user, samlRequest.ReturnTo)
+}
+
+// samlRequest returns the login the response answers by its relay state,
+// the cookie has to match it so the login can't be finished by another
+// browser. Without them it's a login started at the identity provider,
+// when they're allowed, and the relay state may be where to return to.
+func (s *authService) samlRequest(w http.ResponseWriter, r *http.Request) (*domain.SamlRequest, error) {
+	relayState := r.PostForm.Get("RelayState")
+
+	// the login is over, whatever the response is
+	setSamlRequestCookie(w, "", -1)
+
+	cookie, err := r.Cookie(SamlRequestCookie)
+	if err == nil && relayState != "" && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(relayState)) == 1 {
+		samlRequest, ok := s.Cache.SamlRequestCache.Get(relayState)
+		s.Cache.SamlRequestCache.Delete(relayState)
+		if !ok {
+			return nil, errorhandler.ErrInvalidRelayState
+		}
+		return &samlRequest, nil
+	}
+
+	if !s.samlProvider.AllowIdpInitiated() {
+		return nil, errorhandler.ErrInvalidRelayState
+	}
+	return &domain.SamlRequest{ReturnTo: safeReturnTo(relayState)}, nil
+}
+
+// completeSamlLogin gives the user the credentials of the first mode of
+// AUTH_MODES that has a login: the session cookies, the tokens of the jwt
+// refresh login or the browser session of the authorization server.
+func (s *authService) completeSamlLogin(w http.ResponseWriter, r *http.Request, user *domain.User, returnTo string) {
+	switch s.loginMode(r.Context()) {
+	case middleware.AuthMethodCookie:
+		session, err := s.startCookieSession(r.Context(), user)
+		if err != nil {
+			errorhandler.InternalErrorHandler(w)
+			return
+		}
+		auth.SetCookieSession(w, session)
+
+	case middleware.AuthMethodJwt:
+		tokens, err := s.issueTokenRefresh(r.Context(), user, nil)
+		if err != nil {
+			errorhandler.InternalErrorHandler(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(tokens)
+		return
+
+	default:
+		if err := s.startBrowserSession(w, r, user, []string{token.AmrFederated}); err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			errorhandler.InternalErrorHandler(w)
+			return
+		}
+		s.Logger.Infoln("The user logged in the browser successfully.")
+	}
+
+	if returnTo == "" {
+		renderTemplate(s, w, http.StatusOK, "login.html", loginPage{SignedInAs: *user.Username})
+		return
+	}
+	// a 303 so the POST of the identity provider becomes a GET
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// loginMode is the first mode with a login the organization allows, the
+// personal access tokens are only created by users already logged in.
+func (s *authService) loginMode(ctx context.Context) string {
+	for _, mode := range s.authModes {
+		switch mode {
+		case middleware.AuthMethodCookie, middleware.AuthMethodJwt, middleware.AuthMethodOAuthSession:
+			if tenant.AllowsMode(ctx, mode) {
+				return mode
+			}
+		}
+	}
+	return middleware.AuthMethodOAuthSession
+}
+
+// setSamlRequestCookie sends the cookie of the login in progress, the
+// response of the identity provider is a cross site POST so it needs
+// SameSite=None, which only secure cookies can have.
+func setSamlRequestCookie(w http.ResponseWriter, relayState string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SamlRequestCookie,
+		Value:    relayState,
+		Path:     "/saml",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/saml"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+const samlIssuerUrlMock = "https://auth.example.com"
+
+// samlIdpStub is an in-process identity provider, every AuthnRequest is
+// answered with the session of alice.
+type samlIdpStub struct {
+	idp        *gosaml.IdentityProvider
+	spMetadata *gosaml.EntityDescriptor
+}
+
+func (stub *samlIdpStub) GetServiceProvider(r *http.Request, serviceProviderID string) (*gosaml.EntityDescriptor, error) {
+	if stub.spMetadata == nil || stub.spMetadata.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return stub.spMetadata, nil
+}
+
+func (stub *samlIdpStub) GetSession(w http.ResponseWriter, r *http.Request, req *gosaml.IdpAuthnRequest) *gosaml.Session {
+	return &gosaml.Session{
+		ID:         "session-alice",
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		NameID:     "alice",
+		CustomAttributes: []gosaml.Attribute{
+			{Name: "email", Values: []gosaml.AttributeValue{{Type: "xs:string", Value: "alice@example.com"}}},
+			{Name: "groups", Values: []gosaml.AttributeValue{{Type: "xs:string", Value: "Engineering"}, {Type: "xs:string", Value: "Interns"}}},
+		},
+	}
+}
+
+func newSamlIdpStub(t *testing.T) *samlIdpStub {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	metadataUrl, _ := url.Parse("https://idp.example.com/metadata")
+	ssoUrl, _ := url.Parse("https://idp.example.com/sso")
+
+	stub := &samlIdpStub{}
+	stub.idp = &gosaml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataUrl,
+		SSOURL:                  *ssoUrl,
+		ServiceProviderProvider: stub,
+		SessionProvider:         stub,
+	}
+	return stub
+}
+
+func prepareSaml(t *testing.T, authModes ...string) (auth.Service, *userRepoMock, *samlIdpStub) {
+	service, userRepo, _, _ := prepareMocks()
+	stub := newSamlIdpStub(t)
+
+	idpMetadata, _ := xml.Marshal(stub.idp.Metadata())
+	metadataFile := filepath.Join(t.TempDir(), "idp.xml")
+	os.WriteFile(metadataFile, idpMetadata, 0o600)
+
+	config := &configs.Configuration{
+		IssuerUrl:           samlIssuerUrlMock,
+		SamlIdpMetadataFile: metadataFile,
+		SamlEmailAttribute:  "email",
+		SamlGroupAttribute:  "groups",
+		SamlGroupRoles:      []string{"engineering=admin"},
+	}
+	sp, err := saml.Load(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := service.(*authService)
+	s.samlProvider = saml.NewServiceProvider(config, userRepo, sp)
+	s.authModes = authModes
+
+	// the identity provider is configured with the metadata of /saml/metadata
+	w := httptest.NewRecorder()
+	controllerMock(service).SamlMetadataEp(w, httptest.NewRequest(http.MethodGet, "/saml/metadata", nil))
+	stub.spMetadata = &gosaml.EntityDescriptor{}
+	if err := xml.Unmarshal(w.Body.Bytes(), stub.spMetadata); err != nil {
+		t.Fatal(err)
+	}
+
+	return service, userRepo, stub
+}
+
+var samlFormInput = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+// samlLoginMock starts the login at /saml/login and returns the form the
+// identity provider posts to the ACS, with the cookie of the login.
+func samlLoginMock(t *testing.T, service auth.Service, idp *gosaml.IdentityProvider, returnTo string) (url.Values, *http.Cookie) {
+	w := httptest.NewRecorder()
+	controllerMock(service).SamlLoginEp(w, httptest.NewRequest(http.MethodGet, "/saml/login?return_to="+url.QueryEscape(returnTo), nil))
+	if w.Result().StatusCode != http.StatusFound {
+		t.Fatalf("expected 302 Found, got %d", w.Result().StatusCode)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == SamlRequestCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.Secure || cookie.SameSite != http.SameSiteNoneMode {
+		t.Fatalf("expected a secure cross site cookie, got %+v", cookie)
+	}
+
+	idpW := httptest.NewRecorder()
+	idp.ServeSSO(idpW, httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil))
+
+	form := url.Values{}
+	for _, input := range samlFormInput.FindAllStringSubmatch(idpW.Body.String(), -1) {
+		form.Set(input[1], html.UnescapeString(input[2]))
+	}
+	if form.Get("SAMLResponse") == "" {
+		t.Fatalf("expected the identity provider to answer, got %d %v", idpW.Code, idpW.Body.String())
+	}
+	return form, cookie
+}
+
+func samlAcsMock(service auth.Service, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	return samlAcsContextMock(context.Background(), service, form, cookie)
+}
+
+func samlAcsContextMock(ctx context.Context, service auth.Service, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/saml/acs", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	controllerMock(service).SamlAcsEp(w, r)
+	return w
+}
+
+// TestSamlLogin verifies the login through the identity provider, the user
+// is provisioned with the roles of the groups and gets the browser session
+// of the authorization server.
+func TestSamlLogin(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareSaml(t)
+	returnTo := "/oauth/authorize?client_id=client"
+	form, cookie := samlLoginMock(t, service, stub.idp, returnTo)
+
+	// when
+	w := samlAcsMock(service, form, cookie)
+
+	// then
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != returnTo {
+		t.Fatalf("expected a redirect to %v, got %d %v", returnTo, w.Code, w.Body.String())
+	}
+	if !slices.ContainsFunc(w.Result().Cookies(), func(c *http.Cookie) bool { return c.Name == auth.BrowserSessionName }) {
+		t.Error("expected the browser session to start")
+	}
+
+	alice, ok := userRepo.users["alice"]
+	if !ok {
+		t.Fatal("expected the user to be provisioned")
+	}
+	if *alice.HashedPassword != domain.NoPassword || *alice.Email != "alice@example.com" {
+		t.Errorf("unexpected provisioned user: %+v", alice)
+	}
+	if !slices.Equal(alice.Roles, []string{domain.RoleAdmin}) {
+		t.Errorf("expected the roles of the groups, got %v", alice.Roles)
+	}
+
+	// when the same response is posted again
+	replay := samlAcsMock(service, form, cookie)
+
+	// then
+	if replay.Code != http.StatusUnauthorized {
+		t.Errorf("expected the replay to be rejected, got %d", replay.Code)
+	}
+}
+
+// TestSamlLogin_JwtMode verifies the login gives the tokens of the jwt
+// refresh login when it's the configured mode.
+func TestSamlLogin_JwtMode(t *testing.T) {
+	// given
+	service, _, stub := prepareSaml(t, middleware.AuthMethodPersonalAccessToken, middleware.AuthMethodJwt)
+	form, cookie := samlLoginMock(t, service, stub.idp, "")
+
+	// when
+	w := samlAcsMock(service, form, cookie)
+
+	// then
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d %v", w.Code, w.Body.String())
+	}
+
+	var tokens domain.TokenRefreshResponse
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("expected the access and refresh tokens, got %+v", tokens)
+	}
+
+	claims, err := service.(*authService).jwtMaker.VerifyToken(tokens.AccessToken)
+	if err != nil || claims.Username != "alice" {
+		t.Errorf("expected an access token of alice, got %+v %v", claims, err)
+	}
+}
+
+// TestSamlAcs_Rejected verifies the responses without the cookie of the
+// login and the ones signed by a key that isn't in the metadata.
+func TestSamlAcs_Rejected(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareSaml(t)
+	form, _ := samlLoginMock(t, service, stub.idp, "")
+
+	// when
+	withoutCookie := samlAcsMock(service, form, nil)
+
+	// then
+	if withoutCookie.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the cookie, got %d", withoutCookie.Code)
+	}
+
+	// given an identity provider with another key
+	forger := newSamlIdpStub(t)
+	forger.spMetadata = stub.spMetadata
+	form, cookie := samlLoginMock(t, service, forger.idp, "")
+
+	// when
+	forged := samlAcsMock(service, form, cookie)
+
+	// then
+	if forged.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for the forged response, got %d", forged.Code)
+	}
+	if len(userRepo.users) != 0 {
+		t.Errorf("expected no user to be provisioned, got %v", userRepo.users)
+	}
+}
+
+// TestSamlAcs_OtherOrganization verifies the identity provider doesn't
+// provision its users in another organization.
+func TestSamlAcs_OtherOrganization(t *testing.T) {
+	// given
+	service, userRepo, stub := prepareSaml(t)
+	acme, _, _ := organizationsMock()
+	form, cookie := samlLoginMock(t, service, stub.idp, "")
+
+	// when
+	w := samlAcsContextMock(tenant.WithOrganization(context.Background(), acme), service, form, cookie)
+
+	// then
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden, got %d %v", w.Code, w.Body.String())
+	}
+	if len(userRepo.users) != 0 {
+		t.Errorf("expected no user to be provisioned, got %v", userRepo.users)
+	}
+}
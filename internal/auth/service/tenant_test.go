@@ -0,0 +1,340 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"google.golang.org/grpc/codes"
+)
+
+type mockOrganizationRepo struct {
+	orgs []*domain.Organization
+}
+
+func (mock *mockOrganizationRepo) FindOrganizations(ctx context.Context) ([]domain.Organization, error) {
+	orgs := []domain.Organization{}
+	for _, org := range mock.orgs {
+		orgs = append(orgs, *org)
+	}
+	return orgs, nil
+}
+
+func (mock *mockOrganizationRepo) FindOrganizationById(ctx context.Context, id int64) (*domain.Organization, error) {
+	return mock.find(func(org *domain.Organization) bool { return org.Id == id })
+}
+
+func (mock *mockOrganizationRepo) FindOrganizationBySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	return mock.find(func(org *domain.Organization) bool { return org.Slug == slug })
+}
+
+func (mock *mockOrganizationRepo) FindOrganizationByHost(ctx context.Context, host string) (*domain.Organization, error) {
+	return mock.find(func(org *domain.Organization) bool { return org.Host != nil && *org.Host == host })
+}
+
+func (mock *mockOrganizationRepo) CreateOrganization(ctx context.Context, org *domain.Organization) error {
+	mock.orgs = append(mock.orgs, org)
+	return nil
+}
+
+func (mock *mockOrganizationRepo) UpdateOrganization(ctx context.Context, org *domain.Organization) error {
+	return nil
+}
+
+// unavailableOrganizationRepo is the repository while the database is down.
+type unavailableOrganizationRepo struct {
+	mockOrganizationRepo
+}
+
+func (mock *unavailableOrganizationRepo) FindOrganizationBySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (mock *unavailableOrganizationRepo) FindOrganizationByHost(ctx context.Context, host string) (*domain.Organization, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (mock *mockOrganizationRepo) find(match func(*domain.Organization) bool) (*domain.Organization, error) {
+	for _, org := range mock.orgs {
+		if match(org) {
+			return org, nil
+		}
+	}
+	return nil, errorhandler.ErrOrganizationNotFound
+}
+
+func organizationsMock() (*domain.Organization, *domain.Organization, *mockOrganizationRepo) {
+	acme := &domain.Organization{
+		Id:   2,
+		Slug: "acme",
+		Host: ptrString("acme.example.com"),
+		Settings: domain.OrganizationSettings{
+			PasswordMinLength:   12,
+			AccessTokenDuration: 5 * time.Minute,
+		},
+	}
+	globex := &domain.Organization{
+		Id:       3,
+		Slug:     "globex",
+		Settings: domain.OrganizationSettings{AuthModes: []string{middleware.AuthMethodPersonalAccessToken}},
+	}
+	return acme, globex, &mockOrganizationRepo{orgs: []*domain.Organization{acme, globex}}
+}
+
+// TestTenantSettings verifies the password policy and the login modes of
+// the organization of the request override the ones of the server.
+func TestTenantSettings(t *testing.T) {
+	// given
+	auth, _, _, _ := prepareMocks()
+	acme, globex, _ := organizationsMock()
+
+	register := func(ctx context.Context, password string) int {
+		newUser := domain.User{
+			Username:       ptrString(usernameMockBob),
+			HashedPassword: ptrString(password),
+			Age:            ptrInt(ageMock),
+		}
+		jsonReq, _ := json.Marshal(newUser)
+		r := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(jsonReq)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		controllerMock(auth).RegisterEp(w, r)
+		return w.Result().StatusCode
+	}
+
+	// when
+	shortPassword := register(tenant.WithOrganization(context.Background(), acme), hashedPasswordMock)
+	_, loginErr := auth.LoginJwtBased(tenant.WithOrganization(context.Background(), globex), &domain.UserLogin{Username: usernameMockBob}, nil)
+
+	// then
+	if shortPassword != http.StatusBadRequest {
+		t.Fatalf("expected the password shorter than the policy of the organization to be rejected, got %d", shortPassword)
+	}
+
+	if !errors.Is(loginErr, errorhandler.ErrLoginModeNotAllowed) || errorhandler.KindOf(loginErr) != errorhandler.KindForbidden {
+		t.Fatalf("expected the jwt login to be forbidden by the organization, got %v", loginErr)
+	}
+
+	if status := register(context.Background(), hashedPasswordMock); status != http.StatusCreated {
+		t.Fatalf("expected the default organization to keep the policy of the server, got %d", status)
+	}
+}
+
+// TestTenantTokens verifies the tokens carry the organization that issued
+// them and are rejected by the other ones.
+func TestTenantTokens(t *testing.T) {
+	// given
+	auth, userRepo, _, _ := prepareMocks()
+	s := auth.(*authService)
+	acme, globex, organizationRepo := organizationsMock()
+	loginFlowMock(userRepo)
+	acmeCtx := tenant.WithOrganization(context.Background(), acme)
+
+	tokens, err := auth.LoginJwtRefreshBased(acmeCtx, &domain.UserLogin{Username: usernameMockTest, Password: hashedPasswordMock}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+
+	claims, _ := s.jwtMaker.VerifyToken(tokens.AccessToken)
+	if claims.TenantId != acme.Id {
+		t.Fatalf("expected the tid claim %d, got %d", acme.Id, claims.TenantId)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != acme.Settings.AccessTokenDuration {
+		t.Fatalf("expected the access token duration of the organization, got %v", lifetime)
+	}
+
+	// when
+	_, defaultErr := auth.RenewAccessToken(context.Background(), tokens.RefreshToken, nil)
+	renewed, acmeErr := auth.RenewAccessToken(acmeCtx, tokens.RefreshToken, nil)
+
+	// then
+	if !errors.Is(defaultErr, errorhandler.ErrWrongOrganization) {
+		t.Fatalf("expected the refresh token to be rejected by another organization, got %v", defaultErr)
+	}
+	if acmeErr != nil || renewed.AccessToken == "" {
+		t.Fatalf("expected the refresh token to be renewed by its organization, got %v", acmeErr)
+	}
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	m.Tenants = tenant.NewResolver(organizationRepo, "X-Tenant")
+
+	var tenantId int64
+	protected := m.Tenant(m.Authenticate(m.BearerAuthenticator())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantId = tenant.IdFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name         string
+		host         string
+		header       string
+		want         int
+		wantTenantId int64
+	}{
+		{"organization of the token", "", "", http.StatusOK, acme.Id},
+		{"host of the organization", *acme.Host, "", http.StatusOK, acme.Id},
+		{"slug of the organization", "", acme.Slug, http.StatusOK, acme.Id},
+		{"another organization", "", globex.Slug, http.StatusUnauthorized, 0},
+		{"unknown organization", "", "unknown", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantId = 0
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+			}
+
+			// when
+			protected.ServeHTTP(w, r)
+
+			// then
+			if w.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Result().StatusCode)
+			}
+
+			if tenantId != tt.wantTenantId {
+				t.Fatalf("expected the organization %d, got %d", tt.wantTenantId, tenantId)
+			}
+		})
+	}
+}
+
+// TestTenant_Unavailable verifies the requests aren't handled as the
+// default organization while the organizations can't be read, only the
+// health checks are.
+func TestTenant_Unavailable(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	s := service.(*authService)
+	acme, _, _ := organizationsMock()
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	m.Tenants = tenant.NewResolver(&unavailableOrganizationRepo{}, "X-Tenant")
+	handler := m.Tenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		path   string
+		host   string
+		header string
+		want   int
+	}{
+		{"slug of the organization", "/api/v1/sessions", "", acme.Slug, http.StatusServiceUnavailable},
+		{"host of the organization", "/api/v1/sessions", *acme.Host, "", http.StatusServiceUnavailable},
+		{"liveness", "/healthz", *acme.Host, acme.Slug, http.StatusOK},
+		{"readiness", "/readyz", *acme.Host, acme.Slug, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+			}
+
+			// when
+			handler.ServeHTTP(w, r)
+
+			// then
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+// TestTenantForwardAuth verifies the reverse proxies and Envoy get the
+// identity of the user of the organization of the token, the tokens sent to
+// another organization and the modes the organization doesn't allow are
+// rejected.
+func TestTenantForwardAuth(t *testing.T) {
+	// given
+	service, userRepo, _, _ := prepareMocks()
+	s := service.(*authService)
+	acme, globex, organizationRepo := organizationsMock()
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(7), Username: ptrString(usernameMockTest), Roles: []string{domain.RoleAdmin}})
+
+	m := middleware.NewMiddleware(configMock(), userRepo, s.audit, s.Cache)
+	m.Tenants = tenant.NewResolver(organizationRepo, "X-Tenant")
+	verify := m.ForwardAuth(m.BearerAuthenticator())
+	extAuthz := m.ExtAuthzServer(m.BearerAuthenticator())
+
+	accessToken := func(tenantId int64) string {
+		claims, _ := token.NewUserClaims(7, usernameMockTest, "golang", time.Minute)
+		claims.TenantId = tenantId
+		signed, _ := s.jwtMaker.SignClaims(claims)
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		header  string
+		allowed bool
+	}{
+		{"organization of the token", accessToken(acme.Id), "", true},
+		{"another organization", accessToken(acme.Id), globex.Slug, false},
+		{"token of another organization", accessToken(globex.Id), "", false},
+		{"unknown organization of the token", accessToken(99), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/auth/verify", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			headers := map[string]string{"authorization": "Bearer " + tt.token}
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+				headers["x-tenant"] = tt.header
+			}
+
+			// when
+			verify.ServeHTTP(w, r)
+			check, err := extAuthz.Check(context.Background(), &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+				Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+					Method:  http.MethodGet,
+					Path:    "/orders",
+					Host:    "orders.internal",
+					Headers: headers,
+				}},
+			}})
+
+			// then
+			want, wantCode := http.StatusUnauthorized, codes.Unauthenticated
+			if tt.allowed {
+				want, wantCode = http.StatusOK, codes.OK
+			}
+
+			if w.Code != want {
+				t.Fatalf("expected forward auth to answer %d, got %d", want, w.Code)
+			}
+			if err != nil || codes.Code(check.GetStatus().GetCode()) != wantCode {
+				t.Fatalf("expected ext_authz to answer %v, got %v %v", wantCode, check.GetStatus(), err)
+			}
+			if tt.allowed && w.Header().Get(middleware.AuthIdHeader) != "7" {
+				t.Fatalf("expected the identity of the user, got %v", w.Header())
+			}
+		})
+	}
+}
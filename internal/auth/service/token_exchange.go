@@ -0,0 +1,125 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+const (
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken       = "urn:ietf:params:oauth:token-type:access_token"
+	ImpersonationTokenDuration = 10 * time.Minute
+)
+
+// exchangeToken implements the token exchange grant (RFC 8693) for support
+// staff, an admin sends its own access token as the subject_token and the
+// username to impersonate as requested_subject. The short lived token issued
+// carries the act claim naming the admin and has no refresh token.
+func (s *authService) exchangeToken(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	if r.PostForm.Get("subject_token_type") != TokenTypeAccessToken {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "subject_token_type must be an access token", http.StatusBadRequest)
+		return
+	}
+
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != TokenTypeAccessToken {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "only access tokens can be requested", http.StatusBadRequest)
+		return
+	}
+
+	actorClaims, tokenType, ok := s.activeToken(r.Context(), r.PostForm.Get("subject_token"))
+	if !ok || tokenType != TokenTypeHintAccessToken || !tenant.Matches(r.Context(), actorClaims.TenantId) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "subject_token is invalid or expired", http.StatusBadRequest)
+		return
+	}
+
+	// Impersonation tokens can't be exchanged again, the act claim would
+	// hide who is really behind the requests.
+	if actorClaims.Act != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "impersonation tokens can't be exchanged", http.StatusBadRequest)
+		return
+	}
+
+	// Neither can the tokens bound to a DPoP key or a client certificate,
+	// the exchange doesn't ask for the proof and would issue a bearer token.
+	if actorClaims.Cnf != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidGrant, "bound tokens can't be exchanged", http.StatusBadRequest)
+		return
+	}
+
+	actor, err := s.userRepository.FindUserByUsername(r.Context(), actorClaims.Username)
+	if err != nil || !slices.Contains(actor.Roles, domain.RoleAdmin) {
+		s.Logger.Errorf("The user %v tried to impersonate without the admin role", actorClaims.Username)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthAccessDenied, "only admins can impersonate users", http.StatusForbidden)
+		return
+	}
+
+	subjectUsername := r.PostForm.Get("requested_subject")
+	if subjectUsername == "" || subjectUsername == actorClaims.Username {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, "requested_subject must be another user", http.StatusBadRequest)
+		return
+	}
+
+	subject, err := s.userRepository.FindUserByUsername(r.Context(), subjectUsername)
+	if err != nil {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidRequest, errorhandler.ErrUserNotFound.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if slices.Contains(subject.Roles, domain.RoleAdmin) {
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthAccessDenied, "admins can't be impersonated", http.StatusForbidden)
+		return
+	}
+
+	scope := actorClaims.Scope
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		if !containsScopes(actorClaims.Scope, requested) {
+			errorhandler.OAuthErrorHandler(w, errorhandler.OAuthInvalidScope, "", http.StatusBadRequest)
+			return
+		}
+		scope = requested
+	}
+
+	claims, err := s.jwtMaker.NewUserClaims(*subject.Id, *subject.Username, ImpersonationTokenDuration)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+	claims.TenantId = actorClaims.TenantId
+	claims.Scope = scope
+	claims.ClientId = client.Id
+	// Bound to the admin session, revoking it ends the impersonation too.
+	claims.SessionId = actorClaims.SessionId
+	claims.Act = &domain.Actor{Subject: actorClaims.Username}
+
+	accessToken, err := s.jwtMaker.SignAccessClaims(claims)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		errorhandler.OAuthErrorHandler(w, errorhandler.OAuthServerError, "", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit.Record(r.Context(), &audit.Event{
+		Action:   audit.ActionImpersonationStarted,
+		Actor:    actorClaims.Username,
+		Subject:  *subject.Username,
+		ClientId: client.Id,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Status:   http.StatusOK,
+	})
+
+	writeTokenResponse(w, &domain.OAuthTokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(ImpersonationTokenDuration.Seconds()),
+		Scope:           scope,
+		IssuedTokenType: TokenTypeAccessToken,
+	})
+}
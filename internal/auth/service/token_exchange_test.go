@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+const usernameMockAdmin = "admin"
+
+type recorderMock struct {
+	events []*audit.Event
+}
+
+func (mock *recorderMock) Record(ctx context.Context, event *audit.Event) {
+	mock.events = append(mock.events, event)
+}
+
+// prepareTokenExchange returns the service with an admin and a regular user,
+// plus the access token of each one.
+func prepareTokenExchange(t *testing.T) (*authService, *recorderMock, string, string) {
+	s, _, _ := prepareAuthorizationServer(t)
+	recorder := &recorderMock{}
+	s.audit = recorder
+
+	userRepo := s.userRepository.(*userRepoMock)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(1), Username: ptrString(usernameMockTest)})
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(2), Username: ptrString(usernameMockAdmin), Roles: []string{domain.RoleAdmin}})
+
+	client, _ := s.oauthRepository.FindClientById(context.Background(), clientIdMock)
+	adminTokens, err := s.issueOAuthTokens(context.Background(), client, 2, usernameMockAdmin, "profile")
+	if err != nil {
+		t.Fatalf("failed issuing the admin tokens: %v", err)
+	}
+	userTokens, err := s.issueOAuthTokens(context.Background(), client, 1, usernameMockTest, "profile")
+	if err != nil {
+		t.Fatalf("failed issuing the user tokens: %v", err)
+	}
+
+	return s, recorder, adminTokens.AccessToken, userTokens.AccessToken
+}
+
+func tokenExchangeMock(s *authService, subjectToken, requestedSubject string) *http.Response {
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeTokenExchange)
+	form.Set("client_id", clientIdMock)
+	form.Set("subject_token", subjectToken)
+	form.Set("subject_token_type", TokenTypeAccessToken)
+	form.Set("requested_subject", requestedSubject)
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.Token(w, r)
+	return w.Result()
+}
+
+// TestTokenExchange_Success verifies an admin gets a token for the user with
+// the act claim naming the admin, and the exchange is audited.
+func TestTokenExchange_Success(t *testing.T) {
+	// given
+	s, recorder, adminToken, _ := prepareTokenExchange(t)
+
+	// when
+	resp := tokenExchangeMock(s, adminToken, usernameMockTest)
+
+	// then
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	var tr domain.OAuthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		t.Fatalf("failed decoding token response: %v", err)
+	}
+
+	if tr.IssuedTokenType != TokenTypeAccessToken || tr.RefreshToken != "" {
+		t.Fatalf("expected only an access token, got %+v", tr)
+	}
+
+	claims, err := s.jwtMaker.VerifyToken(tr.AccessToken)
+	if err != nil {
+		t.Fatalf("failed verifying the access token: %v", err)
+	}
+
+	if claims.Username != usernameMockTest || claims.Act == nil || claims.Act.Subject != usernameMockAdmin {
+		t.Fatalf("unexpected claims, username: %v, act: %+v", claims.Username, claims.Act)
+	}
+
+	if len(recorder.events) != 1 || recorder.events[0].Action != audit.ActionImpersonationStarted {
+		t.Fatalf("expected the impersonation to be audited, got %+v", recorder.events)
+	}
+
+	// impersonation tokens can't be exchanged again
+	if code := oauthErrorMock(t, tokenExchangeMock(s, tr.AccessToken, usernameMockBob)); code != errorhandler.OAuthInvalidGrant {
+		t.Fatalf("expected invalid_grant, got %v", code)
+	}
+}
+
+// TestTokenExchange_BoundToken verifies the tokens bound to a key can't be
+// exchanged for a bearer token without the proof.
+func TestTokenExchange_BoundToken(t *testing.T) {
+	// given
+	s, recorder, adminToken, _ := prepareTokenExchange(t)
+	claims, err := s.jwtMaker.VerifyToken(adminToken)
+	if err != nil {
+		t.Fatalf("failed verifying the admin token: %v", err)
+	}
+	claims.Cnf = &domain.Confirmation{JwkThumbprint: "thumbprint"}
+	boundToken, _ := s.jwtMaker.SignClaims(claims)
+
+	// when
+	resp := tokenExchangeMock(s, boundToken, usernameMockTest)
+
+	// then
+	if code := oauthErrorMock(t, resp); code != errorhandler.OAuthInvalidGrant {
+		t.Fatalf("expected invalid_grant, got %v", code)
+	}
+
+	if len(recorder.events) != 0 {
+		t.Fatalf("expected no audit event, got %+v", recorder.events)
+	}
+}
+
+// TestTokenExchange_NotAdmin verifies users without the admin role can't
+// impersonate.
+func TestTokenExchange_NotAdmin(t *testing.T) {
+	// given
+	s, recorder, _, userToken := prepareTokenExchange(t)
+
+	// when
+	resp := tokenExchangeMock(s, userToken, usernameMockAdmin)
+
+	// then
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 Forbidden, got %d", resp.StatusCode)
+	}
+
+	if len(recorder.events) != 0 {
+		t.Fatalf("expected no audit event, got %+v", recorder.events)
+	}
+}
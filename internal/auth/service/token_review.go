@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+// ReviewToken answers the TokenReview of the Kubernetes webhook token
+// authentication. The access token is checked like in the introspection,
+// the groups are the roles of the user. Tokens bound to a key or a
+// certificate are rejected since kubectl can't prove the possession, and so
+// are the tokens of another organization than the one of the request (the
+// webhook names it like the other clients, by the header or the host).
+func (s *authService) ReviewToken(ctx context.Context, review *domain.TokenReview) (*domain.TokenReview, error) {
+	if review.ApiVersion != domain.TokenReviewApiVersion || review.Kind != domain.TokenReviewKind {
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidTokenReview)
+	}
+
+	answer := &domain.TokenReview{
+		ApiVersion: domain.TokenReviewApiVersion,
+		Kind:       domain.TokenReviewKind,
+		Spec:       review.Spec,
+	}
+	// the token isn't sent back
+	answer.Spec.Token = ""
+
+	userClaims, tokenType, ok := s.activeToken(ctx, review.Spec.Token)
+	if !ok || tokenType != TokenTypeHintAccessToken || userClaims.Cnf != nil {
+		answer.Status.Error = errorhandler.ErrInvalidToken.Error()
+		return answer, nil
+	}
+
+	if !tenant.Matches(ctx, userClaims.TenantId) {
+		answer.Status.Error = errorhandler.ErrWrongOrganization.Error()
+		return answer, nil
+	}
+
+	// without an aud claim the token is valid for the audiences of the API
+	// server, which is what an empty status.audiences means
+	var audiences []string
+	if len(review.Spec.Audiences) > 0 && len(userClaims.Audience) > 0 {
+		for _, audience := range review.Spec.Audiences {
+			if slices.Contains(userClaims.Audience, audience) {
+				audiences = append(audiences, audience)
+			}
+		}
+		if len(audiences) == 0 {
+			answer.Status.Error = errorhandler.ErrInvalidTokenAudience.Error()
+			return answer, nil
+		}
+	}
+
+	user, err := s.userRepository.FindUserByUsername(ctx, userClaims.Username)
+	if err != nil || user.Locked || *user.Id != userClaims.Id {
+		answer.Status.Error = errorhandler.ErrInvalidToken.Error()
+		return answer, nil
+	}
+
+	s.Logger.Infof("The user %v was authenticated by a token review", *user.Username)
+
+	answer.Status = domain.TokenReviewStatus{
+		Authenticated: true,
+		User: &domain.TokenReviewUserInfo{
+			Username: *user.Username,
+			Uid:      strconv.FormatInt(*user.Id, 10),
+			Groups:   user.Roles,
+		},
+		Audiences: audiences,
+	}
+	return answer, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+func tokenReviewMock(controller auth.Controller, body string) (int, domain.TokenReview) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/k8s/tokenreview", bytes.NewBufferString(body))
+	controller.TokenReviewEp(w, r)
+
+	var review domain.TokenReview
+	json.NewDecoder(w.Result().Body).Decode(&review)
+	return w.Result().StatusCode, review
+}
+
+// TestTokenReview verifies the answers to the TokenReview of Kubernetes,
+// the user of a valid token with the roles as groups and the rejected
+// tokens as not authenticated.
+func TestTokenReview(t *testing.T) {
+	// given
+	service, userRepo, _, caches := prepareMocks()
+	s := service.(*authService)
+	controller := controllerMock(service)
+	userRepo.RegisterUser(context.Background(), &domain.User{Id: ptrInt64(7), Username: ptrString(usernameMockTest), Roles: []string{domain.RoleAdmin, "developers"}})
+
+	sign := func(edit func(claims *token.UserClaims)) string {
+		claims, _ := token.NewUserClaims(7, usernameMockTest, "golang", time.Minute)
+		edit(claims)
+		signed, _ := s.jwtMaker.SignClaims(claims)
+		return signed
+	}
+	accessToken := sign(func(*token.UserClaims) {})
+	revokedToken := sign(func(claims *token.UserClaims) { claims.ID = "revoked" })
+	caches.TokenCache.Set(revokedToken, true, time.Now().Add(time.Minute))
+	boundToken := sign(func(claims *token.UserClaims) { claims.Cnf = &domain.Confirmation{JwkThumbprint: "thumbprint"} })
+	otherAudienceToken := sign(func(claims *token.UserClaims) { claims.Audience = jwt.ClaimStrings{"billing"} })
+	otherOrganizationToken := sign(func(claims *token.UserClaims) { claims.TenantId = 2 })
+
+	review := func(token string, audiences ...string) string {
+		body, _ := json.Marshal(domain.TokenReview{
+			ApiVersion: domain.TokenReviewApiVersion,
+			Kind:       domain.TokenReviewKind,
+			Spec:       domain.TokenReviewSpec{Token: token, Audiences: audiences},
+		})
+		return string(body)
+	}
+
+	// when
+	status, allowed := tokenReviewMock(controller, review(accessToken, "https://kubernetes.default.svc"))
+
+	// then
+	if status != http.StatusOK || !allowed.Status.Authenticated {
+		t.Fatalf("expected the token to be authenticated, got %d %+v", status, allowed.Status)
+	}
+	user := allowed.Status.User
+	if user.Username != usernameMockTest || user.Uid != "7" || !slices.Equal(user.Groups, []string{domain.RoleAdmin, "developers"}) {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if allowed.Spec.Token != "" || allowed.Kind != domain.TokenReviewKind {
+		t.Errorf("unexpected answer: %+v", allowed)
+	}
+
+	for name, rejected := range map[string]string{
+		"invalid":            review("invalid"),
+		"revoked":            review(revokedToken),
+		"bound":              review(boundToken),
+		"other audience":     review(otherAudienceToken, "https://kubernetes.default.svc"),
+		"other organization": review(otherOrganizationToken),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// when
+			status, denied := tokenReviewMock(controller, rejected)
+
+			// then
+			if status != http.StatusOK || denied.Status.Authenticated || denied.Status.User != nil || denied.Status.Error == "" {
+				t.Errorf("expected the token to be rejected, got %d %+v", status, denied.Status)
+			}
+		})
+	}
+
+	// when
+	status, _ = tokenReviewMock(controller, `{"apiVersion":"v1","kind":"Pod"}`)
+
+	// then
+	if status != http.StatusBadRequest {
+		t.Errorf("expected 400 for another kind, got %d", status)
+	}
+}
+
+// TestTokenReviewAuthenticated verifies only the API server, with the
+// TOKEN_REVIEW_TOKEN, can ask for the token reviews.
+func TestTokenReviewAuthenticated(t *testing.T) {
+	// given
+	service, _, _, _ := prepareMocks()
+	controller := controllerMock(service)
+	const tokenReviewTokenMock = "token-review-token"
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{name: "webhook disabled", header: "Bearer ", status: http.StatusUnauthorized},
+		{name: "no token", token: tokenReviewTokenMock, status: http.StatusUnauthorized},
+		{name: "wrong token", token: tokenReviewTokenMock, header: "Bearer other", status: http.StatusUnauthorized},
+		{name: "token", token: tokenReviewTokenMock, header: "Bearer " + tokenReviewTokenMock, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			server.MapTokenReviewRoutes(r, &controller, &middleware.Middleware{TokenReviewToken: tt.token})
+			body, _ := json.Marshal(domain.TokenReview{
+				ApiVersion: domain.TokenReviewApiVersion,
+				Kind:       domain.TokenReviewKind,
+				Spec:       domain.TokenReviewSpec{Token: "invalid"},
+			})
+
+			// when
+			req := httptest.NewRequest(http.MethodPost, "/k8s/tokenreview", bytes.NewReader(body))
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			// then
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
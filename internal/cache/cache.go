@@ -5,6 +5,8 @@ import (
 	"runtime"
 	"sync"
 	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 )
 
 type Data[T any] struct {
@@ -20,12 +22,19 @@ type Cache[K comparable, T any] struct {
 type Caches struct {
 	UserCache  *Cache[string, string]
 	TokenCache *Cache[string, bool]
+	// ProofCache holds the jti of the DPoP proofs already used.
+	ProofCache *Cache[string, bool]
+	// SamlRequestCache holds the SAML logins in progress by relay state.
+	SamlRequestCache *Cache[string, domain.SamlRequest]
 }
 
 func NewCacheStorage() *Caches {
 	return &Caches{
 		UserCache:  NewCache[string, string](),
 		TokenCache: NewCache[string, bool](),
+		ProofCache: NewCache[string, bool](),
+
+		SamlRequestCache: NewCache[string, domain.SamlRequest](),
 	}
 }
 
@@ -68,6 +77,23 @@ func (c *Cache[K, T]) Get(key K) (T, bool) {
 	return data.value, true
 }
 
+// SetIfAbsent sets the value only when the key is missing or expired, it
+// returns false when the key was already there.
+func (c *Cache[K, T]) SetIfAbsent(key K, val T, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if data, ok := c.data[key]; ok && !data.expiry.Before(time.Now()) {
+		return false
+	}
+
+	c.data[key] = &Data[T]{
+		value:  val,
+		expiry: expiresAt,
+	}
+	return true
+}
+
 func (c *Cache[K, T]) Delete(key K) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,15 @@
+package domain
+
+// Group is a group of users pushed by the identity provider, its name can
+// be mapped to a role of the members.
+type Group struct {
+	Id          string
+	DisplayName string
+	ExternalId  *string
+	Members     []GroupMember
+}
+
+type GroupMember struct {
+	UserId   int64
+	Username string
+}
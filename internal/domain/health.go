@@ -0,0 +1,14 @@
+package domain
+
+const (
+	HealthStatusOk       = "ok"
+	HealthStatusFailing  = "failing"
+	HealthStatusDraining = "draining"
+)
+
+// HealthResponse is the body of /healthz and /readyz, Checks has the result
+// of each readiness check by its name.
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -0,0 +1,48 @@
+package domain
+
+import "time"
+
+// Member is a user of the organization with a team role, the users that
+// aren't members can log in but not reach the routes of the members.
+type Member struct {
+	UserId    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Invitation asks someone to join the organization with a role, the token
+// is emailed and only its hash is stored. It's deleted once accepted or
+// declined.
+type Invitation struct {
+	Id        string
+	TokenHash string
+	OrgId     int64
+	Email     string
+	Role      string
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type InvitationTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type InvitationResponse struct {
+	Id        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
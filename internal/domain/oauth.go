@@ -0,0 +1,134 @@
+package domain
+
+import "time"
+
+type OAuthClient struct {
+	Id             string
+	SecretHash     *string
+	Name           string
+	Owner          string
+	RedirectUris   []string
+	Scopes         []string
+	IsConfidential bool
+	CreatedAt      time.Time
+}
+
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientId            string
+	UserId              int64
+	Username            string
+	OrgId               int64
+	RedirectUri         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	Amr                 string
+	ExpiresAt           time.Time
+}
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is a device authorization request (RFC 8628), the user code is
+// what the user types in the browser, the device code is only stored hashed.
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientId       string
+	Scope          string
+	Status         string
+	UserId         *int64
+	Username       *string
+	OrgId          int64
+	Interval       int
+	LastPolledAt   *time.Time
+	ExpiresAt      time.Time
+}
+
+type OAuthConsent struct {
+	Username string
+	ClientId string
+	Scope    string
+}
+
+// AuthorizeRequest holds the parameters of an authorization request, both
+// the GET one sent by the client and the consent form POST.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+type OAuthClientRequest struct {
+	Name           string   `json:"client_name"`
+	RedirectUris   []string `json:"redirect_uris"`
+	Scopes         []string `json:"scopes"`
+	IsConfidential bool     `json:"confidential"`
+}
+
+type OAuthClientResponse struct {
+	ClientId       string   `json:"client_id"`
+	ClientSecret   string   `json:"client_secret,omitempty"`
+	Name           string   `json:"client_name"`
+	RedirectUris   []string `json:"redirect_uris"`
+	Scopes         []string `json:"scopes"`
+	IsConfidential bool     `json:"confidential"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	IdToken         string `json:"id_token,omitempty"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// Actor is the act claim of RFC 8693, the user acting on behalf of the
+// subject of the token.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Confirmation is the cnf claim, the thumbprint of the DPoP key (RFC 9449)
+// or of the client certificate (RFC 8705) the token is bound to.
+type Confirmation struct {
+	JwkThumbprint         string `json:"jkt,omitempty"`
+	CertificateThumbprint string `json:"x5t#S256,omitempty"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type IntrospectionResponse struct {
+	Active    bool          `json:"active"`
+	Scope     string        `json:"scope,omitempty"`
+	ClientId  string        `json:"client_id,omitempty"`
+	Username  string        `json:"username,omitempty"`
+	TokenType string        `json:"token_type,omitempty"`
+	Exp       int64         `json:"exp,omitempty"`
+	Iat       int64         `json:"iat,omitempty"`
+	Sub       string        `json:"sub,omitempty"`
+	Iss       string        `json:"iss,omitempty"`
+	Jti       string        `json:"jti,omitempty"`
+	Act       *Actor        `json:"act,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Organization is a tenant of the server, its users and groups are apart
+// from the ones of the other organizations and its settings override the
+// ones of the server.
+type Organization struct {
+	Id       int64
+	Slug     string
+	Name     string
+	Host     *string
+	Settings OrganizationSettings
+}
+
+// OrganizationSettings are the settings a tenant can change, the zero
+// values keep the ones of the server.
+type OrganizationSettings struct {
+	// AuthModes are the login modes the users can use, a subset of
+	// AUTH_MODES.
+	AuthModes            []string
+	PasswordMinLength    int
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+}
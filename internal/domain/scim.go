@@ -0,0 +1,74 @@
+package domain
+
+import "encoding/json"
+
+// The schemas of the SCIM 2.0 resources and messages, RFC 7643 and 7644.
+const (
+	ScimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+// ScimUser is the User resource, the password is accepted but never kept
+// since the users log in at the identity provider.
+type ScimUser struct {
+	Schemas    []string     `json:"schemas"`
+	Id         string       `json:"id,omitempty"`
+	ExternalId string       `json:"externalId,omitempty"`
+	UserName   string       `json:"userName"`
+	Emails     []ScimEmail  `json:"emails,omitempty"`
+	Active     *bool        `json:"active,omitempty"`
+	Password   string       `json:"password,omitempty"`
+	Groups     []ScimMember `json:"groups,omitempty"`
+	Meta       *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// ScimMember is a member of a group or a group of a user, Value is the id.
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ScimListResponse is a page of the resources, StartIndex is 1-based.
+type ScimListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+type ScimPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// ScimPatchOperation is an add, replace or remove, the value is decoded by
+// the attribute of the path.
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
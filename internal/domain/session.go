@@ -10,3 +10,18 @@ type Session struct {
 	CreatedAt    time.Time
 	ExpiresAt    time.Time
 }
+
+// CookieSession is the result of the cookie based login, both tokens are
+// sent back as cookies.
+type CookieSession struct {
+	SessionToken string
+	CsrfToken    string
+	ExpiresAt    time.Time
+}
+
+// SamlRequest is an AuthnRequest sent to the identity provider, kept by its
+// relay state until the response comes back to the ACS.
+type SamlRequest struct {
+	Id       string
+	ReturnTo string
+}
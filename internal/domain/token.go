@@ -3,7 +3,8 @@ package domain
 import "time"
 
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token     string `json:"token"`
+	TokenType string `json:"token_type,omitempty"`
 }
 
 type TokenRefreshResponse struct {
@@ -12,6 +13,7 @@ type TokenRefreshResponse struct {
 	SessionId             string    `json:"session_id"`
 	AccessToken           string    `json:"access_token"`
 	RefreshToken          string    `json:"refresh_token"`
+	TokenType             string    `json:"token_type,omitempty"`
 }
 
 type RenewAccessTokenRequest struct {
@@ -21,4 +23,31 @@ type RenewAccessTokenRequest struct {
 type RenewAccessTokenResponse struct {
 	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
 	AccessToken          string    `json:"access_token"`
+	TokenType            string    `json:"token_type,omitempty"`
+}
+
+type PersonalAccessToken struct {
+	Id         string
+	TokenHash  string
+	Name       string
+	UserId     int64
+	Username   string
+	OrgId      int64
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+type PersonalAccessTokenRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+type PersonalAccessTokenResponse struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 }
@@ -0,0 +1,35 @@
+package domain
+
+// The apiVersion and kind of the TokenReview of the Kubernetes webhook
+// token authentication.
+const (
+	TokenReviewApiVersion = "authentication.k8s.io/v1"
+	TokenReviewKind       = "TokenReview"
+)
+
+// TokenReview is the authentication.k8s.io/v1 TokenReview the API server
+// sends to the webhook, answered with the Status filled.
+type TokenReview struct {
+	ApiVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       TokenReviewSpec   `json:"spec"`
+	Status     TokenReviewStatus `json:"status"`
+}
+
+type TokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type TokenReviewStatus struct {
+	Authenticated bool                 `json:"authenticated"`
+	User          *TokenReviewUserInfo `json:"user,omitempty"`
+	Audiences     []string             `json:"audiences,omitempty"`
+	Error         string               `json:"error,omitempty"`
+}
+
+type TokenReviewUserInfo struct {
+	Username string   `json:"username"`
+	Uid      string   `json:"uid"`
+	Groups   []string `json:"groups,omitempty"`
+}
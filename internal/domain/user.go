@@ -1,5 +1,12 @@
 package domain
 
+const RoleAdmin = "admin"
+
+// NoPassword is the password of the users provisioned from a directory or
+// an identity provider, no bcrypt hash matches it so they can't log in with
+// a local password.
+const NoPassword = "!"
+
 type UserLogin struct {
 	Username string
 	Password string
@@ -10,8 +17,11 @@ type UserDetails struct {
 }
 
 type User struct {
-	Username       *string `json:"username"`
-	HashedPassword *string `json:"password,omitempty"`
-	Id             *int64  `json:"id,omitempty"`
-	Age            *int    `json:"age,omitempty"`
+	Username       *string  `json:"username"`
+	HashedPassword *string  `json:"password,omitempty"`
+	Id             *int64   `json:"id,omitempty"`
+	Age            *int     `json:"age,omitempty"`
+	Email          *string  `json:"email,omitempty"`
+	Roles          []string `json:"roles,omitempty"`
+	Locked         bool     `json:"-"`
 }
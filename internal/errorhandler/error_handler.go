@@ -36,6 +36,76 @@ var (
 	ErrInvalidType               = errors.New("Error: unsupported type")
 	ErrInvalidId                 = errors.New("Error: invalid username, needs to be your own")
 	ErrEqualAge                  = errors.New("Error: the new age should be different from the actual")
+	ErrClientNotFound            = errors.New("Error: oauth client not found")
+	ErrInvalidRedirectUri        = errors.New("Error: redirect uri is not registered for the client")
+	ErrRedirectUriIsRequired     = errors.New("Error: at least one redirect uri is required")
+	ErrClientNameIsRequired      = errors.New("Error: client name is required")
+	ErrInvalidSession            = errors.New("Error: browser session missing or invalid")
+	ErrInvalidScope              = errors.New("Error: invalid scope")
+	ErrInvalidSigningKey         = errors.New("Error: signing key missing or invalid")
+	ErrInvalidEmail              = errors.New("Error: invalid email")
+	ErrInvalidUserCode           = errors.New("Error: user code is invalid or expired")
+	ErrInvalidDPoPProof          = errors.New("Error: DPoP proof missing or invalid")
+	ErrDPoPProofReplayed         = errors.New("Error: DPoP proof was already used")
+	ErrInvalidClientCertificate  = errors.New("Error: client certificate missing or not mapped to any user")
+	ErrInvalidClientCA           = errors.New("Error: client CA file has no valid certificate")
+	ErrNoCredentials             = errors.New("Error: no credentials were sent")
+	ErrTokenNameIsRequired       = errors.New("Error: token name is required")
+	ErrTokenNotFound             = errors.New("Error: personal access token not found")
+	ErrUnknownAuthMode           = errors.New("Error: unknown authentication mode")
+	ErrUserLocked                = errors.New("Error: user is locked")
+	ErrInvalidConfig             = errors.New("Error: invalid configuration")
+	ErrDatabaseUnavailable       = errors.New("Error: database unavailable")
+	ErrInvalidPageToken          = errors.New("Error: invalid page token")
+	ErrInvalidCheckRequest       = errors.New("Error: check request without a valid http request")
+	ErrInvalidClientCredentials  = errors.New("Error: client credentials missing or invalid")
+	ErrInvalidTokenReview        = errors.New("Error: expected an authentication.k8s.io/v1 TokenReview")
+	ErrInvalidTokenAudience      = errors.New("Error: token isn't valid for the audiences")
+	ErrDirectoryUnavailable      = errors.New("Error: directory unavailable")
+	ErrSamlNotConfigured         = errors.New("Error: SAML login isn't configured")
+	ErrInvalidSamlResponse       = errors.New("Error: SAML response missing or invalid")
+	ErrInvalidRelayState         = errors.New("Error: SAML login expired or was started in another browser")
+	ErrGroupNotFound             = errors.New("Error: group not found")
+	ErrGroupAlreadyExists        = errors.New("Error: group already exist")
+	ErrDisplayNameIsRequired     = errors.New("Error: display name is required")
+	ErrInvalidScimFilter         = errors.New("Error: only the eq filter of userName, displayName and externalId is supported")
+	ErrInvalidScimPatch          = errors.New("Error: invalid patch operation")
+	ErrInvalidScimMember         = errors.New("Error: group member isn't a user")
+	ErrMalformedScimRequest      = errors.New("Error: SCIM request is malformed")
+	ErrOrganizationNotFound      = errors.New("Error: organization not found")
+	ErrOrganizationAlreadyExists = errors.New("Error: organization already exist")
+	ErrWrongOrganization         = errors.New("Error: token was issued by another organization")
+	ErrOrganizationsUnavailable  = errors.New("Error: organizations unavailable")
+	ErrLoginModeNotAllowed       = errors.New("Error: login mode isn't allowed by the organization")
+	ErrProvisioningNotAllowed    = errors.New("Error: users of the directory and identity provider belong to the default organization")
+	ErrPasswordTooShort          = errors.New("Error: password is too short")
+	ErrSlugIsRequired            = errors.New("Error: organization slug is required")
+	ErrMemberNotFound            = errors.New("Error: member not found")
+	ErrAlreadyAMember            = errors.New("Error: user is already a member")
+	ErrInvalidRole               = errors.New("Error: role must be owner, admin or member")
+	ErrInsufficientRole          = errors.New("Error: role of the member doesn't allow it")
+	ErrLastOwner                 = errors.New("Error: organization must keep an owner")
+	ErrInvitationNotFound        = errors.New("Error: invitation not found or expired")
+	ErrInvitationEmailMismatch   = errors.New("Error: invitation was sent to another email")
+	ErrInvalidAuditFilter        = errors.New("Error: outcome must be success or failure and from before to")
+)
+
+// OAuth error codes, as defined by RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+
+	// RFC 8628 section 3.5, device access token errors.
+	OAuthAuthorizationPending = "authorization_pending"
+	OAuthSlowDown             = "slow_down"
+	OAuthExpiredToken         = "expired_token"
 )
 
 const BrazilianDateTimeFormat = "02/01/2006 15:04:05"
@@ -65,6 +135,27 @@ var (
 	}
 )
 
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthErrorHandler writes the error body expected by OAuth clients, which
+// is different from the one used by the rest of the API.
+func OAuthErrorHandler(w http.ResponseWriter, code, description string, status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(OAuthError{Error: code, ErrorDescription: description})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
 func writeError(w http.ResponseWriter, message string, status int, path string) {
 	var timestamp string = time.Now().Format(BrazilianDateTimeFormat)
 	resp := Error{
@@ -0,0 +1,25 @@
+package errorhandler
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcErrorHandler converts the error of a service into the status of its
+// kind, the message of the internal ones is never shown like in http.
+func GrpcErrorHandler(err error) error {
+	switch KindOf(err) {
+	case KindInvalid:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case KindUnauthorized:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case KindForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case KindNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case KindConflict:
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Error(codes.Internal, "An unexpected Error Occurred.")
+	}
+}
@@ -0,0 +1,83 @@
+package errorhandler
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kind classifies the errors returned by the services, each transport maps
+// it to its own status so the services don't need to know about them.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+)
+
+// ServiceError is an error of a service with its kind, the message of the
+// wrapped error is the one shown to the client.
+type ServiceError struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *ServiceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+func Invalid(err error) error {
+	return &ServiceError{Kind: KindInvalid, Err: err}
+}
+
+func Unauthorized(err error) error {
+	return &ServiceError{Kind: KindUnauthorized, Err: err}
+}
+
+func Forbidden(err error) error {
+	return &ServiceError{Kind: KindForbidden, Err: err}
+}
+
+func NotFound(err error) error {
+	return &ServiceError{Kind: KindNotFound, Err: err}
+}
+
+func Conflict(err error) error {
+	return &ServiceError{Kind: KindConflict, Err: err}
+}
+
+// KindOf returns the kind of the error, anything that wasn't classified by
+// the service is internal.
+func KindOf(err error) Kind {
+	var serviceError *ServiceError
+	if errors.As(err, &serviceError) {
+		return serviceError.Kind
+	}
+	return KindInternal
+}
+
+// ServiceErrorHandler writes the error of a service with the status of its
+// kind, the message of the internal ones is never shown.
+func ServiceErrorHandler(w http.ResponseWriter, err error, path string) {
+	switch KindOf(err) {
+	case KindInvalid:
+		BadRequestErrorHandler(w, err, path)
+	case KindUnauthorized:
+		UnauthroizedErrorHandler(w, err)
+	case KindForbidden:
+		ForbiddenErrorHandler(w, err)
+	case KindNotFound:
+		RequestErrorHandler(w, err, http.StatusNotFound, path)
+	case KindConflict:
+		RequestErrorHandler(w, err, http.StatusConflict, path)
+	default:
+		InternalErrorHandler(w)
+	}
+}
@@ -0,0 +1,66 @@
+package errorhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The error response and the scimType of RFC 7644 section 3.12.
+const (
+	ScimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	ScimInvalidFilter = "invalidFilter"
+	ScimInvalidValue  = "invalidValue"
+	ScimInvalidSyntax = "invalidSyntax"
+	ScimUniqueness    = "uniqueness"
+)
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	Status   string   `json:"status"`
+}
+
+// ScimErrorHandler writes the error body of the SCIM clients, the status is
+// a string there.
+func ScimErrorHandler(w http.ResponseWriter, status int, scimType string, err error) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+
+	err = json.NewEncoder(w).Encode(ScimError{
+		Schemas:  []string{ScimErrorSchema},
+		ScimType: scimType,
+		Detail:   err.Error(),
+		Status:   strconv.Itoa(status),
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// ScimServiceErrorHandler is the ServiceErrorHandler of the SCIM endpoints.
+func ScimServiceErrorHandler(w http.ResponseWriter, err error) {
+	switch KindOf(err) {
+	case KindInvalid:
+		scimType := ScimInvalidValue
+		if errors.Is(err, ErrInvalidScimFilter) {
+			scimType = ScimInvalidFilter
+		}
+		ScimErrorHandler(w, http.StatusBadRequest, scimType, err)
+	case KindUnauthorized:
+		ScimErrorHandler(w, http.StatusUnauthorized, "", err)
+	case KindForbidden:
+		ScimErrorHandler(w, http.StatusForbidden, "", err)
+	case KindNotFound:
+		ScimErrorHandler(w, http.StatusNotFound, "", err)
+	case KindConflict:
+		ScimErrorHandler(w, http.StatusConflict, ScimUniqueness, err)
+	default:
+		ScimErrorHandler(w, http.StatusInternalServerError, "", errors.New("An unexpected Error Occurred."))
+	}
+}
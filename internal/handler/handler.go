@@ -1,16 +1,26 @@
 package handler
 
 import (
+	"slices"
+
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/rafaeldepontes/fauthless-go/api"
+	auditServer "github.com/rafaeldepontes/fauthless-go/internal/audit/server"
 	authServer "github.com/rafaeldepontes/fauthless-go/internal/auth/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/health"
+	memberServer "github.com/rafaeldepontes/fauthless-go/internal/member/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+	scimServer "github.com/rafaeldepontes/fauthless-go/internal/scim/server"
 	"github.com/rafaeldepontes/fauthless-go/internal/user/server"
 )
 
 // Handler controls the system routes based on *chi.Mux and a configuration struct.
 func Handler(r *chi.Mux, app *api.Application, typeOf int) {
 	r.Use(chimiddleware.StripSlashes)
+	r.Use(app.Middleware.Tenant)
+	r.Use(app.Middleware.AuditClient)
 
 	// Public
 	switch typeOf {
@@ -20,12 +30,18 @@ func Handler(r *chi.Mux, app *api.Application, typeOf int) {
 		authServer.MapAuthRoutesJwt(r, app.AuthController)
 	case api.JwtRefreshBased:
 		authServer.MapAuthRoutesJwtRefresh(r, app.AuthController)
+		authServer.MapAuthRoutesOAuthServer(r, app.AuthController)
+		authServer.MapTokenReviewRoutes(r, app.AuthController, app.Middleware)
 	case api.OAuth2:
 		authServer.MapAuthRoutesOAuth2(r, app.AuthController)
+	case api.MutualTLS: // the client certificate is the credential, no login...
 	default:
 		app.Logger.Fatalln("No authentication method was chosen.")
 	}
 	authServer.MapAuthRoutes(r, app.AuthController)
+	health.MapHealthRoutes(r, app.Health)
+	mapScimRoutes(r, app)
+	memberServer.MapInvitationRoutes(r, app.MemberController)
 
 	// Protected
 	r.Group(func(r chi.Router) {
@@ -37,7 +53,10 @@ func Handler(r *chi.Mux, app *api.Application, typeOf int) {
 				r.Use(app.Middleware.JwtBased)
 			case api.JwtRefreshBased:
 				r.Use(app.Middleware.JwtRefreshBased)
+				authServer.MapOAuthClientRoutes(&r, app.AuthController)
 			case api.OAuth2: //do nothing...
+			case api.MutualTLS:
+				r.Use(app.Middleware.MutualTLS)
 			default:
 				app.Logger.Fatal("No authentication method was chosen.")
 			}
@@ -49,7 +68,62 @@ func Handler(r *chi.Mux, app *api.Application, typeOf int) {
 				app.Logger.Infoln("Cookie based authorization doens't allow this endpoints...")
 			default:
 				server.MapUserRoutesJwt(&r, app.UserController)
+				memberServer.MapMemberRoutes(&r, app.MemberController, app.Middleware)
+				auditServer.MapAuditRoutes(&r, app.AuditController, app.Middleware)
+			}
+		})
+	})
+}
+
+// HandlerModes controls the routes of the single binary, the protected routes
+// accept the credentials of every mode enabled (see api.DefaultAuthModes).
+func HandlerModes(r *chi.Mux, app *api.Application, modes []string) {
+	r.Use(chimiddleware.StripSlashes)
+	r.Use(app.Middleware.Tenant)
+	r.Use(app.Middleware.AuditClient)
+
+	// Public
+	if slices.Contains(modes, middleware.AuthMethodCookie) {
+		authServer.MapAuthRoutesCookieMultiMode(r, app.AuthController)
+	}
+	if slices.Contains(modes, middleware.AuthMethodJwt) {
+		authServer.MapAuthRoutesJwtRefresh(r, app.AuthController)
+		authServer.MapTokenReviewRoutes(r, app.AuthController, app.Middleware)
+	}
+	// the oauth session is started by the login page of the authorization server
+	if slices.Contains(modes, middleware.AuthMethodJwt) || slices.Contains(modes, middleware.AuthMethodOAuthSession) {
+		authServer.MapAuthRoutesOAuthServer(r, app.AuthController)
+	}
+	authServer.MapAuthRoutesSaml(r, app.AuthController)
+	authServer.MapAuthRoutes(r, app.AuthController)
+	health.MapHealthRoutes(r, app.Health)
+	r.Get("/auth/verify", app.Middleware.ForwardAuth(app.Authenticators...))
+	mapScimRoutes(r, app)
+	memberServer.MapInvitationRoutes(r, app.MemberController)
+
+	// Protected
+	r.Group(func(r chi.Router) {
+		r.Route("/api/v1", func(r chi.Router) {
+			r.Use(app.Middleware.Authenticate(app.Authenticators...))
+
+			authServer.MapOAuthClientRoutes(&r, app.AuthController)
+			if slices.Contains(modes, middleware.AuthMethodPersonalAccessToken) {
+				authServer.MapPersonalAccessTokenRoutes(&r, app.AuthController)
 			}
+
+			server.MapUserRoutes(&r, app.UserController)
+			server.MapUserRoutesJwt(&r, app.UserController)
+			memberServer.MapMemberRoutes(&r, app.MemberController, app.Middleware)
+			auditServer.MapAuditRoutes(&r, app.AuditController, app.Middleware)
 		})
 	})
 }
+
+// mapScimRoutes maps the provisioning of the identity provider, it has its
+// own token whatever the mode is.
+func mapScimRoutes(r *chi.Mux, app *api.Application) {
+	r.Route(scim.BasePath, func(r chi.Router) {
+		r.Use(app.Middleware.ScimAuthenticated)
+		scimServer.MapScimRoutes(&r, app.ScimController)
+	})
+}
@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// The paths of the probes, they're answered even when the organization of
+// the request can't be resolved.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// CheckTimeout bounds each readiness check, a probe that hangs is as bad as
+// one that fails.
+const CheckTimeout = 2 * time.Second
+
+// Check is a dependency the server needs to handle requests, like the
+// database or the signing keys.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Controller answers the liveness and readiness probes. Once Drain is
+// called the server is shutting down and it's no longer ready, so the load
+// balancer stops sending new requests while the current ones finish.
+type Controller struct {
+	checks   []Check
+	draining atomic.Bool
+	Logger   *log.Logger
+}
+
+func NewController(logg *log.Logger, checks ...Check) *Controller {
+	return &Controller{checks: checks, Logger: logg}
+}
+
+func MapHealthRoutes(r *chi.Mux, controller *Controller) {
+	(*r).Get(LivenessPath, controller.Liveness)
+	(*r).Get(ReadinessPath, controller.Readiness)
+}
+
+// Drain marks the server as shutting down.
+func (c *Controller) Drain() {
+	c.draining.Store(true)
+}
+
+// Liveness only tells the process is up and serving, the dependencies are
+// left to the readiness probe so an outage of the database doesn't get the
+// server restarted.
+func (c *Controller) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, domain.HealthResponse{Status: domain.HealthStatusOk})
+}
+
+// Readiness runs every check, the server is ready only when all of them
+// pass.
+func (c *Controller) Readiness(w http.ResponseWriter, r *http.Request) {
+	if c.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, domain.HealthResponse{Status: domain.HealthStatusDraining})
+		return
+	}
+
+	response := domain.HealthResponse{
+		Status: domain.HealthStatusOk,
+		Checks: make(map[string]string, len(c.checks)),
+	}
+	status := http.StatusOK
+
+	for _, check := range c.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), CheckTimeout)
+		err := check.Run(ctx)
+		cancel()
+
+		// the probes are public, the reason is only logged
+		if err != nil {
+			c.Logger.Errorf("The readiness check %v failed: %v", check.Name, err)
+			response.Checks[check.Name] = domain.HealthStatusFailing
+			response.Status = domain.HealthStatusFailing
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[check.Name] = domain.HealthStatusOk
+	}
+
+	writeHealth(w, status, response)
+}
+
+func writeHealth(w http.ResponseWriter, status int, response domain.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
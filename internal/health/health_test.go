@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+func readiness(t *testing.T, controller *Controller) (int, domain.HealthResponse) {
+	w := httptest.NewRecorder()
+	controller.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var response domain.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	return w.Code, response
+}
+
+// TestReadiness verifies a failing check or a shutdown makes the server not
+// ready while it stays alive.
+func TestReadiness(t *testing.T) {
+	// given
+	databaseErr := errors.New("connection refused")
+	ok := Check{Name: "signing_key", Run: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "database", Run: func(ctx context.Context) error { return databaseErr }}
+
+	// when
+	code, response := readiness(t, NewController(logrus.New(), ok))
+
+	// then
+	if code != http.StatusOK || response.Status != domain.HealthStatusOk {
+		t.Errorf("expected ready, got %v %+v", code, response)
+	}
+
+	// when
+	code, response = readiness(t, NewController(logrus.New(), ok, failing))
+
+	// then
+	if code != http.StatusServiceUnavailable || response.Checks["database"] != domain.HealthStatusFailing {
+		t.Errorf("expected the database check to fail, got %v %+v", code, response)
+	}
+	if response.Checks["signing_key"] != domain.HealthStatusOk {
+		t.Errorf("expected the other checks to still run, got %+v", response)
+	}
+
+	// when
+	controller := NewController(logrus.New(), ok)
+	controller.Drain()
+	code, response = readiness(t, controller)
+
+	// then
+	if code != http.StatusServiceUnavailable || response.Status != domain.HealthStatusDraining {
+		t.Errorf("expected draining, got %v %+v", code, response)
+	}
+
+	w := httptest.NewRecorder()
+	controller.Liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the server to stay alive while draining, got %v", w.Code)
+	}
+}
@@ -0,0 +1,164 @@
+// Package ldap checks the logins against a LDAP or Active Directory server,
+// the users are provisioned in the users table the first time they log in.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+)
+
+// DialTimeout bounds the connection to the server, the operations are
+// bounded by the deadline of the login.
+const DialTimeout = 5 * time.Second
+
+// Conn is the part of the connection the verifier uses, *ldap.Conn of
+// go-ldap implements it.
+type Conn interface {
+	Bind(username, password string) error
+	Search(searchRequest *goldap.SearchRequest) (*goldap.SearchResult, error)
+	Close() error
+}
+
+// Dialer opens a connection to the server.
+type Dialer func(ctx context.Context) (Conn, error)
+
+// Verifier is the auth.CredentialVerifier of the directory users.
+type Verifier struct {
+	config         *configs.Configuration
+	userRepository user.Repository
+	dial           Dialer
+	groupRoles     user.GroupRoles
+}
+
+// NewVerifier creates the verifier of the config, dial is DialUrl(config)
+// unless it's a test.
+func NewVerifier(config *configs.Configuration, userRepository user.Repository, dial Dialer) *Verifier {
+	return &Verifier{
+		config:         config,
+		userRepository: userRepository,
+		dial:           dial,
+		groupRoles:     user.NewGroupRoles(config.LdapGroupRoles),
+	}
+}
+
+// DialUrl connects to LDAP_URL, upgrading the ldap:// connections with
+// StartTLS when LDAP_START_TLS is set.
+func DialUrl(config *configs.Configuration) Dialer {
+	return func(ctx context.Context) (Conn, error) {
+		conn, err := goldap.DialURL(config.LdapUrl, goldap.DialWithDialer(&net.Dialer{Timeout: DialTimeout}))
+		if err != nil {
+			return nil, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetTimeout(time.Until(deadline))
+		}
+
+		if config.LdapStartTls {
+			ldapUrl, _ := url.Parse(config.LdapUrl)
+			if err := conn.StartTLS(&tls.Config{ServerName: ldapUrl.Hostname()}); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+}
+
+// VerifyCredentials searches the user with the service account and binds
+// as them with the password. It returns ErrUserNotFound when the directory
+// doesn't have the user, so the users table is tried next. The directory
+// only has users of the default organization, the others skip it.
+func (v *Verifier) VerifyCredentials(ctx context.Context, login *domain.UserLogin) (*domain.User, error) {
+	if tenant.IdFrom(ctx) != tenant.DefaultId {
+		return nil, errorhandler.ErrUserNotFound
+	}
+
+	// a bind without a password is an anonymous bind, which always succeeds
+	if login.Username == "" || login.Password == "" {
+		return nil, errorhandler.ErrInvalidUsernameOrPassword
+	}
+
+	conn, err := v.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrDirectoryUnavailable, err)
+	}
+	defer conn.Close()
+
+	if v.config.LdapBindDn != "" {
+		if err := conn.Bind(v.config.LdapBindDn, v.config.LdapBindPassword); err != nil {
+			return nil, fmt.Errorf("%w: %w", errorhandler.ErrDirectoryUnavailable, err)
+		}
+	}
+
+	entry, err := v.findEntry(conn, login.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, login.Password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, errorhandler.ErrInvalidUsernameOrPassword
+		}
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrDirectoryUnavailable, err)
+	}
+
+	// the username of the directory, not the one typed, so the case matches
+	return user.Provision(ctx, v.userRepository,
+		entry.GetAttributeValue(v.config.LdapUsernameAttribute),
+		entry.GetAttributeValue(v.config.LdapEmailAttribute),
+		v.groupRoles.Roles(groupNames(entry.GetAttributeValues(v.config.LdapGroupAttribute))),
+	)
+}
+
+func (v *Verifier) findEntry(conn Conn, username string) (*goldap.Entry, error) {
+	filter := fmt.Sprintf("(&%v(%v=%v))", v.config.LdapUserFilter, v.config.LdapUsernameAttribute, goldap.EscapeFilter(username))
+	result, err := conn.Search(goldap.NewSearchRequest(
+		v.config.LdapBaseDn, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, 0, false, filter,
+		[]string{v.config.LdapUsernameAttribute, v.config.LdapEmailAttribute, v.config.LdapGroupAttribute},
+		nil,
+	))
+	if err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+			return nil, errorhandler.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrDirectoryUnavailable, err)
+	}
+
+	// more than one entry means the filter is ambiguous, none of them is used
+	if len(result.Entries) != 1 {
+		return nil, errorhandler.ErrUserNotFound
+	}
+	return result.Entries[0], nil
+}
+
+// groupNames are the CN of the groups DN, the names LDAP_GROUP_ROLES uses.
+func groupNames(groups []string) []string {
+	names := []string{}
+	for _, group := range groups {
+		dn, err := goldap.ParseDN(group)
+		if err != nil || len(dn.RDNs) == 0 {
+			continue
+		}
+
+		for _, attribute := range dn.RDNs[0].Attributes {
+			if strings.EqualFold(attribute.Type, "cn") {
+				names = append(names, attribute.Value)
+			}
+		}
+	}
+	return names
+}
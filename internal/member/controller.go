@@ -0,0 +1,15 @@
+package member
+
+import "net/http"
+
+type Controller interface {
+	ListMembers(w http.ResponseWriter, r *http.Request)
+	ChangeRole(w http.ResponseWriter, r *http.Request)
+	RemoveMember(w http.ResponseWriter, r *http.Request)
+
+	Invite(w http.ResponseWriter, r *http.Request)
+	ListInvitations(w http.ResponseWriter, r *http.Request)
+	RevokeInvitation(w http.ResponseWriter, r *http.Request)
+	AcceptInvitation(w http.ResponseWriter, r *http.Request)
+	DeclineInvitation(w http.ResponseWriter, r *http.Request)
+}
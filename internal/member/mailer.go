@@ -0,0 +1,73 @@
+package member
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	log "github.com/sirupsen/logrus"
+)
+
+// Mail is an email in plain text.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the invitations, any provider can be plugged in by
+// implementing it.
+type Mailer interface {
+	Send(ctx context.Context, mail *Mail) error
+}
+
+type logMailer struct {
+	logger *log.Logger
+}
+
+// NewLogMailer initialize a Mailer that writes the emails in the log instead
+// of sending them, it's the one used without an SMTP server.
+func NewLogMailer(logger *log.Logger) Mailer {
+	return &logMailer{logger: logger}
+}
+
+func (m *logMailer) Send(ctx context.Context, mail *Mail) error {
+	m.logger.WithFields(log.Fields{
+		"to":      mail.To,
+		"subject": mail.Subject,
+	}).Infoln(mail.Body)
+	return nil
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSmtpMailer initialize a Mailer that sends the emails through the SMTP
+// server at addr (host:port), it authenticates when there's a username.
+func NewSmtpMailer(addr, username, password, from string) Mailer {
+	m := &smtpMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *smtpMailer) Send(ctx context.Context, mail *Mail) error {
+	// the headers can't be broken by the values the users send
+	if strings.ContainsAny(mail.To+mail.Subject, "\r\n") {
+		return errorhandler.ErrInvalidEmail
+	}
+
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + mail.To + "\r\n" +
+		"Subject: " + mail.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + mail.Body
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, []byte(msg))
+}
@@ -0,0 +1,52 @@
+// Package member is the team of the organizations, the members have a role
+// and the new ones join through an emailed invitation.
+package member
+
+import (
+	"context"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// The roles of the members, each one can do what the ones below it can.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// InvitationDuration is how long an invitation can be accepted.
+const InvitationDuration = 7 * 24 * time.Hour
+
+var roleRanks = map[string]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole tells if the role is at least the minimum one, an owner has the
+// admin role as well.
+func HasRole(role, minimum string) bool {
+	return ValidRole(role) && roleRanks[role] >= roleRanks[minimum]
+}
+
+// Service is the membership of the organization of the context without any
+// transport, the errors are classified with the errorhandler kinds. actorId
+// is the user doing it, the service checks the rules of their role.
+type Service interface {
+	ListMembers(ctx context.Context, cursor int64, size int) (*domain.CursorPagination[domain.Member], error)
+	ChangeRole(ctx context.Context, actorId, userId int64, role string) (*domain.Member, error)
+	RemoveMember(ctx context.Context, actorId, userId int64) error
+
+	Invite(ctx context.Context, actorId int64, req *domain.InvitationRequest) (*domain.InvitationResponse, error)
+	ListInvitations(ctx context.Context) ([]domain.InvitationResponse, error)
+	RevokeInvitation(ctx context.Context, id string) error
+	AcceptInvitation(ctx context.Context, userId int64, rawToken string) (*domain.Member, error)
+	DeclineInvitation(ctx context.Context, rawToken string) error
+}
@@ -0,0 +1,25 @@
+package member
+
+import (
+	"context"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// Repository keeps the members and the invitations of the organization of
+// the context, except FindInvitation and ConsumeInvitation that look the
+// invitation up by its token whatever the organization is.
+type Repository interface {
+	FindMembers(ctx context.Context, cursor int64, size int) ([]domain.Member, int64, error)
+	FindMember(ctx context.Context, userId int64) (*domain.Member, error)
+	CountOwners(ctx context.Context) (int, error)
+	AddMember(ctx context.Context, m *domain.Member) error
+	UpdateMemberRole(ctx context.Context, userId int64, role string) error
+	RemoveMember(ctx context.Context, userId int64) error
+
+	CreateInvitation(ctx context.Context, inv *domain.Invitation) error
+	FindInvitations(ctx context.Context) ([]domain.Invitation, error)
+	FindInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error)
+	ConsumeInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error)
+	DeleteInvitation(ctx context.Context, id string) error
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+const invitationColumns = `id, token_hash, org_id, email, role, invited_by, created_at, expires_at`
+
+type memberRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewMemberRepository initialize a new member.Repository containing a
+// database connection, the members are scoped by the organization of the
+// context.
+func NewMemberRepository(conn *sql.DB, queryTimeout time.Duration) member.Repository {
+	return &memberRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// FindMembers lists the members from the user id cursor, size is the page
+// plus one so the next cursor is known, it's 0 on the last page.
+func (repo *memberRepository) FindMembers(ctx context.Context, cursor int64, size int) ([]domain.Member, int64, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id >= $1 AND m.org_id = $3
+		ORDER BY m.user_id ASC
+		LIMIT $2;
+	`
+	rows, err := repo.db.QueryContext(ctx, query, cursor, size, tenant.IdFrom(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	members := make([]domain.Member, 0, size)
+	for rows.Next() {
+		var m domain.Member
+		if err := rows.Scan(&m.UserId, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor int64
+	if len(members) == size {
+		nextCursor = members[len(members)-1].UserId
+		members = members[:len(members)-1]
+	}
+
+	return members, nextCursor, nil
+}
+
+// FindMember returns the membership of the user, or ErrMemberNotFound.
+func (repo *memberRepository) FindMember(ctx context.Context, userId int64) (*domain.Member, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1 AND m.org_id = $2;
+	`
+	var m domain.Member
+	if err := repo.db.QueryRowContext(ctx, query, userId, tenant.IdFrom(ctx)).Scan(&m.UserId, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (repo *memberRepository) CountOwners(ctx context.Context) (int, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var owners int
+	query := `SELECT COUNT(user_id) FROM organization_members WHERE role = $1 AND org_id = $2;`
+	err := repo.db.QueryRowContext(ctx, query, member.RoleOwner, tenant.IdFrom(ctx)).Scan(&owners)
+	return owners, err
+}
+
+// AddMember saves the membership, returns ErrAlreadyAMember when the user
+// is one.
+func (repo *memberRepository) AddMember(ctx context.Context, m *domain.Member) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO organization_members (org_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING created_at;
+	`
+	err := repo.db.QueryRowContext(ctx, query, tenant.IdFrom(ctx), m.UserId, m.Role).Scan(&m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errorhandler.ErrAlreadyAMember
+	}
+	return err
+}
+
+// UpdateMemberRole changes the role of the member, returns
+// ErrMemberNotFound when the user isn't one.
+func (repo *memberRepository) UpdateMemberRole(ctx context.Context, userId int64, role string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `UPDATE organization_members SET role = $1 WHERE user_id = $2 AND org_id = $3;`
+	result, err := repo.db.ExecContext(ctx, query, role, userId, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrMemberNotFound
+	}
+	return nil
+}
+
+// RemoveMember deletes the membership, returns ErrMemberNotFound when the
+// user isn't a member.
+func (repo *memberRepository) RemoveMember(ctx context.Context, userId int64) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM organization_members WHERE user_id = $1 AND org_id = $2;`
+	result, err := repo.db.ExecContext(ctx, query, userId, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrMemberNotFound
+	}
+	return nil
+}
+
+// CreateInvitation saves the invitation, only the hash of its token is
+// stored.
+func (repo *memberRepository) CreateInvitation(ctx context.Context, inv *domain.Invitation) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	inv.OrgId = tenant.IdFrom(ctx)
+	query := `
+		INSERT INTO organization_invitations (id, token_hash, org_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at;
+	`
+	return repo.db.QueryRowContext(ctx, query, inv.Id, inv.TokenHash, inv.OrgId, inv.Email, inv.Role, inv.InvitedBy, inv.ExpiresAt).Scan(&inv.CreatedAt)
+}
+
+// FindInvitations lists the invitations that can still be accepted, the
+// newest first.
+func (repo *memberRepository) FindInvitations(ctx context.Context) ([]domain.Invitation, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `SELECT ` + invitationColumns + ` FROM organization_invitations WHERE org_id = $1 AND expires_at > now() ORDER BY created_at DESC;`
+	rows, err := repo.db.QueryContext(ctx, query, tenant.IdFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []domain.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// FindInvitation returns the invitation of the token, of any organization,
+// or ErrInvitationNotFound.
+func (repo *memberRepository) FindInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `SELECT ` + invitationColumns + ` FROM organization_invitations WHERE token_hash = $1;`
+	return findInvitation(repo.db.QueryRowContext(ctx, query, tokenHash))
+}
+
+// ConsumeInvitation deletes the invitation of the token and returns it, so
+// it can only be used once, or ErrInvitationNotFound.
+func (repo *memberRepository) ConsumeInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM organization_invitations WHERE token_hash = $1 RETURNING ` + invitationColumns + `;`
+	return findInvitation(repo.db.QueryRowContext(ctx, query, tokenHash))
+}
+
+// DeleteInvitation revokes the invitation, returns ErrInvitationNotFound
+// when there's none with the id.
+func (repo *memberRepository) DeleteInvitation(ctx context.Context, id string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM organization_invitations WHERE id = $1 AND org_id = $2;`
+	result, err := repo.db.ExecContext(ctx, query, id, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrInvitationNotFound
+	}
+	return nil
+}
+
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*domain.Invitation, error) {
+	var inv domain.Invitation
+	err := row.Scan(&inv.Id, &inv.TokenHash, &inv.OrgId, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt)
+	return &inv, err
+}
+
+func findInvitation(row *sql.Row) (*domain.Invitation, error) {
+	inv, err := scanInvitation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errorhandler.ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	jwt "github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// memberController is the http transport of the member.Service, the user
+// acting is the one of the claims.
+type memberController struct {
+	service *member.Service
+}
+
+func NewMemberController(s *member.Service) member.Controller {
+	return &memberController{
+		service: s,
+	}
+}
+
+// ListMembers lists the members paged by the cursor and size query
+// parameters, the next_cursor of the response is 0 on the last page.
+func (c *memberController) ListMembers(w http.ResponseWriter, r *http.Request) {
+	cursor, err := strconv.ParseInt(queryOr(r, "cursor", "0"), 10, 64)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	size, err := strconv.Atoi(queryOr(r, "size", "25"))
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrInvalidType, r.URL.Path)
+		return
+	}
+
+	pageModel, err := (*c.service).ListMembers(r.Context(), cursor, size)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, pageModel)
+}
+
+func (c *memberController) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	userClaims, userId, ok := claimsAndId(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.MemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	m, err := (*c.service).ChangeRole(r.Context(), userClaims.Id, userId, req.Role)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, m)
+}
+
+func (c *memberController) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userClaims, userId, ok := claimsAndId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := (*c.service).RemoveMember(r.Context(), userClaims.Id, userId); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Invite emails the invitation, the response doesn't have the token.
+func (c *memberController) Invite(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	var req domain.InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	invitation, err := (*c.service).Invite(r.Context(), userClaims.Id, &req)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, invitation)
+}
+
+func (c *memberController) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := (*c.service).ListInvitations(r.Context())
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, invitations)
+}
+
+func (c *memberController) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	if err := (*c.service).RevokeInvitation(r.Context(), r.PathValue("id")); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *memberController) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return
+	}
+
+	var req domain.InvitationTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	m, err := (*c.service).AcceptInvitation(r.Context(), userClaims.Id, req.Token)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, m)
+}
+
+func (c *memberController) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	var req domain.InvitationTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	if err := (*c.service).DeclineInvitation(r.Context(), req.Token); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimsAndId returns the claims of the request and the user id of the
+// path, it writes the error and returns false when either is missing.
+func claimsAndId(w http.ResponseWriter, r *http.Request) (*jwt.UserClaims, int64, bool) {
+	userClaims, ok := middleware.UserClaimsFromContext(r.Context())
+	if !ok {
+		errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+		return nil, 0, false
+	}
+
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrIdIsRequired, r.URL.Path)
+		return nil, 0, false
+	}
+	return userClaims, userId, true
+}
+
+func queryOr(r *http.Request, key, defaultVal string) string {
+	if value := r.URL.Query().Get(key); value != "" {
+		return value
+	}
+	return defaultVal
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+)
+
+// MapMemberRoutes maps the members and invitations of the organization,
+// behind the authentication. The invitations are accepted by users that
+// aren't members yet.
+func MapMemberRoutes(route *chi.Router, controller *member.Controller, m *middleware.Middleware) {
+	(*route).With(m.OrgRole(member.RoleMember)).Get("/members", (*controller).ListMembers)
+	(*route).With(m.OrgRole(member.RoleAdmin)).Patch("/members/{id}", (*controller).ChangeRole)
+	// the members can leave, the service checks the rest
+	(*route).With(m.OrgRole(member.RoleMember)).Delete("/members/{id}", (*controller).RemoveMember)
+
+	(*route).With(m.OrgRole(member.RoleAdmin)).Get("/invitations", (*controller).ListInvitations)
+	(*route).With(m.OrgRole(member.RoleAdmin)).Post("/invitations", (*controller).Invite)
+	(*route).With(m.OrgRole(member.RoleAdmin)).Delete("/invitations/{id}", (*controller).RevokeInvitation)
+	(*route).Post("/invitations/accept", (*controller).AcceptInvitation)
+}
+
+// MapInvitationRoutes maps the public decline, the invited don't need an
+// account to turn the invitation down.
+func MapInvitationRoutes(r *chi.Mux, controller *member.Controller) {
+	(*r).Post("/invitations/decline", (*controller).DeclineInvitation)
+}
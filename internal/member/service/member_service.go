@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/pagination"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenLength is the number of random bytes of the invitation tokens.
+const tokenLength = 32
+
+type memberService struct {
+	repo              member.Repository
+	userRepository    user.Repository
+	sessionRepository auth.Repository
+	patRepository     auth.PersonalAccessTokenRepository
+	mailer            member.Mailer
+	audit             audit.Recorder
+	Logger            *log.Logger
+
+	invitationUrl string
+}
+
+// NewMemberService initialize a new member.Service, the invitations are sent
+// by the mailer with a link to INVITATION_URL and the changes to the members
+// are recorded by the recorder.
+func NewMemberService(repo member.Repository, userRepo user.Repository, sessionRepo auth.Repository, patRepo auth.PersonalAccessTokenRepository, mailer member.Mailer, recorder audit.Recorder, logg *log.Logger, config *configs.Configuration) member.Service {
+	return &memberService{
+		repo:              repo,
+		userRepository:    userRepo,
+		sessionRepository: sessionRepo,
+		patRepository:     patRepo,
+		mailer:            mailer,
+		audit:             recorder,
+		Logger:            logg,
+		invitationUrl:     config.InvitationUrl,
+	}
+}
+
+// ListMembers lists the members from the user id cursor, like the cursor
+// pagination of the users.
+func (s *memberService) ListMembers(ctx context.Context, cursor int64, size int) (*domain.CursorPagination[domain.Member], error) {
+	if size <= 0 {
+		size = 25
+	}
+
+	members, nextCursor, err := s.repo.FindMembers(ctx, cursor, size+1)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	return pagination.NewCursorPagination(members, size, nextCursor), nil
+}
+
+// ChangeRole changes the role of a member. The admins manage the admins and
+// members, only the owners make or unmake owners and the last owner can't
+// step down.
+func (s *memberService) ChangeRole(ctx context.Context, actorId, userId int64, role string) (*domain.Member, error) {
+	if !member.ValidRole(role) {
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidRole)
+	}
+
+	actor, target, err := s.actorAndTarget(ctx, actorId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionMemberRoleChanged, target.Username)
+	if err := s.checkManages(ctx, actor, target, role); err != nil {
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return nil, err
+	}
+
+	if err := s.repo.UpdateMemberRole(ctx, userId, role); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, errorhandler.NotFound(err)
+	}
+	s.audit.Record(ctx, event)
+
+	s.Logger.Infof("The member %v changed the role of %v from %v to %v", actor.Username, target.Username, target.Role, role)
+	target.Role = role
+	return target, nil
+}
+
+// RemoveMember removes a member, the members can remove themselves. The
+// sessions and personal access tokens the user has in the organization are
+// revoked, the access tokens already issued stop being accepted by the
+// routes of the members right away.
+func (s *memberService) RemoveMember(ctx context.Context, actorId, userId int64) error {
+	actor, target, err := s.actorAndTarget(ctx, actorId, userId)
+	if err != nil {
+		return err
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionMemberRemoved, target.Username)
+	if actorId != userId {
+		err = s.checkManages(ctx, actor, target, "")
+	} else {
+		err = s.checkKeepsOwner(ctx, target, "")
+	}
+	if err != nil {
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return err
+	}
+
+	if err := s.repo.RemoveMember(ctx, userId); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return errorhandler.NotFound(err)
+	}
+	s.audit.Record(ctx, event)
+
+	if err := s.revokeTokens(ctx, target.Username); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return err
+	}
+
+	s.Logger.Infof("The member %v removed %v from the organization %v", actor.Username, target.Username, tenant.IdFrom(ctx))
+	return nil
+}
+
+// Invite emails an invitation to join the organization, the token is only
+// in the email. Only the owners invite owners.
+func (s *memberService) Invite(ctx context.Context, actorId int64, req *domain.InvitationRequest) (*domain.InvitationResponse, error) {
+	address, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidEmail)
+	}
+
+	if req.Role == "" {
+		req.Role = member.RoleMember
+	}
+	if !member.ValidRole(req.Role) {
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidRole)
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionInvitationCreated, strings.ToLower(address.Address))
+	actor, err := s.repo.FindMember(ctx, actorId)
+	if err != nil {
+		s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrMemberNotFound))
+		return nil, errorhandler.Forbidden(errorhandler.ErrMemberNotFound)
+	}
+	if !member.HasRole(actor.Role, member.RoleAdmin) || !member.HasRole(actor.Role, req.Role) {
+		s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrInsufficientRole))
+		return nil, errorhandler.Forbidden(errorhandler.ErrInsufficientRole)
+	}
+
+	rawToken := token.CookieBased{}.GenerateToken(tokenLength)
+	inv := &domain.Invitation{
+		Id:        uuid.NewString(),
+		TokenHash: hashToken(rawToken),
+		Email:     strings.ToLower(address.Address),
+		Role:      req.Role,
+		InvitedBy: actor.Username,
+		ExpiresAt: time.Now().Add(member.InvitationDuration),
+	}
+
+	if err := s.repo.CreateInvitation(ctx, inv); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	if err := s.mailer.Send(ctx, s.invitationMail(ctx, inv, rawToken)); err != nil {
+		// the invitation can't be accepted without the email
+		s.repo.DeleteInvitation(ctx, inv.Id)
+		s.Logger.Errorf("An error occurred sending the invitation: %v", err)
+		return nil, err
+	}
+	s.audit.Record(ctx, event)
+
+	s.Logger.Infof("The member %v invited %v as %v", actor.Username, inv.Email, inv.Role)
+	response := invitationResponse(inv)
+	return &response, nil
+}
+
+// ListInvitations lists the invitations that can still be accepted.
+func (s *memberService) ListInvitations(ctx context.Context) ([]domain.InvitationResponse, error) {
+	invitations, err := s.repo.FindInvitations(ctx)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	response := make([]domain.InvitationResponse, 0, len(invitations))
+	for i := range invitations {
+		response = append(response, invitationResponse(&invitations[i]))
+	}
+	return response, nil
+}
+
+// RevokeInvitation deletes an invitation, its link stops working.
+func (s *memberService) RevokeInvitation(ctx context.Context, id string) error {
+	if id == "" {
+		return errorhandler.Invalid(errorhandler.ErrIdIsRequired)
+	}
+
+	event := middleware.AuditEvent(ctx, audit.ActionInvitationRevoked, id)
+	if err := s.repo.DeleteInvitation(ctx, id); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return errorhandler.NotFound(err)
+	}
+	s.audit.Record(ctx, event)
+
+	s.Logger.Infof("The invitation %v was revoked", id)
+	return nil
+}
+
+// AcceptInvitation makes the user a member with the role of the invitation,
+// which has to be of the organization of the context, not expired and sent
+// to the email of the user. It can only be accepted once.
+func (s *memberService) AcceptInvitation(ctx context.Context, userId int64, rawToken string) (*domain.Member, error) {
+	inv, err := s.repo.FindInvitation(ctx, hashToken(rawToken))
+	if err != nil || inv.ExpiresAt.Before(time.Now()) || !tenant.Matches(ctx, inv.OrgId) {
+		return nil, errorhandler.NotFound(errorhandler.ErrInvitationNotFound)
+	}
+
+	u, err := s.userRepository.FindUserById(ctx, userId)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, errorhandler.NotFound(errorhandler.ErrUserNotFound)
+	}
+	if u.Email == nil || !strings.EqualFold(*u.Email, inv.Email) {
+		return nil, errorhandler.Forbidden(errorhandler.ErrInvitationEmailMismatch)
+	}
+
+	if _, err := s.repo.FindMember(ctx, userId); err == nil {
+		return nil, errorhandler.Conflict(errorhandler.ErrAlreadyAMember)
+	}
+
+	// whoever consumes it first joins, the other requests find no invitation
+	if _, err := s.repo.ConsumeInvitation(ctx, inv.TokenHash); err != nil {
+		return nil, errorhandler.NotFound(errorhandler.ErrInvitationNotFound)
+	}
+
+	m := &domain.Member{UserId: userId, Username: *u.Username, Role: inv.Role}
+	if err := s.repo.AddMember(ctx, m); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		if errors.Is(err, errorhandler.ErrAlreadyAMember) {
+			return nil, errorhandler.Conflict(err)
+		}
+		return nil, err
+	}
+	s.audit.Record(ctx, middleware.AuditEvent(ctx, audit.ActionInvitationAccepted, inv.Id))
+
+	s.Logger.Infof("The user %v accepted the invitation %v as %v", m.Username, inv.Id, m.Role)
+	return m, nil
+}
+
+// DeclineInvitation deletes the invitation, whoever has the token can
+// decline it without an account.
+func (s *memberService) DeclineInvitation(ctx context.Context, rawToken string) error {
+	inv, err := s.repo.ConsumeInvitation(ctx, hashToken(rawToken))
+	if err != nil {
+		return errorhandler.NotFound(errorhandler.ErrInvitationNotFound)
+	}
+
+	s.Logger.Infof("The invitation %v was declined", inv.Id)
+	return nil
+}
+
+// actorAndTarget returns the membership of who is acting and of the user
+// they act on, the actor has to be a member.
+func (s *memberService) actorAndTarget(ctx context.Context, actorId, userId int64) (*domain.Member, *domain.Member, error) {
+	actor, err := s.repo.FindMember(ctx, actorId)
+	if err != nil {
+		return nil, nil, errorhandler.Forbidden(errorhandler.ErrMemberNotFound)
+	}
+
+	target, err := s.repo.FindMember(ctx, userId)
+	if err != nil {
+		return nil, nil, errorhandler.NotFound(errorhandler.ErrMemberNotFound)
+	}
+	return actor, target, nil
+}
+
+// checkManages checks the actor can change the target to the role, an
+// empty role is removing it. The admins can't touch the owners.
+func (s *memberService) checkManages(ctx context.Context, actor, target *domain.Member, role string) error {
+	if !member.HasRole(actor.Role, member.RoleAdmin) {
+		return errorhandler.Forbidden(errorhandler.ErrInsufficientRole)
+	}
+
+	if !member.HasRole(actor.Role, target.Role) || (role != "" && !member.HasRole(actor.Role, role)) {
+		return errorhandler.Forbidden(errorhandler.ErrInsufficientRole)
+	}
+	return s.checkKeepsOwner(ctx, target, role)
+}
+
+// checkKeepsOwner refuses to leave the organization without owners.
+func (s *memberService) checkKeepsOwner(ctx context.Context, target *domain.Member, role string) error {
+	if target.Role != member.RoleOwner || role == member.RoleOwner {
+		return nil
+	}
+
+	owners, err := s.repo.CountOwners(ctx)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return err
+	}
+	if owners <= 1 {
+		return errorhandler.Conflict(errorhandler.ErrLastOwner)
+	}
+	return nil
+}
+
+// revokeTokens revokes the sessions and deletes the personal access tokens
+// the user has in the organization of the context.
+func (s *memberService) revokeTokens(ctx context.Context, username string) error {
+	if _, err := s.sessionRepository.RevokeUserSessions(ctx, username); err != nil {
+		return err
+	}
+
+	pats, err := s.patRepository.FindPersonalAccessTokensByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	for _, pat := range pats {
+		if err := s.patRepository.DeletePersonalAccessToken(ctx, pat.Id, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memberService) invitationMail(ctx context.Context, inv *domain.Invitation, rawToken string) *member.Mail {
+	orgName := tenant.DefaultSlug
+	if org, ok := tenant.FromContext(ctx); ok {
+		orgName = org.Name
+	}
+
+	separator := "?"
+	if strings.Contains(s.invitationUrl, "?") {
+		separator = "&"
+	}
+	link := s.invitationUrl + separator + "token=" + url.QueryEscape(rawToken)
+	return &member.Mail{
+		To:      inv.Email,
+		Subject: "You were invited to " + orgName,
+		Body: inv.InvitedBy + " invited you to join " + orgName + " as " + inv.Role + ".\n\n" +
+			"Accept or decline the invitation at " + link + "\n\n" +
+			"It expires on " + inv.ExpiresAt.Format(time.RFC1123) + ".\n",
+	}
+}
+
+func invitationResponse(inv *domain.Invitation) domain.InvitationResponse {
+	return domain.InvitationResponse{
+		Id:        inv.Id,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		InvitedBy: inv.InvitedBy,
+		CreatedAt: inv.CreatedAt,
+		ExpiresAt: inv.ExpiresAt,
+	}
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
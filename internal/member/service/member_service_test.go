@@ -0,0 +1,455 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/member/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ownerIdMock  int64 = 1
+	adminIdMock  int64 = 2
+	memberIdMock int64 = 3
+	carolIdMock  int64 = 4
+)
+
+type memberRepoMock struct {
+	members     []*domain.Member
+	invitations []*domain.Invitation
+}
+
+func (mock *memberRepoMock) FindMembers(ctx context.Context, cursor int64, size int) ([]domain.Member, int64, error) {
+	members := []domain.Member{}
+	for _, m := range mock.members {
+		if m.UserId >= cursor && len(members) < size {
+			members = append(members, *m)
+		}
+	}
+
+	var nextCursor int64
+	if len(members) == size {
+		nextCursor = members[len(members)-1].UserId
+		members = members[:len(members)-1]
+	}
+	return members, nextCursor, nil
+}
+
+func (mock *memberRepoMock) FindMember(ctx context.Context, userId int64) (*domain.Member, error) {
+	for _, m := range mock.members {
+		if m.UserId == userId {
+			copied := *m
+			return &copied, nil
+		}
+	}
+	return nil, errorhandler.ErrMemberNotFound
+}
+
+func (mock *memberRepoMock) CountOwners(ctx context.Context) (int, error) {
+	owners := 0
+	for _, m := range mock.members {
+		if m.Role == member.RoleOwner {
+			owners++
+		}
+	}
+	return owners, nil
+}
+
+func (mock *memberRepoMock) AddMember(ctx context.Context, m *domain.Member) error {
+	if _, err := mock.FindMember(ctx, m.UserId); err == nil {
+		return errorhandler.ErrAlreadyAMember
+	}
+	copied := *m
+	mock.members = append(mock.members, &copied)
+	slices.SortFunc(mock.members, func(a, b *domain.Member) int { return int(a.UserId - b.UserId) })
+	return nil
+}
+
+func (mock *memberRepoMock) UpdateMemberRole(ctx context.Context, userId int64, role string) error {
+	for _, m := range mock.members {
+		if m.UserId == userId {
+			m.Role = role
+			return nil
+		}
+	}
+	return errorhandler.ErrMemberNotFound
+}
+
+func (mock *memberRepoMock) RemoveMember(ctx context.Context, userId int64) error {
+	mock.members = slices.DeleteFunc(mock.members, func(m *domain.Member) bool { return m.UserId == userId })
+	return nil
+}
+
+func (mock *memberRepoMock) CreateInvitation(ctx context.Context, inv *domain.Invitation) error {
+	inv.OrgId = tenant.IdFrom(ctx)
+	copied := *inv
+	mock.invitations = append(mock.invitations, &copied)
+	return nil
+}
+
+func (mock *memberRepoMock) FindInvitations(ctx context.Context) ([]domain.Invitation, error) {
+	invitations := []domain.Invitation{}
+	for _, inv := range mock.invitations {
+		invitations = append(invitations, *inv)
+	}
+	return invitations, nil
+}
+
+func (mock *memberRepoMock) FindInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	for _, inv := range mock.invitations {
+		if inv.TokenHash == tokenHash {
+			copied := *inv
+			return &copied, nil
+		}
+	}
+	return nil, errorhandler.ErrInvitationNotFound
+}
+
+func (mock *memberRepoMock) ConsumeInvitation(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	inv, err := mock.FindInvitation(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	mock.invitations = slices.DeleteFunc(mock.invitations, func(stored *domain.Invitation) bool { return stored.TokenHash == tokenHash })
+	return inv, nil
+}
+
+func (mock *memberRepoMock) DeleteInvitation(ctx context.Context, id string) error {
+	count := len(mock.invitations)
+	mock.invitations = slices.DeleteFunc(mock.invitations, func(inv *domain.Invitation) bool { return inv.Id == id })
+	if len(mock.invitations) == count {
+		return errorhandler.ErrInvitationNotFound
+	}
+	return nil
+}
+
+// userRepoMock only finds the users by id, the rest is left to the embedded
+// interface.
+type userRepoMock struct {
+	user.Repository
+	users []domain.User
+}
+
+func (mock *userRepoMock) FindUserById(ctx context.Context, id int64) (*domain.User, error) {
+	for _, u := range mock.users {
+		if *u.Id == id {
+			return &u, nil
+		}
+	}
+	return nil, errorhandler.ErrUserNotFound
+}
+
+type sessionRepoMock struct {
+	auth.Repository
+	revoked []string
+}
+
+func (mock *sessionRepoMock) RevokeUserSessions(ctx context.Context, username string) (int64, error) {
+	mock.revoked = append(mock.revoked, username)
+	return 1, nil
+}
+
+type patRepoMock struct {
+	auth.PersonalAccessTokenRepository
+	pats []domain.PersonalAccessToken
+}
+
+func (mock *patRepoMock) FindPersonalAccessTokensByUsername(ctx context.Context, username string) ([]domain.PersonalAccessToken, error) {
+	pats := []domain.PersonalAccessToken{}
+	for _, pat := range mock.pats {
+		if pat.Username == username {
+			pats = append(pats, pat)
+		}
+	}
+	return pats, nil
+}
+
+func (mock *patRepoMock) DeletePersonalAccessToken(ctx context.Context, id, username string) error {
+	mock.pats = slices.DeleteFunc(mock.pats, func(pat domain.PersonalAccessToken) bool { return pat.Id == id && pat.Username == username })
+	return nil
+}
+
+type mailerMock struct {
+	sent []*member.Mail
+}
+
+func (mock *mailerMock) Send(ctx context.Context, mail *member.Mail) error {
+	mock.sent = append(mock.sent, mail)
+	return nil
+}
+
+type recorderMock struct {
+	events []*audit.Event
+}
+
+func (mock *recorderMock) Record(ctx context.Context, event *audit.Event) {
+	mock.events = append(mock.events, event)
+}
+
+type mocks struct {
+	members  *memberRepoMock
+	sessions *sessionRepoMock
+	pats     *patRepoMock
+	mailer   *mailerMock
+	recorder *recorderMock
+}
+
+func ptrString(s string) *string { return &s }
+
+func ptrInt64(i int64) *int64 { return &i }
+
+// prepareMocks returns the service of an organization with an owner, an
+// admin and a member, carol is a user that isn't a member yet.
+func prepareMocks() (member.Service, *mocks) {
+	m := &mocks{
+		members: &memberRepoMock{members: []*domain.Member{
+			{UserId: ownerIdMock, Username: "olivia", Role: member.RoleOwner},
+			{UserId: adminIdMock, Username: "adam", Role: member.RoleAdmin},
+			{UserId: memberIdMock, Username: "mike", Role: member.RoleMember},
+		}},
+		sessions: &sessionRepoMock{},
+		pats: &patRepoMock{pats: []domain.PersonalAccessToken{
+			{Id: "adam-ci", Username: "adam"},
+			{Id: "mike-ci", Username: "mike"},
+		}},
+		mailer:   &mailerMock{},
+		recorder: &recorderMock{},
+	}
+	userRepo := &userRepoMock{users: []domain.User{
+		{Id: ptrInt64(ownerIdMock), Username: ptrString("olivia"), Email: ptrString("olivia@example.com")},
+		{Id: ptrInt64(carolIdMock), Username: ptrString("carol"), Email: ptrString("Carol@Example.com")},
+		{Id: ptrInt64(5), Username: ptrString("dave"), Email: ptrString("dave@example.com")},
+	}}
+	config := &configs.Configuration{InvitationUrl: "https://app.example.com/invitations"}
+	return NewMemberService(m.members, userRepo, m.sessions, m.pats, m.mailer, m.recorder, logrus.New(), config), m
+}
+
+var invitationTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// invitationToken is the token of the link of the last email sent.
+func invitationToken(t *testing.T, mailer *mailerMock) string {
+	if len(mailer.sent) == 0 {
+		t.Fatal("expected the invitation to be emailed")
+	}
+
+	match := invitationTokenPattern.FindStringSubmatch(mailer.sent[len(mailer.sent)-1].Body)
+	if match == nil {
+		t.Fatal("expected the email to have the link of the invitation")
+	}
+	rawToken, _ := url.QueryUnescape(match[1])
+	return rawToken
+}
+
+// TestInvitation verifies the invitations are emailed, can only be accepted
+// once by the user they were sent to and are gone once declined.
+func TestInvitation(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, m := prepareMocks()
+
+	_, memberErr := service.Invite(ctx, memberIdMock, &domain.InvitationRequest{Email: "carol@example.com"})
+	_, adminErr := service.Invite(ctx, adminIdMock, &domain.InvitationRequest{Email: "carol@example.com", Role: member.RoleOwner})
+	invitation, err := service.Invite(ctx, adminIdMock, &domain.InvitationRequest{Email: "carol@example.com", Role: member.RoleAdmin})
+	if err != nil {
+		t.Fatalf("unexpected error inviting: %v", err)
+	}
+	rawToken := invitationToken(t, m.mailer)
+
+	// when
+	_, otherOrgErr := service.AcceptInvitation(tenant.WithOrganization(ctx, &domain.Organization{Id: 2, Slug: "acme"}), carolIdMock, rawToken)
+	_, mismatchErr := service.AcceptInvitation(ctx, 5, rawToken)
+	carol, acceptErr := service.AcceptInvitation(ctx, carolIdMock, rawToken)
+	_, againErr := service.AcceptInvitation(ctx, carolIdMock, rawToken)
+
+	// then
+	if errorhandler.KindOf(memberErr) != errorhandler.KindForbidden || errorhandler.KindOf(adminErr) != errorhandler.KindForbidden {
+		t.Fatalf("expected only the owners and admins to invite and only the owners to invite owners, got %v and %v", memberErr, adminErr)
+	}
+
+	if len(m.mailer.sent) != 1 || m.mailer.sent[0].To != "carol@example.com" || !strings.Contains(m.mailer.sent[0].Body, "https://app.example.com/invitations?token=") {
+		t.Fatalf("expected one invitation emailed to carol with the link, got %+v", m.mailer.sent)
+	}
+
+	if invitation.InvitedBy != "adam" || invitation.ExpiresAt.Before(time.Now().Add(member.InvitationDuration-time.Minute)) {
+		t.Fatalf("unexpected invitation %+v", invitation)
+	}
+
+	if !errors.Is(otherOrgErr, errorhandler.ErrInvitationNotFound) {
+		t.Fatalf("expected the invitation to be of its organization only, got %v", otherOrgErr)
+	}
+
+	if !errors.Is(mismatchErr, errorhandler.ErrInvitationEmailMismatch) {
+		t.Fatalf("expected the invitation to be for its email only, got %v", mismatchErr)
+	}
+
+	if acceptErr != nil || carol.Role != member.RoleAdmin {
+		t.Fatalf("expected carol to join as admin, got %+v: %v", carol, acceptErr)
+	}
+
+	if !errors.Is(againErr, errorhandler.ErrInvitationNotFound) {
+		t.Fatalf("expected the invitation to be single-use, got %v", againErr)
+	}
+
+	// when
+	service.Invite(ctx, ownerIdMock, &domain.InvitationRequest{Email: "dave@example.com"})
+	declined := invitationToken(t, m.mailer)
+	declineErr := service.DeclineInvitation(ctx, declined)
+	_, afterDeclineErr := service.AcceptInvitation(ctx, 5, declined)
+
+	// then
+	if declineErr != nil || !errors.Is(afterDeclineErr, errorhandler.ErrInvitationNotFound) {
+		t.Fatalf("expected the declined invitation to be gone, got %v and %v", declineErr, afterDeclineErr)
+	}
+
+	// when
+	revoked, _ := service.Invite(ctx, ownerIdMock, &domain.InvitationRequest{Email: "erin@example.com"})
+	revokeErr := service.RevokeInvitation(ctx, revoked.Id)
+	revokeAgainErr := service.RevokeInvitation(ctx, revoked.Id)
+
+	// then
+	if revokeErr != nil || errorhandler.KindOf(revokeAgainErr) != errorhandler.KindNotFound {
+		t.Fatalf("expected the revoked invitation to be gone, got %v and %v", revokeErr, revokeAgainErr)
+	}
+
+	outcomes := []string{}
+	for _, event := range m.recorder.events {
+		outcomes = append(outcomes, strings.TrimSpace(event.Action+" "+event.Target+" "+event.Outcome))
+	}
+	want := []string{
+		"invitation.create carol@example.com failure",
+		"invitation.create carol@example.com failure",
+		"invitation.create carol@example.com",
+		"invitation.accept " + invitation.Id,
+		"invitation.create dave@example.com",
+		"invitation.create erin@example.com",
+		"invitation.revoke " + revoked.Id,
+		"invitation.revoke " + revoked.Id + " failure",
+	}
+	if !slices.Equal(outcomes, want) {
+		t.Fatalf("expected the audit events %v, got %v", want, outcomes)
+	}
+}
+
+// TestRemoveMember verifies the removed members lose their sessions and
+// personal access tokens and the organization keeps an owner.
+func TestRemoveMember(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, m := prepareMocks()
+
+	// when
+	ownerErr := service.RemoveMember(ctx, adminIdMock, ownerIdMock)
+	lastOwnerErr := service.RemoveMember(ctx, ownerIdMock, ownerIdMock)
+	_, demoteErr := service.ChangeRole(ctx, ownerIdMock, ownerIdMock, member.RoleAdmin)
+	removeErr := service.RemoveMember(ctx, ownerIdMock, adminIdMock)
+	leaveErr := service.RemoveMember(ctx, memberIdMock, memberIdMock)
+
+	// then
+	if errorhandler.KindOf(ownerErr) != errorhandler.KindForbidden {
+		t.Fatalf("expected the admins not to remove the owners, got %v", ownerErr)
+	}
+
+	if !errors.Is(lastOwnerErr, errorhandler.ErrLastOwner) || !errors.Is(demoteErr, errorhandler.ErrLastOwner) {
+		t.Fatalf("expected the last owner to stay, got %v and %v", lastOwnerErr, demoteErr)
+	}
+
+	if removeErr != nil || leaveErr != nil {
+		t.Fatalf("unexpected errors removing the members: %v, %v", removeErr, leaveErr)
+	}
+
+	if !slices.Equal(m.sessions.revoked, []string{"adam", "mike"}) {
+		t.Fatalf("expected the sessions of the removed members revoked, got %v", m.sessions.revoked)
+	}
+
+	if len(m.pats.pats) != 0 {
+		t.Fatalf("expected the personal access tokens of the removed members deleted, got %+v", m.pats.pats)
+	}
+
+	if page, _ := service.ListMembers(ctx, 0, 25); len(page.Data) != 1 || page.Data[0].Username != "olivia" {
+		t.Fatalf("expected only the owner left, got %+v", page.Data)
+	}
+
+	outcomes := []string{}
+	for _, event := range m.recorder.events {
+		// the recorder completes the outcome of the successful ones
+		outcomes = append(outcomes, strings.TrimSpace(event.Action+" "+event.Outcome))
+	}
+	want := []string{
+		"member.remove failure",
+		"member.remove failure",
+		"member.role failure",
+		"member.remove",
+		"member.remove",
+	}
+	if !slices.Equal(outcomes, want) {
+		t.Fatalf("expected the audit events %v, got %v", want, outcomes)
+	}
+}
+
+// TestOrgRole verifies the routes of the members check the role the user
+// has in the organization on every request.
+func TestOrgRole(t *testing.T) {
+	// given
+	service, m := prepareMocks()
+	controller := server.NewMemberController(&service)
+	mw := &middleware.Middleware{Members: m.members}
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		server.MapMemberRoutes(&r, &controller, mw)
+	})
+
+	tests := []struct {
+		name   string
+		userId int64
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"member lists the members", memberIdMock, http.MethodGet, "/api/v1/members?size=2", "", http.StatusOK},
+		{"member can't invite", memberIdMock, http.MethodPost, "/api/v1/invitations", `{"email":"x@example.com"}`, http.StatusForbidden},
+		{"admin invites", adminIdMock, http.MethodPost, "/api/v1/invitations", `{"email":"x@example.com"}`, http.StatusCreated},
+		{"admin can't promote to owner", adminIdMock, http.MethodPatch, "/api/v1/members/3", `{"role":"owner"}`, http.StatusForbidden},
+		{"owner promotes to admin", ownerIdMock, http.MethodPatch, "/api/v1/members/3", `{"role":"admin"}`, http.StatusOK},
+		{"not a member", carolIdMock, http.MethodGet, "/api/v1/members", "", http.StatusForbidden},
+		{"removed member", adminIdMock, http.MethodDelete, "/api/v1/members/2", "", http.StatusNoContent},
+		{"removed member loses the access", adminIdMock, http.MethodGet, "/api/v1/members", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.TokenContextKey, &token.UserClaims{Id: tt.userId}))
+
+			// when
+			r.ServeHTTP(w, req)
+
+			// then
+			if w.Result().StatusCode != tt.want {
+				t.Fatalf("expected %d, got %d: %v", tt.want, w.Result().StatusCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+)
+
+// AuditClient keeps the audit.Client of the request in the context, so the
+// events recorded while serving it carry its ip and user agent. The ip is
+// the one of the connection, X-Forwarded-For isn't trusted since anybody
+// can send it.
+func (m *Middleware) AuditClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := &audit.Client{Ip: hostOf(r.RemoteAddr), UserAgent: r.UserAgent()}
+		next.ServeHTTP(w, r.WithContext(audit.WithClient(r.Context(), client)))
+	})
+}
+
+// AuditEvent is the audit event of the action on the target by the user of
+// the claims of the context, the admin when it's impersonating.
+func AuditEvent(ctx context.Context, action, target string) *audit.Event {
+	event := &audit.Event{Action: action, Target: target}
+	if userClaims, ok := UserClaimsFromContext(ctx); ok {
+		event.Actor = userClaims.Username
+		event.ClientId = userClaims.ClientId
+		if userClaims.Act != nil {
+			event.Actor = userClaims.Act.Subject
+			event.Subject = userClaims.Username
+		}
+	}
+	return event
+}
+
+// hostOf is the host of the address, or the address when it has no port.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/sessions"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// Authentication methods, also the names used to enable them in AUTH_MODES.
+const (
+	AuthMethodCookie              = "cookie"
+	AuthMethodJwt                 = "jwt"
+	AuthMethodPersonalAccessToken = "pat"
+	AuthMethodOAuthSession        = "oauth"
+)
+
+const AuthMethodContextKey = contextKey("auth_method")
+
+// Authenticator checks one kind of credential. Authenticate returns
+// ErrNoCredentials when the request doesn't carry its kind of credential, so
+// the next one is tried, any other error rejects the request.
+type Authenticator interface {
+	Method() string
+	Authenticate(r *http.Request) (*token.UserClaims, error)
+}
+
+// challengeError is a rejected credential with the WWW-Authenticate
+// challenge the client should get.
+type challengeError struct {
+	challenge string
+	err       error
+}
+
+func (e *challengeError) Error() string { return e.err.Error() }
+
+func (e *challengeError) Unwrap() error { return e.err }
+
+// Authenticate tries the authenticators in order and serves the request with
+// the claims of the first one that recognizes the credentials, the method
+// that succeeded is kept in the context (AuthMethodFromContext). The modes
+// the organization of the request doesn't allow are skipped.
+func (m *Middleware) Authenticate(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, authenticator := range authenticators {
+				if !tenant.AllowsMode(r.Context(), authenticator.Method()) {
+					continue
+				}
+
+				userClaims, err := authenticator.Authenticate(r)
+				if errors.Is(err, errorhandler.ErrNoCredentials) {
+					continue
+				}
+
+				if err != nil {
+					var challenge *challengeError
+					if errors.As(err, &challenge) {
+						w.Header().Set("WWW-Authenticate", challenge.challenge)
+					}
+					errorhandler.UnauthroizedErrorHandler(w, err)
+					return
+				}
+
+				if strings.Contains(r.URL.Path, "users") && checkMethods(r) && !isOwner(w, r, userClaims) {
+					return
+				}
+
+				r = r.WithContext(context.WithValue(r.Context(), AuthMethodContextKey, authenticator.Method()))
+				m.serveWithClaims(next, w, r, userClaims)
+				return
+			}
+
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrNoCredentials)
+		})
+	}
+}
+
+// AuthMethodFromContext returns which authenticator accepted the request,
+// it's only available behind Authenticate.
+func AuthMethodFromContext(ctx context.Context) (string, bool) {
+	method, ok := ctx.Value(AuthMethodContextKey).(string)
+	return method, ok
+}
+
+type cookieAuthenticator struct {
+	m *Middleware
+}
+
+// CookieAuthenticator accepts the session_token cookie of the cookie based
+// login, unsafe methods need the X-CSRF-Token header matching the
+// csrf_token cookie.
+func (m *Middleware) CookieAuthenticator() Authenticator {
+	return &cookieAuthenticator{m: m}
+}
+
+func (a *cookieAuthenticator) Method() string { return AuthMethodCookie }
+
+func (a *cookieAuthenticator) Authenticate(r *http.Request) (*token.UserClaims, error) {
+	sessionToken, err := r.Cookie("session_token")
+	if err != nil || sessionToken.Value == "" {
+		return nil, errorhandler.ErrNoCredentials
+	}
+
+	username, ok := a.m.Cache.UserCache.Get(tenant.Key(r.Context(), sessionToken.Value))
+	if !ok {
+		return nil, errorhandler.ErrInvalidToken
+	}
+
+	var csrfToken string
+	if cookie, err := r.Cookie("csrf_token"); err == nil {
+		csrfToken = cookie.Value
+	}
+	if !validCSRF(r, csrfToken) {
+		return nil, errorhandler.ErrInvalidCSRFToken
+	}
+
+	user, err := a.m.UserRepository.FindUserByUsername(r.Context(), username)
+	if err != nil {
+		return nil, errorhandler.ErrInvalidToken
+	}
+
+	return &token.UserClaims{
+		Username:         *user.Username,
+		Id:               *user.Id,
+		TenantId:         tenant.IdFrom(r.Context()),
+		RegisteredClaims: jwt.RegisteredClaims{Subject: *user.Username},
+	}, nil
+}
+
+type bearerAuthenticator struct {
+	m *Middleware
+}
+
+// BearerAuthenticator accepts the access tokens of the jwt modes, with the
+// Bearer or the DPoP scheme, and checks their proof of possession and the
+// denylist.
+func (m *Middleware) BearerAuthenticator() Authenticator {
+	return &bearerAuthenticator{m: m}
+}
+
+func (a *bearerAuthenticator) Method() string { return AuthMethodJwt }
+
+func (a *bearerAuthenticator) Authenticate(r *http.Request) (*token.UserClaims, error) {
+	dirtToken := r.Header.Get("Authorization")
+	rawToken := cleanToken(dirtToken)
+	if !hasTokenPrefix(dirtToken) || token.IsPersonalAccessToken(rawToken) {
+		return nil, errorhandler.ErrNoCredentials
+	}
+
+	userClaims, err := a.m.JwtBuilder.VerifyToken(rawToken)
+	if err != nil {
+		return nil, &challengeError{challenge: `Bearer error="invalid_token"`, err: err}
+	}
+
+	if challenge, err := checkProof(r, a.m, dirtToken, rawToken, userClaims); err != nil {
+		return nil, &challengeError{challenge: challenge, err: err}
+	}
+
+	if denied, ok := a.m.Cache.TokenCache.Get(rawToken); ok && denied {
+		return nil, &challengeError{challenge: `Bearer error="invalid_token"`, err: errorhandler.ErrInvalidToken}
+	}
+
+	return userClaims, nil
+}
+
+type personalAccessTokenAuthenticator struct {
+	repository auth.PersonalAccessTokenRepository
+}
+
+// PersonalAccessTokenAuthenticator accepts the personal access tokens sent
+// with the Bearer scheme, they are told apart from the jwt by their prefix.
+func (m *Middleware) PersonalAccessTokenAuthenticator(repository auth.PersonalAccessTokenRepository) Authenticator {
+	return &personalAccessTokenAuthenticator{repository: repository}
+}
+
+func (a *personalAccessTokenAuthenticator) Method() string { return AuthMethodPersonalAccessToken }
+
+func (a *personalAccessTokenAuthenticator) Authenticate(r *http.Request) (*token.UserClaims, error) {
+	dirtToken := r.Header.Get("Authorization")
+	rawToken := strings.TrimPrefix(dirtToken, Token_Prefix)
+	if !strings.HasPrefix(dirtToken, Token_Prefix) || !token.IsPersonalAccessToken(rawToken) {
+		return nil, errorhandler.ErrNoCredentials
+	}
+
+	pat, err := a.repository.FindPersonalAccessToken(r.Context(), token.HashPersonalAccessToken(rawToken))
+	if err != nil {
+		return nil, &challengeError{challenge: `Bearer error="invalid_token"`, err: errorhandler.ErrInvalidToken}
+	}
+
+	if pat.ExpiresAt != nil && pat.ExpiresAt.Before(time.Now()) {
+		return nil, &challengeError{challenge: `Bearer error="invalid_token"`, err: errorhandler.ErrInvalidExpiredToken}
+	}
+
+	// not knowing when it was last used doesn't make the token invalid
+	a.repository.TouchPersonalAccessToken(r.Context(), pat.Id)
+
+	userClaims := &token.UserClaims{
+		Username: pat.Username,
+		Id:       pat.UserId,
+		TenantId: pat.OrgId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      pat.Id,
+			Subject: pat.Username,
+		},
+	}
+	if pat.ExpiresAt != nil {
+		userClaims.ExpiresAt = jwt.NewNumericDate(*pat.ExpiresAt)
+	}
+
+	return userClaims, nil
+}
+
+type oauthSessionAuthenticator struct {
+	store *sessions.CookieStore
+}
+
+// OAuthSessionAuthenticator accepts the browser session started by the
+// login page of the authorization server, unsafe methods need the
+// X-CSRF-Token header with the csrf token of the session.
+func (m *Middleware) OAuthSessionAuthenticator(store *sessions.CookieStore) Authenticator {
+	return &oauthSessionAuthenticator{store: store}
+}
+
+func (a *oauthSessionAuthenticator) Method() string { return AuthMethodOAuthSession }
+
+func (a *oauthSessionAuthenticator) Authenticate(r *http.Request) (*token.UserClaims, error) {
+	if _, err := r.Cookie(auth.BrowserSessionName); err != nil {
+		return nil, errorhandler.ErrNoCredentials
+	}
+
+	session, err := a.store.Get(r, auth.BrowserSessionName)
+	if err != nil || session.IsNew {
+		return nil, errorhandler.ErrInvalidSession
+	}
+
+	userId, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return nil, errorhandler.ErrInvalidSession
+	}
+	username, _ := session.Values["username"].(string)
+	authTime, _ := session.Values["auth_time"].(int64)
+	csrfToken, _ := session.Values["csrf_token"].(string)
+	tenantId, _ := session.Values["tenant_id"].(int64)
+
+	if !validCSRF(r, csrfToken) {
+		return nil, errorhandler.ErrInvalidCSRFToken
+	}
+
+	return &token.UserClaims{
+		Username: username,
+		Id:       userId,
+		TenantId: tenantId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(time.Unix(authTime, 0)),
+			ExpiresAt: jwt.NewNumericDate(time.Unix(authTime, 0).Add(auth.BrowserSessionMaxAge * time.Second)),
+		},
+	}, nil
+}
+
+// validCSRF checks the X-CSRF-Token header of the requests that change
+// something, the ones made by the browser carry the cookies by themselves.
+func validCSRF(r *http.Request, csrfToken string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	header := r.Header.Get("X-CSRF-Token")
+	return csrfToken != "" && subtle.ConstantTimeCompare([]byte(header), []byte(csrfToken)) == 1
+}
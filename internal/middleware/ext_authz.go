@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+type extAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+	m              *Middleware
+	authenticators []Authenticator
+}
+
+// ExtAuthzServer is the Envoy external authorization (ext_authz) of the
+// mesh. Check rebuilds the http request Envoy is about to route and runs
+// the authenticators on it, like Authenticate does, the allowed requests
+// go upstream with the X-Auth-* headers and the denied ones are answered
+// by Envoy with a 401 and the reason.
+func (m *Middleware) ExtAuthzServer(authenticators ...Authenticator) authv3.AuthorizationServer {
+	return &extAuthzServer{m: m, authenticators: authenticators}
+}
+
+func (s *extAuthzServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	r, err := checkedRequest(ctx, req.GetAttributes())
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	// the organization is named like in the requests to the api
+	if r, err = s.m.requestTenant(r); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	user, err := s.m.authenticateUser(r, s.authenticators)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	headers := make([]*corev3.HeaderValueOption, 0, 3)
+	for name, value := range identityHeaders(user) {
+		headers = append(headers, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: name, Value: value},
+			// the X-Auth-* headers sent by the client are replaced
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{Headers: headers},
+		},
+	}, nil
+}
+
+// deniedResponse carries the reason in the gRPC status and in the body of
+// the 401, which is the same of the errors of the http api.
+func deniedResponse(err error) *authv3.CheckResponse {
+	// no error code when there were no credentials at all (RFC 6750)
+	challenge := "Bearer"
+	var challengeErr *challengeError
+	if errors.As(err, &challengeErr) {
+		challenge = challengeErr.challenge
+	} else if !errors.Is(err, errorhandler.ErrNoCredentials) {
+		challenge = `Bearer error="invalid_token"`
+	}
+
+	headers := []*corev3.HeaderValueOption{
+		{Header: &corev3.HeaderValue{Key: "Content-Type", Value: "application/json"}},
+		{Header: &corev3.HeaderValue{Key: "WWW-Authenticate", Value: challenge}},
+	}
+
+	body, _ := json.Marshal(errorhandler.Error{
+		Status:    http.StatusUnauthorized,
+		Message:   err.Error(),
+		Timestamp: time.Now().Format(errorhandler.BrazilianDateTimeFormat),
+	})
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.Unauthenticated), Message: err.Error()},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+				Headers: headers,
+				Body:    string(body),
+			},
+		},
+	}
+}
+
+// checkedRequest is the http request of the attributes, with the client
+// certificate Envoy verified for the certificate bound tokens.
+func checkedRequest(ctx context.Context, attributes *authv3.AttributeContext) (*http.Request, error) {
+	httpRequest := attributes.GetRequest().GetHttp()
+	if httpRequest == nil {
+		return nil, errorhandler.ErrInvalidCheckRequest
+	}
+
+	requestUrl, err := url.ParseRequestURI(httpRequest.GetPath())
+	if err != nil {
+		return nil, errorhandler.ErrInvalidCheckRequest
+	}
+
+	r := (&http.Request{
+		Method:     httpRequest.GetMethod(),
+		URL:        requestUrl,
+		Host:       httpRequest.GetHost(),
+		Header:     http.Header{},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		RequestURI: httpRequest.GetPath(),
+	}).WithContext(ctx)
+
+	for name, value := range httpRequest.GetHeaders() {
+		// the pseudo headers (:authority, :path...) are already in the request
+		if !strings.HasPrefix(name, ":") {
+			r.Header.Set(name, value)
+		}
+	}
+	for _, header := range httpRequest.GetHeaderMap().GetHeaders() {
+		if !strings.HasPrefix(header.GetKey(), ":") {
+			r.Header.Add(header.GetKey(), string(header.GetRawValue()))
+		}
+	}
+
+	if cert := peerCertificate(attributes.GetSource()); cert != nil {
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	return r, nil
+}
+
+// peerCertificate is the url encoded PEM certificate of the source, Envoy
+// only sends it when the listener verifies the client certificates.
+func peerCertificate(source *authv3.AttributeContext_Peer) *x509.Certificate {
+	encoded, err := url.QueryUnescape(source.GetCertificate())
+	if err != nil || encoded == "" {
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+// The headers with the identity of the user answered by ForwardAuth and
+// ExtAuthzServer, the proxy copies them to the request of the protected app.
+const (
+	AuthUserHeader  = "X-Auth-User"
+	AuthIdHeader    = "X-Auth-Id"
+	AuthRolesHeader = "X-Auth-Roles"
+)
+
+// The headers with the original request, sent by Traefik and set in the
+// nginx configuration (see the README).
+const (
+	ForwardedMethodHeader = "X-Forwarded-Method"
+	ForwardedProtoHeader  = "X-Forwarded-Proto"
+	ForwardedHostHeader   = "X-Forwarded-Host"
+	ForwardedUriHeader    = "X-Forwarded-Uri"
+	OriginalUrlHeader     = "X-Original-URL"
+)
+
+// RedirectParam is the query parameter of the login url with the url the
+// browser was trying to open.
+const RedirectParam = "rd"
+
+// ForwardAuth is the GET /auth/verify of the reverse proxies (nginx
+// auth_request and Traefik ForwardAuth). The request carries the cookies
+// and headers of the original one, when the authenticators accept them it
+// answers 200 with the X-Auth-* headers, otherwise 401, or a redirect to
+// the ForwardAuthLoginUrl for the browsers when it's set. The DPoP proofs
+// are for the original request, its url is rebuilt from the X-Forwarded-*
+// headers.
+func (m *Middleware) ForwardAuth(authenticators ...Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the csrf token and the htm of the proofs are checked against the
+		// method of the original request
+		if method := r.Header.Get(ForwardedMethodHeader); method != "" {
+			r = r.Clone(r.Context())
+			r.Method = strings.ToUpper(method)
+		}
+		// and the htu against its url, a proof for /auth/verify is rejected
+		if original := originalUrl(r); original != "" {
+			r = r.WithContext(context.WithValue(r.Context(), ProofUrlContextKey, original))
+		}
+
+		r, err := m.requestTenant(r)
+		if err != nil {
+			m.forwardAuthDenied(w, r, err)
+			return
+		}
+
+		user, err := m.authenticateUser(r, authenticators)
+		if err != nil {
+			m.forwardAuthDenied(w, r, err)
+			return
+		}
+
+		for name, value := range identityHeaders(user) {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// authenticateUser runs the authenticators like Authenticate does and
+// returns the user of the accepted credentials, with the roles the tokens
+// don't carry. The user is looked up in the organization of the
+// credentials, the ones of another organization are rejected (see
+// withTokenTenant).
+func (m *Middleware) authenticateUser(r *http.Request, authenticators []Authenticator) (*domain.User, error) {
+	for _, authenticator := range authenticators {
+		if !tenant.AllowsMode(r.Context(), authenticator.Method()) {
+			continue
+		}
+
+		userClaims, err := authenticator.Authenticate(r)
+		if errors.Is(err, errorhandler.ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := context.WithValue(r.Context(), AuthMethodContextKey, authenticator.Method())
+		ctx, err = m.withTokenTenant(ctx, userClaims)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := m.UserRepository.FindUserByUsername(ctx, userClaims.Username)
+		if err != nil || user.Locked || *user.Id != userClaims.Id {
+			return nil, errorhandler.ErrInvalidToken
+		}
+		return user, nil
+	}
+
+	return nil, errorhandler.ErrNoCredentials
+}
+
+// identityHeaders are the X-Auth-* headers of the user.
+func identityHeaders(user *domain.User) map[string]string {
+	return map[string]string{
+		AuthUserHeader:  *user.Username,
+		AuthIdHeader:    strconv.FormatInt(*user.Id, 10),
+		AuthRolesHeader: strings.Join(user.Roles, ","),
+	}
+}
+
+func (m *Middleware) forwardAuthDenied(w http.ResponseWriter, r *http.Request, err error) {
+	if m.ForwardAuthLoginUrl != "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, loginUrl(m.ForwardAuthLoginUrl, originalUrl(r)), http.StatusFound)
+		return
+	}
+
+	var challenge *challengeError
+	if errors.As(err, &challenge) {
+		w.Header().Set("WWW-Authenticate", challenge.challenge)
+	}
+	errorhandler.UnauthroizedErrorHandler(w, err)
+}
+
+// originalUrl is the url the browser was trying to open, empty when the
+// proxy doesn't send it.
+func originalUrl(r *http.Request) string {
+	if original := r.Header.Get(OriginalUrlHeader); original != "" {
+		return original
+	}
+
+	host := r.Header.Get(ForwardedHostHeader)
+	if host == "" {
+		return ""
+	}
+	scheme := r.Header.Get(ForwardedProtoHeader)
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + host + r.Header.Get(ForwardedUriHeader)
+}
+
+func loginUrl(login, redirect string) string {
+	if redirect == "" {
+		return login
+	}
+
+	loginUrl, err := url.Parse(login)
+	if err != nil {
+		return login
+	}
+	query := loginUrl.Query()
+	query.Set(RedirectParam, redirect)
+	loginUrl.RawQuery = query.Encode()
+	return loginUrl.String()
+}
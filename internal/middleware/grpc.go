@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	jwt "github.com/rafaeldepontes/fauthless-go/internal/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadata is the metadata with the token of the gRPC calls,
+// the same "Bearer <token>" of the Authorization header.
+const AuthorizationMetadata = "authorization"
+
+// GrpcMethod is the Method of the audit events of the gRPC calls, their
+// Path is the full method and their Status the gRPC code.
+const GrpcMethod = "GRPC"
+
+// UnaryInterceptor authenticates the gRPC calls like JwtRefreshBased does
+// with the http requests, the token is verified by the JwtBuilder and the
+// denylisted ones are rejected. The public methods, like the login, skip it.
+// The organization is the one named by the metadata of the Tenants header
+// or else the one of the token.
+func (m *Middleware) UnaryInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := m.callTenant(callClient(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.Contains(public, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, userClaims, err := m.authenticateCall(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(context.WithValue(ctx, TokenContextKey, userClaims), req)
+		m.recordImpersonatedCall(ctx, userClaims, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor is the UnaryInterceptor of the streams, the claims are
+// in the context of the stream.
+func (m *Middleware) StreamInterceptor(public ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := m.callTenant(callClient(ss.Context()))
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(public, info.FullMethod) {
+			return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+		}
+
+		ctx, userClaims, err := m.authenticateCall(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = handler(srv, &authenticatedStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ctx, TokenContextKey, userClaims),
+		})
+		m.recordImpersonatedCall(ctx, userClaims, info.FullMethod, err)
+		return err
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticateCall returns the claims of the bearer token of the call. There
+// is no DPoP proof in gRPC so the DPoP bound tokens are rejected, the
+// certificate bound ones need the same client certificate. The context is
+// of the organization of the token (see withTokenTenant).
+func (m *Middleware) authenticateCall(ctx context.Context) (context.Context, *jwt.UserClaims, error) {
+	values := metadata.ValueFromIncomingContext(ctx, AuthorizationMetadata)
+	if len(values) != 1 || !strings.HasPrefix(values[0], Token_Prefix) {
+		return nil, nil, status.Error(codes.Unauthenticated, errorhandler.ErrInvalidToken.Error())
+	}
+	token := strings.TrimPrefix(values[0], Token_Prefix)
+
+	userClaims, err := m.JwtBuilder.VerifyToken(token)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	// tokens revoked through /oauth/revoke are denylisted until they expire
+	if denied, ok := m.Cache.TokenCache.Get(token); ok && denied {
+		return nil, nil, status.Error(codes.Unauthenticated, errorhandler.ErrInvalidToken.Error())
+	}
+
+	if cnf := userClaims.Cnf; cnf != nil {
+		if cnf.JwkThumbprint != "" {
+			return nil, nil, status.Error(codes.Unauthenticated, errorhandler.ErrInvalidDPoPProof.Error())
+		}
+		if cnf.CertificateThumbprint != "" && peerCertificateThumbprint(ctx) != cnf.CertificateThumbprint {
+			return nil, nil, status.Error(codes.Unauthenticated, errorhandler.ErrInvalidClientCertificate.Error())
+		}
+	}
+
+	ctx, err = m.withTokenTenant(ctx, userClaims)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return ctx, userClaims, nil
+}
+
+// callClient is the context with the audit.Client of the call, the address
+// of the peer and the user agent of the metadata.
+func callClient(ctx context.Context) context.Context {
+	client := &audit.Client{}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.Ip = hostOf(p.Addr.String())
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		client.UserAgent = values[0]
+	}
+	return audit.WithClient(ctx, client)
+}
+
+// peerCertificateThumbprint is the PeerCertificateThumbprint of the gRPC
+// connections.
+func peerCertificateThumbprint(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return CertificateThumbprint(tlsInfo.State.VerifiedChains[0][0])
+}
+
+func (m *Middleware) recordImpersonatedCall(ctx context.Context, userClaims *jwt.UserClaims, fullMethod string, err error) {
+	if userClaims.Act == nil {
+		return
+	}
+
+	m.Audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionImpersonatedRequest,
+		Actor:    userClaims.Act.Subject,
+		Subject:  userClaims.Username,
+		ClientId: userClaims.ClientId,
+		Method:   GrpcMethod,
+		Path:     fullMethod,
+		Status:   int(status.Code(err)),
+	})
+}
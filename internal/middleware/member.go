@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+)
+
+// OrgRole lets through the members of the organization of the request that
+// have at least the role, it goes behind the authentication. The role is
+// read on every request, so a member removed or demoted loses the access
+// right away even with the tokens already issued.
+func (m *Middleware) OrgRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userClaims, ok := UserClaimsFromContext(r.Context())
+			if !ok {
+				errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+				return
+			}
+
+			if m.Members == nil {
+				errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrMemberNotFound)
+				return
+			}
+
+			found, err := m.Members.FindMember(r.Context(), userClaims.Id)
+			if err != nil {
+				errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrMemberNotFound)
+				return
+			}
+
+			if !member.HasRole(found.Role, role) {
+				errorhandler.ForbiddenErrorHandler(w, errorhandler.ErrInsufficientRole)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,19 +1,49 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
 	"github.com/rafaeldepontes/fauthless-go/internal/cache"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/member"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
 	jwt "github.com/rafaeldepontes/fauthless-go/internal/token"
+	"github.com/rafaeldepontes/fauthless-go/internal/tool"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
 )
 
 type Middleware struct {
-	JwtBuilder *jwt.JwtBuilder
-	UserCache  *cache.Cache[string, string]
-	Cache      *cache.Caches
+	JwtBuilder     *jwt.JwtBuilder
+	UserCache      *cache.Cache[string, string]
+	Cache          *cache.Caches
+	Audit          audit.Recorder
+	UserRepository user.Repository
+	IssuerUrl      string
+	// ForwardAuthLoginUrl is where ForwardAuth sends the browsers that
+	// aren't logged in, they get a 401 when it's empty.
+	ForwardAuthLoginUrl string
+	// ScimToken is the bearer token of the SCIM client of the default
+	// organization and ScimTokens the ones of the others by their slug, the
+	// SCIM endpoints reject the requests of an organization without one.
+	ScimToken  string
+	ScimTokens map[string]string
+	// TokenReviewToken is the bearer token of the Kubernetes API server, the
+	// token review rejects every request when it's empty.
+	TokenReviewToken string
+	// Tenants resolves the organizations of the requests, every request is
+	// of the default organization when it's nil.
+	Tenants *tenant.Resolver
+	// Members are the members of the organizations, OrgRole rejects every
+	// request when it's nil.
+	Members member.Repository
 }
 
 type contextKey string
@@ -22,10 +52,19 @@ const TokenContextKey = contextKey("token")
 
 var Token_Prefix = "Bearer "
 
-func NewMiddleware(sk string, cache *cache.Caches) *Middleware {
+var DPoP_Prefix = jwt.DPoPScheme + " "
+
+func NewMiddleware(config *configs.Configuration, userRepo user.Repository, recorder audit.Recorder, cache *cache.Caches) *Middleware {
 	return &Middleware{
-		JwtBuilder: jwt.NewJwtBuilder(sk),
-		Cache:      cache,
+		JwtBuilder:          jwt.NewJwtBuilder(config.JwtSecretKey, config.Issuer),
+		IssuerUrl:           config.IssuerUrl,
+		ForwardAuthLoginUrl: config.ForwardAuthLoginUrl,
+		ScimToken:           config.ScimToken,
+		ScimTokens:          scimTokens(config.ScimOrgTokens),
+		TokenReviewToken:    config.TokenReviewToken,
+		Cache:               cache,
+		Audit:               recorder,
+		UserRepository:      userRepo,
 	}
 }
 
@@ -60,8 +99,8 @@ func (m *Middleware) JwtBased(next http.Handler) http.Handler {
 		dirtToken := r.Header.Get("Authorization")
 		token := cleanToken(dirtToken)
 
-		if dirtToken == "" || !strings.HasPrefix(dirtToken, Token_Prefix) {
-			fmt.Println(dirtToken == "" || !strings.HasPrefix(dirtToken, Token_Prefix))
+		if dirtToken == "" || !hasTokenPrefix(dirtToken) {
+			fmt.Println(dirtToken == "" || !hasTokenPrefix(dirtToken))
 			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
 			return
 		}
@@ -73,12 +112,16 @@ func (m *Middleware) JwtBased(next http.Handler) http.Handler {
 			return
 		}
 
+		if !validProof(w, r, m, dirtToken, token, userClaims) {
+			return
+		}
+
 		isRefresh := false
 		if !validCredentials(w, r, m, &token, userClaims, isRefresh) {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		m.serveWithClaims(next, w, r, userClaims)
 	})
 }
 
@@ -87,8 +130,8 @@ func (m *Middleware) JwtRefreshBased(next http.Handler) http.Handler {
 		dirtToken := r.Header.Get("Authorization")
 		token := cleanToken(dirtToken)
 
-		if dirtToken == "" || !strings.HasPrefix(dirtToken, Token_Prefix) {
-			fmt.Println(dirtToken == "" || !strings.HasPrefix(dirtToken, Token_Prefix))
+		if dirtToken == "" || !hasTokenPrefix(dirtToken) {
+			fmt.Println(dirtToken == "" || !hasTokenPrefix(dirtToken))
 			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
 			return
 		}
@@ -100,19 +143,177 @@ func (m *Middleware) JwtRefreshBased(next http.Handler) http.Handler {
 			return
 		}
 
+		if !validProof(w, r, m, dirtToken, token, userClaims) {
+			return
+		}
+
+		// tokens revoked through /oauth/revoke are denylisted until they expire
+		if denied, ok := m.Cache.TokenCache.Get(token); ok && denied {
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+			return
+		}
+
 		isRefresh := true
 		if !validCredentials(w, r, m, &token, userClaims, isRefresh) {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		m.serveWithClaims(next, w, r, userClaims)
+	})
+}
+
+// UserClaimsFromContext returns the claims of the token that authenticated
+// the request, it's only available behind the jwt based middlewares.
+func UserClaimsFromContext(ctx context.Context) (*jwt.UserClaims, bool) {
+	userClaims, ok := ctx.Value(TokenContextKey).(*jwt.UserClaims)
+	return userClaims, ok
+}
+
+// ActorFromContext returns who is acting on behalf of the user, it's only
+// available when the request was made with an impersonation token.
+func ActorFromContext(ctx context.Context) (*domain.Actor, bool) {
+	userClaims, ok := UserClaimsFromContext(ctx)
+	if !ok || userClaims.Act == nil {
+		return nil, false
+	}
+	return userClaims.Act, true
+}
+
+// serveWithClaims calls the next handler with the claims in the context,
+// requests made while impersonating are recorded in the audit trail. The
+// credentials of another organization are rejected (see withTokenTenant).
+func (m *Middleware) serveWithClaims(next http.Handler, w http.ResponseWriter, r *http.Request, userClaims *jwt.UserClaims) {
+	ctx, err := m.withTokenTenant(r.Context(), userClaims)
+	if err != nil {
+		errorhandler.UnauthroizedErrorHandler(w, err)
+		return
+	}
+	r = r.WithContext(ctx)
+
+	if userClaims.Act == nil {
+		next.ServeHTTP(w, withUserClaims(r, userClaims))
+		return
+	}
+
+	ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	next.ServeHTTP(ww, withUserClaims(r, userClaims))
+
+	m.Audit.Record(r.Context(), &audit.Event{
+		Action:   audit.ActionImpersonatedRequest,
+		Actor:    userClaims.Act.Subject,
+		Subject:  userClaims.Username,
+		ClientId: userClaims.ClientId,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Status:   ww.Status(),
 	})
 }
 
+func withUserClaims(r *http.Request, userClaims *jwt.UserClaims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), TokenContextKey, userClaims))
+}
+
 func cleanToken(dirtToken string) string {
+	if strings.HasPrefix(dirtToken, DPoP_Prefix) {
+		return strings.TrimPrefix(dirtToken, DPoP_Prefix)
+	}
 	return strings.TrimPrefix(dirtToken, Token_Prefix)
 }
 
+func hasTokenPrefix(dirtToken string) bool {
+	return strings.HasPrefix(dirtToken, Token_Prefix) || strings.HasPrefix(dirtToken, DPoP_Prefix)
+}
+
+// ProofUrlContextKey holds the url the DPoP proofs of the request are for
+// when it isn't the url of the request, like the app behind ForwardAuth.
+const ProofUrlContextKey = contextKey("proof_url")
+
+// VerifyDPoP verifies the DPoP proof sent with the request and keeps its jti
+// so it can't be replayed, accessToken is empty when there's no token yet
+// (login and renewal). issuerUrl is the public url the proof is checked
+// against, see tool.BaseUrl, unless the context has a ProofUrlContextKey.
+func VerifyDPoP(r *http.Request, proofCache *cache.Cache[string, bool], issuerUrl, accessToken string) (*jwt.DPoPProof, error) {
+	proofs := r.Header.Values(jwt.DPoPHeader)
+	if len(proofs) != 1 {
+		return nil, errorhandler.ErrInvalidDPoPProof
+	}
+
+	proofUrl, ok := r.Context().Value(ProofUrlContextKey).(string)
+	if !ok {
+		proofUrl = tool.BaseUrl(r, issuerUrl) + r.URL.Path
+	}
+
+	proof, err := jwt.VerifyDPoPProof(proofs[0], r.Method, proofUrl, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !proofCache.SetIfAbsent(proof.Claims.ID, true, time.Now().Add(jwt.DPoPProofLifetime+jwt.DPoPClockSkew)) {
+		return nil, errorhandler.ErrDPoPProofReplayed
+	}
+
+	return proof, nil
+}
+
+// TokenConfirmation returns what the tokens of a login or renewal should be
+// bound to, the key of the optional DPoP proof and the client certificate
+// when the connection has one (nil when there's neither).
+func (m *Middleware) TokenConfirmation(r *http.Request) (*domain.Confirmation, error) {
+	cnf := &domain.Confirmation{CertificateThumbprint: PeerCertificateThumbprint(r)}
+
+	if r.Header.Get(jwt.DPoPHeader) != "" {
+		proof, err := VerifyDPoP(r, m.Cache.ProofCache, m.IssuerUrl, "")
+		if err != nil {
+			return nil, err
+		}
+		cnf.JwkThumbprint = proof.Thumbprint
+	}
+
+	if *cnf == (domain.Confirmation{}) {
+		return nil, nil
+	}
+	return cnf, nil
+}
+
+// validProof checks the proof of possession when the token is bound (cnf),
+// certificate bound tokens need the same client certificate and DPoP bound
+// ones must be sent with the DPoP scheme, which unbound tokens can't use.
+func validProof(w http.ResponseWriter, r *http.Request, m *Middleware, dirtToken, token string, userClaims *jwt.UserClaims) bool {
+	challenge, err := checkProof(r, m, dirtToken, token, userClaims)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", challenge)
+		errorhandler.UnauthroizedErrorHandler(w, err)
+		return false
+	}
+	return true
+}
+
+// checkProof returns the WWW-Authenticate challenge and the error when the
+// proof of possession is missing or invalid.
+func checkProof(r *http.Request, m *Middleware, dirtToken, token string, userClaims *jwt.UserClaims) (string, error) {
+	cnf := userClaims.Cnf
+	if cnf != nil && cnf.CertificateThumbprint != "" && PeerCertificateThumbprint(r) != cnf.CertificateThumbprint {
+		return `Bearer error="invalid_token"`, errorhandler.ErrInvalidClientCertificate
+	}
+
+	isDPoP := strings.HasPrefix(dirtToken, DPoP_Prefix)
+	isBound := cnf != nil && cnf.JwkThumbprint != ""
+	if !isBound && !isDPoP {
+		return "", nil
+	}
+
+	if !isBound || !isDPoP {
+		return `DPoP error="invalid_token"`, errorhandler.ErrInvalidToken
+	}
+
+	proof, err := VerifyDPoP(r, m.Cache.ProofCache, m.IssuerUrl, token)
+	if err != nil || proof.Thumbprint != cnf.JwkThumbprint {
+		return `DPoP error="invalid_dpop_proof"`, errorhandler.ErrInvalidDPoPProof
+	}
+
+	return "", nil
+}
+
 func validCredentials(w http.ResponseWriter, r *http.Request, m *Middleware, token *string, userClaims *jwt.UserClaims, isRefresh bool) bool {
 	path := r.URL.Path
 
@@ -138,7 +339,13 @@ func validCredentials(w http.ResponseWriter, r *http.Request, m *Middleware, tok
 		tokenCache.Set(*token, true, userClaims.ExpiresAt.Time)
 	}
 
-	pathSlice := strings.Split(path, "/")
+	return isOwner(w, r, userClaims)
+}
+
+// isOwner checks the user is changing its own account, the username is the
+// last part of the path.
+func isOwner(w http.ResponseWriter, r *http.Request, userClaims *jwt.UserClaims) bool {
+	pathSlice := strings.Split(r.URL.Path, "/")
 	if len(pathSlice) <= 0 {
 		fmt.Println("Invalid path")
 		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrIdIsRequired, r.URL.Path)
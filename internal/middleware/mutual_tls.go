@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/token"
+)
+
+// MutualTLS authenticates the request with the client certificate verified
+// by the TLS handshake. The certificate is mapped to the user (or service
+// account) whose username is one of its SANs or its subject common name, the
+// claims in the context are the same the jwt based middlewares set.
+func (m *Middleware) MutualTLS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidClientCertificate)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		user := m.certificateUser(r.Context(), cert)
+		if user == nil {
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidClientCertificate)
+			return
+		}
+
+		userClaims := &token.UserClaims{
+			Username: *user.Username,
+			Id:       *user.Id,
+			TenantId: tenant.IdFrom(r.Context()),
+			Cnf:      &domain.Confirmation{CertificateThumbprint: CertificateThumbprint(cert)},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   *user.Username,
+				ExpiresAt: jwt.NewNumericDate(cert.NotAfter),
+			},
+		}
+
+		if strings.Contains(r.URL.Path, "users") && checkMethods(r) && !isOwner(w, r, userClaims) {
+			return
+		}
+
+		m.serveWithClaims(next, w, r, userClaims)
+	})
+}
+
+// certificateUser finds the user of the certificate, the identities are
+// tried from the most to the least specific: URI, DNS and email SANs and
+// then the subject common name.
+func (m *Middleware) certificateUser(ctx context.Context, cert *x509.Certificate) *domain.User {
+	for _, identity := range certificateIdentities(cert) {
+		if user, err := m.UserRepository.FindUserByUsername(ctx, identity); err == nil {
+			return user
+		}
+	}
+	return nil
+}
+
+func certificateIdentities(cert *x509.Certificate) []string {
+	identities := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+len(cert.EmailAddresses)+1)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	return identities
+}
+
+// PeerCertificateThumbprint returns the thumbprint of the client certificate
+// verified by the TLS handshake, empty without one.
+func PeerCertificateThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return CertificateThumbprint(r.TLS.VerifiedChains[0][0])
+}
+
+// CertificateThumbprint is the x5t#S256 of RFC 8705, the hash of the DER
+// encoded certificate.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
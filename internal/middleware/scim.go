@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+// ScimAuthenticated lets in the identity provider pushing the users of an
+// organization, it sends the token of the organization with the Bearer
+// scheme (SCIM_TOKEN for the default one, SCIM_ORG_TOKENS for the others).
+// A request that names no organization is of the one of its token. The
+// errors have the SCIM body.
+func (m *Middleware) ScimAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		ctx, ok := m.scimTenant(r.Context(), strings.TrimPrefix(header, Token_Prefix))
+		if !strings.HasPrefix(header, Token_Prefix) || !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			errorhandler.ScimErrorHandler(w, http.StatusUnauthorized, "", errorhandler.ErrInvalidToken)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// scimTenant checks the token is the one of the organization of the
+// context, when there's none it becomes the organization of the token.
+func (m *Middleware) scimTenant(ctx context.Context, sent string) (context.Context, bool) {
+	if org, ok := tenant.FromContext(ctx); ok {
+		expected := m.ScimToken
+		if org.Id != tenant.DefaultId {
+			expected = m.ScimTokens[org.Slug]
+		}
+		return ctx, expected != "" && sharedTokenMatches(sent, expected)
+	}
+
+	if m.ScimToken != "" && sharedTokenMatches(sent, m.ScimToken) {
+		return ctx, true
+	}
+	for slug, expected := range m.ScimTokens {
+		if m.Tenants == nil || expected == "" || !sharedTokenMatches(sent, expected) {
+			continue
+		}
+		org, err := m.Tenants.BySlug(ctx, slug)
+		if err != nil || org == nil {
+			return ctx, false
+		}
+		return tenant.WithOrganization(ctx, org), true
+	}
+	return ctx, false
+}
+
+// scimTokens maps the slugs of the organizations to their SCIM token, the
+// mappings are slug=token.
+func scimTokens(mappings []string) map[string]string {
+	tokens := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		if slug, token, found := strings.Cut(mapping, "="); found {
+			tokens[strings.TrimSpace(slug)] = strings.TrimSpace(token)
+		}
+	}
+	return tokens
+}
+
+// TokenReviewAuthenticated lets in the Kubernetes API server asking for the
+// token reviews, it sends TOKEN_REVIEW_TOKEN with the Bearer scheme (the
+// token of the user of the webhook kubeconfig).
+func (m *Middleware) TokenReviewAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if m.TokenReviewToken == "" || !strings.HasPrefix(header, Token_Prefix) || !sharedTokenMatches(strings.TrimPrefix(header, Token_Prefix), m.TokenReviewToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			errorhandler.UnauthroizedErrorHandler(w, errorhandler.ErrInvalidToken)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sharedTokenMatches compares the hashes, so the time doesn't tell the
+// length of the token either.
+func sharedTokenMatches(sent, expected string) bool {
+	sentHash := sha256.Sum256([]byte(sent))
+	expectedHash := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(sentHash[:], expectedHash[:]) == 1
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/health"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	jwt "github.com/rafaeldepontes/fauthless-go/internal/token"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Tenant resolves the organization of the request, by the slug sent in the
+// header of the Tenants or else by the host, and keeps it in the context.
+// The requests that name none are of the default organization. While the
+// organizations can't be read the requests get a 503, like the gRPC calls,
+// instead of going on as the default organization; only the health checks
+// keep answering.
+func (m *Middleware) Tenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == health.LivenessPath || r.URL.Path == health.ReadinessPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r, err := m.requestTenant(r)
+		if errors.Is(err, errorhandler.ErrOrganizationsUnavailable) {
+			errorhandler.RequestErrorHandler(w, errorhandler.ErrOrganizationsUnavailable, http.StatusServiceUnavailable, r.URL.Path)
+			return
+		}
+		if err != nil {
+			errorhandler.RequestErrorHandler(w, err, http.StatusNotFound, r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTenant is the request with the organization it names in the
+// context, see Tenant. It returns ErrOrganizationNotFound with the request
+// unchanged when the organization doesn't exist, and
+// ErrOrganizationsUnavailable when it couldn't be resolved.
+func (m *Middleware) requestTenant(r *http.Request) (*http.Request, error) {
+	if m.Tenants == nil {
+		return r, nil
+	}
+
+	org, err := m.Tenants.Resolve(r.Context(), r.Header.Get(m.Tenants.Header), r.Host)
+	if errors.Is(err, errorhandler.ErrOrganizationNotFound) {
+		return r, err
+	}
+	if err != nil {
+		return r, fmt.Errorf("%w: %w", errorhandler.ErrOrganizationsUnavailable, err)
+	}
+	if org != nil {
+		r = r.WithContext(tenant.WithOrganization(r.Context(), org))
+	}
+	return r, nil
+}
+
+// withTokenTenant checks the credentials were issued by the organization of
+// the context. When the request didn't name one it becomes the organization
+// of the credentials, so the tokens work without the header.
+func (m *Middleware) withTokenTenant(ctx context.Context, userClaims *jwt.UserClaims) (context.Context, error) {
+	if _, ok := tenant.FromContext(ctx); !ok && m.Tenants != nil && tenant.OfClaim(userClaims.TenantId) != tenant.DefaultId {
+		org, err := m.Tenants.ById(ctx, userClaims.TenantId)
+		if err != nil || org == nil {
+			return nil, errorhandler.ErrWrongOrganization
+		}
+		ctx = tenant.WithOrganization(ctx, org)
+	}
+
+	if !tenant.Matches(ctx, userClaims.TenantId) {
+		return nil, errorhandler.ErrWrongOrganization
+	}
+
+	if method, ok := AuthMethodFromContext(ctx); ok && !tenant.AllowsMode(ctx, method) {
+		return nil, errorhandler.ErrLoginModeNotAllowed
+	}
+	return ctx, nil
+}
+
+// callTenant is the Tenant of the gRPC calls, the slug is sent in the
+// metadata named like the header. The calls without it are of the
+// organization of their token.
+func (m *Middleware) callTenant(ctx context.Context) (context.Context, error) {
+	if m.Tenants == nil {
+		return ctx, nil
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(m.Tenants.Header))
+	if len(values) == 0 {
+		return ctx, nil
+	}
+
+	org, err := m.Tenants.Resolve(ctx, values[0], "")
+	if errors.Is(err, errorhandler.ErrOrganizationNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return tenant.WithOrganization(ctx, org), nil
+}
@@ -6,8 +6,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"hash"
-	"os"
-	"strconv"
 
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
@@ -18,12 +16,9 @@ type cursorService[T any] struct {
 	sigLen    int
 }
 
-func NewCursorService[T any]() *cursorService[T] {
-	sigLenStr := os.Getenv("SIGNATURE_LENGTH")
-	sigLen, _ := strconv.Atoi(sigLenStr)
-
+func NewCursorService[T any](secretKey string, sigLen int) *cursorService[T] {
 	return &cursorService[T]{
-		secretKey: []byte(os.Getenv("SECRET_CURSOR_KEY")),
+		secretKey: []byte(secretKey),
 		sigLen:    sigLen,
 	}
 }
@@ -42,8 +37,7 @@ func (s *cursorService[T]) Encode(size int, nextCursor int64) (string, error) {
 		return "", err
 	}
 
-	secretKey := os.Getenv("SECRET_CURSOR_KEY")
-	var mac hash.Hash = hmac.New(sha256.New, []byte(secretKey))
+	var mac hash.Hash = hmac.New(sha256.New, s.secretKey)
 	mac.Write(sb)
 	signature := mac.Sum(nil)
 
@@ -0,0 +1,262 @@
+// Package saml is the service provider of the SAML 2.0 logins, the users
+// are provisioned in the users table the first time they log in.
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+)
+
+// The endpoints of the service provider, under ISSUER_URL.
+const (
+	MetadataPath = "/saml/metadata"
+	LoginPath    = "/saml/login"
+	AcsPath      = "/saml/acs"
+)
+
+// MetadataTimeout bounds the fetch of SAML_IDP_METADATA_URL at the start.
+const MetadataTimeout = 10 * time.Second
+
+// ServiceProvider validates the responses of the identity provider and maps
+// their assertions to the local users.
+type ServiceProvider struct {
+	config         *configs.Configuration
+	userRepository user.Repository
+	sp             *gosaml.ServiceProvider
+	groupRoles     user.GroupRoles
+}
+
+// NewServiceProvider creates the service provider of the config, sp is
+// Load(ctx, config) unless it's a test.
+func NewServiceProvider(config *configs.Configuration, userRepository user.Repository, sp *gosaml.ServiceProvider) *ServiceProvider {
+	return &ServiceProvider{
+		config:         config,
+		userRepository: userRepository,
+		sp:             sp,
+		groupRoles:     user.NewGroupRoles(config.SamlGroupRoles),
+	}
+}
+
+// Load reads the metadata of the identity provider and the key of the
+// service provider, without SAML_KEY_FILE a new key is generated, which
+// means the IdP has to be given the metadata again after a restart if it
+// encrypts the assertions.
+func Load(ctx context.Context, config *configs.Configuration) (*gosaml.ServiceProvider, error) {
+	idpMetadata, err := loadIdpMetadata(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("SAML identity provider metadata: %w", err)
+	}
+
+	keyPair, err := loadKeyPair(config)
+	if err != nil {
+		return nil, fmt.Errorf("SAML service provider key: %w", err)
+	}
+
+	issuerUrl, err := url.Parse(strings.TrimSuffix(config.IssuerUrl, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &gosaml.ServiceProvider{
+		EntityID:          config.SamlEntityId,
+		Key:               keyPair.PrivateKey.(*rsa.PrivateKey),
+		Certificate:       keyPair.Leaf,
+		MetadataURL:       *issuerUrl.JoinPath(MetadataPath),
+		AcsURL:            *issuerUrl.JoinPath(AcsPath),
+		IDPMetadata:       idpMetadata,
+		AllowIDPInitiated: config.SamlAllowIdpInitiated,
+		AuthnNameIDFormat: gosaml.UnspecifiedNameIDFormat,
+	}
+	// without an AudienceRestriction crewjam accepts the assertion, one made
+	// for any other service provider of the IdP would do
+	sp.ValidateAudienceRestriction = func(assertion *gosaml.Assertion) error {
+		audience := sp.Metadata().EntityID
+		for _, restriction := range assertion.Conditions.AudienceRestrictions {
+			if restriction.Audience.Value == audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("the assertion isn't for %q", audience)
+	}
+	return sp, nil
+}
+
+func loadIdpMetadata(ctx context.Context, config *configs.Configuration) (*gosaml.EntityDescriptor, error) {
+	if config.SamlIdpMetadataFile != "" {
+		data, err := os.ReadFile(config.SamlIdpMetadataFile)
+		if err != nil {
+			return nil, err
+		}
+		return samlsp.ParseMetadata(data)
+	}
+
+	metadataUrl, err := url.Parse(config.SamlIdpMetadataUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, MetadataTimeout)
+	defer cancel()
+	return samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataUrl)
+}
+
+func loadKeyPair(config *configs.Configuration) (*tls.Certificate, error) {
+	if config.SamlKeyFile == "" {
+		return generateKeyPair(config.IssuerUrl)
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(config.SamlCertFile, config.SamlKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keyPair.PrivateKey.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("the key must be a RSA key")
+	}
+	return &keyPair, nil
+}
+
+// generateKeyPair creates a self signed certificate, the IdPs only use it
+// as a container of the public key.
+func generateKeyPair(issuerUrl string) (*tls.Certificate, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: issuerUrl},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey, Leaf: leaf}, nil
+}
+
+// Metadata is the xml the identity provider is configured with.
+func (p *ServiceProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// AllowIdpInitiated tells if the responses that don't answer a request of
+// /saml/login are accepted.
+func (p *ServiceProvider) AllowIdpInitiated() bool {
+	return p.sp.AllowIDPInitiated
+}
+
+// AuthnRequest creates the request of the HTTP-Redirect binding, it returns
+// the url of the identity provider and the id the response has to answer.
+// The relay state must be url safe.
+func (p *ServiceProvider) AuthnRequest(relayState string) (*url.URL, string, error) {
+	req, err := p.sp.MakeAuthenticationRequest(
+		p.sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding),
+		gosaml.HTTPRedirectBinding,
+		gosaml.HTTPPostBinding,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	redirect, err := req.Redirect(relayState, p.sp)
+	if err != nil {
+		return nil, "", err
+	}
+	return redirect, req.ID, nil
+}
+
+// ParseResponse validates the response posted to the ACS, its signature,
+// issuer, audience and time conditions, and that it answers one of the
+// requestIds. It returns the local user of the assertion.
+func (p *ServiceProvider) ParseResponse(r *http.Request, requestIds []string) (*domain.User, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrInvalidSamlResponse, err)
+	}
+
+	assertion, err := p.sp.ParseResponse(r, requestIds)
+	if err != nil {
+		// crewjam hides why the response is invalid behind the error message
+		var invalid *gosaml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %w", errorhandler.ErrInvalidSamlResponse, err)
+	}
+
+	username := attribute(assertion, p.config.SamlUsernameAttribute)
+	if p.config.SamlUsernameAttribute == "" && assertion.Subject != nil && assertion.Subject.NameID != nil {
+		username = assertion.Subject.NameID.Value
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: the assertion has no username", errorhandler.ErrInvalidSamlResponse)
+	}
+
+	return user.Provision(r.Context(), p.userRepository,
+		username,
+		attribute(assertion, p.config.SamlEmailAttribute),
+		p.groupRoles.Roles(attributeValues(assertion, p.config.SamlGroupAttribute)),
+	)
+}
+
+func attribute(assertion *gosaml.Assertion, name string) string {
+	if values := attributeValues(assertion, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// attributeValues finds the attribute by its name or its friendly name, the
+// IdPs send the same attribute as "email", "mail" or its OID.
+func attributeValues(assertion *gosaml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	values := []string{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if value.Value != "" && !slices.Contains(values, value.Value) {
+					values = append(values, value.Value)
+				}
+			}
+		}
+	}
+	return values
+}
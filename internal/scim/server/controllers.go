@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+)
+
+// scimController is the http transport of the scim.Service, the bodies and
+// the errors are the ones of RFC 7644.
+type scimController struct {
+	service *scim.Service
+}
+
+func NewScimController(s *scim.Service) scim.Controller {
+	return &scimController{
+		service: s,
+	}
+}
+
+func (c *scimController) ListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := (*c.service).ListUsers(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, list)
+}
+
+func (c *scimController) GetUser(w http.ResponseWriter, r *http.Request) {
+	scimUser, err := (*c.service).GetUser(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimUser)
+}
+
+func (c *scimController) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in domain.ScimUser
+	if !decodeScim(w, r, &in) {
+		return
+	}
+
+	scimUser, err := (*c.service).CreateUser(r.Context(), &in)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeCreated(w, scimUser.Meta, scimUser)
+}
+
+func (c *scimController) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var in domain.ScimUser
+	if !decodeScim(w, r, &in) {
+		return
+	}
+
+	scimUser, err := (*c.service).ReplaceUser(r.Context(), r.PathValue("id"), &in)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimUser)
+}
+
+func (c *scimController) PatchUser(w http.ResponseWriter, r *http.Request) {
+	var patch domain.ScimPatch
+	if !decodeScim(w, r, &patch) {
+		return
+	}
+
+	scimUser, err := (*c.service).PatchUser(r.Context(), r.PathValue("id"), &patch)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimUser)
+}
+
+func (c *scimController) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := (*c.service).DeleteUser(r.Context(), r.PathValue("id")); err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *scimController) ListGroups(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := (*c.service).ListGroups(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, list)
+}
+
+func (c *scimController) GetGroup(w http.ResponseWriter, r *http.Request) {
+	scimGroup, err := (*c.service).GetGroup(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimGroup)
+}
+
+func (c *scimController) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var in domain.ScimGroup
+	if !decodeScim(w, r, &in) {
+		return
+	}
+
+	scimGroup, err := (*c.service).CreateGroup(r.Context(), &in)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeCreated(w, scimGroup.Meta, scimGroup)
+}
+
+func (c *scimController) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var in domain.ScimGroup
+	if !decodeScim(w, r, &in) {
+		return
+	}
+
+	scimGroup, err := (*c.service).ReplaceGroup(r.Context(), r.PathValue("id"), &in)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimGroup)
+}
+
+func (c *scimController) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var patch domain.ScimPatch
+	if !decodeScim(w, r, &patch) {
+		return
+	}
+
+	scimGroup, err := (*c.service).PatchGroup(r.Context(), r.PathValue("id"), &patch)
+	if err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	writeScim(w, http.StatusOK, scimGroup)
+}
+
+func (c *scimController) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := (*c.service).DeleteGroup(r.Context(), r.PathValue("id")); err != nil {
+		errorhandler.ScimServiceErrorHandler(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pageParams reads startIndex and count, the service bounds them.
+func pageParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	query := r.URL.Query()
+
+	startIndex, count := 1, scim.DefaultCount
+	var err error
+	if value := query.Get("startIndex"); value != "" {
+		if startIndex, err = strconv.Atoi(value); err != nil {
+			errorhandler.ScimErrorHandler(w, http.StatusBadRequest, errorhandler.ScimInvalidValue, errorhandler.ErrMalformedScimRequest)
+			return 0, 0, false
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		if count, err = strconv.Atoi(value); err != nil {
+			errorhandler.ScimErrorHandler(w, http.StatusBadRequest, errorhandler.ScimInvalidValue, errorhandler.ErrMalformedScimRequest)
+			return 0, 0, false
+		}
+	}
+	return startIndex, count, true
+}
+
+func decodeScim(w http.ResponseWriter, r *http.Request, body any) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		errorhandler.ScimErrorHandler(w, http.StatusBadRequest, errorhandler.ScimInvalidSyntax, errorhandler.ErrMalformedScimRequest)
+		return false
+	}
+	return true
+}
+
+func writeCreated(w http.ResponseWriter, meta *domain.ScimMeta, body any) {
+	if meta != nil && meta.Location != "" {
+		w.Header().Set("Location", meta.Location)
+	}
+	writeScim(w, http.StatusCreated, body)
+}
+
+func writeScim(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+)
+
+// MapScimRoutes maps the SCIM resources, the route is the one of
+// scim.BasePath with the SCIM authentication.
+func MapScimRoutes(route *chi.Router, controller *scim.Controller) {
+	(*route).Get("/Users", (*controller).ListUsers)
+	(*route).Post("/Users", (*controller).CreateUser)
+	(*route).Get("/Users/{id}", (*controller).GetUser)
+	(*route).Put("/Users/{id}", (*controller).ReplaceUser)
+	(*route).Patch("/Users/{id}", (*controller).PatchUser)
+	(*route).Delete("/Users/{id}", (*controller).DeleteUser)
+
+	(*route).Get("/Groups", (*controller).ListGroups)
+	(*route).Post("/Groups", (*controller).CreateGroup)
+	(*route).Get("/Groups/{id}", (*controller).GetGroup)
+	(*route).Put("/Groups/{id}", (*controller).ReplaceGroup)
+	(*route).Patch("/Groups/{id}", (*controller).PatchGroup)
+	(*route).Delete("/Groups/{id}", (*controller).DeleteGroup)
+}
@@ -0,0 +1,38 @@
+// Package scim is the SCIM 2.0 provisioning of the users and groups, the
+// identity provider creates, updates and removes them instead of a script.
+package scim
+
+import (
+	"context"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// BasePath is where the SCIM endpoints are mapped, the locations of the
+// resources are under it.
+const BasePath = "/scim/v2"
+
+// DefaultCount is the page size when the client doesn't send count and
+// MaxCount the largest one it can ask for.
+const (
+	DefaultCount = 100
+	MaxCount     = 100
+)
+
+// Service is the SCIM provisioning without any transport, the errors are
+// classified with the errorhandler kinds. startIndex is 1-based like SCIM.
+type Service interface {
+	ListUsers(ctx context.Context, filter string, startIndex, count int) (*domain.ScimListResponse[domain.ScimUser], error)
+	GetUser(ctx context.Context, id string) (*domain.ScimUser, error)
+	CreateUser(ctx context.Context, u *domain.ScimUser) (*domain.ScimUser, error)
+	ReplaceUser(ctx context.Context, id string, u *domain.ScimUser) (*domain.ScimUser, error)
+	PatchUser(ctx context.Context, id string, patch *domain.ScimPatch) (*domain.ScimUser, error)
+	DeleteUser(ctx context.Context, id string) error
+
+	ListGroups(ctx context.Context, filter string, startIndex, count int) (*domain.ScimListResponse[domain.ScimGroup], error)
+	GetGroup(ctx context.Context, id string) (*domain.ScimGroup, error)
+	CreateGroup(ctx context.Context, g *domain.ScimGroup) (*domain.ScimGroup, error)
+	ReplaceGroup(ctx context.Context, id string, g *domain.ScimGroup) (*domain.ScimGroup, error)
+	PatchGroup(ctx context.Context, id string, patch *domain.ScimPatch) (*domain.ScimGroup, error)
+	DeleteGroup(ctx context.Context, id string) error
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// ListGroups lists the groups by name, the filter can be on the
+// displayName or the externalId.
+func (s *scimService) ListGroups(ctx context.Context, filter string, startIndex, count int) (*domain.ScimListResponse[domain.ScimGroup], error) {
+	startIndex, count = pageOf(startIndex, count)
+
+	var (
+		groups []domain.Group
+		total  int
+	)
+	if filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		var g *domain.Group
+		switch attribute {
+		case "displayname":
+			g, err = s.groupRepository.FindGroupByName(ctx, value)
+		case "externalid":
+			g, err = s.groupRepository.FindGroupByExternalId(ctx, value)
+		default:
+			return nil, errorhandler.Invalid(errorhandler.ErrInvalidScimFilter)
+		}
+		if err != nil && !errors.Is(err, errorhandler.ErrGroupNotFound) {
+			return nil, err
+		}
+
+		if g != nil {
+			groups = append(groups, *g)
+		}
+		total = len(groups)
+		groups = window(groups, startIndex, count)
+	} else {
+		var err error
+		groups, total, err = s.groupRepository.FindGroups(ctx, startIndex-1, count)
+		if err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			return nil, err
+		}
+	}
+
+	resources := make([]domain.ScimGroup, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, *s.toScimGroup(&groups[i]))
+	}
+	return listResponse(resources, total, startIndex), nil
+}
+
+func (s *scimService) GetGroup(ctx context.Context, id string) (*domain.ScimGroup, error) {
+	g, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toScimGroup(g), nil
+}
+
+// CreateGroup creates the group with its members, they get the role of the
+// group when SCIM_GROUP_ROLES maps it.
+func (s *scimService) CreateGroup(ctx context.Context, in *domain.ScimGroup) (*domain.ScimGroup, error) {
+	if err := s.checkDisplayName(ctx, in.DisplayName); err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupMembers(ctx, in.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &domain.Group{
+		Id:          uuid.NewString(),
+		DisplayName: in.DisplayName,
+		ExternalId:  optional(in.ExternalId),
+		Members:     members,
+	}
+	if err := s.groupRepository.CreateGroup(ctx, g); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	if err := s.syncRoles(ctx, memberIds(g.Members)); err != nil {
+		return nil, err
+	}
+
+	s.Logger.Infof("SCIM created the group %v", g.DisplayName)
+	return s.toScimGroup(g), nil
+}
+
+// ReplaceGroup replaces the name and members of the group, the roles of
+// the members it had and the ones it has now are synced.
+func (s *scimService) ReplaceGroup(ctx context.Context, id string, in *domain.ScimGroup) (*domain.ScimGroup, error) {
+	g, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.DisplayName != g.DisplayName {
+		if err := s.checkDisplayName(ctx, in.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+
+	members, err := s.groupMembers(ctx, in.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := memberIds(g.Members)
+	g.DisplayName = in.DisplayName
+	g.ExternalId = optional(in.ExternalId)
+	g.Members = members
+
+	return s.updateGroup(ctx, g, affected)
+}
+
+// PatchGroup applies the operations to the group, the identity providers
+// add and remove the members with them.
+func (s *scimService) PatchGroup(ctx context.Context, id string, patch *domain.ScimPatch) (*domain.ScimGroup, error) {
+	g, err := s.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := memberIds(g.Members)
+	err = eachPatchValue(patch, func(op, path string, value json.RawMessage) error {
+		return s.patchGroupAttribute(ctx, g, op, path, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateGroup(ctx, g, affected)
+}
+
+func (s *scimService) DeleteGroup(ctx context.Context, id string) error {
+	g, err := s.findGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.groupRepository.DeleteGroup(ctx, g.Id); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return err
+	}
+
+	s.Logger.Infof("SCIM deleted the group %v", g.DisplayName)
+	return s.syncRoles(ctx, memberIds(g.Members))
+}
+
+// updateGroup saves the group and syncs the roles of the members it had,
+// affected, and the ones it has now.
+func (s *scimService) updateGroup(ctx context.Context, g *domain.Group, affected []int64) (*domain.ScimGroup, error) {
+	if err := s.groupRepository.UpdateGroup(ctx, g); err != nil {
+		if errors.Is(err, errorhandler.ErrGroupNotFound) {
+			return nil, errorhandler.NotFound(err)
+		}
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	if err := s.syncRoles(ctx, append(affected, memberIds(g.Members)...)); err != nil {
+		return nil, err
+	}
+
+	s.Logger.Infof("SCIM updated the group %v", g.DisplayName)
+	return s.toScimGroup(g), nil
+}
+
+// patchGroupAttribute changes the attribute of the path, the members are
+// removed by the filter members[value eq "id"] or by a list of them.
+func (s *scimService) patchGroupAttribute(ctx context.Context, g *domain.Group, op, path string, value json.RawMessage) error {
+	attribute := strings.ToLower(path)
+	switch {
+	case attribute == "displayname":
+		var displayName string
+		if op == patchRemove || json.Unmarshal(value, &displayName) != nil {
+			return errorhandler.Invalid(errorhandler.ErrDisplayNameIsRequired)
+		}
+		if displayName != g.DisplayName {
+			if err := s.checkDisplayName(ctx, displayName); err != nil {
+				return err
+			}
+		}
+		g.DisplayName = displayName
+	case attribute == "externalid":
+		var externalId string
+		if op != patchRemove && json.Unmarshal(value, &externalId) != nil {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+		g.ExternalId = optional(externalId)
+	case attribute == "members":
+		if op == patchRemove && len(value) == 0 {
+			g.Members = nil
+			return nil
+		}
+
+		var in []domain.ScimMember
+		if err := json.Unmarshal(value, &in); err != nil {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+		if op == patchRemove {
+			for _, member := range in {
+				g.Members = removeMember(g.Members, member.Value)
+			}
+			return nil
+		}
+
+		members, err := s.groupMembers(ctx, in)
+		if err != nil {
+			return err
+		}
+		if op == patchReplace {
+			g.Members = nil
+		}
+		for _, member := range members {
+			if !slices.Contains(g.Members, member) {
+				g.Members = append(g.Members, member)
+			}
+		}
+	case strings.HasPrefix(attribute, "members[") && strings.HasSuffix(attribute, "]"):
+		filterAttribute, userId, err := parseFilter(path[len("members[") : len(path)-1])
+		if err != nil || op != patchRemove || filterAttribute != "value" {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+		g.Members = removeMember(g.Members, userId)
+	}
+	return nil
+}
+
+// groupMembers finds the users of the SCIM members, every one of them has
+// to exist.
+func (s *scimService) groupMembers(ctx context.Context, in []domain.ScimMember) ([]domain.GroupMember, error) {
+	members := []domain.GroupMember{}
+	for _, member := range in {
+		userId, err := strconv.ParseInt(member.Value, 10, 64)
+		if err != nil {
+			return nil, errorhandler.Invalid(errorhandler.ErrInvalidScimMember)
+		}
+
+		u, err := s.userRepository.FindUserById(ctx, userId)
+		if errors.Is(err, errorhandler.ErrUserNotFound) {
+			return nil, errorhandler.Invalid(errorhandler.ErrInvalidScimMember)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		groupMember := domain.GroupMember{UserId: *u.Id, Username: *u.Username}
+		if !slices.Contains(members, groupMember) {
+			members = append(members, groupMember)
+		}
+	}
+	return members, nil
+}
+
+func (s *scimService) findGroup(ctx context.Context, id string) (*domain.Group, error) {
+	g, err := s.groupRepository.FindGroupById(ctx, id)
+	if errors.Is(err, errorhandler.ErrGroupNotFound) {
+		return nil, errorhandler.NotFound(err)
+	}
+	return g, err
+}
+
+func (s *scimService) checkDisplayName(ctx context.Context, displayName string) error {
+	if strings.TrimSpace(displayName) == "" {
+		return errorhandler.Invalid(errorhandler.ErrDisplayNameIsRequired)
+	}
+
+	_, err := s.groupRepository.FindGroupByName(ctx, displayName)
+	if err == nil {
+		return errorhandler.Conflict(errorhandler.ErrGroupAlreadyExists)
+	}
+	if !errors.Is(err, errorhandler.ErrGroupNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *scimService) toScimGroup(g *domain.Group) *domain.ScimGroup {
+	scimGroup := &domain.ScimGroup{
+		Schemas:     []string{domain.ScimGroupSchema},
+		Id:          g.Id,
+		DisplayName: g.DisplayName,
+		Meta:        &domain.ScimMeta{ResourceType: "Group", Location: s.location("/Groups/" + g.Id)},
+	}
+	if g.ExternalId != nil {
+		scimGroup.ExternalId = *g.ExternalId
+	}
+
+	for _, member := range g.Members {
+		userId := strconv.FormatInt(member.UserId, 10)
+		scimGroup.Members = append(scimGroup.Members, domain.ScimMember{
+			Value:   userId,
+			Display: member.Username,
+			Ref:     s.location("/Users/" + userId),
+		})
+	}
+	return scimGroup
+}
+
+func removeMember(members []domain.GroupMember, userId string) []domain.GroupMember {
+	return slices.DeleteFunc(members, func(member domain.GroupMember) bool {
+		return strconv.FormatInt(member.UserId, 10) == userId
+	})
+}
+
+func memberIds(members []domain.GroupMember) []int64 {
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserId)
+	}
+	return ids
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// The operations of a PatchOp, the identity providers don't agree on their
+// case so they're compared in lower case.
+const (
+	patchAdd     = "add"
+	patchReplace = "replace"
+	patchRemove  = "remove"
+)
+
+// eachPatchValue calls apply with each attribute the patch changes, an
+// operation without a path has an object of the attributes as value.
+func eachPatchValue(patch *domain.ScimPatch, apply func(op, path string, value json.RawMessage) error) error {
+	if patch == nil || len(patch.Operations) == 0 {
+		return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+	}
+
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != patchAdd && op != patchReplace && op != patchRemove {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+
+		if operation.Path != "" {
+			if err := apply(op, operation.Path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var values map[string]json.RawMessage
+		if op == patchRemove || json.Unmarshal(operation.Value, &values) != nil {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+		for _, path := range slices.Sorted(maps.Keys(values)) {
+			if err := apply(op, path, values[path]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// patchBool reads a boolean, some identity providers send it as "False".
+func patchBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+}
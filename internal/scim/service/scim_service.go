@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	log "github.com/sirupsen/logrus"
+)
+
+type scimService struct {
+	userRepository    user.Repository
+	groupRepository   user.GroupRepository
+	sessionRepository auth.Repository
+	patRepository     auth.PersonalAccessTokenRepository
+	audit             audit.Recorder
+	Logger            *log.Logger
+
+	issuerUrl  string
+	groupRoles user.GroupRoles
+}
+
+// NewScimService initialize a new scim.Service backed by the users and
+// groups repositories, the sessions and personal access tokens are revoked
+// when the users are deactivated or deleted. The changes of the users are
+// recorded by the recorder.
+func NewScimService(userRepo user.Repository, groupRepo user.GroupRepository, sessionRepo auth.Repository, patRepo auth.PersonalAccessTokenRepository, recorder audit.Recorder, logg *log.Logger, config *configs.Configuration) scim.Service {
+	return &scimService{
+		userRepository:    userRepo,
+		groupRepository:   groupRepo,
+		sessionRepository: sessionRepo,
+		patRepository:     patRepo,
+		audit:             recorder,
+		Logger:            logg,
+		issuerUrl:         strings.TrimSuffix(config.IssuerUrl, "/"),
+		groupRoles:        user.NewGroupRoles(config.ScimGroupRoles),
+	}
+}
+
+// filterPattern is the only filter the identity providers need, they look
+// for the resource by its name before creating it.
+var filterPattern = regexp.MustCompile(`^\s*(\w+)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseFilter parses `attribute eq "value"`, the attribute is returned in
+// lower case since SCIM ignores its case.
+func parseFilter(filter string) (string, string, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", errorhandler.Invalid(errorhandler.ErrInvalidScimFilter)
+	}
+
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", errorhandler.Invalid(errorhandler.ErrInvalidScimFilter)
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+// pageOf bounds the startIndex and count sent by the client.
+func pageOf(startIndex, count int) (int, int) {
+	return max(startIndex, 1), min(max(count, 0), scim.MaxCount)
+}
+
+// window is the page of the resources found by a filter.
+func window[T any](resources []T, startIndex, count int) []T {
+	start := min(startIndex-1, len(resources))
+	return resources[start:min(start+count, len(resources))]
+}
+
+func listResponse[T any](resources []T, total, startIndex int) *domain.ScimListResponse[T] {
+	return &domain.ScimListResponse[T]{
+		Schemas:      []string{domain.ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// record records the change of the user by the identity provider, as a
+// failure when err isn't nil.
+func (s *scimService) record(ctx context.Context, action, username string, err error) {
+	event := &audit.Event{Action: action, Actor: audit.ActorScim, Target: username}
+	if err != nil {
+		event = audit.Failure(event, err)
+	}
+	s.audit.Record(ctx, event)
+}
+
+// location is the url of the resource, it's left out without ISSUER_URL.
+func (s *scimService) location(path string) string {
+	if s.issuerUrl == "" {
+		return ""
+	}
+	return s.issuerUrl + scim.BasePath + path
+}
+
+// syncRoles sets the roles of the users to the ones of their groups, it's
+// only done when SCIM_GROUP_ROLES maps a group so the roles given some
+// other way are kept otherwise.
+func (s *scimService) syncRoles(ctx context.Context, userIds []int64) error {
+	if len(s.groupRoles) == 0 {
+		return nil
+	}
+
+	slices.Sort(userIds)
+	for _, userId := range slices.Compact(userIds) {
+		u, err := s.userRepository.FindUserById(ctx, userId)
+		if errors.Is(err, errorhandler.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		groups, err := s.groupRepository.FindGroupsOfUser(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(groups))
+		for _, g := range groups {
+			names = append(names, g.DisplayName)
+		}
+		if err := s.userRepository.UpdateRoles(ctx, *u.Username, s.groupRoles.Roles(names)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,566 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/auth"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim"
+	"github.com/rafaeldepontes/fauthless-go/internal/scim/server"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	"github.com/sirupsen/logrus"
+)
+
+const scimTokenMock = "scim-token"
+
+// userRepoMock keeps the users by id, the methods SCIM doesn't use are left
+// to the embedded interface.
+type userRepoMock struct {
+	user.Repository
+	users []*domain.User
+}
+
+func (mock *userRepoMock) find(match func(u *domain.User) bool) (*domain.User, error) {
+	for _, u := range mock.users {
+		if match(u) {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, errorhandler.ErrUserNotFound
+}
+
+func (mock *userRepoMock) FindUserById(ctx context.Context, id int64) (*domain.User, error) {
+	return mock.find(func(u *domain.User) bool { return *u.Id == id })
+}
+
+func (mock *userRepoMock) FindUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return mock.find(func(u *domain.User) bool { return *u.Username == username })
+}
+
+func (mock *userRepoMock) FindUsers(ctx context.Context, offset, limit int) ([]domain.User, int, error) {
+	users := []domain.User{}
+	for _, u := range mock.users[min(offset, len(mock.users)):min(offset+limit, len(mock.users))] {
+		users = append(users, *u)
+	}
+	return users, len(mock.users), nil
+}
+
+func (mock *userRepoMock) RegisterUser(ctx context.Context, u *domain.User) error {
+	id := int64(len(mock.users) + 1)
+	u.Id = &id
+	copied := *u
+	mock.users = append(mock.users, &copied)
+	return nil
+}
+
+func (mock *userRepoMock) UpdateUser(ctx context.Context, u *domain.User) error {
+	for _, stored := range mock.users {
+		if *stored.Id == *u.Id {
+			stored.Username, stored.Email, stored.Locked = u.Username, u.Email, u.Locked
+			return nil
+		}
+	}
+	return errorhandler.ErrUserNotFound
+}
+
+func (mock *userRepoMock) UpdateRoles(ctx context.Context, username string, roles []string) error {
+	for _, stored := range mock.users {
+		if *stored.Username == username {
+			stored.Roles = roles
+			return nil
+		}
+	}
+	return errorhandler.ErrUserNotFound
+}
+
+func (mock *userRepoMock) DeleteAccount(ctx context.Context, username string) error {
+	mock.users = slices.DeleteFunc(mock.users, func(u *domain.User) bool { return *u.Username == username })
+	return nil
+}
+
+type groupRepoMock struct {
+	groups []*domain.Group
+}
+
+func (mock *groupRepoMock) find(match func(g *domain.Group) bool) (*domain.Group, error) {
+	for _, g := range mock.groups {
+		if match(g) {
+			copied := *g
+			copied.Members = slices.Clone(g.Members)
+			return &copied, nil
+		}
+	}
+	return nil, errorhandler.ErrGroupNotFound
+}
+
+func (mock *groupRepoMock) FindGroups(ctx context.Context, offset, limit int) ([]domain.Group, int, error) {
+	groups := []domain.Group{}
+	for _, g := range mock.groups[min(offset, len(mock.groups)):min(offset+limit, len(mock.groups))] {
+		groups = append(groups, *g)
+	}
+	return groups, len(mock.groups), nil
+}
+
+func (mock *groupRepoMock) FindGroupById(ctx context.Context, id string) (*domain.Group, error) {
+	return mock.find(func(g *domain.Group) bool { return g.Id == id })
+}
+
+func (mock *groupRepoMock) FindGroupByName(ctx context.Context, displayName string) (*domain.Group, error) {
+	return mock.find(func(g *domain.Group) bool { return g.DisplayName == displayName })
+}
+
+func (mock *groupRepoMock) FindGroupByExternalId(ctx context.Context, externalId string) (*domain.Group, error) {
+	return mock.find(func(g *domain.Group) bool { return g.ExternalId != nil && *g.ExternalId == externalId })
+}
+
+func (mock *groupRepoMock) FindGroupsOfUser(ctx context.Context, userId int64) ([]domain.Group, error) {
+	groups := []domain.Group{}
+	for _, g := range mock.groups {
+		if slices.ContainsFunc(g.Members, func(m domain.GroupMember) bool { return m.UserId == userId }) {
+			groups = append(groups, domain.Group{Id: g.Id, DisplayName: g.DisplayName})
+		}
+	}
+	return groups, nil
+}
+
+func (mock *groupRepoMock) CreateGroup(ctx context.Context, g *domain.Group) error {
+	copied := *g
+	copied.Members = slices.Clone(g.Members)
+	mock.groups = append(mock.groups, &copied)
+	return nil
+}
+
+func (mock *groupRepoMock) UpdateGroup(ctx context.Context, g *domain.Group) error {
+	for i, stored := range mock.groups {
+		if stored.Id == g.Id {
+			copied := *g
+			copied.Members = slices.Clone(g.Members)
+			mock.groups[i] = &copied
+			return nil
+		}
+	}
+	return errorhandler.ErrGroupNotFound
+}
+
+func (mock *groupRepoMock) DeleteGroup(ctx context.Context, id string) error {
+	mock.groups = slices.DeleteFunc(mock.groups, func(g *domain.Group) bool { return g.Id == id })
+	return nil
+}
+
+type sessionRepoMock struct {
+	auth.Repository
+	revoked []string
+}
+
+func (mock *sessionRepoMock) RevokeUserSessions(ctx context.Context, username string) (int64, error) {
+	mock.revoked = append(mock.revoked, username)
+	return 1, nil
+}
+
+type patRepoMock struct {
+	auth.PersonalAccessTokenRepository
+	pats []domain.PersonalAccessToken
+}
+
+func (mock *patRepoMock) FindPersonalAccessTokensByUsername(ctx context.Context, username string) ([]domain.PersonalAccessToken, error) {
+	pats := []domain.PersonalAccessToken{}
+	for _, pat := range mock.pats {
+		if pat.Username == username {
+			pats = append(pats, pat)
+		}
+	}
+	return pats, nil
+}
+
+func (mock *patRepoMock) DeletePersonalAccessToken(ctx context.Context, id, username string) error {
+	mock.pats = slices.DeleteFunc(mock.pats, func(pat domain.PersonalAccessToken) bool { return pat.Id == id && pat.Username == username })
+	return nil
+}
+
+type recorderMock struct {
+	events []*audit.Event
+}
+
+func (mock *recorderMock) Record(ctx context.Context, event *audit.Event) {
+	mock.events = append(mock.events, event)
+}
+
+type mocks struct {
+	users    *userRepoMock
+	groups   *groupRepoMock
+	sessions *sessionRepoMock
+	pats     *patRepoMock
+	recorder *recorderMock
+}
+
+func prepareMocks(groupRoles ...string) (scim.Service, *mocks) {
+	m := &mocks{
+		users:    &userRepoMock{},
+		groups:   &groupRepoMock{},
+		sessions: &sessionRepoMock{},
+		pats:     &patRepoMock{},
+		recorder: &recorderMock{},
+	}
+	config := &configs.Configuration{IssuerUrl: "https://auth.example.com", ScimGroupRoles: groupRoles}
+	return NewScimService(m.users, m.groups, m.sessions, m.pats, m.recorder, logrus.New(), config), m
+}
+
+func ptrBool(b bool) *bool { return &b }
+
+func createUserMock(t *testing.T, service scim.Service, username string) *domain.ScimUser {
+	scimUser, err := service.CreateUser(context.Background(), &domain.ScimUser{
+		UserName: username,
+		Emails:   []domain.ScimEmail{{Value: username + "@example.com", Primary: true}},
+		Active:   ptrBool(true),
+		Password: "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scimUser
+}
+
+func patchMock(op, path, value string) *domain.ScimPatch {
+	return &domain.ScimPatch{
+		Schemas:    []string{domain.ScimPatchOpSchema},
+		Operations: []domain.ScimPatchOperation{{Op: op, Path: path, Value: json.RawMessage(value)}},
+	}
+}
+
+// TestScimUser verifies the identity provider creates, finds, deactivates
+// and deletes the users, without them ever getting a password.
+func TestScimUser(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, m := prepareMocks()
+
+	// when
+	alice := createUserMock(t, service, "alice")
+
+	// then
+	if alice.Id != "1" || alice.Meta.Location != "https://auth.example.com/scim/v2/Users/1" || !*alice.Active {
+		t.Fatalf("unexpected user: %+v", alice)
+	}
+	if *m.users.users[0].HashedPassword != domain.NoPassword {
+		t.Error("expected the user to have no password")
+	}
+
+	// when the identity provider looks for it
+	list, err := service.ListUsers(ctx, `userName eq "alice"`, 1, 100)
+
+	// then
+	if err != nil || list.TotalResults != 1 || list.Resources[0].Id != alice.Id {
+		t.Fatalf("expected alice to be found, got %+v %v", list, err)
+	}
+
+	// when it's created again
+	_, err = service.CreateUser(ctx, &domain.ScimUser{UserName: "alice"})
+
+	// then
+	if errorhandler.KindOf(err) != errorhandler.KindConflict {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+
+	// when it's deactivated, with the value some identity providers send
+	patched, err := service.PatchUser(ctx, alice.Id, patchMock("Replace", "", `{"active": "False"}`))
+
+	// then
+	if err != nil || *patched.Active || !m.users.users[0].Locked {
+		t.Fatalf("expected the user to be locked, got %+v %v", patched, err)
+	}
+
+	// when the email is replaced by its filter
+	patched, err = service.PatchUser(ctx, alice.Id, patchMock("replace", `emails[type eq "work"].value`, `"alice@corp.example.com"`))
+
+	// then
+	if err != nil || patched.Emails[0].Value != "alice@corp.example.com" {
+		t.Fatalf("expected the email to be replaced, got %+v %v", patched, err)
+	}
+
+	// when
+	err = service.DeleteUser(ctx, alice.Id)
+	_, getErr := service.GetUser(ctx, alice.Id)
+
+	// then
+	if err != nil || errorhandler.KindOf(getErr) != errorhandler.KindNotFound {
+		t.Errorf("expected the user to be deleted, got %v %v", err, getErr)
+	}
+}
+
+// TestScimUser_Deprovisioning verifies the users deactivated or deleted by
+// the identity provider lose their sessions and personal access tokens.
+func TestScimUser_Deprovisioning(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, m := prepareMocks()
+	alice := createUserMock(t, service, "alice")
+	bob := createUserMock(t, service, "bob")
+	carol := createUserMock(t, service, "carol")
+	m.pats.pats = []domain.PersonalAccessToken{
+		{Id: "alice-ci", Username: "alice"},
+		{Id: "bob-ci", Username: "bob"},
+		{Id: "carol-ci", Username: "carol"},
+	}
+
+	// when
+	_, patchErr := service.PatchUser(ctx, alice.Id, patchMock("replace", "active", "false"))
+	_, replaceErr := service.ReplaceUser(ctx, bob.Id, &domain.ScimUser{UserName: "robert", Active: ptrBool(false)})
+	deleteErr := service.DeleteUser(ctx, carol.Id)
+
+	// then
+	if patchErr != nil || replaceErr != nil || deleteErr != nil {
+		t.Fatalf("unexpected errors: %v %v %v", patchErr, replaceErr, deleteErr)
+	}
+	if !slices.Equal(m.sessions.revoked, []string{"alice", "bob", "carol"}) {
+		t.Errorf("expected the sessions to be revoked, got %v", m.sessions.revoked)
+	}
+	if len(m.pats.pats) != 0 {
+		t.Errorf("expected the personal access tokens to be deleted, got %v", m.pats.pats)
+	}
+
+	// when an active user is patched
+	dave := createUserMock(t, service, "dave")
+	_, err := service.PatchUser(ctx, dave.Id, patchMock("replace", "active", "true"))
+
+	// then
+	if err != nil || slices.Contains(m.sessions.revoked, "dave") {
+		t.Errorf("expected the sessions of the active user to be kept, got %v %v", m.sessions.revoked, err)
+	}
+
+	outcomes := []string{}
+	for _, event := range m.recorder.events {
+		if event.Actor != audit.ActorScim {
+			t.Fatalf("expected the events to be recorded for SCIM, got %+v", event)
+		}
+		outcomes = append(outcomes, event.Action+" "+event.Target)
+	}
+	want := []string{
+		"scim.user.create alice",
+		"scim.user.create bob",
+		"scim.user.create carol",
+		"scim.user.patch alice",
+		"scim.user.replace bob",
+		"scim.user.delete carol",
+		"scim.user.create dave",
+		"scim.user.patch dave",
+	}
+	if !slices.Equal(outcomes, want) {
+		t.Errorf("expected the audit events %v, got %v", want, outcomes)
+	}
+}
+
+// TestScimListUsers verifies the 1-based pagination and the filters that
+// aren't supported.
+func TestScimListUsers(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, _ := prepareMocks()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		createUserMock(t, service, username)
+	}
+
+	// when
+	list, err := service.ListUsers(ctx, "", 2, 1)
+
+	// then
+	if err != nil || list.TotalResults != 3 || list.StartIndex != 2 || list.ItemsPerPage != 1 || list.Resources[0].UserName != "bob" {
+		t.Fatalf("expected the second page of one user, got %+v %v", list, err)
+	}
+
+	// when
+	_, err = service.ListUsers(ctx, `userName co "a"`, 1, 100)
+
+	// then
+	if errorhandler.KindOf(err) != errorhandler.KindInvalid || !errors.Is(err, errorhandler.ErrInvalidScimFilter) {
+		t.Errorf("expected an invalid filter, got %v", err)
+	}
+}
+
+// TestScimGroupRoles verifies the members get the roles of their groups
+// and lose them when they're removed.
+func TestScimGroupRoles(t *testing.T) {
+	// given
+	ctx := context.Background()
+	service, m := prepareMocks("engineering=admin")
+	alice := createUserMock(t, service, "alice")
+	bob := createUserMock(t, service, "bob")
+
+	// when
+	group, err := service.CreateGroup(ctx, &domain.ScimGroup{
+		DisplayName: "Engineering",
+		Members:     []domain.ScimMember{{Value: alice.Id}},
+	})
+
+	// then
+	if err != nil || !slices.Equal(m.users.users[0].Roles, []string{domain.RoleAdmin}) {
+		t.Fatalf("expected alice to be admin, got %v %v", m.users.users[0].Roles, err)
+	}
+
+	// when bob is added and alice removed
+	if _, err := service.PatchGroup(ctx, group.Id, patchMock("add", "members", `[{"value": "`+bob.Id+`"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	patched, err := service.PatchGroup(ctx, group.Id, patchMock("remove", `members[value eq "`+alice.Id+`"]`, ""))
+
+	// then
+	if err != nil || len(patched.Members) != 1 || patched.Members[0].Display != "bob" {
+		t.Fatalf("expected only bob in the group, got %+v %v", patched, err)
+	}
+	if len(m.users.users[0].Roles) != 0 || !slices.Equal(m.users.users[1].Roles, []string{domain.RoleAdmin}) {
+		t.Errorf("expected the role to move to bob, got %v and %v", m.users.users[0].Roles, m.users.users[1].Roles)
+	}
+
+	// when
+	user, _ := service.GetUser(ctx, bob.Id)
+
+	// then
+	if len(user.Groups) != 1 || user.Groups[0].Value != group.Id {
+		t.Errorf("expected the group of bob, got %+v", user.Groups)
+	}
+
+	// when a member that isn't a user is added
+	_, err = service.PatchGroup(ctx, group.Id, patchMock("add", "members", `[{"value": "42"}]`))
+
+	// then
+	if !errors.Is(err, errorhandler.ErrInvalidScimMember) {
+		t.Errorf("expected an invalid member, got %v", err)
+	}
+
+	// when
+	err = service.DeleteGroup(ctx, group.Id)
+
+	// then
+	if err != nil || len(m.users.users[1].Roles) != 0 {
+		t.Errorf("expected bob to lose the role, got %v %v", m.users.users[1].Roles, err)
+	}
+}
+
+// TestScimAuthenticated verifies the endpoints only answer the bearer
+// token of the identity provider, with the SCIM errors.
+func TestScimAuthenticated(t *testing.T) {
+	// given
+	service, _ := prepareMocks()
+	controller := server.NewScimController(&service)
+	m := &middleware.Middleware{ScimToken: scimTokenMock}
+
+	r := chi.NewRouter()
+	r.Route(scim.BasePath, func(r chi.Router) {
+		r.Use(m.ScimAuthenticated)
+		server.MapScimRoutes(&r, &controller)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "wrong token", token: "Bearer other", status: http.StatusUnauthorized},
+		{name: "token", token: "Bearer " + scimTokenMock, status: http.StatusCreated},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			req := httptest.NewRequest(http.MethodPost, scim.BasePath+"/Users", strings.NewReader(`{"userName": "user`+strconv.Itoa(i)+`"}`))
+			req.Header.Set("Authorization", tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			// then
+			if w.Code != tt.status || w.Header().Get("Content-Type") != "application/scim+json" {
+				t.Errorf("expected %d with a SCIM body, got %d %v", tt.status, w.Code, w.Header())
+			}
+		})
+	}
+}
+
+// organizationRepoMock finds the organizations by slug, the methods the
+// resolver doesn't use are left to the embedded interface.
+type organizationRepoMock struct {
+	tenant.Repository
+	orgs []*domain.Organization
+}
+
+func (mock *organizationRepoMock) FindOrganizationBySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	for _, org := range mock.orgs {
+		if org.Slug == slug {
+			return org, nil
+		}
+	}
+	return nil, errorhandler.ErrOrganizationNotFound
+}
+
+func (mock *organizationRepoMock) FindOrganizationByHost(ctx context.Context, host string) (*domain.Organization, error) {
+	return nil, errorhandler.ErrOrganizationNotFound
+}
+
+// TestScimAuthenticated_Organizations verifies each organization has its
+// own token, which doesn't work in the others, and the requests that name
+// no organization are of the one of their token.
+func TestScimAuthenticated_Organizations(t *testing.T) {
+	// given
+	m := middleware.NewMiddleware(&configs.Configuration{ScimToken: scimTokenMock, ScimOrgTokens: []string{"acme=acme-token"}}, nil, nil, nil)
+	m.Tenants = tenant.NewResolver(&organizationRepoMock{orgs: []*domain.Organization{
+		{Id: tenant.DefaultId, Slug: tenant.DefaultSlug},
+		{Id: 2, Slug: "acme"},
+		{Id: 3, Slug: "globex"},
+	}}, "X-Tenant")
+
+	r := chi.NewRouter()
+	r.Use(m.Tenant)
+	r.Route(scim.BasePath, func(r chi.Router) {
+		r.Use(m.ScimAuthenticated)
+		r.Get("/Users", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strconv.FormatInt(tenant.IdFrom(r.Context()), 10)))
+		})
+	})
+
+	tests := []struct {
+		name   string
+		slug   string
+		token  string
+		status int
+		orgId  string
+	}{
+		{name: "default organization", token: scimTokenMock, status: http.StatusOK, orgId: "1"},
+		{name: "organization of the token", token: "acme-token", status: http.StatusOK, orgId: "2"},
+		{name: "organization named", slug: "acme", token: "acme-token", status: http.StatusOK, orgId: "2"},
+		{name: "default token in an organization", slug: "acme", token: scimTokenMock, status: http.StatusUnauthorized},
+		{name: "token of another organization", slug: tenant.DefaultSlug, token: "acme-token", status: http.StatusUnauthorized},
+		{name: "organization without a token", slug: "globex", token: "acme-token", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			req := httptest.NewRequest(http.MethodGet, scim.BasePath+"/Users", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.slug != "" {
+				req.Header.Set("X-Tenant", tt.slug)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			// then
+			if w.Code != tt.status || (tt.status == http.StatusOK && w.Body.String() != tt.orgId) {
+				t.Errorf("expected %d in the organization %v, got %d %v", tt.status, tt.orgId, w.Code, w.Body.String())
+			}
+		})
+	}
+}
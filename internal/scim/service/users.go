@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// ListUsers lists the users by id, the filter can only be on the userName.
+func (s *scimService) ListUsers(ctx context.Context, filter string, startIndex, count int) (*domain.ScimListResponse[domain.ScimUser], error) {
+	startIndex, count = pageOf(startIndex, count)
+
+	var (
+		users []domain.User
+		total int
+	)
+	if filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if attribute != "username" {
+			return nil, errorhandler.Invalid(errorhandler.ErrInvalidScimFilter)
+		}
+
+		if u, err := s.userRepository.FindUserByUsername(ctx, value); err == nil {
+			users = append(users, *u)
+		}
+		total = len(users)
+		users = window(users, startIndex, count)
+	} else {
+		var err error
+		users, total, err = s.userRepository.FindUsers(ctx, startIndex-1, count)
+		if err != nil {
+			s.Logger.Errorf("An error occurred: %v", err)
+			return nil, err
+		}
+	}
+
+	resources := make([]domain.ScimUser, 0, len(users))
+	for i := range users {
+		scimUser, err := s.toScimUser(ctx, &users[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *scimUser)
+	}
+	return listResponse(resources, total, startIndex), nil
+}
+
+func (s *scimService) GetUser(ctx context.Context, id string) (*domain.ScimUser, error) {
+	u, err := s.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toScimUser(ctx, u)
+}
+
+// CreateUser creates the user without a password, it logs in through the
+// identity provider. The password SCIM may send is ignored.
+func (s *scimService) CreateUser(ctx context.Context, in *domain.ScimUser) (*domain.ScimUser, error) {
+	if in.UserName == "" {
+		return nil, errorhandler.Invalid(errorhandler.ErrUsernameIsRequired)
+	}
+
+	email, err := primaryEmail(in.Emails)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUsernameFree(ctx, in.UserName); err != nil {
+		return nil, err
+	}
+
+	age := 0
+	password := domain.NoPassword
+	username := in.UserName
+	u := &domain.User{
+		Username:       &username,
+		HashedPassword: &password,
+		Age:            &age,
+		Email:          email,
+		Locked:         in.Active != nil && !*in.Active,
+	}
+	if err := s.userRepository.RegisterUser(ctx, u); err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		s.record(ctx, audit.ActionScimUserCreated, username, err)
+		return nil, err
+	}
+
+	// the users are registered unlocked
+	if u.Locked {
+		if err := s.userRepository.UpdateUser(ctx, u); err != nil {
+			s.record(ctx, audit.ActionScimUserCreated, username, err)
+			return nil, err
+		}
+	}
+	s.record(ctx, audit.ActionScimUserCreated, username, nil)
+
+	s.Logger.Infof("SCIM created the user %v", username)
+	return s.toScimUser(ctx, u)
+}
+
+// ReplaceUser replaces the username, email and active of the user, a user
+// without active is active. An inactive user loses its sessions and
+// personal access tokens.
+func (s *scimService) ReplaceUser(ctx context.Context, id string, in *domain.ScimUser) (*domain.ScimUser, error) {
+	u, err := s.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *u.Username
+
+	if in.UserName == "" {
+		return nil, errorhandler.Invalid(errorhandler.ErrUsernameIsRequired)
+	}
+	if in.UserName != *u.Username {
+		if err := s.checkUsernameFree(ctx, in.UserName); err != nil {
+			return nil, err
+		}
+	}
+
+	email, err := primaryEmail(in.Emails)
+	if err != nil {
+		return nil, err
+	}
+
+	username := in.UserName
+	u.Username = &username
+	u.Email = email
+	u.Locked = in.Active != nil && !*in.Active
+
+	err = s.userRepository.UpdateUser(ctx, u)
+	if err == nil && u.Locked {
+		err = s.revokeTokens(ctx, previous)
+	}
+	s.record(ctx, audit.ActionScimUserReplaced, previous, err)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	s.Logger.Infof("SCIM replaced the user %v", username)
+	return s.toScimUser(ctx, u)
+}
+
+// PatchUser applies the operations to the user, the identity providers
+// deactivate the users with them instead of deleting. Like ReplaceUser, an
+// inactive user loses its sessions and personal access tokens.
+func (s *scimService) PatchUser(ctx context.Context, id string, patch *domain.ScimPatch) (*domain.ScimUser, error) {
+	u, err := s.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *u.Username
+
+	err = eachPatchValue(patch, func(op, path string, value json.RawMessage) error {
+		return s.patchUserAttribute(ctx, u, op, path, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepository.UpdateUser(ctx, u)
+	if err == nil && u.Locked {
+		err = s.revokeTokens(ctx, previous)
+	}
+	s.record(ctx, audit.ActionScimUserPatched, previous, err)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return nil, err
+	}
+
+	s.Logger.Infof("SCIM patched the user %v", *u.Username)
+	return s.toScimUser(ctx, u)
+}
+
+// DeleteUser deletes the user after revoking its sessions and personal
+// access tokens, they only have its username.
+func (s *scimService) DeleteUser(ctx context.Context, id string) error {
+	u, err := s.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeTokens(ctx, *u.Username)
+	if err == nil {
+		err = s.userRepository.DeleteAccount(ctx, *u.Username)
+	}
+	s.record(ctx, audit.ActionScimUserDeleted, *u.Username, err)
+	if err != nil {
+		s.Logger.Errorf("An error occurred: %v", err)
+		return err
+	}
+
+	s.Logger.Infof("SCIM deleted the user %v", *u.Username)
+	return nil
+}
+
+// patchUserAttribute changes the attribute of the path, the ones that
+// aren't kept, like the name, are ignored.
+func (s *scimService) patchUserAttribute(ctx context.Context, u *domain.User, op, path string, value json.RawMessage) error {
+	attribute := strings.ToLower(path)
+	switch {
+	case attribute == "active":
+		if op == patchRemove {
+			u.Locked = false
+			return nil
+		}
+		active, err := patchBool(value)
+		if err != nil {
+			return err
+		}
+		u.Locked = !active
+	case attribute == "username":
+		if op == patchRemove {
+			return errorhandler.Invalid(errorhandler.ErrUsernameIsRequired)
+		}
+		var username string
+		if err := json.Unmarshal(value, &username); err != nil || username == "" {
+			return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+		}
+		if username != *u.Username {
+			if err := s.checkUsernameFree(ctx, username); err != nil {
+				return err
+			}
+		}
+		u.Username = &username
+	case strings.HasPrefix(attribute, "emails"):
+		if op == patchRemove {
+			u.Email = nil
+			return nil
+		}
+		// the list of emails, or the value of one like emails[type eq "work"].value
+		var emails []domain.ScimEmail
+		if err := json.Unmarshal(value, &emails); err != nil {
+			var email string
+			if err := json.Unmarshal(value, &email); err != nil {
+				return errorhandler.Invalid(errorhandler.ErrInvalidScimPatch)
+			}
+			emails = []domain.ScimEmail{{Value: email}}
+		}
+		email, err := primaryEmail(emails)
+		if err != nil {
+			return err
+		}
+		u.Email = email
+	}
+	return nil
+}
+
+// revokeTokens revokes the sessions and deletes the personal access tokens
+// the user has in the organization of the context.
+func (s *scimService) revokeTokens(ctx context.Context, username string) error {
+	if _, err := s.sessionRepository.RevokeUserSessions(ctx, username); err != nil {
+		return err
+	}
+
+	pats, err := s.patRepository.FindPersonalAccessTokensByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	for _, pat := range pats {
+		if err := s.patRepository.DeletePersonalAccessToken(ctx, pat.Id, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findUser returns the user with the SCIM id, it's the id of the users
+// table.
+func (s *scimService) findUser(ctx context.Context, id string) (*domain.User, error) {
+	userId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errorhandler.NotFound(errorhandler.ErrUserNotFound)
+	}
+
+	found, err := s.userRepository.FindUserById(ctx, userId)
+	if errors.Is(err, errorhandler.ErrUserNotFound) {
+		return nil, errorhandler.NotFound(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// FindUserById leaves out the email, roles and lock
+	return s.userRepository.FindUserByUsername(ctx, *found.Username)
+}
+
+func (s *scimService) checkUsernameFree(ctx context.Context, username string) error {
+	if existing, err := s.userRepository.FindUserByUsername(ctx, username); err == nil && existing != nil {
+		return errorhandler.Conflict(errorhandler.ErrUserAlreadyExists)
+	}
+	return nil
+}
+
+func (s *scimService) toScimUser(ctx context.Context, u *domain.User) (*domain.ScimUser, error) {
+	id := strconv.FormatInt(*u.Id, 10)
+	active := !u.Locked
+	scimUser := &domain.ScimUser{
+		Schemas:  []string{domain.ScimUserSchema},
+		Id:       id,
+		UserName: *u.Username,
+		Active:   &active,
+		Meta:     &domain.ScimMeta{ResourceType: "User", Location: s.location("/Users/" + id)},
+	}
+	if u.Email != nil && *u.Email != "" {
+		scimUser.Emails = []domain.ScimEmail{{Value: *u.Email, Primary: true}}
+	}
+
+	groups, err := s.groupRepository.FindGroupsOfUser(ctx, *u.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		scimUser.Groups = append(scimUser.Groups, domain.ScimMember{
+			Value:   g.Id,
+			Display: g.DisplayName,
+			Ref:     s.location("/Groups/" + g.Id),
+		})
+	}
+	return scimUser, nil
+}
+
+// primaryEmail is the only email the users table keeps, the primary one or
+// else the first.
+func primaryEmail(emails []domain.ScimEmail) (*string, error) {
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	email := emails[0].Value
+	for _, e := range emails {
+		if e.Primary {
+			email = e.Value
+		}
+	}
+	if email == "" {
+		return nil, nil
+	}
+
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, errorhandler.Invalid(errorhandler.ErrInvalidEmail)
+	}
+	return &email, nil
+}
@@ -0,0 +1,16 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+type Repository interface {
+	FindOrganizations(ctx context.Context) ([]domain.Organization, error)
+	FindOrganizationById(ctx context.Context, id int64) (*domain.Organization, error)
+	FindOrganizationBySlug(ctx context.Context, slug string) (*domain.Organization, error)
+	FindOrganizationByHost(ctx context.Context, host string) (*domain.Organization, error)
+	CreateOrganization(ctx context.Context, org *domain.Organization) error
+	UpdateOrganization(ctx context.Context, org *domain.Organization) error
+}
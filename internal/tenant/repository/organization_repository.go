@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+const organizationColumns = `id, slug, name, host, auth_modes, password_min_length, access_token_seconds, refresh_token_seconds`
+
+type organizationRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewOrganizationRepository initialize a new OrganizationRepository
+// containing a database connection.
+func NewOrganizationRepository(conn *sql.DB, queryTimeout time.Duration) tenant.Repository {
+	return &organizationRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// FindOrganizations lists every organization by id, returns an error if
+// any.
+func (repo *organizationRepository) FindOrganizations(ctx context.Context) ([]domain.Organization, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	rows, err := repo.db.QueryContext(ctx, `SELECT `+organizationColumns+` FROM organizations ORDER BY id ASC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []domain.Organization{}
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+// FindOrganizationById returns the organization, or ErrOrganizationNotFound.
+func (repo *organizationRepository) FindOrganizationById(ctx context.Context, id int64) (*domain.Organization, error) {
+	return repo.findOrganization(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE id = $1;`, id)
+}
+
+// FindOrganizationBySlug returns the organization, or
+// ErrOrganizationNotFound.
+func (repo *organizationRepository) FindOrganizationBySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	return repo.findOrganization(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE slug = $1;`, slug)
+}
+
+// FindOrganizationByHost returns the organization served at the host, or
+// ErrOrganizationNotFound.
+func (repo *organizationRepository) FindOrganizationByHost(ctx context.Context, host string) (*domain.Organization, error) {
+	return repo.findOrganization(ctx, `SELECT `+organizationColumns+` FROM organizations WHERE host = $1;`, host)
+}
+
+// CreateOrganization saves a new organization and sets its id, returns
+// ErrOrganizationAlreadyExists when the slug or host is taken.
+func (repo *organizationRepository) CreateOrganization(ctx context.Context, org *domain.Organization) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var exists bool
+	err := repo.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE slug = $1 OR host = $2);`, org.Slug, org.Host).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errorhandler.ErrOrganizationAlreadyExists
+	}
+
+	query := `
+		INSERT INTO organizations (slug, name, host, auth_modes, password_min_length, access_token_seconds, refresh_token_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id;
+	`
+	settings := org.Settings
+	return repo.db.QueryRowContext(ctx, query,
+		org.Slug, org.Name, org.Host,
+		strings.Join(settings.AuthModes, " "),
+		settings.PasswordMinLength,
+		int64(settings.AccessTokenDuration.Seconds()),
+		int64(settings.RefreshTokenDuration.Seconds()),
+	).Scan(&org.Id)
+}
+
+// UpdateOrganization replaces the name, host and settings of the
+// organization, returns ErrOrganizationNotFound when there's none with the
+// id.
+func (repo *organizationRepository) UpdateOrganization(ctx context.Context, org *domain.Organization) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE organizations
+	SET name = $1, host = $2, auth_modes = $3, password_min_length = $4,
+	access_token_seconds = $5, refresh_token_seconds = $6
+	WHERE id = $7
+	`
+	settings := org.Settings
+	result, err := repo.db.ExecContext(ctx, query,
+		org.Name, org.Host,
+		strings.Join(settings.AuthModes, " "),
+		settings.PasswordMinLength,
+		int64(settings.AccessTokenDuration.Seconds()),
+		int64(settings.RefreshTokenDuration.Seconds()),
+		org.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrOrganizationNotFound
+	}
+	return nil
+}
+
+func (repo *organizationRepository) findOrganization(ctx context.Context, query string, arg any) (*domain.Organization, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	org, err := scanOrganization(repo.db.QueryRowContext(ctx, query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errorhandler.ErrOrganizationNotFound
+	}
+	return org, err
+}
+
+// scanOrganization reads the organizationColumns of a row.
+func scanOrganization(row interface{ Scan(dest ...any) error }) (*domain.Organization, error) {
+	var (
+		org                           domain.Organization
+		authModes                     string
+		accessSeconds, refreshSeconds int64
+	)
+	err := row.Scan(&org.Id, &org.Slug, &org.Name, &org.Host, &authModes, &org.Settings.PasswordMinLength, &accessSeconds, &refreshSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Settings.AuthModes = strings.Fields(authModes)
+	org.Settings.AccessTokenDuration = time.Duration(accessSeconds) * time.Second
+	org.Settings.RefreshTokenDuration = time.Duration(refreshSeconds) * time.Second
+	return &org, nil
+}
@@ -0,0 +1,92 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/cache"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+// CacheDuration is how long a resolved organization is kept, a change of
+// its settings takes up to it to apply.
+const CacheDuration = time.Minute
+
+// Resolver finds the organization of the requests, by the slug sent in
+// Header or else by the host.
+type Resolver struct {
+	Header     string
+	repository Repository
+	cache      *cache.Cache[string, *domain.Organization]
+}
+
+func NewResolver(repository Repository, header string) *Resolver {
+	return &Resolver{
+		Header:     header,
+		repository: repository,
+		cache:      cache.NewCache[string, *domain.Organization](),
+	}
+}
+
+// Resolve returns the organization of the slug, or else the one of the
+// host, it's nil when the request names none. An unknown slug is
+// ErrOrganizationNotFound, an unknown host is just no organization.
+func (res *Resolver) Resolve(ctx context.Context, slug, host string) (*domain.Organization, error) {
+	if slug != "" {
+		org, err := res.BySlug(ctx, slug)
+		if err == nil && org == nil {
+			return nil, errorhandler.ErrOrganizationNotFound
+		}
+		return org, err
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if host == "" {
+		return nil, nil
+	}
+
+	host = strings.ToLower(host)
+	return res.lookup("host:"+host, func() (*domain.Organization, error) {
+		return res.repository.FindOrganizationByHost(ctx, host)
+	})
+}
+
+// BySlug returns the organization of the slug, nil when there's none.
+func (res *Resolver) BySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	return res.lookup("slug:"+slug, func() (*domain.Organization, error) {
+		return res.repository.FindOrganizationBySlug(ctx, slug)
+	})
+}
+
+// ById returns the organization of the id, nil when there's none.
+func (res *Resolver) ById(ctx context.Context, id int64) (*domain.Organization, error) {
+	return res.lookup("id:"+strconv.FormatInt(id, 10), func() (*domain.Organization, error) {
+		return res.repository.FindOrganizationById(ctx, id)
+	})
+}
+
+// lookup caches what find returns, the misses too so an unknown host
+// doesn't query the database on every request.
+func (res *Resolver) lookup(key string, find func() (*domain.Organization, error)) (*domain.Organization, error) {
+	if org, ok := res.cache.Get(key); ok {
+		return org, nil
+	}
+
+	org, err := find()
+	if errors.Is(err, errorhandler.ErrOrganizationNotFound) {
+		org, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res.cache.Set(key, org, time.Now().Add(CacheDuration))
+	return org, nil
+}
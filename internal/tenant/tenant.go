@@ -0,0 +1,102 @@
+// Package tenant keeps the organization of the request in the context, the
+// repositories scope their queries by it.
+package tenant
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// DefaultId is the organization of the users created before there were
+// organizations and of the requests that don't name any.
+const DefaultId int64 = 1
+
+// DefaultSlug is the slug of the DefaultId organization.
+const DefaultSlug = "default"
+
+type contextKey struct{}
+
+// WithOrganization returns the context of the requests of the organization.
+func WithOrganization(ctx context.Context, org *domain.Organization) context.Context {
+	return context.WithValue(ctx, contextKey{}, org)
+}
+
+// FromContext returns the organization resolved for the request, there's
+// none when the request didn't name one.
+func FromContext(ctx context.Context) (*domain.Organization, bool) {
+	org, ok := ctx.Value(contextKey{}).(*domain.Organization)
+	return org, ok && org != nil
+}
+
+// IdFrom returns the id of the organization of the context, DefaultId when
+// there's none.
+func IdFrom(ctx context.Context) int64 {
+	if org, ok := FromContext(ctx); ok {
+		return org.Id
+	}
+	return DefaultId
+}
+
+// Matches tells if a token with the tid claim was issued by the
+// organization of the context, a token without it is of DefaultId.
+func Matches(ctx context.Context, tid int64) bool {
+	return OfClaim(tid) == IdFrom(ctx)
+}
+
+// OfClaim is the organization of the tid claim, DefaultId when it's empty.
+func OfClaim(tid int64) int64 {
+	if tid == 0 {
+		return DefaultId
+	}
+	return tid
+}
+
+// Key scopes a cache key by the organization of the context, the keys of
+// the default organization are left as they are.
+func Key(ctx context.Context, key string) string {
+	if id := IdFrom(ctx); id != DefaultId {
+		return strconv.FormatInt(id, 10) + ":" + key
+	}
+	return key
+}
+
+// AllowsMode tells if the organization lets its users log in with the
+// mode, every mode of the server is allowed when it doesn't restrict them.
+func AllowsMode(ctx context.Context, mode string) bool {
+	org, ok := FromContext(ctx)
+	if !ok || len(org.Settings.AuthModes) == 0 {
+		return true
+	}
+	return slices.Contains(org.Settings.AuthModes, mode)
+}
+
+// PasswordMinLength is the minimum length of the passwords, the one of the
+// organization or else serverMin.
+func PasswordMinLength(ctx context.Context, serverMin int) int {
+	if org, ok := FromContext(ctx); ok && org.Settings.PasswordMinLength > 0 {
+		return org.Settings.PasswordMinLength
+	}
+	return serverMin
+}
+
+// AccessTokenDuration is how long the access tokens last, the duration of
+// the organization or else serverDuration.
+func AccessTokenDuration(ctx context.Context, serverDuration time.Duration) time.Duration {
+	if org, ok := FromContext(ctx); ok && org.Settings.AccessTokenDuration > 0 {
+		return org.Settings.AccessTokenDuration
+	}
+	return serverDuration
+}
+
+// RefreshTokenDuration is how long the refresh tokens last, the duration
+// of the organization or else serverDuration.
+func RefreshTokenDuration(ctx context.Context, serverDuration time.Duration) time.Duration {
+	if org, ok := FromContext(ctx); ok && org.Settings.RefreshTokenDuration > 0 {
+		return org.Settings.RefreshTokenDuration
+	}
+	return serverDuration
+}
@@ -0,0 +1,157 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+const (
+	DPoPHeader    = "DPoP"
+	DPoPScheme    = "DPoP"
+	DPoPProofType = "dpop+jwt"
+	// DPoPProofLifetime is how old a proof can be, its jti is kept in the
+	// replay cache for the same time.
+	DPoPProofLifetime = time.Minute
+	DPoPClockSkew     = 5 * time.Second
+)
+
+// Only asymmetric algorithms, the proof is signed by the client key.
+var dpopAlgs = []string{"ES256", "ES384", "RS256", "PS256"}
+
+type DPoPProofClaims struct {
+	jwt.RegisteredClaims
+	Htm string `json:"htm"`
+	Htu string `json:"htu"`
+	Ath string `json:"ath,omitempty"`
+}
+
+// DPoPProof is a verified proof, Thumbprint identifies the key that signed
+// it and is what the tokens are bound to (cnf.jkt).
+type DPoPProof struct {
+	Claims     *DPoPProofClaims
+	Thumbprint string
+}
+
+// VerifyDPoPProof verifies a RFC 9449 proof sent in the DPoP header against
+// the method and url of the request. When the proof comes with an access
+// token its ath must be the hash of that token. Replays aren't checked here,
+// the caller keeps the jti.
+func VerifyDPoPProof(proof, htm, htu, accessToken string) (*DPoPProof, error) {
+	var (
+		claims DPoPProofClaims
+		jwk    domain.JSONWebKey
+	)
+
+	parser := jwt.NewParser(jwt.WithValidMethods(dpopAlgs))
+	_, err := parser.ParseWithClaims(proof, &claims, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != DPoPProofType {
+			return nil, errorhandler.ErrInvalidDPoPProof
+		}
+
+		rawJwk, ok := t.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errorhandler.ErrInvalidDPoPProof
+		}
+
+		// The header must only carry the public key.
+		if _, private := rawJwk["d"]; private {
+			return nil, errorhandler.ErrInvalidDPoPProof
+		}
+
+		data, _ := json.Marshal(rawJwk)
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, errorhandler.ErrInvalidDPoPProof
+		}
+
+		return PublicKey(jwk)
+	})
+	if err != nil {
+		return nil, errorhandler.ErrInvalidDPoPProof
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil || claims.Htm != htm || !sameHtu(claims.Htu, htu) {
+		return nil, errorhandler.ErrInvalidDPoPProof
+	}
+
+	now := time.Now()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.After(now.Add(DPoPClockSkew)) || issuedAt.Before(now.Add(-DPoPProofLifetime)) {
+		return nil, errorhandler.ErrInvalidDPoPProof
+	}
+
+	if accessToken != "" && claims.Ath != AccessTokenHash(accessToken) {
+		return nil, errorhandler.ErrInvalidDPoPProof
+	}
+
+	return &DPoPProof{Claims: &claims, Thumbprint: Thumbprint(jwk)}, nil
+}
+
+// AccessTokenHash is the ath claim of the proofs sent with an access token.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey converts a RSA or EC (P-256, P-384) JWK into its public key.
+func PublicKey(jwk domain.JSONWebKey) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errorhandler.ErrInvalidSigningKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, errorhandler.ErrInvalidSigningKey
+		}
+
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, errorhandler.ErrInvalidSigningKey
+		}
+
+		point := append([]byte{4}, append(x, y...)...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	default:
+		return nil, errorhandler.ErrInvalidSigningKey
+	}
+}
+
+// sameHtu compares the urls ignoring the query and fragment, as RFC 9449
+// section 4.3 says.
+func sameHtu(proofHtu, requestHtu string) bool {
+	proofUrl, err := url.Parse(proofHtu)
+	if err != nil {
+		return false
+	}
+	requestUrl, err := url.Parse(requestHtu)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(proofUrl.Scheme, requestUrl.Scheme) &&
+		strings.EqualFold(proofUrl.Host, requestUrl.Host) &&
+		proofUrl.Path == requestUrl.Path
+}
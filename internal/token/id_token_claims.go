@@ -0,0 +1,41 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AmrPassword     = "pwd"
+	AmrFederated    = "fed" // logged in at an identity provider, like SAML
+	AcrSingleFactor = "urn:fauthless:acr:single-factor"
+)
+
+type IdTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	Amr      []string         `json:"amr,omitempty"`
+	Acr      string           `json:"acr,omitempty"`
+	Azp      string           `json:"azp,omitempty"`
+}
+
+// NewIdTokenClaims creates the claims of an OpenID Connect ID token issued
+// to the client (audience) about the subject.
+func NewIdTokenClaims(issuer, subject, clientId, nonce string, authTime time.Time, amr []string, duration time.Duration) *IdTokenClaims {
+	return &IdTokenClaims{
+		Nonce:    nonce,
+		AuthTime: jwt.NewNumericDate(authTime),
+		Amr:      amr,
+		Acr:      AcrSingleFactor,
+		Azp:      clientId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{clientId},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+		},
+	}
+}
@@ -8,23 +8,43 @@ import (
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
 )
 
+// AccessTokenType is the typ header of the access tokens signed by a
+// KeySet (RFC 9068), the ID tokens signed by the same keys don't have it.
+const AccessTokenType = "at+jwt"
+
 type JwtBuilder struct {
 	secretKey string
+	issuer    string
+	// keySet signs the access tokens when it's set, so the other services
+	// can verify them with the jwks_uri.
+	keySet *KeySet
+}
+
+func NewJwtBuilder(secretKey, issuer string) *JwtBuilder {
+	return &JwtBuilder{secretKey: secretKey, issuer: issuer}
+}
+
+// WithKeySet returns a copy of the builder that signs the access tokens
+// with the active key of the set (RS256) and verifies them with any of
+// its keys. The refresh tokens are still signed with the secret key.
+func (builder JwtBuilder) WithKeySet(keySet *KeySet) *JwtBuilder {
+	builder.keySet = keySet
+	return &builder
 }
 
-func NewJwtBuilder(secretKey string) *JwtBuilder {
-	return &JwtBuilder{secretKey}
+// NewUserClaims creates the claims of a token issued by this builder.
+func (builder JwtBuilder) NewUserClaims(id int64, username string, duration time.Duration) (*UserClaims, error) {
+	return NewUserClaims(id, username, builder.issuer, duration)
 }
 
 func (builder JwtBuilder) GenerateToken(id int64, username string, duration time.Duration) (string, *UserClaims, error) {
 	var userClaims *UserClaims
-	userClaims, err := NewUserClaims(id, username, duration)
+	userClaims, err := builder.NewUserClaims(id, username, duration)
 	if err != nil {
 		return "", nil, err
 	}
 
-	var tokenJwt *jwt.Token = jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims)
-	token, err := tokenJwt.SignedString([]byte(builder.secretKey))
+	token, err := builder.SignClaims(userClaims)
 	if err != nil {
 		return "", nil, err
 	}
@@ -32,15 +52,38 @@ func (builder JwtBuilder) GenerateToken(id int64, username string, duration time
 	return token, userClaims, nil
 }
 
+// SignClaims signs any set of claims with the builder secret key, it's
+// used when the caller needs to fill the claims by itself before signing
+// them (scopes, audience...).
+func (builder JwtBuilder) SignClaims(claims jwt.Claims) (string, error) {
+	var tokenJwt *jwt.Token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return tokenJwt.SignedString([]byte(builder.secretKey))
+}
+
+// SignAccessClaims signs the claims of an access token, with the key set
+// when the builder has one and like SignClaims otherwise.
+func (builder JwtBuilder) SignAccessClaims(claims jwt.Claims) (string, error) {
+	if builder.keySet == nil {
+		return builder.SignClaims(claims)
+	}
+	return builder.keySet.sign(claims, AccessTokenType)
+}
+
 func (builder JwtBuilder) VerifyToken(token string) (*UserClaims, error) {
 	userClaims := &UserClaims{}
 	var tokenJwt *jwt.Token
 	tokenJwt, err := jwt.ParseWithClaims(token, userClaims, func(t *jwt.Token) (any, error) {
-		_, ok := t.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, errorhandler.ErrInvalidTokenSigningMethod
+		switch t.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			return []byte(builder.secretKey), nil
+		case *jwt.SigningMethodRSA:
+			// only the access tokens, the ID tokens are signed by the same keys
+			if builder.keySet == nil || t.Header["typ"] != AccessTokenType {
+				return nil, errorhandler.ErrInvalidTokenSigningMethod
+			}
+			return builder.keySet.publicKey(t)
 		}
-		return []byte(builder.secretKey), nil
+		return nil, errorhandler.ErrInvalidTokenSigningMethod
 	})
 
 	if err = checkForError(err); err != nil {
@@ -0,0 +1,28 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from the jwt
+// ones sent in the same Authorization header, it also makes leaked tokens
+// easy to find by secret scanners.
+const PersonalAccessTokenPrefix = "fat_"
+
+// NewPersonalAccessToken generates a new personal access token, only its
+// hash is stored.
+func NewPersonalAccessToken(length int) string {
+	return PersonalAccessTokenPrefix + CookieBased{}.GenerateToken(length)
+}
+
+func IsPersonalAccessToken(rawToken string) bool {
+	return strings.HasPrefix(rawToken, PersonalAccessTokenPrefix)
+}
+
+// HashPersonalAccessToken is the value stored and looked up in the database.
+func HashPersonalAccessToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,206 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+)
+
+const (
+	SigningKeyBits = 2048
+	SigningAlg     = "RS256"
+	// The key replaced by a rotation is kept next to the active one with
+	// this suffix, so the tokens it signed can still be verified.
+	PreviousSigningKeySuffix = ".previous"
+)
+
+type SigningKey struct {
+	Id         string
+	PrivateKey *rsa.PrivateKey
+}
+
+// KeySet holds the asymmetric keys used for the tokens that third parties
+// need to verify (ID tokens, and the access tokens with ACCESS_TOKEN_ALG). The first key is the active one, the others
+// are only kept so the tokens they signed can still be verified.
+type KeySet struct {
+	keys []*SigningKey
+	mu   sync.RWMutex
+}
+
+func NewKeySet(keys ...*SigningKey) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// NewSigningKey wraps a RSA private key, the key id is its RFC 7638
+// thumbprint.
+func NewSigningKey(privateKey *rsa.PrivateKey) *SigningKey {
+	return &SigningKey{
+		Id:         Thumbprint(PublicJWK(&privateKey.PublicKey)),
+		PrivateKey: privateKey,
+	}
+}
+
+// GenerateSigningKey creates a new RSA signing key.
+func GenerateSigningKey() (*SigningKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, SigningKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(privateKey), nil
+}
+
+// LoadSigningKey reads a PEM encoded RSA private key (PKCS#1 or PKCS#8)
+// from the path, returns the key and an error if any.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errorhandler.ErrInvalidSigningKey
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewSigningKey(privateKey), nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errorhandler.ErrInvalidSigningKey
+	}
+
+	return NewSigningKey(privateKey), nil
+}
+
+// SaveSigningKey writes the key PEM encoded (PKCS#8) to the path, only the
+// owner can read it, returns an error if any.
+func SaveSigningKey(path string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
+
+// Active returns the key used to sign new tokens.
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if len(ks.keys) == 0 {
+		return nil
+	}
+	return ks.keys[0]
+}
+
+// Sign signs the claims with the active key, setting its id in the header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	return ks.sign(claims, "")
+}
+
+// sign is Sign with the typ header, the one of jwt is kept when it's empty.
+func (ks *KeySet) sign(claims jwt.Claims, typ string) (string, error) {
+	key := ks.Active()
+	if key == nil {
+		return "", errorhandler.ErrInvalidSigningKey
+	}
+
+	var tokenJwt *jwt.Token = jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tokenJwt.Header["kid"] = key.Id
+	if typ != "" {
+		tokenJwt.Header["typ"] = typ
+	}
+	return tokenJwt.SignedString(key.PrivateKey)
+}
+
+// Verify parses a token signed by any key of the set into the claims.
+func (ks *KeySet) Verify(token string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errorhandler.ErrInvalidTokenSigningMethod
+		}
+		return ks.publicKey(t)
+	}, opts...)
+
+	return checkForError(err)
+}
+
+// publicKey returns the key of the kid of the token.
+func (ks *KeySet) publicKey(t *jwt.Token) (*rsa.PublicKey, error) {
+	kid, _ := t.Header["kid"].(string)
+	key := ks.find(kid)
+	if key == nil {
+		return nil, errorhandler.ErrInvalidSigningKey
+	}
+	return &key.PrivateKey.PublicKey, nil
+}
+
+// JWKS returns the public part of every key, as served by the jwks_uri.
+func (ks *KeySet) JWKS() domain.JSONWebKeySet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	jwks := domain.JSONWebKeySet{Keys: make([]domain.JSONWebKey, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := PublicJWK(&key.PrivateKey.PublicKey)
+		jwk.Use = "sig"
+		jwk.Alg = SigningAlg
+		jwk.Kid = key.Id
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func (ks *KeySet) find(kid string) *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.Id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// PublicJWK converts a RSA public key into its JWK representation.
+func PublicJWK(publicKey *rsa.PublicKey) domain.JSONWebKey {
+	return domain.JSONWebKey{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of a JWK, only the required
+// members are used, in lexicographic order.
+func Thumbprint(jwk domain.JSONWebKey) string {
+	var canonical string
+	switch jwk.Kty {
+	case "EC":
+		canonical = `{"crv":"` + jwk.Crv + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	default:
+		canonical = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
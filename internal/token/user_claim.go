@@ -1,20 +1,30 @@
 package token
 
 import (
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 )
 
 type UserClaims struct {
 	jwt.RegisteredClaims
-	Username string `json:"username"`
-	Id       int64  `json:"id"`
+	Username  string `json:"username"`
+	Id        int64  `json:"id"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	SessionId string `json:"sid,omitempty"`
+	// TenantId is the organization the token was issued by, the tokens
+	// issued before there were organizations have none (tenant.DefaultId).
+	TenantId int64 `json:"tid,omitempty"`
+	// Act is only set on impersonation tokens issued by the token exchange.
+	Act *domain.Actor `json:"act,omitempty"`
+	// Cnf is only set on tokens bound to a DPoP key.
+	Cnf *domain.Confirmation `json:"cnf,omitempty"`
 }
 
-func NewUserClaims(id int64, username string, duration time.Duration) (*UserClaims, error) {
+func NewUserClaims(id int64, username, issuer string, duration time.Duration) (*UserClaims, error) {
 	tokenId, err := uuid.NewRandom()
 	if err != nil {
 		return &UserClaims{}, err
@@ -28,7 +38,7 @@ func NewUserClaims(id int64, username string, duration time.Duration) (*UserClai
 			Subject:   username,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			Issuer:    os.Getenv("ISSUER"),
+			Issuer:    issuer,
 		},
 	}, nil
 }
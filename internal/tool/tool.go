@@ -1,10 +1,28 @@
 package tool
 
-import "os"
+import (
+	"net/http"
+	"os"
+	"strings"
+)
 
 func ChecksEnvFile(s *string) {
 	_, err := os.Stat(*s)
 	if err != nil {
 		*s = ".env.example"
 	}
-}
\ No newline at end of file
+}
+
+// BaseUrl is the public url of the server, issuerUrl (ISSUER_URL) should be
+// set when it's behind a proxy, otherwise it comes from the request.
+func BaseUrl(r *http.Request, issuerUrl string) string {
+	if issuerUrl != "" {
+		return strings.TrimSuffix(issuerUrl, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
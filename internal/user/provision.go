@@ -0,0 +1,96 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+// GroupRoles maps the groups of a directory or identity provider to roles,
+// the groups are compared ignoring the case.
+type GroupRoles map[string]string
+
+// NewGroupRoles parses the "group=role" pairs of the config, the invalid
+// ones are left to the validation of the config.
+func NewGroupRoles(mappings []string) GroupRoles {
+	groupRoles := make(GroupRoles, len(mappings))
+	for _, mapping := range mappings {
+		if group, role, found := strings.Cut(mapping, "="); found {
+			groupRoles[strings.ToLower(strings.TrimSpace(group))] = strings.TrimSpace(role)
+		}
+	}
+	return groupRoles
+}
+
+// Roles returns the roles of the groups, without repeating them. It's nil
+// when there's no mapping, so Provision leaves the roles alone.
+func (g GroupRoles) Roles(groups []string) []string {
+	if len(g) == 0 {
+		return nil
+	}
+
+	roles := []string{}
+	for _, group := range groups {
+		if role, ok := g[strings.ToLower(group)]; ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Provision returns the local user of someone authenticated somewhere else,
+// creating it without a password the first time. The roles are synced when
+// they aren't nil. The directory and the identity provider are the ones of
+// the server, so their users only belong to the default organization. A
+// failed lookup is returned, only a missing user is created.
+func Provision(ctx context.Context, repository Repository, username, email string, roles []string) (*domain.User, error) {
+	if tenant.IdFrom(ctx) != tenant.DefaultId {
+		return nil, errorhandler.ErrProvisioningNotAllowed
+	}
+	if username == "" {
+		return nil, errorhandler.ErrUsernameIsRequired
+	}
+
+	localUser, err := repository.FindUserByUsername(ctx, username)
+	switch {
+	case errors.Is(err, errorhandler.ErrUserNotFound):
+		age := 0
+		password := domain.NoPassword
+		localUser = &domain.User{
+			Username:       &username,
+			HashedPassword: &password,
+			Age:            &age,
+		}
+		if email != "" {
+			localUser.Email = &email
+		}
+
+		if err := repository.RegisterUser(ctx, localUser); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case localUser.HashedPassword == nil || *localUser.HashedPassword != domain.NoPassword:
+		// a local user with the same name isn't taken over, whoever registered
+		// it could still log in with its password
+		return nil, errorhandler.ErrUserAlreadyExists
+	}
+
+	if localUser.Locked {
+		return nil, errorhandler.ErrUserLocked
+	}
+
+	if roles != nil {
+		if err := repository.UpdateRoles(ctx, username, roles); err != nil {
+			return nil, err
+		}
+		localUser.Roles = roles
+	}
+
+	return localUser, nil
+}
@@ -1,14 +1,36 @@
 package user
 
-import "github.com/rafaeldepontes/fauthless-go/internal/domain"
+import (
+	"context"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
 
 type Repository interface {
-	FindAllUsersCursor(cursor int64, size int) ([]domain.User, int64, error)
-	FindAllUsers(size, page int) ([]domain.User, int, error)
-	FindUserById(id int64) (*domain.User, error)
-	FindUserByUsername(username string) (*domain.User, error)
-	RegisterUser(u *domain.User) error
-	SetUserToken(token, csrfToken string, userId int64) error
-	UpdateUserDetails(user *domain.User) error
-	DeleteAccount(username string) error
+	FindAllUsersCursor(ctx context.Context, cursor int64, size int) ([]domain.User, int64, error)
+	FindAllUsers(ctx context.Context, size, page int) ([]domain.User, int, error)
+	FindUserById(ctx context.Context, id int64) (*domain.User, error)
+	FindUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	RegisterUser(ctx context.Context, u *domain.User) error
+	SetUserToken(ctx context.Context, token, csrfToken string, userId int64) error
+	UpdateUserDetails(ctx context.Context, user *domain.User) error
+	DeleteAccount(ctx context.Context, username string) error
+	LockUser(ctx context.Context, username string, locked bool) error
+	UpdatePassword(ctx context.Context, username, hashedPassword string) error
+	UpdateRoles(ctx context.Context, username string, roles []string) error
+	FindUsers(ctx context.Context, offset, limit int) ([]domain.User, int, error)
+	UpdateUser(ctx context.Context, u *domain.User) error
+}
+
+// GroupRepository keeps the groups pushed by SCIM, the members are the ids
+// of the users.
+type GroupRepository interface {
+	FindGroups(ctx context.Context, offset, limit int) ([]domain.Group, int, error)
+	FindGroupById(ctx context.Context, id string) (*domain.Group, error)
+	FindGroupByName(ctx context.Context, displayName string) (*domain.Group, error)
+	FindGroupByExternalId(ctx context.Context, externalId string) (*domain.Group, error)
+	FindGroupsOfUser(ctx context.Context, userId int64) ([]domain.Group, error)
+	CreateGroup(ctx context.Context, g *domain.Group) error
+	UpdateGroup(ctx context.Context, g *domain.Group) error
+	DeleteGroup(ctx context.Context, id string) error
 }
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
+)
+
+type groupRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewGroupRepository initialize a new GroupRepository containing
+// a database connection, the groups are scoped by the organization of the
+// context.
+func NewGroupRepository(conn *sql.DB, queryTimeout time.Duration) user.GroupRepository {
+	return &groupRepository{
+		db:           conn,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// FindGroups lists the groups with their members ordered by name, returns
+// the page and the total of groups.
+func (repo *groupRepository) FindGroups(ctx context.Context, offset, limit int) ([]domain.Group, int, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var total int
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(id) FROM user_groups WHERE org_id = $1;`, tenant.IdFrom(ctx)).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, display_name, external_id
+		FROM user_groups
+		WHERE org_id = $3
+		ORDER BY display_name ASC
+		LIMIT $1 OFFSET $2;
+	`
+	groups, err := repo.queryGroups(ctx, query, limit, offset, tenant.IdFrom(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range groups {
+		if groups[i].Members, err = repo.findMembers(ctx, groups[i].Id); err != nil {
+			return nil, 0, err
+		}
+	}
+	return groups, total, nil
+}
+
+// FindGroupById returns the group with its members, or ErrGroupNotFound.
+func (repo *groupRepository) FindGroupById(ctx context.Context, id string) (*domain.Group, error) {
+	return repo.findGroup(ctx, `SELECT id, display_name, external_id FROM user_groups WHERE id = $1 AND org_id = $2;`, id)
+}
+
+// FindGroupByName returns the group with its members, or ErrGroupNotFound.
+func (repo *groupRepository) FindGroupByName(ctx context.Context, displayName string) (*domain.Group, error) {
+	return repo.findGroup(ctx, `SELECT id, display_name, external_id FROM user_groups WHERE display_name = $1 AND org_id = $2;`, displayName)
+}
+
+// FindGroupByExternalId returns the group with the id of the identity
+// provider, or ErrGroupNotFound.
+func (repo *groupRepository) FindGroupByExternalId(ctx context.Context, externalId string) (*domain.Group, error) {
+	return repo.findGroup(ctx, `SELECT id, display_name, external_id FROM user_groups WHERE external_id = $1 AND org_id = $2;`, externalId)
+}
+
+// FindGroupsOfUser lists the groups the user is a member of, without their
+// members.
+func (repo *groupRepository) FindGroupsOfUser(ctx context.Context, userId int64) ([]domain.Group, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT g.id, g.display_name, g.external_id
+		FROM user_groups g
+		JOIN user_group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1 AND g.org_id = $2
+		ORDER BY g.display_name ASC;
+	`
+	return repo.queryGroups(ctx, query, userId, tenant.IdFrom(ctx))
+}
+
+// CreateGroup saves the group and its members, the id is given by the
+// caller.
+func (repo *groupRepository) CreateGroup(ctx context.Context, g *domain.Group) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO user_groups (id, display_name, external_id, org_id) VALUES ($1, $2, $3, $4);`
+	if _, err := tx.ExecContext(ctx, query, g.Id, g.DisplayName, g.ExternalId, tenant.IdFrom(ctx)); err != nil {
+		return err
+	}
+
+	if err := insertMembers(ctx, tx, g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateGroup replaces the name, external id and members of the group,
+// returns ErrGroupNotFound when there's no group with the id.
+func (repo *groupRepository) UpdateGroup(ctx context.Context, g *domain.Group) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_groups SET display_name = $1, external_id = $2 WHERE id = $3 AND org_id = $4;`
+	result, err := tx.ExecContext(ctx, query, g.DisplayName, g.ExternalId, g.Id, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrGroupNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_group_members WHERE group_id = $1;`, g.Id); err != nil {
+		return err
+	}
+	if err := insertMembers(ctx, tx, g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteGroup deletes the group and its memberships, returns
+// ErrGroupNotFound when there's no group with the id.
+func (repo *groupRepository) DeleteGroup(ctx context.Context, id string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, `DELETE FROM user_groups WHERE id = $1 AND org_id = $2;`, id, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrGroupNotFound
+	}
+	return nil
+}
+
+func (repo *groupRepository) findGroup(ctx context.Context, query string, arg any) (*domain.Group, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var g domain.Group
+	if err := repo.db.QueryRowContext(ctx, query, arg, tenant.IdFrom(ctx)).Scan(&g.Id, &g.DisplayName, &g.ExternalId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	members, err := repo.findMembers(ctx, g.Id)
+	if err != nil {
+		return nil, err
+	}
+	g.Members = members
+	return &g, nil
+}
+
+func (repo *groupRepository) queryGroups(ctx context.Context, query string, args ...any) ([]domain.Group, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []domain.Group{}
+	for rows.Next() {
+		var g domain.Group
+		if err := rows.Scan(&g.Id, &g.DisplayName, &g.ExternalId); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (repo *groupRepository) findMembers(ctx context.Context, groupId string) ([]domain.GroupMember, error) {
+	query := `
+		SELECT u.id, u.username
+		FROM user_group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY u.id ASC;
+	`
+	rows, err := repo.db.QueryContext(ctx, query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []domain.GroupMember{}
+	for rows.Next() {
+		var member domain.GroupMember
+		if err := rows.Scan(&member.UserId, &member.Username); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func insertMembers(ctx context.Context, tx *sql.Tx, g *domain.Group) error {
+	query := `
+		INSERT INTO user_group_members (group_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+	for _, member := range g.Members {
+		if _, err := tx.ExecContext(ctx, query, g.Id, member.UserId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
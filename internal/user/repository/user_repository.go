@@ -1,23 +1,31 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/postgres"
 )
 
 type userRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
 // NewUserRepository initialize a new UserRepository containing
 // a database connection, it returns a pointer to the new UserRepository.
-func NewUserRepository(conn *sql.DB) user.Repository {
+// Every query is scoped by the organization of the context (tenant.IdFrom).
+func NewUserRepository(conn *sql.DB, queryTimeout time.Duration) user.Repository {
 	return &userRepository{
-		db: conn,
+		db:           conn,
+		queryTimeout: queryTimeout,
 	}
 }
 
@@ -27,15 +35,18 @@ func NewUserRepository(conn *sql.DB) user.Repository {
 //
 // returns a slice of User, the total of records in the database
 // and an Error if any.
-func (repo *userRepository) FindAllUsersCursor(cursor int64, size int) ([]domain.User, int64, error) {
+func (repo *userRepository) FindAllUsersCursor(ctx context.Context, cursor int64, size int) ([]domain.User, int64, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
 	query := `
 		SELECT id, username, age
 		FROM users
-		WHERE id >= $1
+		WHERE id >= $1 AND org_id = $3
 		ORDER BY id ASC
 		LIMIT $2;
 	`
-	rows, err := repo.db.Query(query, cursor, size)
+	rows, err := repo.db.QueryContext(ctx, query, cursor, size, tenant.IdFrom(ctx))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -69,24 +80,27 @@ func (repo *userRepository) FindAllUsersCursor(cursor int64, size int) ([]domain
 // using a pagination method based on offset and limit
 // returns a slice of User, the total of records in the database
 // and an Error if any.
-func (repo *userRepository) FindAllUsers(size, page int) ([]domain.User, int, error) {
-	queryCount := `SELECT COUNT(id) FROM users;`
+func (repo *userRepository) FindAllUsers(ctx context.Context, size, page int) ([]domain.User, int, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	queryCount := `SELECT COUNT(id) FROM users WHERE org_id = $1;`
 
 	var total int
-	if err := repo.db.QueryRow(queryCount).Scan(&total); err != nil {
+	if err := repo.db.QueryRowContext(ctx, queryCount, tenant.IdFrom(ctx)).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
-	query := `SELECT id, username, age FROM users ORDER BY id ASC LIMIT $1 OFFSET $2;`
+	query := `SELECT id, username, age FROM users WHERE org_id = $3 ORDER BY id ASC LIMIT $1 OFFSET $2;`
 	offset := (page - 1) * size
 
-	stmt, err := repo.db.Prepare(query)
+	stmt, err := repo.db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(size, offset)
+	rows, err := stmt.QueryContext(ctx, size, offset, tenant.IdFrom(ctx))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -111,10 +125,13 @@ func (repo *userRepository) FindAllUsers(size, page int) ([]domain.User, int, er
 
 // FindUserById search for an user by his id
 // returns the user and an error if any.
-func (repo *userRepository) FindUserById(id int64) (*domain.User, error) {
+func (repo *userRepository) FindUserById(ctx context.Context, id int64) (*domain.User, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
 	var user domain.User
-	query := `SELECT id, username, age FROM users WHERE id = $1;`
-	row := repo.db.QueryRow(query, id)
+	query := `SELECT id, username, age FROM users WHERE id = $1 AND org_id = $2;`
+	row := repo.db.QueryRowContext(ctx, query, id, tenant.IdFrom(ctx))
 	if err := row.Scan(&user.Id, &user.Username, &user.Age); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errorhandler.ErrUserNotFound // or return custom NotFound error
@@ -125,76 +142,95 @@ func (repo *userRepository) FindUserById(id int64) (*domain.User, error) {
 }
 
 // FindUserByUsername search for an user by his username
-// returns the user and an error if any.
-func (repo *userRepository) FindUserByUsername(username string) (*domain.User, error) {
-	var user domain.User
-	query := `SELECT id, password, username, age FROM users WHERE username = $1;`
-
-	stmt, err := repo.db.Prepare(query)
+// returns the user and an error if any, ErrUserNotFound when there's none.
+func (repo *userRepository) FindUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var (
+		user  domain.User
+		roles string
+	)
+	query := `SELECT id, password, username, age, email, roles, locked FROM users WHERE username = $1 AND org_id = $2;`
+
+	stmt, err := repo.db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(username).Scan(&user.Id, &user.HashedPassword, &user.Username, &user.Age)
+	err = stmt.QueryRowContext(ctx, username, tenant.IdFrom(ctx)).Scan(&user.Id, &user.HashedPassword, &user.Username, &user.Age, &user.Email, &roles, &user.Locked)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorhandler.ErrUserNotFound
+		}
 		return nil, err
 	}
+	user.Roles = strings.Fields(roles)
 
 	return &user, nil
 }
 
 // RegisterUser saves a new user into the database, expects a
 // pointer to a user and returns an error if any.
-func (repo *userRepository) RegisterUser(u *domain.User) error {
+func (repo *userRepository) RegisterUser(ctx context.Context, u *domain.User) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
 	query := `
-		INSERT INTO users (username, password, age)
-		VALUES ($1, $2, $3)
+		INSERT INTO users (username, password, age, email, org_id)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id;
 	`
-	err := repo.db.QueryRow(query, u.Username, u.HashedPassword, u.Age).Scan(&u.Id)
+	err := repo.db.QueryRowContext(ctx, query, u.Username, u.HashedPassword, u.Age, u.Email, tenant.IdFrom(ctx)).Scan(&u.Id)
 	return err
 }
 
 // SetUserToken save the user token into the database, expects
 // both csrft and session token and also the Id related to the user
 // returns an error if any.
-func (repo *userRepository) SetUserToken(token, csrfToken string, userId int64) error {
+func (repo *userRepository) SetUserToken(ctx context.Context, token, csrfToken string, userId int64) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
 	query := `
 	UPDATE users 
 	SET session_token = $1, 
 	csrf_token = $2 
-	WHERE id = $3;
+	WHERE id = $3 AND org_id = $4;
 	`
 
-	stmt, err := repo.db.Prepare(query)
+	stmt, err := repo.db.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	stmt.Exec(token, csrfToken, userId)
+	stmt.ExecContext(ctx, token, csrfToken, userId, tenant.IdFrom(ctx))
 
 	return nil
 }
 
 // UpdateUserDetails updates the user details in the ddatabase
 // with the new username and/or age, returns an erro if any.
-func (repo *userRepository) UpdateUserDetails(user *domain.User) error {
+func (repo *userRepository) UpdateUserDetails(ctx context.Context, user *domain.User) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
 	query := `
 	UPDATE users
 	SET age = $1
-	WHERE id = $2
+	WHERE id = $2 AND org_id = $3
 	`
 
 	var stmt *sql.Stmt
-	stmt, err := repo.db.Prepare(query)
+	stmt, err := repo.db.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(user.Age, user.Id)
+	_, err = stmt.ExecContext(ctx, user.Age, user.Id, tenant.IdFrom(ctx))
 	if err != nil {
 		return err
 	}
@@ -204,7 +240,126 @@ func (repo *userRepository) UpdateUserDetails(user *domain.User) error {
 
 // DeleteAccount deletes the user account from the database
 // based on the username, returns an error if any.
-func (repo *userRepository) DeleteAccount(username string) error {
-	_, err := repo.db.Exec(`DELETE FROM users WHERE username = $1`, username)
+func (repo *userRepository) DeleteAccount(ctx context.Context, username string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	_, err := repo.db.ExecContext(ctx, `DELETE FROM users WHERE username = $1 AND org_id = $2`, username, tenant.IdFrom(ctx))
 	return err
 }
+
+// LockUser locks or unlocks the user, locked users can't log in, returns
+// ErrUserNotFound when there's no user with the username.
+func (repo *userRepository) LockUser(ctx context.Context, username string, locked bool) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, `UPDATE users SET locked = $1 WHERE username = $2 AND org_id = $3`, locked, username, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrUserNotFound
+	}
+	return nil
+}
+
+// FindUsers lists the users with their email, roles and lock, ordered by
+// id, returns the page and the total of users.
+func (repo *userRepository) FindUsers(ctx context.Context, offset, limit int) ([]domain.User, int, error) {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	var total int
+	if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(id) FROM users WHERE org_id = $1;`, tenant.IdFrom(ctx)).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, username, age, email, roles, locked
+		FROM users
+		WHERE org_id = $3
+		ORDER BY id ASC
+		LIMIT $1 OFFSET $2;
+	`
+	rows, err := repo.db.QueryContext(ctx, query, limit, offset, tenant.IdFrom(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]domain.User, 0, limit)
+	for rows.Next() {
+		var (
+			u     domain.User
+			roles string
+		)
+		if err := rows.Scan(&u.Id, &u.Username, &u.Age, &u.Email, &roles, &u.Locked); err != nil {
+			return nil, 0, err
+		}
+		u.Roles = strings.Fields(roles)
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// UpdateUser replaces the username, email and lock of the user with the id,
+// returns ErrUserNotFound when there's none.
+func (repo *userRepository) UpdateUser(ctx context.Context, u *domain.User) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	query := `
+	UPDATE users
+	SET username = $1, email = $2, locked = $3
+	WHERE id = $4 AND org_id = $5
+	`
+	result, err := repo.db.ExecContext(ctx, query, u.Username, u.Email, u.Locked, u.Id, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password hash of the user, returns
+// ErrUserNotFound when there's no user with the username.
+func (repo *userRepository) UpdatePassword(ctx context.Context, username, hashedPassword string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE username = $2 AND org_id = $3`, hashedPassword, username, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateRoles replaces the roles of the user, returns ErrUserNotFound when
+// there's no user with the username.
+func (repo *userRepository) UpdateRoles(ctx context.Context, username string, roles []string) error {
+	ctx, cancel := postgres.WithTimeout(ctx, repo.queryTimeout)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, `UPDATE users SET roles = $1 WHERE username = $2 AND org_id = $3`, strings.Join(roles, " "), username, tenant.IdFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return errorhandler.ErrUserNotFound
+	}
+	return nil
+}
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
 )
 
+// userController is the http transport of the user.Service, it reads the
+// path, query and body of the requests and maps the errors to the status
+// codes.
 type userController struct {
 	service *user.Service
 }
@@ -17,25 +24,151 @@ func NewUserController(s *user.Service) user.Controller {
 }
 
 func (c *userController) ListAllHashedCursor(w http.ResponseWriter, r *http.Request) {
-	(*c.service).FindAllUsersHashedCursorPagination(w, r)
+	var cursor domain.CursorResquest
+	json.NewDecoder(r.Body).Decode(&cursor)
+
+	pageModel, err := (*c.service).FindAllUsersHashedCursorPagination(r.Context(), cursor.HashedCursor)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, pageModel)
 }
 
 func (c *userController) ListAllCursor(w http.ResponseWriter, r *http.Request) {
-	(*c.service).FindAllUsersCursorPagination(w, r)
+	defaultValueCursor := "100"
+	cursor, err := getQueryParam[int64](r, "cursor", defaultValueCursor)
+	if err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	defaultValueSize := "25"
+	size, err := getQueryParam[int](r, "size", defaultValueSize)
+	if err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	pageModel, err := (*c.service).FindAllUsersCursorPagination(r.Context(), cursor, size)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, pageModel)
 }
 
 func (c *userController) ListAllOffset(w http.ResponseWriter, r *http.Request) {
-	(*c.service).FindAllUsersOffSetPagination(w, r)
+	defaultValueSize := "25"
+	size, err := getQueryParam[int](r, "size", defaultValueSize)
+	if err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	defaultValuePage := "1"
+	currentPage, err := getQueryParam[int](r, "page", defaultValuePage)
+	if err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	pageModel, err := (*c.service).FindAllUsersOffSetPagination(r.Context(), size, currentPage)
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, pageModel)
 }
 
 func (c *userController) FindById(w http.ResponseWriter, r *http.Request) {
-	(*c.service).FindUserById(w, r)
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrIdIsRequired, r.URL.Path)
+		return
+	}
+
+	pathId, _ := strconv.Atoi(idStr)
+
+	user, err := (*c.service).FindUserById(r.Context(), int64(pathId))
+	if err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	writeJson(w, http.StatusOK, user)
 }
 
 func (c *userController) UpdateDetails(w http.ResponseWriter, r *http.Request) {
-	(*c.service).UpdateUserDetails(w, r)
+	var newUserDetails domain.UserDetails
+	if err := json.NewDecoder(r.Body).Decode(&newUserDetails); err != nil {
+		errorhandler.InternalErrorHandler(w)
+		return
+	}
+
+	if err := (*c.service).UpdateUserDetails(r.Context(), r.PathValue("username"), &newUserDetails); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 }
 
 func (c *userController) DeleteAccount(w http.ResponseWriter, r *http.Request) {
-	(*c.service).DeleteAccount(w, r)
+	if err := (*c.service).DeleteAccount(r.Context(), r.PathValue("username")); err != nil {
+		errorhandler.ServiceErrorHandler(w, err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func getQueryParam[T int | int64 | string | bool | float64](r *http.Request, key string, defaultVal string) (T, error) {
+	valStr := r.URL.Query().Get(key)
+	if valStr == "" {
+		valStr = defaultVal
+	}
+
+	var zeroVal T
+
+	switch any(zeroVal).(type) {
+	case int:
+		value, err := strconv.Atoi(valStr)
+		if err != nil {
+			return zeroVal, err
+		}
+		return any(value).(T), nil
+	case int64:
+		value, err := strconv.ParseInt(valStr, 10, 64)
+		if err != nil {
+			return zeroVal, err
+		}
+		return any(value).(T), nil
+	case bool:
+		value, err := strconv.ParseBool(valStr)
+		if err != nil {
+			return zeroVal, err
+		}
+		return any(value).(T), nil
+	case float64:
+		value, err := strconv.ParseBool(valStr)
+		if err != nil {
+			return zeroVal, err
+		}
+		return any(value).(T), nil
+	case string:
+		return any(valStr).(T), nil
+	default:
+		return zeroVal, errorhandler.ErrInvalidType
+	}
 }
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
+	"github.com/rafaeldepontes/fauthless-go/internal/user"
+	fauthlessv1 "github.com/rafaeldepontes/fauthless-go/pkg/pb/fauthless/v1"
+)
+
+// userGrpcServer is the gRPC transport of the user.Service, the calls are
+// authenticated by the interceptors of the Middleware.
+type userGrpcServer struct {
+	fauthlessv1.UnimplementedUserServiceServer
+	service *user.Service
+}
+
+func NewUserGrpcServer(s *user.Service) fauthlessv1.UserServiceServer {
+	return &userGrpcServer{
+		service: s,
+	}
+}
+
+func (s *userGrpcServer) GetUser(ctx context.Context, req *fauthlessv1.GetUserRequest) (*fauthlessv1.User, error) {
+	user, err := (*s.service).FindUserById(ctx, req.GetId())
+	if err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+	return toGrpcUser(user), nil
+}
+
+// ListUsers pages the users by id, the page token is the id the next page
+// starts at.
+func (s *userGrpcServer) ListUsers(ctx context.Context, req *fauthlessv1.ListUsersRequest) (*fauthlessv1.ListUsersResponse, error) {
+	var cursor int64
+	if req.GetPageToken() != "" {
+		var err error
+		cursor, err = strconv.ParseInt(req.GetPageToken(), 10, 64)
+		if err != nil || cursor <= 0 {
+			return nil, errorhandler.GrpcErrorHandler(errorhandler.Invalid(errorhandler.ErrInvalidPageToken))
+		}
+	}
+
+	pageModel, err := (*s.service).FindAllUsersCursorPagination(ctx, cursor, int(req.GetPageSize()))
+	if err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+
+	resp := &fauthlessv1.ListUsersResponse{
+		Users: make([]*fauthlessv1.User, 0, len(pageModel.Data)),
+	}
+	for i := range pageModel.Data {
+		resp.Users = append(resp.Users, toGrpcUser(&pageModel.Data[i]))
+	}
+	if pageModel.NextCursor != 0 {
+		resp.NextPageToken = strconv.FormatInt(pageModel.NextCursor, 10)
+	}
+	return resp, nil
+}
+
+func (s *userGrpcServer) UpdateUser(ctx context.Context, req *fauthlessv1.UpdateUserRequest) (*fauthlessv1.UpdateUserResponse, error) {
+	if err := isOwner(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+
+	details := &domain.UserDetails{Age: int(req.GetAge())}
+	if err := (*s.service).UpdateUserDetails(ctx, req.GetUsername(), details); err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+	return &fauthlessv1.UpdateUserResponse{}, nil
+}
+
+func (s *userGrpcServer) DeleteUser(ctx context.Context, req *fauthlessv1.DeleteUserRequest) (*fauthlessv1.DeleteUserResponse, error) {
+	if err := isOwner(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+
+	if err := (*s.service).DeleteAccount(ctx, req.GetUsername()); err != nil {
+		return nil, errorhandler.GrpcErrorHandler(err)
+	}
+	return &fauthlessv1.DeleteUserResponse{}, nil
+}
+
+// isOwner checks the user is changing its own account, like the http
+// middleware does with the path.
+func isOwner(ctx context.Context, username string) error {
+	userClaims, ok := middleware.UserClaimsFromContext(ctx)
+	if !ok {
+		return errorhandler.GrpcErrorHandler(errorhandler.Unauthorized(errorhandler.ErrInvalidToken))
+	}
+
+	if userClaims.Username != username {
+		return errorhandler.GrpcErrorHandler(errorhandler.Forbidden(errorhandler.ErrInvalidId))
+	}
+	return nil
+}
+
+func toGrpcUser(user *domain.User) *fauthlessv1.User {
+	grpcUser := &fauthlessv1.User{}
+	if user.Id != nil {
+		grpcUser.Id = *user.Id
+	}
+	if user.Username != nil {
+		grpcUser.Username = *user.Username
+	}
+	if user.Age != nil {
+		grpcUser.Age = int32(*user.Age)
+	}
+	if user.Email != nil {
+		grpcUser.Email = *user.Email
+	}
+	return grpcUser
+}
@@ -1,13 +1,19 @@
 package user
 
-import "net/http"
+import (
+	"context"
 
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+)
+
+// Service is the user management without any transport, the errors are
+// classified with the errorhandler kinds.
 type Service interface {
-	FindAllUsersHashedCursorPagination(w http.ResponseWriter, r *http.Request)
-	FindAllUsersCursorPagination(w http.ResponseWriter, r *http.Request)
-	FindAllUsersOffSetPagination(w http.ResponseWriter, r *http.Request)
-	FindUserById(w http.ResponseWriter, r *http.Request)
-	FindUserByUsername(w http.ResponseWriter, r *http.Request)
-	UpdateUserDetails(w http.ResponseWriter, r *http.Request)
-	DeleteAccount(w http.ResponseWriter, r *http.Request)
+	FindAllUsersHashedCursorPagination(ctx context.Context, hashedCursor string) (*domain.CursorHashedPagination[domain.User], error)
+	FindAllUsersCursorPagination(ctx context.Context, cursor int64, size int) (*domain.CursorPagination[domain.User], error)
+	FindAllUsersOffSetPagination(ctx context.Context, size, page int) (*domain.OffSetPagination[domain.User], error)
+	FindUserById(ctx context.Context, id int64) (*domain.User, error)
+	FindUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	UpdateUserDetails(ctx context.Context, username string, details *domain.UserDetails) error
+	DeleteAccount(ctx context.Context, username string) error
 }
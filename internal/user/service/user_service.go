@@ -1,13 +1,14 @@
 package service
 
 import (
-	"encoding/json"
-	"net/http"
-	"strconv"
+	"context"
 
+	"github.com/rafaeldepontes/fauthless-go/configs"
+	"github.com/rafaeldepontes/fauthless-go/internal/audit"
 	"github.com/rafaeldepontes/fauthless-go/internal/cache"
 	"github.com/rafaeldepontes/fauthless-go/internal/domain"
 	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/middleware"
 	"github.com/rafaeldepontes/fauthless-go/internal/pagination"
 	"github.com/rafaeldepontes/fauthless-go/internal/user"
 	log "github.com/sirupsen/logrus"
@@ -17,24 +18,29 @@ type userService struct {
 	repo   user.Repository
 	Logger *log.Logger
 	Cache  *cache.Caches
+	audit  audit.Recorder
+
+	cursorSecretKey       string
+	cursorSignatureLength int
 }
 
-// NewUserService initialize a new UserService containing a UserRepository.
-func NewUserService(userRepo user.Repository, logg *log.Logger, cache *cache.Caches) user.Service {
+// NewUserService initialize a new UserService containing a UserRepository,
+// the changes to the accounts are recorded by the recorder.
+func NewUserService(userRepo user.Repository, logg *log.Logger, config *configs.Configuration, cache *cache.Caches, recorder audit.Recorder) user.Service {
 	return &userService{
-		repo:   userRepo,
-		Logger: logg,
-		Cache:  cache,
+		repo:                  userRepo,
+		Logger:                logg,
+		Cache:                 cache,
+		audit:                 recorder,
+		cursorSecretKey:       config.CursorSecretKey,
+		cursorSignatureLength: config.CursorSignatureLength,
 	}
 }
 
-func (s *userService) FindAllUsersHashedCursorPagination(w http.ResponseWriter, r *http.Request) {
+func (s *userService) FindAllUsersHashedCursorPagination(ctx context.Context, hashedCursor string) (*domain.CursorHashedPagination[domain.User], error) {
 	s.Logger.Infoln("Listing all the users in the database using the cursor pagination with a hash...")
 
-	cs := pagination.NewCursorService[domain.User]()
-
-	var cursor domain.CursorResquest
-	json.NewDecoder(r.Body).Decode(&cursor)
+	cs := pagination.NewCursorService[domain.User](s.cursorSecretKey, s.cursorSignatureLength)
 
 	var (
 		hashSrc    string
@@ -46,12 +52,11 @@ func (s *userService) FindAllUsersHashedCursorPagination(w http.ResponseWriter,
 	cursorId = 1
 	size = 11
 
-	if cursor.HashedCursor != "" {
-		cursorBody, err := cs.Decode(cursor.HashedCursor)
+	if hashedCursor != "" {
+		cursorBody, err := cs.Decode(hashedCursor)
 		if err != nil {
 			s.Logger.Errorf("An error occurred: %v", err)
-			errorhandler.InternalErrorHandler(w)
-			return
+			return nil, err
 		}
 		cursorBody.Size++
 
@@ -60,11 +65,10 @@ func (s *userService) FindAllUsersHashedCursorPagination(w http.ResponseWriter,
 	}
 
 	var users []domain.User
-	users, nextCursor, err := s.repo.FindAllUsersCursor(cursorId, size)
+	users, nextCursor, err := s.repo.FindAllUsersCursor(ctx, cursorId, size)
 	if err != nil {
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", err)
-		return
+		return nil, errorhandler.Invalid(err)
 	}
 
 	s.Logger.Infof("Found %v users, the next should be %v", len(users), nextCursor)
@@ -72,36 +76,15 @@ func (s *userService) FindAllUsersHashedCursorPagination(w http.ResponseWriter,
 	hashSrc, err = cs.Encode(size, nextCursor)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		return nil, err
 	}
 
-	pageModel := pagination.NewCursorHashedPagination(users, hashSrc)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(pageModel)
+	return pagination.NewCursorHashedPagination(users, hashSrc), nil
 }
 
-func (s *userService) FindAllUsersCursorPagination(w http.ResponseWriter, r *http.Request) {
+func (s *userService) FindAllUsersCursorPagination(ctx context.Context, cursor int64, size int) (*domain.CursorPagination[domain.User], error) {
 	s.Logger.Infoln("Listing all the users in the database using the cursor pagination...")
 
-	defaultValueCursor := "100"
-	cursor, err := getQueryParam[int64](r, "cursor", defaultValueCursor)
-	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
-	}
-
-	defaultValueSize := "25"
-	size, err := getQueryParam[int](r, "size", defaultValueSize)
-	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
-	}
-
 	if size <= 0 {
 		size = 25
 	}
@@ -110,182 +93,123 @@ func (s *userService) FindAllUsersCursorPagination(w http.ResponseWriter, r *htt
 	size++
 
 	var users []domain.User
-	users, nextCursor, err := s.repo.FindAllUsersCursor(cursor, size)
+	users, nextCursor, err := s.repo.FindAllUsersCursor(ctx, cursor, size)
 	if err != nil {
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", err)
-		return
+		return nil, errorhandler.Invalid(err)
 	}
 
 	s.Logger.Infof("Found %v users, the next should be %v", len(users), nextCursor)
 
-	pageModel := pagination.NewCursorPagination(users, size-1, nextCursor)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(pageModel)
+	return pagination.NewCursorPagination(users, size-1, nextCursor), nil
 }
 
 // FindAllUsers list all the users without a filter and returns each
 // one with pagination and a few datas missing for LGPD.
-func (s *userService) FindAllUsersOffSetPagination(w http.ResponseWriter, r *http.Request) {
+func (s *userService) FindAllUsersOffSetPagination(ctx context.Context, size, page int) (*domain.OffSetPagination[domain.User], error) {
 	s.Logger.Infoln("Listing all the users in the database using the offset pagination...")
 
-	defaultValueSize := "25"
-	size, err := getQueryParam[int](r, "size", defaultValueSize)
-	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
-	}
-
 	if size <= 0 {
 		size = 25
 	}
 
-	defaultValuePage := "1"
-	currentPage, err := getQueryParam[int](r, "page", defaultValuePage)
-	if err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
-	}
-
-	if currentPage <= 0 {
-		currentPage = 1
+	if page <= 0 {
+		page = 1
 	}
 
 	var users []domain.User
-	users, totalRecords, err := s.repo.FindAllUsers(size, currentPage)
+	users, totalRecords, err := s.repo.FindAllUsers(ctx, size, page)
 	if err != nil {
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", err)
-		return
+		return nil, errorhandler.Invalid(err)
 	}
 
-	pageModel := pagination.NewOffSetPagination(users, uint(currentPage), uint(totalRecords), uint(size))
-
 	s.Logger.Infof("Found %v users from a total of %v", len(users), totalRecords)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(pageModel)
+	return pagination.NewOffSetPagination(users, uint(page), uint(totalRecords), uint(size)), nil
 }
 
 // FindUserById list an user by his id and returns a none
 // pagination result and a few datas missing for LGPD.
-func (s *userService) FindUserById(w http.ResponseWriter, r *http.Request) {
-	idStr := r.PathValue("id")
-	s.Logger.Infof("Listing user by id - %v", idStr)
-
-	if idStr == "" {
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrIdIsRequired, r.URL.Path)
-		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrIdIsRequired)
-		return
-	}
-
-	pathId, _ := strconv.Atoi(idStr)
-	id := int64(pathId)
+func (s *userService) FindUserById(ctx context.Context, id int64) (*domain.User, error) {
+	s.Logger.Infof("Listing user by id - %v", id)
 
-	var user *domain.User
-	user, err := s.repo.FindUserById(id)
+	user, err := s.repo.FindUserById(ctx, id)
 	if err != nil {
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrUserNotFound, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", err)
-		return
+		return nil, errorhandler.Invalid(errorhandler.ErrUserNotFound)
 	}
 
 	s.Logger.Infof("User found! username: %v\n", *user.Id)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	json.NewEncoder(w).Encode(user)
+	return user, nil
 }
 
-func (s *userService) FindUserByUsername(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
+func (s *userService) FindUserByUsername(ctx context.Context, username string) (*domain.User, error) {
 	s.Logger.Infof("Listing user by username: %v", username)
 
 	if username == "" {
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrUsernameIsRequired, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", errorhandler.ErrUsernameIsRequired)
-		return
+		return nil, errorhandler.Invalid(errorhandler.ErrUsernameIsRequired)
 	}
 
-	var user *domain.User
-	user, err := s.repo.FindUserByUsername(username)
+	user, err := s.repo.FindUserByUsername(ctx, username)
 	if err != nil {
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrUserNotFound, r.URL.Path)
 		s.Logger.Errorf("An error occurred: %v", err)
-		return
+		return nil, errorhandler.Invalid(errorhandler.ErrUserNotFound)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	json.NewEncoder(w).Encode(user)
+	return user, nil
 }
 
 // UpdateUserDetails changes the user age and/or name if it's the account owner.
-func (s *userService) UpdateUserDetails(w http.ResponseWriter, r *http.Request) {
+func (s *userService) UpdateUserDetails(ctx context.Context, username string, details *domain.UserDetails) error {
 	s.Logger.Infoln("Updating an user")
+	event := middleware.AuditEvent(ctx, audit.ActionUserUpdated, username)
 
-	var user *domain.User
-	username := r.PathValue("username")
-	user, err := s.repo.FindUserByUsername(username)
+	user, err := s.repo.FindUserByUsername(ctx, username)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, errorhandler.ErrUserNotFound, r.URL.Path)
-		return
-	}
-
-	var newUserDetails domain.UserDetails
-	if err := json.NewDecoder(r.Body).Decode(&newUserDetails); err != nil {
-		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		s.audit.Record(ctx, audit.Failure(event, errorhandler.ErrUserNotFound))
+		return errorhandler.Invalid(errorhandler.ErrUserNotFound)
 	}
 
-	if err := isValidUserDetails(user, &newUserDetails); err != nil {
+	if err := isValidUserDetails(user, details); err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.BadRequestErrorHandler(w, err, r.URL.Path)
-		return
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return errorhandler.Invalid(err)
 	}
 
-	user.Age = &newUserDetails.Age
+	user.Age = &details.Age
 
-	err = s.repo.UpdateUserDetails(user)
+	err = s.repo.UpdateUserDetails(ctx, user)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return err
 	}
+	s.audit.Record(ctx, event)
 
 	s.Logger.Infof("User updated successfully! username: %v\n", *user.Id)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	return nil
 }
 
 // DeleteAccount deletes the user from the database by his username
 // if it's the account owner.
-func (s *userService) DeleteAccount(w http.ResponseWriter, r *http.Request) {
-	username := r.PathValue("username")
+func (s *userService) DeleteAccount(ctx context.Context, username string) error {
 	s.Logger.Infof("Deleting an account by his username: %v\n", username)
 
-	err := s.repo.DeleteAccount(username)
+	event := middleware.AuditEvent(ctx, audit.ActionUserDeleted, username)
+
+	err := s.repo.DeleteAccount(ctx, username)
 	if err != nil {
 		s.Logger.Errorf("An error occurred: %v", err)
-		errorhandler.InternalErrorHandler(w)
-		return
+		s.audit.Record(ctx, audit.Failure(event, err))
+		return err
 	}
+	s.audit.Record(ctx, event)
 
 	s.Logger.Infof("Account deleted successfully")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode("Account deleted successfully")
+	return nil
 }
 
 func isValidUserDetails(user *domain.User, userRequest *domain.UserDetails) error {
@@ -299,43 +223,3 @@ func isValidUserDetails(user *domain.User, userRequest *domain.UserDetails) erro
 
 	return nil
 }
-
-func getQueryParam[T int | int64 | string | bool | float64](r *http.Request, key string, defaultVal string) (T, error) {
-	valStr := r.URL.Query().Get(key)
-	if valStr == "" {
-		valStr = defaultVal
-	}
-
-	var zeroVal T
-
-	switch any(zeroVal).(type) {
-	case int:
-		value, err := strconv.Atoi(valStr)
-		if err != nil {
-			return zeroVal, err
-		}
-		return any(value).(T), nil
-	case int64:
-		value, err := strconv.ParseInt(valStr, 10, 64)
-		if err != nil {
-			return zeroVal, err
-		}
-		return any(value).(T), nil
-	case bool:
-		value, err := strconv.ParseBool(valStr)
-		if err != nil {
-			return zeroVal, err
-		}
-		return any(value).(T), nil
-	case float64:
-		value, err := strconv.ParseBool(valStr)
-		if err != nil {
-			return zeroVal, err
-		}
-		return any(value).(T), nil
-	case string:
-		return any(valStr).(T), nil
-	default:
-		return zeroVal, errorhandler.ErrInvalidType
-	}
-}
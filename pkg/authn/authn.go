@@ -0,0 +1,151 @@
+// Package authn verifies the tokens issued by fauthless-go in other Go
+// services, with the middlewares for net/http (and chi) and the gRPC
+// interceptors that put the Claims in the context.
+//
+//	verifier, err := authn.NewVerifier(authn.Config{SecretKey: os.Getenv("JWT_SECRET_KEY"), Issuer: "golang"})
+//	r.Use(verifier.Middleware)
+//	...
+//	claims, _ := authn.ClaimsFromContext(r.Context())
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoKeys            = errors.New("Error: a secret key or a jwks url is required")
+	ErrMissingToken      = errors.New("Error: token missing")
+	ErrInvalidToken      = errors.New("Error: token is invalid")
+	ErrExpiredToken      = errors.New("Error: token already expired")
+	ErrUnknownSigningKey = errors.New("Error: token signed by an unknown key")
+	ErrBoundToken        = errors.New("Error: token is bound to a key or certificate")
+	ErrWrongOrganization = errors.New("Error: token was issued by another organization")
+)
+
+// DefaultTenantId is the organization of the tokens without a tid claim.
+const DefaultTenantId int64 = 1
+
+// DefaultJwksRefresh is how long the keys of the jwks url are cached.
+const DefaultJwksRefresh = time.Hour
+
+// Config is how the tokens are verified. SecretKey verifies the HS256
+// tokens (the JWT_SECRET_KEY of the server) and JwksUrl the RS256 ones, the
+// server signs them when its ACCESS_TOKEN_ALG is RS256. Either or both can
+// be set. Issuer and Audience are only checked when set.
+type Config struct {
+	SecretKey string
+
+	// JwksUrl is the jwks_uri of the server, like
+	// https://auth.example.com/.well-known/jwks.json. Its keys are cached for
+	// JwksRefresh and fetched again when a token has an unknown kid, so the
+	// rotated keys are picked up.
+	JwksUrl     string
+	JwksRefresh time.Duration
+	HttpClient  *http.Client
+
+	Issuer   string
+	Audience string
+	// TenantId is the id of the organization the tokens must be issued by
+	// (the tid claim), the tokens of every organization are accepted when
+	// it's zero.
+	TenantId int64
+	// ClockSkew is the leeway of the exp, nbf and iat claims.
+	ClockSkew time.Duration
+}
+
+// Verifier verifies the tokens, it's safe for concurrent use.
+type Verifier struct {
+	secretKey []byte
+	jwks      *jwksCache
+	parser    *jwt.Parser
+	tenantId  int64
+}
+
+func NewVerifier(config Config) (*Verifier, error) {
+	if config.SecretKey == "" && config.JwksUrl == "" {
+		return nil, ErrNoKeys
+	}
+
+	algs := []string{}
+	if config.SecretKey != "" {
+		algs = append(algs, jwt.SigningMethodHS256.Alg())
+	}
+	if config.JwksUrl != "" {
+		algs = append(algs, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algs),
+		jwt.WithLeeway(config.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+
+	verifier := &Verifier{parser: jwt.NewParser(opts...), tenantId: config.TenantId}
+	if config.SecretKey != "" {
+		verifier.secretKey = []byte(config.SecretKey)
+	}
+	if config.JwksUrl != "" {
+		verifier.jwks = newJwksCache(config.JwksUrl, config.JwksRefresh, config.HttpClient)
+	}
+	return verifier, nil
+}
+
+// Verify checks the signature and the claims of the token. The tokens bound
+// to a DPoP key or a client certificate (cnf) are rejected, the proof of
+// possession can only be checked by the server. So are the ID tokens, signed
+// by the same keys of the jwks url but without the user of the access
+// tokens.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			return v.secretKey, nil
+		case *jwt.SigningMethodRSA:
+			kid, _ := t.Header["kid"].(string)
+			return v.jwks.key(ctx, kid)
+		}
+		return nil, ErrInvalidToken
+	})
+	if err != nil {
+		return nil, verifyError(err)
+	}
+
+	if claims.Username == "" || claims.Id == 0 {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	if claims.Cnf != nil {
+		return nil, ErrBoundToken
+	}
+	if v.tenantId != 0 && claims.tenant() != v.tenantId {
+		return nil, ErrWrongOrganization
+	}
+	return claims, nil
+}
+
+func verifyError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownSigningKey):
+		return ErrUnknownSigningKey
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrExpiredToken
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+}
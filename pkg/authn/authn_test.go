@@ -0,0 +1,307 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const secretKey = "secret"
+
+func claimsMock(issuedAt time.Time) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "golang",
+			Subject:   "rafael",
+			Audience:  jwt.ClaimStrings{"orders"},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(15 * time.Minute)),
+		},
+		Username: "rafael",
+		Id:       1,
+	}
+}
+
+func signHS256(t *testing.T, claims *Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+	if err != nil {
+		t.Fatalf("failed signing the token: %v", err)
+	}
+	return token
+}
+
+// TestVerify verifies the signature and the configurable checks.
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		config Config
+		claims *Claims
+		key    string
+		err    error
+	}{
+		{
+			name:   "valid",
+			config: Config{SecretKey: secretKey, Issuer: "golang", Audience: "orders"},
+			claims: claimsMock(now),
+		},
+		{
+			name:   "wrong signature",
+			config: Config{SecretKey: secretKey},
+			claims: claimsMock(now),
+			key:    "other",
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "wrong issuer",
+			config: Config{SecretKey: secretKey, Issuer: "other"},
+			claims: claimsMock(now),
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "wrong audience",
+			config: Config{SecretKey: secretKey, Audience: "billing"},
+			claims: claimsMock(now),
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "expired",
+			config: Config{SecretKey: secretKey},
+			claims: claimsMock(now.Add(-time.Hour)),
+			err:    ErrExpiredToken,
+		},
+		{
+			name:   "expired within the clock skew",
+			config: Config{SecretKey: secretKey, ClockSkew: time.Hour},
+			claims: claimsMock(now.Add(-30 * time.Minute)),
+		},
+		{
+			name:   "bound to a key",
+			config: Config{SecretKey: secretKey},
+			claims: func() *Claims {
+				claims := claimsMock(now)
+				claims.Cnf = &Confirmation{JwkThumbprint: "thumbprint"}
+				return claims
+			}(),
+			err: ErrBoundToken,
+		},
+		{
+			name:   "organization",
+			config: Config{SecretKey: secretKey, TenantId: 2},
+			claims: func() *Claims {
+				claims := claimsMock(now)
+				claims.TenantId = 2
+				return claims
+			}(),
+		},
+		{
+			name:   "other organization",
+			config: Config{SecretKey: secretKey, TenantId: 2},
+			claims: func() *Claims {
+				claims := claimsMock(now)
+				claims.TenantId = 3
+				return claims
+			}(),
+			err: ErrWrongOrganization,
+		},
+		{
+			name:   "default organization without tid",
+			config: Config{SecretKey: secretKey, TenantId: DefaultTenantId},
+			claims: claimsMock(now),
+		},
+		{
+			name:   "default organization with another organization",
+			config: Config{SecretKey: secretKey, TenantId: 2},
+			claims: claimsMock(now),
+			err:    ErrWrongOrganization,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// given
+			verifier, err := NewVerifier(test.config)
+			if err != nil {
+				t.Fatalf("NewVerifier returned an error: %v", err)
+			}
+			key := secretKey
+			if test.key != "" {
+				key = test.key
+			}
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, test.claims).SignedString([]byte(key))
+
+			// when
+			claims, err := verifier.Verify(context.Background(), token)
+
+			// then
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if test.err == nil && claims.Username != "rafael" {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+
+	if _, err := NewVerifier(Config{}); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("expected ErrNoKeys, got %v", err)
+	}
+}
+
+// TestVerify_Jwks verifies the RS256 tokens, the keys are cached and
+// fetched again when a token is signed by a rotated key.
+func TestVerify_Jwks(t *testing.T) {
+	// given
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := map[string]*rsa.PrivateKey{"old": oldKey}
+
+	var fetches atomic.Int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		jwks := map[string][]map[string]string{"keys": {}}
+		for kid, key := range keys {
+			jwks["keys"] = append(jwks["keys"], map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer jwksServer.Close()
+
+	verifier, _ := NewVerifier(Config{JwksUrl: jwksServer.URL})
+	sign := func(kid string, key *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claimsMock(time.Now()))
+		token.Header["kid"] = kid
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+
+	// when
+	for range 3 {
+		if _, err := verifier.Verify(context.Background(), sign("old", oldKey)); err != nil {
+			t.Fatalf("expected the token to be valid, got %v", err)
+		}
+	}
+
+	// then
+	if fetches.Load() != 1 {
+		t.Errorf("expected the keys to be cached, got %v fetches", fetches.Load())
+	}
+	if _, err := verifier.Verify(context.Background(), signHS256(t, claimsMock(time.Now()))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected HS256 to be rejected without a secret key, got %v", err)
+	}
+
+	// when the key is rotated
+	keys["new"] = newKey
+	verifier.jwks.fetchedAt = time.Now().Add(-time.Minute)
+	_, err := verifier.Verify(context.Background(), sign("new", newKey))
+
+	// then
+	if err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), sign("unknown", newKey)); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("expected ErrUnknownSigningKey, got %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("expected the unknown kid to be throttled, got %v fetches", fetches.Load())
+	}
+
+	// when an ID token, signed by the same keys, is used as an access token
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    "golang",
+		Subject:   "rafael",
+		Audience:  jwt.ClaimStrings{"client-id"},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	idToken.Header["kid"] = "new"
+	signed, _ := idToken.SignedString(newKey)
+	_, err = verifier.Verify(context.Background(), signed)
+
+	// then
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected the ID token to be rejected, got %v", err)
+	}
+}
+
+// TestMiddleware verifies the claims are in the context of the request.
+func TestMiddleware(t *testing.T) {
+	// given
+	verifier, _ := NewVerifier(Config{SecretKey: secretKey})
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || claims.Id != 1 {
+			t.Errorf("expected the claims in the context, got %+v", claims)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// when
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Authorization", TokenPrefix+signHS256(t, claimsMock(time.Now())))
+	handler.ServeHTTP(w, r)
+
+	unauthorizedW := httptest.NewRecorder()
+	handler.ServeHTTP(unauthorizedW, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	// then
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %v", w.Code)
+	}
+	if unauthorizedW.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without a token, got %v", unauthorizedW.Code)
+	}
+}
+
+// TestUnaryInterceptor verifies the token of the calls and the public
+// methods.
+func TestUnaryInterceptor(t *testing.T) {
+	// given
+	verifier, _ := NewVerifier(Config{SecretKey: secretKey})
+	interceptor := verifier.UnaryInterceptor("/orders.v1.OrderService/Health")
+	handler := func(ctx context.Context, req any) (any, error) {
+		claims, _ := ClaimsFromContext(ctx)
+		return claims, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(AuthorizationMetadata, TokenPrefix+signHS256(t, claimsMock(time.Now()))))
+
+	// when
+	resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/orders.v1.OrderService/Get"}, handler)
+	_, unauthenticatedErr := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/orders.v1.OrderService/Get"}, handler)
+	_, publicErr := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/orders.v1.OrderService/Health"}, handler)
+
+	// then
+	if err != nil || resp.(*Claims).Username != "rafael" {
+		t.Errorf("expected the claims in the context, got %v, %v", resp, err)
+	}
+	if status.Code(unauthenticatedErr) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %v", unauthenticatedErr)
+	}
+	if publicErr != nil {
+		t.Errorf("expected the public method to skip the interceptor, got %v", publicErr)
+	}
+}
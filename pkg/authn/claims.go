@@ -0,0 +1,57 @@
+package authn
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of the access tokens of fauthless-go.
+type Claims struct {
+	jwt.RegisteredClaims
+	Username  string `json:"username"`
+	Id        int64  `json:"id"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	SessionId string `json:"sid,omitempty"`
+	// TenantId is the organization the token was issued by, the tokens
+	// issued before there were organizations have none (DefaultTenantId).
+	TenantId int64 `json:"tid,omitempty"`
+	// Act is who is acting on behalf of the user, only set on impersonation
+	// tokens.
+	Act *Actor `json:"act,omitempty"`
+	// Cnf is the key or certificate the token is bound to, see Verify.
+	Cnf *Confirmation `json:"cnf,omitempty"`
+}
+
+// tenant returns the organization of the token, DefaultTenantId when it has
+// no tid claim.
+func (c *Claims) tenant() int64 {
+	if c.TenantId == 0 {
+		return DefaultTenantId
+	}
+	return c.TenantId
+}
+
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+type Confirmation struct {
+	JwkThumbprint         string `json:"jkt,omitempty"`
+	CertificateThumbprint string `json:"x5t#S256,omitempty"`
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx with the claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the token that authenticated the
+// request or the call.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
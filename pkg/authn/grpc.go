@@ -0,0 +1,70 @@
+package authn
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadata is the metadata with the "Bearer <token>" of the
+// gRPC calls.
+const AuthorizationMetadata = "authorization"
+
+// UnaryInterceptor rejects the calls without a valid bearer token with
+// Unauthenticated, the claims of the others are in the context. The public
+// methods (full method names) skip it.
+func (v *Verifier) UnaryInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if slices.Contains(public, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		claims, err := v.verifyCall(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(NewContext(ctx, claims), req)
+	}
+}
+
+// StreamInterceptor is the UnaryInterceptor of the streams.
+func (v *Verifier) StreamInterceptor(public ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if slices.Contains(public, info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		claims, err := v.verifyCall(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: NewContext(ss.Context(), claims)})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (v *Verifier) verifyCall(ctx context.Context) (*Claims, error) {
+	values := metadata.ValueFromIncomingContext(ctx, AuthorizationMetadata)
+	if len(values) != 1 || !strings.HasPrefix(values[0], TokenPrefix) {
+		return nil, status.Error(codes.Unauthenticated, ErrMissingToken.Error())
+	}
+
+	claims, err := v.Verify(ctx, strings.TrimPrefix(values[0], TokenPrefix))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return claims, nil
+}
@@ -0,0 +1,44 @@
+package authn
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TokenPrefix is the prefix of the token in the Authorization header and in
+// the authorization metadata of the gRPC calls.
+const TokenPrefix = "Bearer "
+
+// Middleware rejects the requests without a valid bearer token with a 401,
+// the claims of the others are in the context. It's a chi middleware too:
+//
+//	r.Use(verifier.Middleware)
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), TokenPrefix)
+		if !found {
+			unauthorized(w, ErrMissingToken)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), token)
+		if err != nil {
+			unauthorized(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// unauthorized writes the status and message like the errors of the server.
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  http.StatusUnauthorized,
+		"message": err.Error(),
+	})
+}
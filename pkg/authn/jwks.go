@@ -0,0 +1,120 @@
+package authn
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minJwksRefresh limits how often an unknown kid fetches the keys again, so
+// tokens with made up kids can't flood the server.
+const minJwksRefresh = 30 * time.Second
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJwksCache(url string, refresh time.Duration, client *http.Client) *jwksCache {
+	if refresh <= 0 {
+		refresh = DefaultJwksRefresh
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &jwksCache{url: url, refresh: refresh, client: client}
+}
+
+// key returns the public key of the kid, the keys are fetched again when
+// they're stale or the kid is unknown (a rotation). If the fetch fails the
+// cached keys are still used.
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, found := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > c.refresh
+	if found && !stale {
+		return key, nil
+	}
+
+	if stale || time.Since(c.fetchedAt) > minJwksRefresh {
+		keys, err := c.fetch(ctx)
+		// the fetch is also throttled when it fails
+		c.fetchedAt = time.Now()
+		if err == nil {
+			c.keys = keys
+			key, found = keys[kid]
+		}
+	}
+
+	if !found {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+func (c *jwksCache) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error: jwks returned %v", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		if key := rsaPublicKey(jwk); key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(jwk jsonWebKey) *rsa.PublicKey {
+	n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+	if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+}
@@ -0,0 +1,293 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockId is the key of the advisory lock held while migrating, so instances
+// starting at the same time don't apply the same migration twice.
+const lockId = 7_354_220_911
+
+var ErrChecksumMismatch = errors.New("Error: an applied migration was changed")
+
+// Migration is a versioned change of the schema, the files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status tells if a migration was applied, AppliedAt is nil when it's
+// pending. Modified means the up file changed after it was applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+// Load reads the embedded migrations, sorted by version.
+func Load() ([]Migration, error) {
+	entries, err := fs.Glob(files, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		base := path.Base(entry)
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %v: expected <version>_<name>.up.sql or .down.sql", base)
+		}
+
+		versionText, name, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %v: invalid version", base)
+		}
+
+		content, err := files.ReadFile(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+			migration.Checksum = checksum(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration, each one in its own transaction,
+// returns the migrations applied and an error if any. Nothing is applied
+// when an applied migration was changed.
+func Up(db *sql.DB) ([]Migration, error) {
+	var applied []Migration
+	err := withLock(db, func(conn *sql.Conn) error {
+		statuses, err := statuses(conn)
+		if err != nil {
+			return err
+		}
+
+		if err := verify(statuses); err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.AppliedAt != nil {
+				continue
+			}
+
+			err := inTransaction(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(status.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, status.Version, status.Name, status.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%v: %w", status.Version, status.Name, err)
+			}
+			applied = append(applied, status.Migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps migrations applied, returns the migrations
+// reverted and an error if any.
+func Down(db *sql.DB, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withLock(db, func(conn *sql.Conn) error {
+		statuses, err := statuses(conn)
+		if err != nil {
+			return err
+		}
+
+		if err := verify(statuses); err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			status := statuses[i]
+			if status.AppliedAt == nil {
+				continue
+			}
+
+			err := inTransaction(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(status.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, status.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%v: %w", status.Version, status.Name, err)
+			}
+			reverted = append(reverted, status.Migration)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Statuses lists every migration, when it was applied and if it was changed
+// after that.
+func Statuses(db *sql.DB) ([]Status, error) {
+	var result []Status
+	err := withLock(db, func(conn *sql.Conn) error {
+		var err error
+		result, err = statuses(conn)
+		return err
+	})
+	return result, err
+}
+
+func statuses(conn *sql.Conn) ([]Status, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type appliedMigration struct {
+		checksum  string
+		appliedAt time.Time
+	}
+
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var (
+			version   int64
+			migration appliedMigration
+		)
+		if err := rows.Scan(&version, &migration.checksum, &migration.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = migration
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		status := Status{Migration: migration}
+		if appliedMigration, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedMigration.appliedAt
+			// applied before the checksums were recorded
+			status.Modified = appliedMigration.checksum != "" && appliedMigration.checksum != migration.Checksum
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+func verify(statuses []Status) error {
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("%w: %d_%v", ErrChecksumMismatch, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// withLock runs fn on a single connection holding the advisory lock, the
+// lock belongs to the connection so every statement must use it.
+func withLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockId); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockId)
+
+	if err := createTable(conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func createTable(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+	  version BIGINT PRIMARY KEY,
+	  name VARCHAR(255) NOT NULL,
+	  checksum VARCHAR(64) NOT NULL DEFAULT '',
+	  applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);
+	ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT '';
+	`)
+	return err
+}
+
+func inTransaction(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checksum ignores the line endings, so a checkout with other settings
+// doesn't look like a changed migration.
+func checksum(content []byte) string {
+	normalized := strings.ReplaceAll(string(content), "\r\n", "\n")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import "testing"
+
+// TestLoad verifies every embedded migration has both directions and the
+// versions are sorted.
+func TestLoad(t *testing.T) {
+	// when
+	migrations, err := Load()
+
+	// then
+	if err != nil {
+		t.Fatalf("failed loading the migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected the embedded migrations")
+	}
+
+	for i, migration := range migrations {
+		if migration.Up == "" || migration.Down == "" {
+			t.Fatalf("expected the up and down files of %d_%v", migration.Version, migration.Name)
+		}
+
+		if i > 0 && migrations[i-1].Version >= migration.Version {
+			t.Fatalf("expected the versions sorted, got %d after %d", migration.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// TestChecksum verifies the line endings don't change the checksum.
+func TestChecksum(t *testing.T) {
+	if checksum([]byte("SELECT 1;\r\nSELECT 2;\r\n")) != checksum([]byte("SELECT 1;\nSELECT 2;\n")) {
+		t.Fatal("expected the same checksum with other line endings")
+	}
+
+	if checksum([]byte("SELECT 1;")) == checksum([]byte("SELECT 2;")) {
+		t.Fatal("expected another checksum for another content")
+	}
+}
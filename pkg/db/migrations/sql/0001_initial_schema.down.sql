@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_device_codes;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
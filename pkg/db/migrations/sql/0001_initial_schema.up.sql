@@ -0,0 +1,77 @@
+CREATE TABLE IF NOT EXISTS users (
+  id BIGSERIAL PRIMARY KEY,
+  username VARCHAR(50) UNIQUE NOT NULL,
+  password VARCHAR(255) NOT NULL,
+  session_token VARCHAR(255),
+  csrf_token VARCHAR(255),
+  age INT not null,
+  email VARCHAR(255),
+  roles TEXT NOT NULL DEFAULT ''
+ );
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id VARCHAR(255) PRIMARY KEY NOT NULL,
+  username VARCHAR(50) NOT NULL,
+  is_revoked BOOL NOT null default false,
+  refresh_token VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  expires_at TIMESTAMP
+ );
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+  id VARCHAR(64) PRIMARY KEY,
+  secret_hash VARCHAR(128),
+  name VARCHAR(100) NOT NULL,
+  owner VARCHAR(50) NOT NULL,
+  redirect_uris TEXT NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '',
+  is_confidential BOOL NOT NULL DEFAULT false,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+ );
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+  code_hash VARCHAR(128) PRIMARY KEY,
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL,
+  username VARCHAR(50) NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scope TEXT NOT NULL DEFAULT '',
+  code_challenge VARCHAR(128) NOT NULL,
+  code_challenge_method VARCHAR(10) NOT NULL,
+  nonce VARCHAR(255) NOT NULL DEFAULT '',
+  auth_time TIMESTAMP WITH TIME ZONE NOT NULL,
+  amr VARCHAR(100) NOT NULL DEFAULT '',
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+ );
+
+CREATE TABLE IF NOT EXISTS oauth_device_codes (
+  device_code_hash VARCHAR(128) PRIMARY KEY,
+  user_code VARCHAR(16) UNIQUE NOT NULL,
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  scope TEXT NOT NULL DEFAULT '',
+  status VARCHAR(10) NOT NULL DEFAULT 'pending',
+  user_id BIGINT,
+  username VARCHAR(50),
+  poll_interval INT NOT NULL,
+  last_polled_at TIMESTAMP WITH TIME ZONE,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+ );
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+  username VARCHAR(50) NOT NULL,
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  scope TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (username, client_id)
+ );
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id VARCHAR(64) PRIMARY KEY,
+  token_hash VARCHAR(128) UNIQUE NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  user_id BIGINT NOT NULL,
+  username VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  expires_at TIMESTAMP WITH TIME ZONE,
+  last_used_at TIMESTAMP WITH TIME ZONE
+ );
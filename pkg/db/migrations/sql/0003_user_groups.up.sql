@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_groups (
+  id VARCHAR(64) PRIMARY KEY,
+  display_name VARCHAR(100) UNIQUE NOT NULL,
+  external_id VARCHAR(255),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+ );
+
+CREATE TABLE IF NOT EXISTS user_group_members (
+  group_id VARCHAR(64) NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, user_id)
+ );
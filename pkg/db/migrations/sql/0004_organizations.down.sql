@@ -0,0 +1,13 @@
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS org_id;
+ALTER TABLE personal_access_tokens DROP COLUMN IF EXISTS org_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS org_id;
+
+ALTER TABLE user_groups DROP CONSTRAINT IF EXISTS user_groups_org_id_display_name_key;
+ALTER TABLE user_groups DROP COLUMN IF EXISTS org_id;
+ALTER TABLE user_groups ADD CONSTRAINT user_groups_display_name_key UNIQUE (display_name);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_org_id_username_key;
+ALTER TABLE users DROP COLUMN IF EXISTS org_id;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS organizations (
+  id BIGSERIAL PRIMARY KEY,
+  slug VARCHAR(50) UNIQUE NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  host VARCHAR(255) UNIQUE,
+  auth_modes TEXT NOT NULL DEFAULT '',
+  password_min_length INT NOT NULL DEFAULT 0,
+  access_token_seconds BIGINT NOT NULL DEFAULT 0,
+  refresh_token_seconds BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+ );
+
+-- the users and groups that exist belong to the default organization
+INSERT INTO organizations (id, slug, name) VALUES (1, 'default', 'Default') ON CONFLICT DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), (SELECT MAX(id) FROM organizations));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+ALTER TABLE users ADD CONSTRAINT users_org_id_username_key UNIQUE (org_id, username);
+
+ALTER TABLE user_groups ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE user_groups DROP CONSTRAINT IF EXISTS user_groups_display_name_key;
+ALTER TABLE user_groups ADD CONSTRAINT user_groups_org_id_display_name_key UNIQUE (org_id, display_name);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE personal_access_tokens ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE oauth_authorization_codes ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1;
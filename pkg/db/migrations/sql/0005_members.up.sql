@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS organization_members (
+  org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (org_id, user_id)
+ );
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+  id VARCHAR(64) PRIMARY KEY,
+  token_hash VARCHAR(64) UNIQUE NOT NULL,
+  org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  email VARCHAR(255) NOT NULL,
+  role VARCHAR(20) NOT NULL,
+  invited_by VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+ );
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  org_id BIGINT NOT NULL DEFAULT 1,
+  time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  action VARCHAR(50) NOT NULL,
+  outcome VARCHAR(20) NOT NULL,
+  actor VARCHAR(255) NOT NULL DEFAULT '',
+  subject VARCHAR(255) NOT NULL DEFAULT '',
+  target VARCHAR(255) NOT NULL DEFAULT '',
+  reason TEXT NOT NULL DEFAULT '',
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  client_id VARCHAR(255) NOT NULL DEFAULT '',
+  method VARCHAR(20) NOT NULL DEFAULT '',
+  path TEXT NOT NULL DEFAULT '',
+  status INTEGER NOT NULL DEFAULT 0
+ );
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_id ON audit_events (org_id, id DESC);
+
+-- the trail is append only, the events are kept even after their
+-- organization is deleted
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_change ON audit_events;
+CREATE TRIGGER audit_events_no_change
+  BEFORE UPDATE OR DELETE ON audit_events
+  FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+  BEFORE TRUNCATE ON audit_events
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
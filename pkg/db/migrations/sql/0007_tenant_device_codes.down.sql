@@ -0,0 +1 @@
+ALTER TABLE oauth_device_codes DROP COLUMN IF EXISTS org_id;
@@ -0,0 +1,2 @@
+-- the organization the user approved the device in, set with the decision
+ALTER TABLE oauth_device_codes ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1;
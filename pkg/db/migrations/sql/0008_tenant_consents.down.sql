@@ -0,0 +1,5 @@
+-- the consents of the other organizations would collide on the old key
+DELETE FROM oauth_consents WHERE org_id <> 1;
+ALTER TABLE oauth_consents DROP CONSTRAINT IF EXISTS oauth_consents_pkey;
+ALTER TABLE oauth_consents DROP COLUMN IF EXISTS org_id;
+ALTER TABLE oauth_consents ADD PRIMARY KEY (username, client_id);
@@ -0,0 +1,4 @@
+-- the consents are given per organization, as the usernames are
+ALTER TABLE oauth_consents ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE oauth_consents DROP CONSTRAINT IF EXISTS oauth_consents_pkey;
+ALTER TABLE oauth_consents ADD PRIMARY KEY (org_id, username, client_id);
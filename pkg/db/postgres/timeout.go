@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// WithTimeout bounds a query by the QUERY_TIMEOUT, so a slow database fails
+// fast instead of piling up connections. The request context still cancels
+// the query first when the client goes away.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,5 @@
+// Package pb has the code generated from the protobuf files of api/proto,
+// the messages and the gRPC clients and servers.
+package pb
+
+//go:generate protoc -I ../../api/proto --go_out=../.. --go_opt=module=github.com/rafaeldepontes/fauthless-go --go-grpc_out=../.. --go-grpc_opt=module=github.com/rafaeldepontes/fauthless-go fauthless/v1/auth.proto fauthless/v1/user.proto
@@ -11,6 +11,7 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/migrations"
 )
 
 var db *sql.DB
@@ -60,6 +61,11 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not connect to docker/postgres: %s", err)
 	}
 
+	if _, err := migrations.Up(db); err != nil {
+		_ = pool.Purge(resource)
+		log.Fatalf("Could not migrate the database: %s", err)
+	}
+
 	code := m.Run()
 
 	if err := pool.Purge(resource); err != nil {
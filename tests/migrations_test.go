@@ -0,0 +1,60 @@
+package main_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rafaeldepontes/fauthless-go/pkg/db/migrations"
+)
+
+// TestMigrations verifies the migrations can be reverted and applied again,
+// concurrently, without applying any of them twice.
+func TestMigrations(t *testing.T) {
+	// given
+	all, err := migrations.Load()
+	if err != nil {
+		t.Fatalf("failed loading the migrations: %v", err)
+	}
+
+	if reverted, err := migrations.Down(db, len(all)); err != nil || len(reverted) != len(all) {
+		t.Fatalf("expected every migration reverted, got %d: %v", len(reverted), err)
+	}
+
+	// when
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied int
+	)
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrationsApplied, err := migrations.Up(db)
+			if err != nil {
+				t.Errorf("failed applying the migrations: %v", err)
+			}
+
+			mu.Lock()
+			applied += len(migrationsApplied)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// then
+	if applied != len(all) {
+		t.Fatalf("expected %d migrations applied once, got %d", len(all), applied)
+	}
+
+	statuses, err := migrations.Statuses(db)
+	if err != nil {
+		t.Fatalf("failed reading the statuses: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.Modified {
+			t.Fatalf("expected %d_%v applied and unchanged", status.Version, status.Name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rafaeldepontes/fauthless-go/internal/auth/repository"
+	"github.com/rafaeldepontes/fauthless-go/internal/domain"
+	"github.com/rafaeldepontes/fauthless-go/internal/errorhandler"
+	"github.com/rafaeldepontes/fauthless-go/internal/tenant"
+)
+
+// TestSessionRepository_Organizations verifies the sessions are only found
+// and revoked by id in their own organization.
+func TestSessionRepository_Organizations(t *testing.T) {
+	// given
+	ctx := context.Background()
+	acme := tenant.WithOrganization(ctx, &domain.Organization{Id: 2, Slug: "acme"})
+	sessions := repository.NewSessionRepository(db, 5*time.Second)
+	id, err := sessions.CreateSession(ctx, &domain.Session{
+		Id:           "default-session",
+		Username:     "alice",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("failed creating the session: %v", err)
+	}
+
+	// when
+	_, findErr := sessions.FindSessionById(acme, id)
+	revokeErr := sessions.RevokeSession(acme, id)
+	session, err := sessions.FindSessionById(ctx, id)
+
+	// then
+	if !errors.Is(findErr, errorhandler.ErrSessionNotFound) || !errors.Is(revokeErr, errorhandler.ErrSessionNotFound) {
+		t.Fatalf("expected the session not to be found in another organization, got %v and %v", findErr, revokeErr)
+	}
+
+	if err != nil || session.IsRevoked {
+		t.Fatalf("expected the session to be kept in its organization, got %+v: %v", session, err)
+	}
+
+	// when
+	revokeErr = sessions.RevokeSession(ctx, id)
+	session, err = sessions.FindSessionById(ctx, id)
+
+	// then
+	if revokeErr != nil || err != nil || !session.IsRevoked {
+		t.Fatalf("expected the session to be revoked in its organization, got %+v: %v %v", session, revokeErr, err)
+	}
+}